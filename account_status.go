@@ -0,0 +1,192 @@
+package nfsv3driver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"gopkg.in/ldap.v2"
+)
+
+// Account status error codes are appended to the error message so that the platform can tell these failures apart
+// from a wrong password and show users what to do about them.
+const (
+	AccountDisabledErrorCode    = "ACCOUNT_DISABLED"
+	AccountLockedErrorCode      = "ACCOUNT_LOCKED"
+	AccountExpiredErrorCode     = "ACCOUNT_EXPIRED"
+	PasswordExpiredErrorCode    = "PASSWORD_EXPIRED"
+	PasswordMustChangeErrorCode = "PASSWORD_MUST_CHANGE"
+)
+
+const (
+	AccountDisabledErrorMessage    = "account disabled"
+	AccountLockedErrorMessage      = "account locked"
+	AccountExpiredErrorMessage     = "account expired"
+	PasswordExpiredErrorMessage    = "password expired"
+	PasswordMustChangeErrorMessage = "password must be changed before first use"
+)
+
+// AccountStatusError reports that a directory account exists but may not be used to mount.
+type AccountStatusError struct {
+	Code        string
+	Description string
+}
+
+func (e AccountStatusError) Error() string {
+	return fmt.Sprintf("%s (error code %s)", e.Description, e.Code)
+}
+
+// SafeError returns the error in the form that is passed back to the platform.
+func (e AccountStatusError) SafeError() dockerdriver.SafeError {
+	return dockerdriver.SafeError{SafeDescription: e.Error()}
+}
+
+var (
+	errAccountDisabled    = AccountStatusError{Code: AccountDisabledErrorCode, Description: AccountDisabledErrorMessage}
+	errAccountLocked      = AccountStatusError{Code: AccountLockedErrorCode, Description: AccountLockedErrorMessage}
+	errAccountExpired     = AccountStatusError{Code: AccountExpiredErrorCode, Description: AccountExpiredErrorMessage}
+	errPasswordExpired    = AccountStatusError{Code: PasswordExpiredErrorCode, Description: PasswordExpiredErrorMessage}
+	errPasswordMustChange = AccountStatusError{Code: PasswordMustChangeErrorCode, Description: PasswordMustChangeErrorMessage}
+)
+
+// accountStatusAttributes are read along with the user's ids. The first group is Active Directory's, the second
+// the OpenLDAP password policy overlay's.
+var accountStatusAttributes = []string{
+	"userAccountControl",
+	"msDS-User-Account-Control-Computed",
+	"pwdLastSet",
+	"accountExpires",
+	"pwdAccountLockedTime",
+	"pwdReset",
+}
+
+// userAccountControl flags, see https://docs.microsoft.com/en-us/windows/win32/adschema/a-useraccountcontrol
+const (
+	uacAccountDisable   = 0x2
+	uacLockout          = 0x10
+	uacDontExpirePasswd = 0x10000
+	uacPasswordExpired  = 0x800000
+)
+
+// Active Directory explains a failed bind with a sub-code in the diagnostic message, e.g.
+// "80090308: LdapErr: DSID-0C09042F, comment: AcceptSecurityContext error, data 533, v2580".
+var adBindSubCodes = map[string]AccountStatusError{
+	"530": errAccountDisabled, // not permitted to log on at this time
+	"531": errAccountDisabled, // not permitted to log on at this workstation
+	"532": errPasswordExpired,
+	"533": errAccountDisabled,
+	"701": errAccountExpired,
+	"773": errPasswordMustChange,
+	"775": errAccountLocked,
+}
+
+// bindFailureStatus classifies a failed user bind. It returns false when the failure is an ordinary wrong
+// password or anything else that does not say why the account is unusable.
+func bindFailureStatus(err error, entry *ldap.Entry) (AccountStatusError, bool) {
+	if ldapErr, ok := err.(*ldap.Error); ok && ldapErr.ResultCode == ldap.LDAPResultInvalidCredentials && ldapErr.Err != nil {
+		for code, status := range adBindSubCodes {
+			if strings.Contains(ldapErr.Err.Error(), "data "+code+",") {
+				return status, true
+			}
+		}
+	}
+
+	// the lockout state is disclosed even without the right password, as Active Directory itself does
+	if isLocked(entry) {
+		return errAccountLocked, true
+	}
+
+	return AccountStatusError{}, false
+}
+
+// accountStatus checks the account attributes of a user whose password has been verified. Directories that do not
+// enforce these states on bind, or that mirror Active Directory's attributes, are caught here.
+func accountStatus(entry *ldap.Entry, now time.Time) (AccountStatusError, bool) {
+	uac := uintAttribute(entry, "userAccountControl")
+	computed := uintAttribute(entry, "msDS-User-Account-Control-Computed")
+
+	switch {
+	case uac&uacAccountDisable != 0:
+		return errAccountDisabled, true
+	case isLocked(entry):
+		return errAccountLocked, true
+	case isExpired(entry, now):
+		return errAccountExpired, true
+	case computed&uacPasswordExpired != 0:
+		return errPasswordExpired, true
+	case entry.GetAttributeValue("pwdLastSet") == "0" && uac&uacDontExpirePasswd == 0,
+		strings.EqualFold(entry.GetAttributeValue("pwdReset"), "TRUE"):
+		return errPasswordMustChange, true
+	}
+
+	return AccountStatusError{}, false
+}
+
+// accountRevoked checks the account attributes of a user who has already mounted a share. Only states that an
+// administrator sets to take access away count; a lockout or an expired password does not end existing mounts.
+func accountRevoked(entry *ldap.Entry, now time.Time) (AccountStatusError, bool) {
+	switch {
+	case uintAttribute(entry, "userAccountControl")&uacAccountDisable != 0:
+		return errAccountDisabled, true
+	case isExpired(entry, now):
+		return errAccountExpired, true
+	}
+
+	return AccountStatusError{}, false
+}
+
+// isAccountStatus tells whether err is an AccountStatusError in the form passed back to the platform.
+func isAccountStatus(err error) bool {
+	for _, status := range []AccountStatusError{errAccountDisabled, errAccountLocked, errAccountExpired, errPasswordExpired, errPasswordMustChange} {
+		if err.Error() == status.Error() {
+			return true
+		}
+	}
+	return false
+}
+
+// IsIdentityRevoked tells whether an error from IdResolver.Validate means that the user may no longer use their
+// mounts, as opposed to the directory being unavailable.
+func IsIdentityRevoked(err error) bool {
+	if _, ok := err.(AccountStatusError); ok {
+		return true
+	}
+	return isUserDoesNotExist(err)
+}
+
+func isLocked(entry *ldap.Entry) bool {
+	// userAccountControl's lockout flag is only maintained in the computed attribute on current domain controllers
+	if (uintAttribute(entry, "userAccountControl")|uintAttribute(entry, "msDS-User-Account-Control-Computed"))&uacLockout != 0 {
+		return true
+	}
+
+	// ppolicy sets pwdAccountLockedTime while the account is locked, 000001010000Z meaning until an administrator
+	// unlocks it
+	return entry.GetAttributeValue("pwdAccountLockedTime") != ""
+}
+
+func isExpired(entry *ldap.Entry, now time.Time) bool {
+	expires, err := strconv.ParseInt(entry.GetAttributeValue("accountExpires"), 10, 64)
+	if err != nil || expires <= 0 || expires == 1<<63-1 {
+		return false
+	}
+
+	return !now.Before(fromFiletime(expires))
+}
+
+// fromFiletime converts a Windows FILETIME, the number of 100ns intervals since 1601-01-01 UTC, to a time.
+func fromFiletime(filetime int64) time.Time {
+	const epochDifference = 11644473600 // seconds between 1601-01-01 and 1970-01-01
+	return time.Unix(filetime/1e7-epochDifference, (filetime%1e7)*100).UTC()
+}
+
+func uintAttribute(entry *ldap.Entry, name string) uint64 {
+	// userAccountControl is a signed 32 bit integer in the schema, so the flags may come back negative
+	value, err := strconv.ParseInt(entry.GetAttributeValue(name), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return uint64(uint32(value))
+}
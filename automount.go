@@ -0,0 +1,198 @@
+package nfsv3driver
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/goshims/ldapshim"
+	"code.cloudfoundry.org/lager"
+	"gopkg.in/ldap.v2"
+)
+
+const InvalidAutomountKeyErrorMessage = "Invalid 'automount_key' option"
+const AutomountKeyDoesNotExistErrorMessage = "Automount key does not exist"
+const AutomountNotConfiguredErrorMessage = "Automount key is specified but automount maps are not configured"
+const UnsupportedAutomountEntryErrorMessage = "Automount entry is not supported, please contact your system administrator"
+
+// AutomountEntry is the share an automount key refers to, with the options from its map entry translated into
+// mount options. A read only entry has the share itself mounted read only, whatever the bind options say.
+type AutomountEntry struct {
+	Remote   string
+	Options  map[string]interface{}
+	ReadOnly bool
+}
+
+// AutomountResolver finds the share behind an automount key.
+//
+//go:generate counterfeiter -o nfsdriverfakes/fake_automount_resolver.go . AutomountResolver
+type AutomountResolver interface {
+	Resolve(env dockerdriver.Env, key string) (AutomountEntry, error)
+}
+
+type ldapAutomountResolver struct {
+	directory *ldapIdResolver
+	mapDN     string
+}
+
+// NewLdapAutomountResolver returns an AutomountResolver that looks keys up among the automount entries directly
+// beneath the automountMap entry mapDN, falling back to the map's wildcard entry. It binds with the service account.
+func NewLdapAutomountResolver(
+	svcUser string,
+	svcPass Credential,
+	ldapHosts []string,
+	ldapPort int,
+	ldapProto string,
+	ldapCACert string,
+	ldap ldapshim.Ldap,
+	ldapTimeout time.Duration,
+	mapDN string,
+) AutomountResolver {
+	return &ldapAutomountResolver{
+		directory: &ldapIdResolver{
+			svcUser:     svcUser,
+			svcPass:     svcPass,
+			ldapHosts:   ldapHosts,
+			ldapPort:    ldapPort,
+			ldapProto:   ldapProto,
+			ldapCACert:  ldapCACert,
+			ldap:        ldap,
+			ldapTimeout: ldapTimeout,
+		},
+		mapDN: mapDN,
+	}
+}
+
+func (r *ldapAutomountResolver) Resolve(env dockerdriver.Env, key string) (AutomountEntry, error) {
+	logger := env.Logger().Session("automount-resolve", lager.Data{"key": key, "map": r.mapDN})
+	logger.Info("start")
+	defer logger.Info("end")
+
+	if key == "" || key == "*" || strings.ContainsAny(key, "/&\x00") || strings.IndexFunc(key, unicode.IsSpace) >= 0 {
+		return AutomountEntry{}, dockerdriver.SafeError{SafeDescription: InvalidAutomountKeyErrorMessage}
+	}
+
+	l, _, err := r.directory.dialAny(logger)
+	if err == errInvalidCACert {
+		return AutomountEntry{}, err
+	}
+	if err != nil {
+		return AutomountEntry{}, dockerdriver.SafeError{SafeDescription: LdapUnreachableErrorMessage}
+	}
+	defer l.Close()
+
+	svcPass, err := r.directory.svcPass.Value()
+	if err != nil {
+		logger.Error("read-service-account-password-failed", err)
+		return AutomountEntry{}, err
+	}
+
+	err = l.Bind(r.directory.svcUser, svcPass)
+	if err != nil {
+		return AutomountEntry{}, err
+	}
+
+	information, err := r.information(l, key)
+	if err == nil && information == "" {
+		information, err = r.information(l, "*")
+	}
+	if err != nil {
+		return AutomountEntry{}, err
+	}
+	if information == "" {
+		return AutomountEntry{}, dockerdriver.SafeError{SafeDescription: AutomountKeyDoesNotExistErrorMessage}
+	}
+
+	entry, err := ParseAutomountInformation(key, information)
+	if err != nil {
+		logger.Error("unsupported-automount-entry", err, lager.Data{"information": information})
+		return AutomountEntry{}, dockerdriver.SafeError{SafeDescription: UnsupportedAutomountEntryErrorMessage}
+	}
+
+	logger.Info("resolved", lager.Data{"remote": entry.Remote, "options": entry.Options})
+	return entry, nil
+}
+
+// information returns the automountInformation of key in the map, or "" when the map has no such key.
+func (r *ldapAutomountResolver) information(l ldapshim.LdapConnection, key string) (string, error) {
+	searchRequest := r.directory.ldap.NewSearchRequest(
+		r.mapDN,
+		ldap.ScopeSingleLevel,
+		ldap.NeverDerefAliases,
+		0,
+		0,
+		false,
+		fmt.Sprintf("(&(objectClass=automount)(automountKey=%s))", ldap.EscapeFilter(key)),
+		[]string{"automountInformation"},
+		nil,
+	)
+
+	sr, err := l.Search(searchRequest)
+	if err != nil {
+		return "", err
+	}
+
+	switch len(sr.Entries) {
+	case 0:
+		return "", nil
+	case 1:
+		return sr.Entries[0].GetAttributeValue("automountInformation"), nil
+	default:
+		return "", dockerdriver.SafeError{SafeDescription: AmbiguousSearchErrorMessage}
+	}
+}
+
+// ParseAutomountInformation parses an autofs map entry of the form "[-options] host:/path", substituting key for
+// any '&' in the location. Only single NFS locations are supported. The ro option makes the entry read only and, as
+// for the readonly mount option, caches attributes; the vers, nfsvers and sec options become the version and sec
+// mount options. Other options are left to the driver's own mount options.
+func ParseAutomountInformation(key, information string) (AutomountEntry, error) {
+	fields := strings.Fields(information)
+
+	options := map[string]interface{}{}
+	readOnly := false
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "-") {
+		for _, option := range strings.Split(strings.TrimPrefix(fields[0], "-"), ",") {
+			name, value := option, ""
+			if i := strings.Index(option, "="); i >= 0 {
+				name, value = option[:i], option[i+1:]
+			}
+
+			switch name {
+			case "fstype":
+				if value != "nfs" && value != "nfs3" {
+					return AutomountEntry{}, fmt.Errorf("unsupported file system type '%s'", value)
+				}
+			case "ro":
+				options["readonly"] = true
+				readOnly = true
+			case "vers", "nfsvers":
+				options["version"] = value
+			case "sec":
+				options["sec"] = value
+			}
+		}
+		fields = fields[1:]
+	}
+
+	if len(fields) == 0 {
+		return AutomountEntry{}, errors.New("no location")
+	}
+	if len(fields) > 1 {
+		return AutomountEntry{}, errors.New("multi-mount and replicated entries are not supported")
+	}
+
+	remote := strings.Replace(fields[0], "&", key, -1)
+	colon := strings.Index(remote, ":")
+	if colon <= 0 || !strings.HasPrefix(remote[colon+1:], "/") {
+		return AutomountEntry{}, fmt.Errorf("location '%s' is not of the form host:/path", remote)
+	}
+	if strings.ContainsAny(remote[:colon], ",()") {
+		return AutomountEntry{}, errors.New("multi-mount and replicated entries are not supported")
+	}
+
+	return AutomountEntry{Remote: remote, Options: options, ReadOnly: readOnly}, nil
+}
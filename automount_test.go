@@ -0,0 +1,189 @@
+package nfsv3driver_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/goshims/ldapshim/ldap_fake"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nfsv3driver"
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"gopkg.in/ldap.v2"
+)
+
+var _ = Describe("LdapAutomountResolver", func() {
+	var (
+		logger             *lagertest.TestLogger
+		env                dockerdriver.Env
+		ldapFake           *ldap_fake.FakeLdap
+		ldapConnectionFake *ldap_fake.FakeLdapConnection
+		key                string
+		entry              nfsv3driver.AutomountEntry
+		err                error
+	)
+
+	automountEntry := func(information string) *ldap.SearchResult {
+		return &ldap.SearchResult{Entries: []*ldap.Entry{{
+			DN:         "automountKey=x,automountMapName=auto.home,ou=automount,dc=corp",
+			Attributes: []*ldap.EntryAttribute{{Name: "automountInformation", Values: []string{information}}},
+		}}}
+	}
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("automount")
+		env = driverhttp.NewHttpDriverEnv(logger, context.TODO())
+
+		ldapFake = &ldap_fake.FakeLdap{}
+		ldapConnectionFake = &ldap_fake.FakeLdapConnection{}
+		ldapFake.DialReturns(ldapConnectionFake, nil)
+		ldapConnectionFake.SearchReturns(automountEntry("-rw,vers=3 filer:/export/home/alice"), nil)
+
+		key = "alice"
+	})
+
+	JustBeforeEach(func() {
+		resolver := nfsv3driver.NewLdapAutomountResolver(
+			"svcuser",
+			nfsv3driver.StaticCredential("svcpw"),
+			[]string{"host"},
+			389,
+			"tcp",
+			"",
+			ldapFake,
+			time.Minute,
+			"automountMapName=auto.home,ou=automount,dc=corp",
+		)
+		entry, err = resolver.Resolve(env, key)
+	})
+
+	It("looks the key up in the map with the service account", func() {
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entry.Remote).To(Equal("filer:/export/home/alice"))
+		Expect(entry.Options).To(Equal(map[string]interface{}{"version": "3"}))
+
+		user, password := ldapConnectionFake.BindArgsForCall(0)
+		Expect(user).To(Equal("svcuser"))
+		Expect(password).To(Equal("svcpw"))
+
+		baseDN, scope, _, _, _, _, filter, attributes, _ := ldapFake.NewSearchRequestArgsForCall(0)
+		Expect(baseDN).To(Equal("automountMapName=auto.home,ou=automount,dc=corp"))
+		Expect(scope).To(Equal(ldap.ScopeSingleLevel))
+		Expect(filter).To(Equal("(&(objectClass=automount)(automountKey=alice))"))
+		Expect(attributes).To(ConsistOf("automountInformation"))
+		Expect(ldapConnectionFake.CloseCallCount()).To(Equal(1))
+	})
+
+	Context("when the map has no entry for the key", func() {
+		BeforeEach(func() {
+			ldapConnectionFake.SearchReturnsOnCall(0, &ldap.SearchResult{}, nil)
+			ldapConnectionFake.SearchReturnsOnCall(1, automountEntry("filer:/export/home/&"), nil)
+		})
+
+		It("uses the wildcard entry", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entry.Remote).To(Equal("filer:/export/home/alice"))
+
+			_, _, _, _, _, _, filter, _, _ := ldapFake.NewSearchRequestArgsForCall(1)
+			Expect(filter).To(Equal("(&(objectClass=automount)(automountKey=\\2a))"))
+		})
+
+		Context("when the map has no wildcard entry either", func() {
+			BeforeEach(func() {
+				ldapConnectionFake.SearchReturnsOnCall(1, &ldap.SearchResult{}, nil)
+			})
+
+			It("returns a safe error", func() {
+				Expect(err).To(MatchError(nfsv3driver.AutomountKeyDoesNotExistErrorMessage))
+				Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+			})
+		})
+	})
+
+	Context("when the key contains filter characters", func() {
+		BeforeEach(func() {
+			key = "alice)(cn=*"
+		})
+
+		It("escapes them", func() {
+			_, _, _, _, _, _, filter, _, _ := ldapFake.NewSearchRequestArgsForCall(0)
+			Expect(filter).To(Equal("(&(objectClass=automount)(automountKey=alice\\29\\28cn=\\2a))"))
+		})
+	})
+
+	table.DescribeTable("when the key is invalid",
+		func(invalid string) {
+			resolver := nfsv3driver.NewLdapAutomountResolver("svcuser", nfsv3driver.StaticCredential("svcpw"), []string{"host"}, 389, "tcp", "", ldapFake, time.Minute, "automountMapName=auto.home,dc=corp")
+			_, err := resolver.Resolve(env, invalid)
+			Expect(err).To(MatchError(nfsv3driver.InvalidAutomountKeyErrorMessage))
+		},
+		table.Entry("empty", ""),
+		table.Entry("the wildcard", "*"),
+		table.Entry("a path", "../alice"),
+		table.Entry("whitespace", "alice bob"),
+	)
+
+	Context("when the entry is not supported", func() {
+		BeforeEach(func() {
+			ldapConnectionFake.SearchReturns(automountEntry("-fstype=cifs ://server/share"), nil)
+		})
+
+		It("logs the entry and returns a safe error", func() {
+			Expect(err).To(MatchError(nfsv3driver.UnsupportedAutomountEntryErrorMessage))
+			Expect(logger.Buffer()).To(gbytes.Say("unsupported-automount-entry.*cifs"))
+		})
+	})
+
+	Context("when the directory cannot be reached", func() {
+		BeforeEach(func() {
+			ldapFake.DialReturns(nil, errors.New("connection refused"))
+		})
+
+		It("returns a safe error", func() {
+			Expect(err).To(MatchError("LDAP server could not be reached, please contact your system administrator"))
+		})
+	})
+
+	Context("when the search fails", func() {
+		BeforeEach(func() {
+			ldapConnectionFake.SearchReturns(nil, errors.New("no such object"))
+		})
+
+		It("returns the error", func() {
+			Expect(err).To(MatchError("no such object"))
+		})
+	})
+})
+
+var _ = Describe("ParseAutomountInformation", func() {
+	table.DescribeTable("supported entries",
+		func(information string, remote string, options map[string]interface{}, readOnly bool) {
+			entry, err := nfsv3driver.ParseAutomountInformation("alice", information)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entry.Remote).To(Equal(remote))
+			Expect(entry.Options).To(Equal(options))
+			Expect(entry.ReadOnly).To(Equal(readOnly))
+		},
+		table.Entry("a location only", "filer:/export/home/alice", "filer:/export/home/alice", map[string]interface{}{}, false),
+		table.Entry("a key substitution", "filer:/export/&/data", "filer:/export/alice/data", map[string]interface{}{}, false),
+		table.Entry("translated options", "-fstype=nfs,ro,nfsvers=3,sec=krb5,hard,intr filer:/export", "filer:/export", map[string]interface{}{"readonly": true, "version": "3", "sec": "krb5"}, true),
+		table.Entry("a read-write entry", "-rw,nfsvers=3 filer:/export", "filer:/export", map[string]interface{}{"version": "3"}, false),
+	)
+
+	table.DescribeTable("unsupported entries",
+		func(information string) {
+			_, err := nfsv3driver.ParseAutomountInformation("alice", information)
+			Expect(err).To(HaveOccurred())
+		},
+		table.Entry("no location", "-rw"),
+		table.Entry("another file system", "-fstype=cifs ://server/share"),
+		table.Entry("a local device", ":/dev/sdb1"),
+		table.Entry("replicated servers", "filer1,filer2:/export"),
+		table.Entry("a multi-mount", "/ filer:/export /data filer:/data"),
+	)
+})
@@ -0,0 +1,70 @@
+package nfsv3driver
+
+import (
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/lager"
+)
+
+const UserDoesNotExistErrorMessage = "User does not exist"
+
+// IdResolverSource names a resolver so that the chained resolver can report which source answered.
+type IdResolverSource struct {
+	Name     string
+	Resolver IdResolver
+}
+
+type chainedIdResolver struct {
+	sources []IdResolverSource
+}
+
+// NewChainedIdResolver returns a resolver that tries each source in order. The first definitive answer (a
+// resolved user or any error other than "User does not exist") ends the search.
+func NewChainedIdResolver(sources ...IdResolverSource) IdResolver {
+	return &chainedIdResolver{sources: sources}
+}
+
+func (c *chainedIdResolver) Resolve(env dockerdriver.Env, username string, password string) (uid string, gid string, groups []string, err error) {
+	env = redactEnv(env, nil)
+	logger := env.Logger().Session("chained-resolve", lager.Data{"username": username})
+	logger.Info("start")
+	defer logger.Info("end")
+
+	for _, source := range c.sources {
+		uid, gid, groups, err = source.Resolver.Resolve(env, username, password)
+		if isUserDoesNotExist(err) {
+			logger.Info("user-not-found-in-source", lager.Data{"source": source.Name})
+			continue
+		}
+
+		if err != nil {
+			logger.Info("resolve-failed", lager.Data{"source": source.Name})
+			return "", "", nil, err
+		}
+
+		logger.Info("user-resolved", lager.Data{"source": source.Name, "uid": uid, "gid": gid})
+		return uid, gid, groups, nil
+	}
+
+	return "", "", nil, dockerdriver.SafeError{SafeDescription: UserDoesNotExistErrorMessage}
+}
+
+func (c *chainedIdResolver) Validate(env dockerdriver.Env, username string) error {
+	logger := env.Logger().Session("chained-validate", lager.Data{"username": username})
+
+	for _, source := range c.sources {
+		err := source.Resolver.Validate(env, username)
+		if isUserDoesNotExist(err) {
+			logger.Debug("user-not-found-in-source", lager.Data{"source": source.Name})
+			continue
+		}
+
+		return err
+	}
+
+	return dockerdriver.SafeError{SafeDescription: UserDoesNotExistErrorMessage}
+}
+
+func isUserDoesNotExist(err error) bool {
+	safeErr, ok := err.(dockerdriver.SafeError)
+	return ok && safeErr.SafeDescription == UserDoesNotExistErrorMessage
+}
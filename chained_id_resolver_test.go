@@ -0,0 +1,157 @@
+package nfsv3driver_test
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nfsv3driver"
+	"code.cloudfoundry.org/nfsv3driver/nfsdriverfakes"
+)
+
+var _ = Describe("ChainedIdResolver", func() {
+	var (
+		logger         *lagertest.TestLogger
+		env            dockerdriver.Env
+		firstResolver  *nfsdriverfakes.FakeIdResolver
+		secondResolver *nfsdriverfakes.FakeIdResolver
+		subject        nfsv3driver.IdResolver
+		uid, gid       string
+		err            error
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("chained-id-resolver")
+		env = driverhttp.NewHttpDriverEnv(logger, context.TODO())
+
+		firstResolver = &nfsdriverfakes.FakeIdResolver{}
+		secondResolver = &nfsdriverfakes.FakeIdResolver{}
+
+		subject = nfsv3driver.NewChainedIdResolver(
+			nfsv3driver.IdResolverSource{Name: "corp-ad", Resolver: firstResolver},
+			nfsv3driver.IdResolverSource{Name: "local", Resolver: secondResolver},
+		)
+	})
+
+	JustBeforeEach(func() {
+		uid, gid, _, err = subject.Resolve(env, "user", "pw")
+	})
+
+	Context("when the first source resolves the user", func() {
+		BeforeEach(func() {
+			firstResolver.ResolveReturns("100", "200", nil, nil)
+		})
+
+		It("returns its answer without consulting later sources", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(uid).To(Equal("100"))
+			Expect(gid).To(Equal("200"))
+			Expect(secondResolver.ResolveCallCount()).To(Equal(0))
+		})
+
+		It("passes the credentials through", func() {
+			_, username, password := firstResolver.ResolveArgsForCall(0)
+			Expect(username).To(Equal("user"))
+			Expect(password).To(Equal("pw"))
+		})
+
+		It("logs the source that resolved the user", func() {
+			Expect(logger.Buffer()).To(gbytes.Say("user-resolved.*corp-ad"))
+		})
+	})
+
+	Context("when the first source does not know the user", func() {
+		BeforeEach(func() {
+			firstResolver.ResolveReturns("", "", nil, dockerdriver.SafeError{SafeDescription: nfsv3driver.UserDoesNotExistErrorMessage})
+			secondResolver.ResolveReturns("300", "400", nil, nil)
+		})
+
+		It("falls back to the next source", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(uid).To(Equal("300"))
+			Expect(gid).To(Equal("400"))
+			Expect(firstResolver.ResolveCallCount()).To(Equal(1))
+			Expect(secondResolver.ResolveCallCount()).To(Equal(1))
+		})
+
+		It("logs the source that resolved the user", func() {
+			Expect(logger.Buffer()).To(gbytes.Say("user-not-found-in-source.*corp-ad"))
+			Expect(logger.Buffer()).To(gbytes.Say("user-resolved.*local"))
+		})
+
+		Context("when no source knows the user", func() {
+			BeforeEach(func() {
+				secondResolver.ResolveReturns("", "", nil, dockerdriver.SafeError{SafeDescription: nfsv3driver.UserDoesNotExistErrorMessage})
+			})
+
+			It("reports that the user does not exist", func() {
+				Expect(err).To(MatchError(nfsv3driver.UserDoesNotExistErrorMessage))
+				Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+			})
+		})
+	})
+
+	Context("when the first source fails with a definitive error", func() {
+		BeforeEach(func() {
+			firstResolver.ResolveReturns("", "", nil, dockerdriver.SafeError{SafeDescription: "Invalid Credentials"})
+		})
+
+		It("returns that error without consulting later sources", func() {
+			Expect(err).To(MatchError("Invalid Credentials"))
+			Expect(secondResolver.ResolveCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when the first source fails with an unsafe error", func() {
+		BeforeEach(func() {
+			firstResolver.ResolveReturns("", "", nil, errors.New("badness"))
+		})
+
+		It("returns that error without consulting later sources", func() {
+			Expect(err).To(MatchError("badness"))
+			Expect(secondResolver.ResolveCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when there are no sources", func() {
+		BeforeEach(func() {
+			subject = nfsv3driver.NewChainedIdResolver()
+		})
+
+		It("reports that the user does not exist", func() {
+			Expect(err).To(MatchError(nfsv3driver.UserDoesNotExistErrorMessage))
+		})
+	})
+
+	Describe("Validate", func() {
+		It("asks later sources when a source does not know the user", func() {
+			firstResolver.ValidateReturns(dockerdriver.SafeError{SafeDescription: nfsv3driver.UserDoesNotExistErrorMessage})
+			secondResolver.ValidateReturns(nil)
+
+			Expect(subject.Validate(env, "user")).To(Succeed())
+			_, username := secondResolver.ValidateArgsForCall(0)
+			Expect(username).To(Equal("user"))
+		})
+
+		It("returns the first definitive answer", func() {
+			firstResolver.ValidateReturns(errors.New("badness"))
+
+			Expect(subject.Validate(env, "user")).To(MatchError("badness"))
+			Expect(secondResolver.ValidateCallCount()).To(Equal(0))
+		})
+
+		It("reports that the user does not exist when no source knows them", func() {
+			firstResolver.ValidateReturns(dockerdriver.SafeError{SafeDescription: nfsv3driver.UserDoesNotExistErrorMessage})
+			secondResolver.ValidateReturns(dockerdriver.SafeError{SafeDescription: nfsv3driver.UserDoesNotExistErrorMessage})
+
+			err := subject.Validate(env, "user")
+			Expect(nfsv3driver.IsIdentityRevoked(err)).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,904 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/goshims/ioutilshim"
+	"code.cloudfoundry.org/goshims/osshim"
+	"code.cloudfoundry.org/goshims/syscallshim"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/nfsv3driver"
+	"code.cloudfoundry.org/nfsv3driver/nfscsi"
+	"gopkg.in/ldap.v2"
+	"gopkg.in/yaml.v2"
+)
+
+// driverConfig holds every setting of the driver. It starts out from the command line flags and the LDAP_*,
+// MOUNT_* and PLUGIN_* environment variables and is then overlaid with the YAML or JSON file given by -configFile, if any.
+// Only the settings under log_level, ldap and mount are applied when the driver reloads its configuration on
+// SIGHUP; the rest require a restart.
+type driverConfig struct {
+	ListenAddr         string   `yaml:"listen_addr"`
+	AdminAddr          string   `yaml:"admin_addr"`
+	DriversPath        string   `yaml:"drivers_path"`
+	Transport          string   `yaml:"transport"`
+	MapfsPath          string   `yaml:"mapfs_path"`
+	MountDir           string   `yaml:"mount_dir"`
+	RequireSSL         bool     `yaml:"require_ssl"`
+	CAFile             string   `yaml:"ca_file"`
+	CertFile           string   `yaml:"cert_file"`
+	KeyFile            string   `yaml:"key_file"`
+	ClientCertFile     string   `yaml:"client_cert_file"`
+	ClientKeyFile      string   `yaml:"client_key_file"`
+	InsecureSkipVerify bool     `yaml:"insecure_skip_verify"`
+	SecretsDir         string   `yaml:"secrets_dir"`
+	RedactKeys         []string `yaml:"redact_keys"`
+
+	LogLevel string      `yaml:"log_level"`
+	LDAP     ldapConfig  `yaml:"ldap"`
+	Mount    mountConfig `yaml:"mount"`
+
+	Revalidation   revalidationConfig   `yaml:"revalidation"`
+	Token          tokenConfig          `yaml:"token"`
+	Kerberos       kerberosConfig       `yaml:"kerberos"`
+	Reconciliation reconciliationConfig `yaml:"reconciliation"`
+	MountRecords   mountRecordsConfig   `yaml:"mount_records"`
+	CSI            csiConfig            `yaml:"csi"`
+	Plugin         pluginConfig         `yaml:"plugin"`
+	Simulation     simulationConfig     `yaml:"simulation"`
+}
+
+type ldapConfig struct {
+	Host              string `yaml:"host"`
+	Port              int    `yaml:"port"`
+	Proto             string `yaml:"proto"`
+	UserFqdn          string `yaml:"user_fqdn"`
+	SvcUser           string `yaml:"svc_user"`
+	SvcPass           string `yaml:"svc_pass"`
+	SvcPassFile       string `yaml:"svc_pass_file"`
+	CACert            string `yaml:"ca_cert"`
+	Timeout           int    `yaml:"timeout"`
+	PageSize          int    `yaml:"page_size"`
+	MaxReferralHops   int    `yaml:"max_referral_hops"`
+	MaxUserFailures   int    `yaml:"max_user_failures"`
+	MaxSourceFailures int    `yaml:"max_source_failures"`
+	FailureBackoff    int    `yaml:"failure_backoff"`
+	MaxFailureBackoff int    `yaml:"max_failure_backoff"`
+	LockoutDuration   int    `yaml:"lockout_duration"`
+	Filter            string `yaml:"filter"`
+
+	// AutomountMapDN is the automountMap entry that the 'automount_key' mount option is looked up in
+	AutomountMapDN string `yaml:"automount_map_dn"`
+
+	// Domain and NetbiosName name the directory above when usernames are routed by domain
+	Domain      string             `yaml:"domain"`
+	NetbiosName string             `yaml:"netbios_name"`
+	Domains     []ldapDomainConfig `yaml:"domains"`
+
+	IdMapping    idMappingConfig    `yaml:"id_mapping"`
+	OfflineCache offlineCacheConfig `yaml:"offline_cache"`
+
+	// Sources are where usernames are resolved, in order; without any, the directories above are the only source
+	Sources []idSourceConfig `yaml:"sources"`
+}
+
+// idSourceConfig is a source the chained resolver looks usernames up in, moving on to the next source only when a
+// user does not exist in this one. An ldap source resolves users in one directory, named by its domain or netbios
+// name or "default" for the top level one, or in every directory, routed by domain, when no directory is given. A
+// local source resolves a fixed list of users.
+type idSourceConfig struct {
+	Name      string            `yaml:"name"`
+	Type      string            `yaml:"type"`
+	Directory string            `yaml:"directory"`
+	Users     []localUserConfig `yaml:"users"`
+}
+
+type localUserConfig struct {
+	Username     string   `yaml:"username"`
+	Password     string   `yaml:"password"`
+	PasswordFile string   `yaml:"password_file"`
+	Uid          string   `yaml:"uid"`
+	Gid          string   `yaml:"gid"`
+	Groups       []string `yaml:"groups"`
+}
+
+func (u localUserConfig) localUser() nfsv3driver.LocalUser {
+	var password nfsv3driver.Credential = nfsv3driver.StaticCredential(u.Password)
+	if u.PasswordFile != "" {
+		password = nfsv3driver.NewFileCredential(&ioutilshim.IoutilShim{}, u.PasswordFile)
+	}
+
+	return nfsv3driver.LocalUser{
+		Username: u.Username,
+		Password: password,
+		Uid:      u.Uid,
+		Gid:      u.Gid,
+		Groups:   u.Groups,
+	}
+}
+
+// directory returns the directory an ldap source named, and whether it is configured.
+func (c ldapConfig) directory(name string) (ldapDomainConfig, bool) {
+	if c.Host != "" && (strings.EqualFold(name, "default") || strings.EqualFold(name, c.Domain) || strings.EqualFold(name, c.NetbiosName)) {
+		return c.defaultDomain(), true
+	}
+	for _, domain := range c.Domains {
+		if strings.EqualFold(name, domain.Name) || strings.EqualFold(name, domain.NetbiosName) {
+			return domain, true
+		}
+	}
+	return ldapDomainConfig{}, false
+}
+
+// idMappingConfig derives uids and gids from objectSid like sssd's ldap_id_mapping, for directories whose users
+// have no uidNumber and gidNumber. The defaults match sssd's.
+type idMappingConfig struct {
+	Enabled          bool              `yaml:"enabled"`
+	RangeMin         uint32            `yaml:"range_min"`
+	RangeMax         uint32            `yaml:"range_max"`
+	RangeSize        uint32            `yaml:"range_size"`
+	DefaultDomainSid string            `yaml:"default_domain_sid"`
+	DomainSlices     map[string]uint32 `yaml:"domain_slices"`
+}
+
+func (c idMappingConfig) mapper() (nfsv3driver.IdMapper, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+
+	return nfsv3driver.NewSidIdMapper(nfsv3driver.SidIdMapperConfig{
+		RangeMin:         c.RangeMin,
+		RangeMax:         c.RangeMax,
+		RangeSize:        c.RangeSize,
+		DefaultDomainSid: c.DefaultDomainSid,
+		DomainSlices:     c.DomainSlices,
+	})
+}
+
+// offlineCacheConfig lets mounts keep resolving users for grace_period seconds after their last successful
+// resolution while the directory is unreachable. The key file holds a base64 encoded 256-bit key.
+type offlineCacheConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	Path        string `yaml:"path"`
+	KeyFile     string `yaml:"key_file"`
+	GracePeriod int    `yaml:"grace_period"`
+}
+
+func (c offlineCacheConfig) store() (nfsv3driver.OfflineIdentityStore, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+
+	key, err := readKeyFile(c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return nfsv3driver.NewEncryptedIdentityStore(&ioutilshim.IoutilShim{}, &osshim.OsShim{}, &syscallshim.SyscallShim{}, c.Path, key)
+}
+
+// readKeyFile reads a base64 encoded key.
+func readKeyFile(keyFile string) ([]byte, error) {
+	contents, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(contents)))
+	if err != nil {
+		return nil, fmt.Errorf("%s is not base64 encoded", keyFile)
+	}
+	return key, nil
+}
+
+// ldapDomainConfig is a further directory that usernames of the form user@name or NETBIOS_NAME\user are looked up
+// in. Timeouts, paging, referral and throttling settings are shared with the default directory.
+type ldapDomainConfig struct {
+	Name        string   `yaml:"name"`
+	NetbiosName string   `yaml:"netbios_name"`
+	Hosts       []string `yaml:"hosts"`
+	Port        int      `yaml:"port"`
+	Proto       string   `yaml:"proto"`
+	UserFqdn    string   `yaml:"user_fqdn"`
+	SvcUser     string   `yaml:"svc_user"`
+	SvcPass     string   `yaml:"svc_pass"`
+	SvcPassFile string   `yaml:"svc_pass_file"`
+	CACert      string   `yaml:"ca_cert"`
+	Filter      string   `yaml:"filter"`
+}
+
+// defaultDomain describes the directory configured by the top level LDAP settings.
+func (c ldapConfig) defaultDomain() ldapDomainConfig {
+	return ldapDomainConfig{
+		Name:        c.Domain,
+		NetbiosName: c.NetbiosName,
+		Hosts:       []string{c.Host},
+		Port:        c.Port,
+		Proto:       c.Proto,
+		UserFqdn:    c.UserFqdn,
+		SvcUser:     c.SvcUser,
+		SvcPass:     c.SvcPass,
+		SvcPassFile: c.SvcPassFile,
+		CACert:      c.CACert,
+		Filter:      c.Filter,
+	}
+}
+
+// loginThrottleConfig returns the settings failed logins against the directories are throttled with.
+func (c ldapConfig) loginThrottleConfig() nfsv3driver.LoginThrottleConfig {
+	return nfsv3driver.LoginThrottleConfig{
+		UserMaxFailures:   c.MaxUserFailures,
+		SourceMaxFailures: c.MaxSourceFailures,
+		BaseBackoff:       time.Duration(c.FailureBackoff) * time.Second,
+		MaxBackoff:        time.Duration(c.MaxFailureBackoff) * time.Second,
+		LockoutDuration:   time.Duration(c.LockoutDuration) * time.Second,
+	}
+}
+
+// svcPassCredential returns the service account password, read from svc_pass_file on every use when one is set.
+func (d ldapDomainConfig) svcPassCredential() nfsv3driver.Credential {
+	if d.SvcPassFile != "" {
+		return nfsv3driver.NewFileCredential(&ioutilshim.IoutilShim{}, d.SvcPassFile)
+	}
+	return nfsv3driver.StaticCredential(d.SvcPass)
+}
+
+type mountConfig struct {
+	AllowedOptions    []string          `yaml:"allowed_options"`
+	MapfsMountTimeout int               `yaml:"mapfs_mount_timeout"`
+	SharePolicy       sharePolicyConfig `yaml:"share_policy"`
+}
+
+// sharePolicyConfig restricts which LDAP groups may mount which exports. Once any share is governed, shares that no
+// rule matches are refused unless unmatched is "allow", so that a share named in a way no rule foresaw is not let
+// through; without rules everything is allowed unless unmatched is "deny".
+type sharePolicyConfig struct {
+	Unmatched string            `yaml:"unmatched"`
+	Shares    []shareRuleConfig `yaml:"shares"`
+}
+
+type shareRuleConfig struct {
+	Export string   `yaml:"export"`
+	Groups []string `yaml:"groups"`
+}
+
+func (c sharePolicyConfig) authorizer() (nfsv3driver.ShareAuthorizer, error) {
+	if c.Unmatched != "allow" && c.Unmatched != "deny" {
+		return nil, fmt.Errorf("unmatched must be one of allow, deny, got '%s'", c.Unmatched)
+	}
+	if len(c.Shares) == 0 && c.Unmatched == "allow" {
+		return nil, nil
+	}
+
+	var rules []nfsv3driver.ShareRule
+	for _, share := range c.Shares {
+		rules = append(rules, nfsv3driver.ShareRule{Export: share.Export, Groups: share.Groups})
+	}
+	return nfsv3driver.NewSharePolicy(rules, c.Unmatched == "allow")
+}
+
+// revalidationConfig controls the periodic check of the users behind LDAP-backed mounts. An interval of 0 turns
+// the check off. Mounts still up from before a restart are only checked when mount_records are kept, since nothing
+// else remembers their users.
+type revalidationConfig struct {
+	Interval int    `yaml:"interval"`
+	Action   string `yaml:"action"`
+}
+
+// tokenConfig enables the 'token' mount option. The key file is re-read for every token, so the platform's keys
+// can be rotated in place; changing the other settings requires a restart.
+type tokenConfig struct {
+	PublicKeyFile string `yaml:"public_key_file"`
+	JwksFile      string `yaml:"jwks_file"`
+	Audience      string `yaml:"audience"`
+	Issuer        string `yaml:"issuer"`
+}
+
+func (c tokenConfig) keyFile() string {
+	if c.JwksFile != "" {
+		return c.JwksFile
+	}
+	return c.PublicKeyFile
+}
+
+// kerberosConfig enables per-user tickets for mounts with the 'sec' option set to krb5, krb5i or krb5p. Durations
+// are in seconds. The credential cache directory must only be accessible by the driver, which rules out /tmp;
+// rpc.gssd is pointed at it with its -d flag.
+type kerberosConfig struct {
+	Enabled           bool   `yaml:"enabled"`
+	Realm             string `yaml:"realm"`
+	CcacheDir         string `yaml:"ccache_dir"`
+	KinitPath         string `yaml:"kinit_path"`
+	KdestroyPath      string `yaml:"kdestroy_path"`
+	RenewInterval     int    `yaml:"renew_interval"`
+	RenewableLifetime int    `yaml:"renewable_lifetime"`
+}
+
+// reconciliationConfig controls how often the volumes are reconciled with the mounts and mapfs processes on the
+// host, in seconds. They are always reconciled at startup; an interval of 0 turns the periodic reconciliation off.
+type reconciliationConfig struct {
+	Interval int `yaml:"interval"`
+}
+
+// mountRecordsConfig keeps how each volume was mounted, without the user's credentials, so that volumes that are
+// still mounted can be remounted after a restart. The key file holds a base64 encoded 256-bit key.
+type mountRecordsConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Path    string `yaml:"path"`
+	KeyFile string `yaml:"key_file"`
+}
+
+func (c mountRecordsConfig) store() (nfsv3driver.MountRecordStore, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+
+	key, err := readKeyFile(c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return nfsv3driver.NewEncryptedMountRecordStore(&ioutilshim.IoutilShim{}, &osshim.OsShim{}, &syscallshim.SyscallShim{}, c.Path, key)
+}
+
+// csiConfig is used by the csi command, which serves the CSI identity and node services instead of the volume
+// plugin API. The node id defaults to the host name.
+type csiConfig struct {
+	Endpoint string `yaml:"endpoint"`
+	NodeID   string `yaml:"node_id"`
+}
+
+// pluginConfig is used by the plugin transport, which runs the driver as a Docker managed plugin. The daemon
+// finds the plugin's socket as <name>.sock in socket_dir, and creates volumes once for the whole swarm if the scope
+// is global.
+type pluginConfig struct {
+	Name      string `yaml:"name"`
+	SocketDir string `yaml:"socket_dir"`
+	Scope     string `yaml:"scope"`
+}
+
+func (c pluginConfig) socketPath() string {
+	return filepath.Join(c.SocketDir, c.Name+".sock")
+}
+
+// simulationConfig runs the driver without touching the host: the mount, umount, mapfs and pkill commands are only
+// recorded, in the transcript the admin API serves, and volumes are mounted in scratch_dir instead of the mount dir.
+type simulationConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	ScratchDir string `yaml:"scratch_dir"`
+}
+
+// loadConfig assembles the configuration and validates it, returning every problem found rather than stopping
+// at the first one.
+func loadConfig(configFile string) (driverConfig, []error) {
+	config := configFromFlags()
+	errs := parseEnvironment(&config)
+
+	if configFile != "" {
+		contents, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			return config, append(errs, err)
+		}
+
+		err = yaml.UnmarshalStrict(contents, &config)
+		if err != nil {
+			return config, append(errs, fmt.Errorf("%s: %s", configFile, err.Error()))
+		}
+	}
+
+	config.applyDefaults()
+
+	return config, append(errs, config.validate()...)
+}
+
+func configFromFlags() driverConfig {
+	var redact []string
+	for _, key := range strings.Split(*redactKeys, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			redact = append(redact, key)
+		}
+	}
+
+	return driverConfig{
+		ListenAddr:         *atAddress,
+		AdminAddr:          *adminAddress,
+		DriversPath:        *driversPath,
+		Transport:          *transport,
+		MapfsPath:          *mapfsPath,
+		MountDir:           *mountDir,
+		RequireSSL:         *requireSSL,
+		CAFile:             *caFile,
+		CertFile:           *certFile,
+		KeyFile:            *keyFile,
+		ClientCertFile:     *clientCertFile,
+		ClientKeyFile:      *clientKeyFile,
+		InsecureSkipVerify: *insecureSkipVerify,
+		SecretsDir:         *secretsDir,
+		RedactKeys:         redact,
+		LogLevel:           "",
+		LDAP: ldapConfig{
+			MaxUserFailures:   5,
+			FailureBackoff:    1,
+			MaxFailureBackoff: 60,
+			LockoutDuration:   900,
+			IdMapping: idMappingConfig{
+				RangeMin:  200000,
+				RangeMax:  2000200000,
+				RangeSize: 200000,
+			},
+			OfflineCache: offlineCacheConfig{
+				GracePeriod: 86400,
+			},
+		},
+		Mount: mountConfig{
+			MapfsMountTimeout: int(nfsv3driver.MapfsMountTimeout.Seconds()),
+		},
+		Kerberos: kerberosConfig{
+			CcacheDir:         "/var/vcap/data/nfsv3driver/ccaches",
+			KinitPath:         "kinit",
+			KdestroyPath:      "kdestroy",
+			RenewInterval:     3600,
+			RenewableLifetime: 604800,
+		},
+		Reconciliation: reconciliationConfig{
+			Interval: 300,
+		},
+		CSI: csiConfig{
+			Endpoint: *csiEndpoint,
+			NodeID:   *nodeID,
+		},
+		Plugin: pluginConfig{
+			Name:      "nfsv3driver",
+			SocketDir: "/run/docker/plugins",
+		},
+	}
+}
+
+func parseEnvironment(config *driverConfig) []error {
+	var errs []error
+
+	stringFromEnvironment := func(name string, value *string) {
+		if v, ok := os.LookupEnv(name); ok {
+			*value = v
+		}
+	}
+	intFromEnvironment := func(name string, value *int) {
+		v, ok := os.LookupEnv(name)
+		if !ok || v == "" {
+			return
+		}
+
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s must be an integer", name))
+			return
+		}
+		*value = i
+	}
+	listFromEnvironment := func(name string, value *[]string) {
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return
+		}
+
+		*value = nil
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*value = append(*value, item)
+			}
+		}
+	}
+
+	stringFromEnvironment("LDAP_SVC_USER", &config.LDAP.SvcUser)
+	stringFromEnvironment("LDAP_SVC_PASS", &config.LDAP.SvcPass)
+	stringFromEnvironment("LDAP_SVC_PASS_FILE", &config.LDAP.SvcPassFile)
+	stringFromEnvironment("LDAP_USER_FQDN", &config.LDAP.UserFqdn)
+	stringFromEnvironment("LDAP_HOST", &config.LDAP.Host)
+	intFromEnvironment("LDAP_PORT", &config.LDAP.Port)
+	stringFromEnvironment("LDAP_CA_CERT", &config.LDAP.CACert)
+	stringFromEnvironment("LDAP_PROTO", &config.LDAP.Proto)
+	intFromEnvironment("LDAP_TIMEOUT", &config.LDAP.Timeout)
+	stringFromEnvironment("LDAP_USER_FILTER", &config.LDAP.Filter)
+
+	intFromEnvironment("LDAP_MAX_USER_FAILURES", &config.LDAP.MaxUserFailures)
+	intFromEnvironment("LDAP_MAX_SOURCE_FAILURES", &config.LDAP.MaxSourceFailures)
+	intFromEnvironment("LDAP_FAILURE_BACKOFF", &config.LDAP.FailureBackoff)
+	intFromEnvironment("LDAP_MAX_FAILURE_BACKOFF", &config.LDAP.MaxFailureBackoff)
+	intFromEnvironment("LDAP_LOCKOUT_DURATION", &config.LDAP.LockoutDuration)
+
+	intFromEnvironment("LDAP_PAGE_SIZE", &config.LDAP.PageSize)
+	intFromEnvironment("LDAP_MAX_REFERRAL_HOPS", &config.LDAP.MaxReferralHops)
+
+	listFromEnvironment("MOUNT_ALLOWED_OPTIONS", &config.Mount.AllowedOptions)
+	intFromEnvironment("MOUNT_MAPFS_MOUNT_TIMEOUT", &config.Mount.MapfsMountTimeout)
+
+	stringFromEnvironment("PLUGIN_SCOPE", &config.Plugin.Scope)
+
+	return errs
+}
+
+func (c *driverConfig) applyDefaults() {
+	if c.LDAP.Proto == "" {
+		c.LDAP.Proto = "tcp"
+	}
+	if c.Mount.SharePolicy.Unmatched == "" {
+		if len(c.Mount.SharePolicy.Shares) > 0 {
+			c.Mount.SharePolicy.Unmatched = "deny"
+		} else {
+			c.Mount.SharePolicy.Unmatched = "allow"
+		}
+	}
+	if c.Plugin.Scope == "" {
+		c.Plugin.Scope = "local"
+	}
+	if c.Simulation.Enabled && c.Simulation.ScratchDir != "" {
+		c.MountDir = c.Simulation.ScratchDir
+	}
+	if c.Revalidation.Action == "" {
+		c.Revalidation.Action = string(nfsv3driver.RevalidationActionLog)
+	}
+	for i := range c.LDAP.Domains {
+		if c.LDAP.Domains[i].Proto == "" {
+			c.LDAP.Domains[i].Proto = "tcp"
+		}
+	}
+
+	// if the LDAP timeout is not set, use default value
+	if c.LDAP.Timeout == 0 {
+		c.LDAP.Timeout = 120
+	}
+}
+
+func (c *driverConfig) validate() []error {
+	var errs []error
+	invalid := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	switch c.Transport {
+	case "tcp", "tcp-json", "unix", "plugin":
+	default:
+		invalid("transport must be one of 'tcp', 'tcp-json', 'unix' or 'plugin', got '%s'", c.Transport)
+	}
+
+	if c.RequireSSL && (c.CAFile == "" || c.CertFile == "" || c.KeyFile == "") {
+		invalid("require_ssl is set but ca_file, cert_file and key_file are not all set")
+	}
+
+	if c.LogLevel != "" {
+		if _, err := lager.LogLevelFromString(c.LogLevel); err != nil {
+			invalid("log_level must be one of 'debug', 'info', 'error' or 'fatal', got '%s'", c.LogLevel)
+		}
+	}
+
+	if c.LDAP.Host != "" {
+		var missing []string
+		if c.LDAP.SvcUser == "" {
+			missing = append(missing, "svc_user")
+		}
+		if c.LDAP.SvcPass == "" && c.LDAP.SvcPassFile == "" {
+			missing = append(missing, "svc_pass or svc_pass_file")
+		}
+		if c.LDAP.UserFqdn == "" {
+			missing = append(missing, "user_fqdn")
+		}
+		if c.LDAP.Port == 0 {
+			missing = append(missing, "port")
+		}
+		if len(missing) > 0 {
+			invalid("LDAP is enabled but required LDAP parameters are not set: %s", strings.Join(missing, ", "))
+		}
+	}
+
+	if c.LDAP.Port < 0 || c.LDAP.Port > 65535 {
+		invalid("ldap.port must be between 1 and 65535, got %d", c.LDAP.Port)
+	}
+
+	if c.LDAP.CACert != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(c.LDAP.CACert)) {
+		invalid("ldap.ca_cert does not contain a PEM encoded certificate")
+	}
+
+	if c.LDAP.Filter != "" && strings.Count(c.LDAP.Filter, "%s") != 1 {
+		invalid("ldap.filter must contain exactly one %%s for the username")
+	}
+
+	if c.LDAP.OfflineCache.Enabled {
+		if !filepath.IsAbs(c.LDAP.OfflineCache.Path) {
+			invalid("ldap.offline_cache.path must be an absolute path, got '%s'", c.LDAP.OfflineCache.Path)
+		}
+		if c.LDAP.OfflineCache.GracePeriod <= 0 {
+			invalid("ldap.offline_cache.grace_period must be positive, got %d", c.LDAP.OfflineCache.GracePeriod)
+		}
+		if _, err := c.LDAP.OfflineCache.store(); err != nil {
+			invalid("ldap.offline_cache: %s", err.Error())
+		}
+	}
+
+	if c.LDAP.AutomountMapDN != "" {
+		if c.LDAP.Host == "" {
+			invalid("ldap.automount_map_dn requires ldap.host to be set")
+		}
+		if _, err := ldap.ParseDN(c.LDAP.AutomountMapDN); err != nil {
+			invalid("ldap.automount_map_dn: %s", err.Error())
+		}
+	}
+
+	if _, err := c.LDAP.IdMapping.mapper(); err != nil {
+		invalid("ldap.id_mapping: %s", err.Error())
+	}
+
+	domainNames := map[string]bool{}
+	for _, name := range []string{c.LDAP.Domain, c.LDAP.NetbiosName} {
+		if name != "" {
+			domainNames[strings.ToLower(name)] = true
+		}
+	}
+	for i, domain := range c.LDAP.Domains {
+		errs = append(errs, domain.validate(fmt.Sprintf("ldap.domains[%d]", i), domainNames)...)
+	}
+
+	sourceNames := map[string]bool{}
+	for i, source := range c.LDAP.Sources {
+		errs = append(errs, source.validate(fmt.Sprintf("ldap.sources[%d]", i), sourceNames, c.LDAP)...)
+	}
+
+	for name, value := range map[string]int{
+		"ldap.timeout":             c.LDAP.Timeout,
+		"ldap.page_size":           c.LDAP.PageSize,
+		"ldap.max_referral_hops":   c.LDAP.MaxReferralHops,
+		"ldap.max_user_failures":   c.LDAP.MaxUserFailures,
+		"ldap.max_source_failures": c.LDAP.MaxSourceFailures,
+		"ldap.failure_backoff":     c.LDAP.FailureBackoff,
+		"ldap.max_failure_backoff": c.LDAP.MaxFailureBackoff,
+		"ldap.lockout_duration":    c.LDAP.LockoutDuration,
+	} {
+		if value < 0 {
+			invalid("%s must not be negative, got %d", name, value)
+		}
+	}
+
+	for _, option := range c.Mount.AllowedOptions {
+		if !contains(nfsv3driver.MapfsAllowedOptions, option) {
+			invalid("mount.allowed_options contains unknown option '%s'", option)
+		}
+	}
+
+	if c.Mount.MapfsMountTimeout <= 0 {
+		invalid("mount.mapfs_mount_timeout must be positive, got %d", c.Mount.MapfsMountTimeout)
+	}
+
+	if _, err := c.Mount.SharePolicy.authorizer(); err != nil {
+		invalid("mount.share_policy: %s", err.Error())
+	}
+
+	if c.Revalidation.Interval < 0 {
+		invalid("revalidation.interval must not be negative, got %d", c.Revalidation.Interval)
+	}
+
+	switch nfsv3driver.RevalidationAction(c.Revalidation.Action) {
+	case nfsv3driver.RevalidationActionLog, nfsv3driver.RevalidationActionFlag, nfsv3driver.RevalidationActionUnmount:
+	default:
+		invalid("revalidation.action must be one of 'log', 'flag' or 'unmount', got '%s'", c.Revalidation.Action)
+	}
+
+	if c.Token.PublicKeyFile != "" && c.Token.JwksFile != "" {
+		invalid("token.public_key_file and token.jwks_file must not both be set")
+	}
+	if keyFile := c.Token.keyFile(); keyFile != "" {
+		if c.Token.Audience == "" {
+			invalid("token.audience must be set when token verification is enabled")
+		}
+		if contents, err := ioutil.ReadFile(keyFile); err != nil {
+			invalid("token: %s", err.Error())
+		} else if _, err := nfsv3driver.ParseTokenKeys(contents); err != nil {
+			invalid("token: %s: %s", keyFile, err.Error())
+		}
+	} else if c.Token.Audience != "" || c.Token.Issuer != "" {
+		invalid("token.audience and token.issuer require token.public_key_file or token.jwks_file")
+	}
+
+	if c.Kerberos.Enabled {
+		if !filepath.IsAbs(c.Kerberos.CcacheDir) {
+			invalid("kerberos.ccache_dir must be an absolute path, got '%s'", c.Kerberos.CcacheDir)
+		}
+		if c.Kerberos.RenewInterval <= 0 {
+			invalid("kerberos.renew_interval must be positive, got %d", c.Kerberos.RenewInterval)
+		}
+		if c.Kerberos.RenewableLifetime < 0 {
+			invalid("kerberos.renewable_lifetime must not be negative, got %d", c.Kerberos.RenewableLifetime)
+		}
+	}
+
+	if c.Reconciliation.Interval < 0 {
+		invalid("reconciliation.interval must not be negative, got %d", c.Reconciliation.Interval)
+	}
+
+	if c.MountRecords.Enabled {
+		if !filepath.IsAbs(c.MountRecords.Path) {
+			invalid("mount_records.path must be an absolute path, got '%s'", c.MountRecords.Path)
+		}
+		if _, err := c.MountRecords.store(); err != nil {
+			invalid("mount_records: %s", err.Error())
+		}
+	}
+
+	if !filepath.IsAbs(nfscsi.SocketPath(c.CSI.Endpoint)) {
+		invalid("csi.endpoint must be an absolute path or unix:// URL, got '%s'", c.CSI.Endpoint)
+	}
+
+	if c.Plugin.Name == "" || strings.ContainsAny(c.Plugin.Name, "/:") {
+		invalid("plugin.name must be set and must not contain '/' or ':', got '%s'", c.Plugin.Name)
+	}
+	if !filepath.IsAbs(c.Plugin.SocketDir) {
+		invalid("plugin.socket_dir must be an absolute path, got '%s'", c.Plugin.SocketDir)
+	}
+	if !contains(nfsv3driver.DockerPluginScopes, c.Plugin.Scope) {
+		invalid("plugin.scope must be one of 'local' or 'global', got '%s'", c.Plugin.Scope)
+	}
+
+	if c.Simulation.Enabled && !filepath.IsAbs(c.Simulation.ScratchDir) {
+		invalid("simulation.scratch_dir must be an absolute path, got '%s'", c.Simulation.ScratchDir)
+	}
+
+	return errs
+}
+
+func (s idSourceConfig) validate(prefix string, seen map[string]bool, ldapConfig ldapConfig) []error {
+	var errs []error
+	invalid := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(prefix+": "+format, args...))
+	}
+
+	if s.Name == "" {
+		invalid("name must be set")
+	} else if seen[s.Name] {
+		invalid("source name '%s' is configured more than once", s.Name)
+	}
+	seen[s.Name] = true
+
+	switch s.Type {
+	case "ldap":
+		if len(s.Users) > 0 {
+			invalid("users can only be given for a local source")
+		}
+		if s.Directory == "" && ldapConfig.Host == "" && len(ldapConfig.Domains) == 0 {
+			invalid("no LDAP directories are configured")
+		}
+		if _, ok := ldapConfig.directory(s.Directory); s.Directory != "" && !ok {
+			invalid("directory '%s' is not configured", s.Directory)
+		}
+	case "local":
+		if s.Directory != "" {
+			invalid("directory can only be given for an ldap source")
+		}
+		if len(s.Users) == 0 {
+			invalid("a local source must have users")
+		}
+		usernames := map[string]bool{}
+		for i, user := range s.Users {
+			if user.Username == "" {
+				invalid("users[%d]: username must be set", i)
+			} else if usernames[user.Username] {
+				invalid("users[%d]: username '%s' is configured more than once", i, user.Username)
+			}
+			usernames[user.Username] = true
+
+			if (user.Password == "") == (user.PasswordFile == "") {
+				invalid("users[%d]: exactly one of password or password_file must be set", i)
+			}
+			if _, err := strconv.ParseUint(user.Uid, 10, 32); err != nil {
+				invalid("users[%d]: uid must be a number, got '%s'", i, user.Uid)
+			}
+			if _, err := strconv.ParseUint(user.Gid, 10, 32); err != nil {
+				invalid("users[%d]: gid must be a number, got '%s'", i, user.Gid)
+			}
+		}
+	default:
+		invalid("type must be one of 'ldap' or 'local', got '%s'", s.Type)
+	}
+
+	return errs
+}
+
+func (d ldapDomainConfig) validate(prefix string, seen map[string]bool) []error {
+	var errs []error
+	invalid := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(prefix+": "+format, args...))
+	}
+
+	if d.Name == "" && d.NetbiosName == "" {
+		invalid("name or netbios_name must be set")
+	}
+	for _, name := range []string{d.Name, d.NetbiosName} {
+		if name == "" {
+			continue
+		}
+		if strings.ContainsAny(name, `@\`) {
+			invalid("domain name '%s' must not contain '@' or '\\'", name)
+		}
+		if seen[strings.ToLower(name)] {
+			invalid("domain name '%s' is configured more than once", name)
+		}
+		seen[strings.ToLower(name)] = true
+	}
+
+	var missing []string
+	if len(d.Hosts) == 0 {
+		missing = append(missing, "hosts")
+	}
+	if d.SvcUser == "" {
+		missing = append(missing, "svc_user")
+	}
+	if d.SvcPass == "" && d.SvcPassFile == "" {
+		missing = append(missing, "svc_pass or svc_pass_file")
+	}
+	if d.UserFqdn == "" {
+		missing = append(missing, "user_fqdn")
+	}
+	if d.Port == 0 {
+		missing = append(missing, "port")
+	}
+	if len(missing) > 0 {
+		invalid("required LDAP parameters are not set: %s", strings.Join(missing, ", "))
+	}
+
+	for _, host := range d.Hosts {
+		if host == "" {
+			invalid("hosts must not contain empty entries")
+		}
+	}
+	if d.Port < 0 || d.Port > 65535 {
+		invalid("port must be between 1 and 65535, got %d", d.Port)
+	}
+	if d.CACert != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(d.CACert)) {
+		invalid("ca_cert does not contain a PEM encoded certificate")
+	}
+	if d.Filter != "" && strings.Count(d.Filter, "%s") != 1 {
+		invalid("filter must contain exactly one %%s for the username")
+	}
+
+	return errs
+}
+
+// restartRequired lists the settings that differ from other but cannot be applied without a restart.
+func (c driverConfig) restartRequired(other driverConfig) []string {
+	var settings []string
+
+	a := reflect.ValueOf(c)
+	b := reflect.ValueOf(other)
+	for i := 0; i < a.NumField(); i++ {
+		name := strings.Split(a.Type().Field(i).Tag.Get("yaml"), ",")[0]
+		if name == "log_level" || name == "ldap" || name == "mount" {
+			continue
+		}
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			settings = append(settings, name)
+		}
+	}
+
+	// the offline cache is opened at start, so it can be disabled in place but not enabled or moved
+	if cache, running := c.LDAP.OfflineCache, other.LDAP.OfflineCache; cache.Enabled {
+		if !running.Enabled || cache.Path != running.Path || cache.KeyFile != running.KeyFile {
+			settings = append(settings, "ldap.offline_cache")
+		}
+	}
+
+	return settings
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/nfsv3driver"
+)
+
+// configReloader is an ifrit runner that re-reads the driver configuration on SIGHUP and applies the settings that
+// can change while volumes are mounted. A configuration that fails validation is rejected as a whole and the
+// running configuration is kept.
+type configReloader struct {
+	logger     lager.Logger
+	logSink    *lager.ReconfigurableSink
+	configFile string
+	config     driverConfig
+	idResolver *nfsv3driver.ReloadableIdResolver
+	throttle   nfsv3driver.LoginThrottle
+	mounter    nfsv3driver.ReloadableMounter
+
+	offlineStore  nfsv3driver.OfflineIdentityStore
+	ldapReadiness *nfsv3driver.ReloadableReadinessCheck
+	metrics       *nfsv3driver.DriverMetrics
+}
+
+func newConfigReloader(
+	logger lager.Logger,
+	logSink *lager.ReconfigurableSink,
+	configFile string,
+	config driverConfig,
+	idResolver *nfsv3driver.ReloadableIdResolver,
+	throttle nfsv3driver.LoginThrottle,
+	offlineStore nfsv3driver.OfflineIdentityStore,
+	mounter nfsv3driver.ReloadableMounter,
+	ldapReadiness *nfsv3driver.ReloadableReadinessCheck,
+	metrics *nfsv3driver.DriverMetrics,
+) *configReloader {
+	return &configReloader{
+		logger:     logger.Session("config-reloader"),
+		logSink:    logSink,
+		configFile: configFile,
+		config:     config,
+		idResolver: idResolver,
+		throttle:   throttle,
+		mounter:    mounter,
+
+		offlineStore:  offlineStore,
+		ldapReadiness: ldapReadiness,
+		metrics:       metrics,
+	}
+}
+
+func (r *configReloader) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	close(ready)
+
+	for {
+		select {
+		case <-hup:
+			r.reload()
+		case <-signals:
+			return nil
+		}
+	}
+}
+
+func (r *configReloader) reload() {
+	logger := r.logger.Session("reload")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	config, errs := loadConfig(r.configFile)
+	if len(errs) > 0 {
+		for _, err := range errs {
+			logger.Error("invalid-config", err)
+		}
+		logger.Error("config-rejected", errors.New("keeping the running configuration"))
+		return
+	}
+
+	mask, err := nfsv3driver.NewMapFsVolumeMountMask(config.Mount.AllowedOptions...)
+	if err != nil {
+		logger.Error("config-rejected", err)
+		return
+	}
+
+	authorizer, err := config.Mount.SharePolicy.authorizer()
+	if err != nil {
+		logger.Error("config-rejected", err)
+		return
+	}
+
+	if settings := config.restartRequired(r.config); len(settings) > 0 {
+		logger.Info("restart-required", lager.Data{"settings": settings})
+	}
+
+	if config.LogLevel != "" {
+		level, _ := lager.LogLevelFromString(config.LogLevel)
+		r.logSink.SetMinLevel(level)
+	}
+	r.throttle.Reload(config.LDAP.loginThrottleConfig())
+	r.idResolver.Reload(newIdResolver(config, r.throttle, r.offlineStore, r.metrics))
+	r.mounter.Reload(mask, time.Duration(config.Mount.MapfsMountTimeout)*time.Second, authorizer, newAutomountResolver(config))
+	if r.ldapReadiness != nil {
+		r.ldapReadiness.Reload(newLdapReadinessChecks(config)...)
+	}
+
+	// settings that need a restart stay as they were, so that later reloads keep reporting them
+	offlineCache := r.config.LDAP.OfflineCache
+	r.config.LogLevel, r.config.LDAP, r.config.Mount = config.LogLevel, config.LDAP, config.Mount
+	r.config.LDAP.OfflineCache = offlineCacheConfig{
+		Enabled:     offlineCache.Enabled,
+		Path:        offlineCache.Path,
+		KeyFile:     offlineCache.KeyFile,
+		GracePeriod: config.LDAP.OfflineCache.GracePeriod,
+	}
+
+	logger.Info("config-reloaded", lager.Data{"ldap-enabled": config.LDAP.Host != "", "log-level": config.LogLevel})
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"regexp"
+
+	"code.cloudfoundry.org/goshims/bufioshim"
+	"code.cloudfoundry.org/goshims/osshim"
+	"code.cloudfoundry.org/goshims/syscallshim"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/nfsv3driver"
+	"code.cloudfoundry.org/nfsv3driver/nfscsi"
+	"code.cloudfoundry.org/volumedriver/invoker"
+	"code.cloudfoundry.org/volumedriver/mountchecker"
+	"github.com/tedsuo/ifrit"
+	"github.com/tedsuo/ifrit/grouper"
+)
+
+// version is the plugin version reported to the container orchestrator. Release builds set it with
+// -ldflags "-X main.version=...".
+var version = "dev"
+
+// runCsiNode serves the CSI identity and node services in place of the volume plugin API, mounting volumes with the
+// same mounter, LDAP settings and share policy, until the process is told to stop.
+func runCsiNode(logger lager.Logger, logSink *lager.ReconfigurableSink, config driverConfig, idResolver *nfsv3driver.ReloadableIdResolver, throttle nfsv3driver.LoginThrottle, offlineStore nfsv3driver.OfflineIdentityStore, driverMetrics *nfsv3driver.DriverMetrics) {
+	nodeID := config.CSI.NodeID
+	if nodeID == "" {
+		hostname, err := os.Hostname()
+		exitOnFailure(logger, err)
+		nodeID = hostname
+	}
+
+	processGroupInvoker := invoker.NewProcessGroupInvoker()
+	mountChecker := mountchecker.NewChecker(&bufioshim.BufioShim{}, &osshim.OsShim{})
+	mounter, kerberos := newMapfsMounter(logger, config, idResolver, processGroupInvoker, &osshim.OsShim{}, mountChecker, newKinitClient(config))
+	if kerberos != nil {
+		// the container orchestrator chooses where volumes are mounted, so any mount on the host may be one of them
+		restoreKerberos(logger, kerberos, mountChecker, regexp.MustCompile("^/"))
+	}
+
+	node := nfscsi.NewNodeServer(logger, mounter, processGroupInvoker, &osshim.OsShim{}, &syscallshim.SyscallShim{}, nodeID)
+
+	servers := grouper.Members{
+		{Name: "csi-server", Runner: nfscsi.NewServer(logger, config.CSI.Endpoint, nfscsi.NewIdentityServer(version), node)},
+		{Name: "config-reloader", Runner: newConfigReloader(logger, logSink, *configFile, config, idResolver, throttle, offlineStore, mounter, nil, driverMetrics)},
+	}
+
+	if kerberos != nil {
+		servers = append(servers, grouper.Member{Name: "kerberos-ticket-manager", Runner: kerberos})
+	}
+
+	process := ifrit.Invoke(processRunnerFor(servers))
+	logger.Info("started", lager.Data{"endpoint": config.CSI.Endpoint, "node-id": nodeID})
+
+	untilTerminated(logger, process)
+}
@@ -1,16 +1,19 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
+	"fmt"
 	"os"
 	"path/filepath"
-	"strconv"
+	"regexp"
 	"time"
 
 	"code.cloudfoundry.org/goshims/timeshim"
 
 	cf_http "code.cloudfoundry.org/cfhttp"
+	"code.cloudfoundry.org/clock"
 	cf_debug_server "code.cloudfoundry.org/debugserver"
 	"code.cloudfoundry.org/dockerdriver"
 	"code.cloudfoundry.org/dockerdriver/driverhttp"
@@ -23,8 +26,11 @@ import (
 	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/lager/lagerflags"
 	"code.cloudfoundry.org/nfsv3driver"
+	"code.cloudfoundry.org/nfsv3driver/driveradmin"
 	"code.cloudfoundry.org/nfsv3driver/driveradmin/driveradminhttp"
 	"code.cloudfoundry.org/nfsv3driver/driveradmin/driveradminlocal"
+	"code.cloudfoundry.org/nfsv3driver/metrics"
+	"code.cloudfoundry.org/nfsv3driver/nfscsi"
 	"code.cloudfoundry.org/volumedriver"
 	"code.cloudfoundry.org/volumedriver/invoker"
 	"code.cloudfoundry.org/volumedriver/mountchecker"
@@ -56,7 +62,7 @@ var driversPath = flag.String(
 var transport = flag.String(
 	"transport",
 	"tcp",
-	"Transport protocol to transmit HTTP over",
+	"Transport protocol to transmit HTTP over: tcp, tcp-json, unix, or plugin to run as a Docker managed plugin",
 )
 
 var mapfsPath = flag.String(
@@ -112,83 +118,176 @@ var insecureSkipVerify = flag.Bool(
 	"whether SSL communication should skip verification of server IP addresses in the certificate",
 )
 
-const fsType = "nfs"
-const mountOptions = "rsize=1048576,wsize=1048576,hard,timeo=600,retrans=2,actimeo=0"
+var secretsDir = flag.String(
+	"secretsDir",
+	"",
+	"Path to a directory populated by the platform with the LDAP passwords that bind options may reference, each in a file named after its username",
+)
+
+var redactKeys = flag.String(
+	"redactKeys",
+	"",
+	"comma separated list of additional option and log data keys whose values are scrubbed from log output",
+)
+
+var csiEndpoint = flag.String(
+	"csiEndpoint",
+	"unix:///var/lib/kubelet/plugins/"+nfscsi.PluginName+"/csi.sock",
+	"unix socket to serve the CSI identity and node services on, for the csi command",
+)
+
+var nodeID = flag.String(
+	"nodeId",
+	"",
+	"node id the csi command reports to the container orchestrator, defaults to the host name",
+)
 
-var (
-	ldapSvcUser  string
-	ldapSvcPass  string
-	ldapUserFqdn string
-	ldapHost     string
-	ldapPort     int
-	ldapCACert   string
-	ldapProto    string
-	ldapTimeout  int
+var configFile = flag.String(
+	"configFile",
+	"",
+	"Path to a YAML or JSON file with driver settings; its log_level, ldap and mount sections are reloaded on SIGHUP",
 )
 
+const fsType = "nfs"
+const mountOptions = "rsize=1048576,wsize=1048576,hard,timeo=600,retrans=2,actimeo=0"
+
 func main() {
 	parseCommandLine()
-	parseEnvironment()
+
+	command := flag.Arg(0)
+	_, isOperatorCommand := operatorCommands[command]
+	if command != "" && command != "csi" && !isOperatorCommand {
+		fmt.Fprintf(os.Stderr, "unknown command '%s'\n", command)
+		os.Exit(1)
+	}
+
+	config, errs := loadConfig(*configFile)
+	if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err.Error())
+		}
+		os.Exit(1)
+	}
+
+	if isOperatorCommand {
+		os.Exit(runOperatorCommand(command, flag.Args()[1:], config, os.Stdin, os.Stdout, os.Stderr))
+	}
 
 	var nfsDriverServer ifrit.Runner
-	var idResolver nfsv3driver.IdResolver
-	var mounter volumedriver.Mounter
 
-	logger, logSink := newLogger()
+	logger, logSink := newLogger(config)
 	logger.Info("start")
 	defer logger.Info("end")
 
-	if ldapHost != "" {
-		idResolver = nfsv3driver.NewLdapIdResolver(
-			ldapSvcUser,
-			ldapSvcPass,
-			ldapHost,
-			ldapPort,
-			ldapProto,
-			ldapUserFqdn,
-			ldapCACert,
-			&ldapshim.LdapShim{},
-			time.Duration(ldapTimeout)*time.Second,
-		)
+	registry := metrics.NewRegistry()
+	driverMetrics := nfsv3driver.NewDriverMetrics(registry, clock.NewClock())
+	throttle := nfsv3driver.NewLoginThrottle(&timeshim.TimeShim{}, config.LDAP.loginThrottleConfig())
+	offlineStore, err := config.LDAP.OfflineCache.store()
+	exitOnFailure(logger, err)
+	idResolver := nfsv3driver.NewReloadableIdResolver(newIdResolver(config, throttle, offlineStore, driverMetrics))
+
+	if command == "csi" {
+		runCsiNode(logger, logSink, config, idResolver, throttle, offlineStore, driverMetrics)
+		return
 	}
 
-	mask, err := nfsv3driver.NewMapFsVolumeMountMask()
-	if err != nil {
+	// every command the mounter runs is kept for the admin API; in simulation mode none of them is run
+	transcript := nfsv3driver.NewCommandTranscript(clock.NewClock(), config.Simulation.Enabled, config.MapfsPath)
+	if config.Simulation.Enabled {
+		logger.Info("simulation-mode", lager.Data{"scratch-dir": config.MountDir})
+	}
+
+	// the mount-dir readiness check only looks at the mount directory, so it is created before anything is served
+	err = os.MkdirAll(config.MountDir, os.ModePerm)
+	exitOnFailure(logger, err)
+	if config.Kerberos.Enabled {
+		err = os.MkdirAll(config.Kerberos.CcacheDir, 0700)
 		exitOnFailure(logger, err)
 	}
 
-	processGroupInvoker := invoker.NewProcessGroupInvoker()
-	mounter = nfsv3driver.NewMapfsMounter(
-		processGroupInvoker,
+	processGroupInvoker := transcript.Invoker(invoker.NewProcessGroupInvoker())
+	mountChecker := transcript.MountChecker(mountchecker.NewChecker(&bufioshim.BufioShim{}, &osshim.OsShim{}))
+	mounter, kerberos := newMapfsMounter(logger, config, idResolver, processGroupInvoker, transcript.Os(&osshim.OsShim{}), mountChecker, newTranscriptKinitClient(transcript, config))
+
+	statusTracker := nfsv3driver.NewVolumeStatusTracker(clock.NewClock(), &ioutilshim.IoutilShim{}, config.MapfsPath, config.RedactKeys)
+	mounter = nfsv3driver.NewStatusTrackingMounter(mounter, statusTracker)
+	mounter = driverMetrics.Mounter(mounter)
+
+	var revalidator *nfsv3driver.IdentityRevalidator
+	if config.Revalidation.Interval > 0 {
+		revalidator = nfsv3driver.NewIdentityRevalidator(
+			logger,
+			clock.NewClock(),
+			idResolver,
+			time.Duration(config.Revalidation.Interval)*time.Second,
+			nfsv3driver.RevalidationAction(config.Revalidation.Action),
+		)
+		mounter = nfsv3driver.NewRevalidatingMounter(mounter, revalidator)
+	}
+
+	// the configuration has been validated, so the mount records key is known to be good
+	var recorder *nfsv3driver.MountRecorder
+	if store, _ := config.MountRecords.store(); store != nil {
+		recorder = nfsv3driver.NewMountRecorder(store)
+		mounter = nfsv3driver.NewRecordingMounter(mounter, recorder)
+	}
+
+	stateIoutil := nfsv3driver.NewStateFileIoutil(
+		logger,
+		&ioutilshim.IoutilShim{},
 		&osshim.OsShim{},
 		&syscallshim.SyscallShim{},
+		clock.NewClock(),
+		filepath.Join(config.MountDir, nfsv3driver.DriverStateFileName),
+	)
+
+	reconciler := nfsv3driver.NewMountReconciler(
+		logger,
+		clock.NewClock(),
+		processGroupInvoker,
 		&ioutilshim.IoutilShim{},
-		mountchecker.NewChecker(&bufioshim.BufioShim{}, &osshim.OsShim{}),
-		fsType,
-		mountOptions,
-		idResolver,
-		mask,
-		*mapfsPath,
+		&osshim.OsShim{},
+		&syscallshim.SyscallShim{},
+		config.MountDir,
+		config.MapfsPath,
+		time.Duration(config.Reconciliation.Interval)*time.Second,
 	)
+	// the simulated mounts are not on the host, so the reconciler would release every volume
+	if !config.Simulation.Enabled {
+		reconciler.Restore(driverhttp.NewHttpDriverEnv(logger, context.TODO()), stateIoutil)
+	}
+	if kerberos != nil {
+		mountDir, err := filepath.Abs(config.MountDir)
+		exitOnFailure(logger, err)
+		restoreKerberos(logger, kerberos, mountChecker, regexp.MustCompile("^"+regexp.QuoteMeta(mountDir)+"/"))
+	}
 
 	client := volumedriver.NewVolumeDriver(
 		logger,
 		&osshim.OsShim{},
 		&filepathshim.FilepathShim{},
-		&ioutilshim.IoutilShim{},
+		stateIoutil,
 		&timeshim.TimeShim{},
-		mountchecker.NewChecker(&bufioshim.BufioShim{}, &osshim.OsShim{}),
-		*mountDir,
+		mountChecker,
+		config.MountDir,
 		mounter,
 		oshelper.NewOsHelper(),
 	)
 
-	if *transport == "tcp" {
-		nfsDriverServer = createNfsDriverServer(logger, client, *atAddress, *driversPath, false)
-	} else if *transport == "tcp-json" {
-		nfsDriverServer = createNfsDriverServer(logger, client, *atAddress, *driversPath, true)
+	var driver dockerdriver.Driver = client
+	if recorder != nil {
+		driver = nfsv3driver.NewRecordingDriver(client, recorder)
+	}
+
+	if config.Transport == "tcp" {
+		nfsDriverServer = createNfsDriverServer(logger, driver, statusTracker, config, false)
+	} else if config.Transport == "tcp-json" {
+		nfsDriverServer = createNfsDriverServer(logger, driver, statusTracker, config, true)
+	} else if config.Transport == "plugin" {
+		driver = nfsv3driver.NewDockerPluginDriver(driver, config.Plugin.Scope)
+		nfsDriverServer = createNfsDriverPluginServer(logger, driver, statusTracker, config.Plugin)
 	} else {
-		nfsDriverServer = createNfsDriverUnixServer(logger, client, *atAddress)
+		nfsDriverServer = createNfsDriverUnixServer(logger, driver, statusTracker, config.ListenAddr)
 	}
 
 	servers := grouper.Members{
@@ -202,13 +301,49 @@ func main() {
 	}
 
 	adminClient := driveradminlocal.NewDriverAdminLocal()
+	for _, check := range newReadinessChecks(config) {
+		adminClient.RegisterReadinessCheck(check)
+	}
+	ldapReadiness := nfsv3driver.NewReloadableReadinessCheck("ldap", newLdapReadinessChecks(config)...)
+	adminClient.RegisterReadinessCheck(ldapReadiness)
+	adminClient.SetMetrics(registry)
 	adminHandler, _ := driveradminhttp.NewHandler(logger, adminClient)
-	adminServer := http_server.New(*adminAddress, adminHandler)
+	adminServer := http_server.New(config.AdminAddr, adminHandler)
 
 	servers = append(grouper.Members{
 		{Name: "driveradmin", Runner: adminServer},
 	}, servers...)
 
+	servers = append(servers, grouper.Member{
+		Name:   "config-reloader",
+		Runner: newConfigReloader(logger, logSink, *configFile, config, idResolver, throttle, offlineStore, mounter, ldapReadiness, driverMetrics),
+	})
+
+	if revalidator != nil {
+		revalidator.SetVolumeUnmounter(client)
+		// only the mount records know who the volumes still mounted from before a restart were mounted for
+		if recorder != nil {
+			revalidator.TrackRestored(driverhttp.NewHttpDriverEnv(logger, context.TODO()), client, recorder)
+		}
+		adminClient.RegisterMountHealthReporter(revalidator)
+
+		servers = append(servers, grouper.Member{Name: "identity-revalidator", Runner: revalidator})
+	}
+
+	if kerberos != nil {
+		servers = append(servers, grouper.Member{Name: "kerberos-ticket-manager", Runner: kerberos})
+	}
+
+	reconciler.SetVolumeLister(client)
+	adminClient.RegisterReconciliationReporter(reconciler)
+	statusTracker.SetVolumeLister(client)
+	adminClient.RegisterVolumeStatusReporter(statusTracker)
+	driverMetrics.SetVolumeStatusReporter(statusTracker)
+	adminClient.RegisterTranscriptReporter(transcript)
+	if config.Reconciliation.Interval > 0 && !config.Simulation.Enabled {
+		servers = append(servers, grouper.Member{Name: "mount-reconciler", Runner: reconciler})
+	}
+
 	process := ifrit.Invoke(processRunnerFor(servers))
 	logger.Info("started")
 
@@ -218,6 +353,304 @@ func main() {
 	untilTerminated(logger, process)
 }
 
+// newMapfsMounter returns the mounter every command mounts volumes with, and the Kerberos ticket manager it uses, if
+// Kerberos is enabled. The mounter runs its commands with invoker, changes the file system with os, finds mounts with
+// mountChecker, and obtains tickets with kinit. The ticket manager is restored with restoreKerberos once the mounts
+// it may have tickets for are known.
+func newMapfsMounter(
+	logger lager.Logger,
+	config driverConfig,
+	idResolver nfsv3driver.IdResolver,
+	invoker invoker.Invoker,
+	os osshim.Os,
+	mountChecker mountchecker.MountChecker,
+	kinit nfsv3driver.KerberosClient,
+) (nfsv3driver.ReloadableMounter, *nfsv3driver.KerberosTicketManager) {
+	var secrets nfsv3driver.SecretStore
+	if config.SecretsDir != "" {
+		secrets = nfsv3driver.NewDirectorySecretStore(&ioutilshim.IoutilShim{}, config.SecretsDir)
+	}
+
+	mask, err := nfsv3driver.NewMapFsVolumeMountMask(config.Mount.AllowedOptions...)
+	if err != nil {
+		exitOnFailure(logger, err)
+	}
+
+	authorizer, err := config.Mount.SharePolicy.authorizer()
+	if err != nil {
+		exitOnFailure(logger, err)
+	}
+
+	var tokens nfsv3driver.TokenVerifier
+	if keyFile := config.Token.keyFile(); keyFile != "" {
+		tokens = nfsv3driver.NewJwtTokenVerifier(
+			nfsv3driver.NewFileTokenKeySource(&ioutilshim.IoutilShim{}, keyFile),
+			config.Token.Audience,
+			config.Token.Issuer,
+			&timeshim.TimeShim{},
+		)
+	}
+
+	var kerberos *nfsv3driver.KerberosTicketManager
+	var kerberosCredentials nfsv3driver.KerberosCredentials
+	if config.Kerberos.Enabled {
+		kerberos = nfsv3driver.NewKerberosTicketManager(
+			logger,
+			clock.NewClock(),
+			kinit,
+			os,
+			config.Kerberos.CcacheDir,
+			config.Kerberos.Realm,
+			time.Duration(config.Kerberos.RenewInterval)*time.Second,
+		)
+		kerberosCredentials = kerberos
+	}
+
+	mounter := nfsv3driver.NewMapfsMounter(
+		invoker,
+		os,
+		&syscallshim.SyscallShim{},
+		&ioutilshim.IoutilShim{},
+		mountChecker,
+		fsType,
+		mountOptions,
+		idResolver,
+		mask,
+		config.MapfsPath,
+		secrets,
+		authorizer,
+		tokens,
+		kerberosCredentials,
+	)
+	mounter.Reload(mask, time.Duration(config.Mount.MapfsMountTimeout)*time.Second, authorizer, newAutomountResolver(config))
+
+	// the redact_keys are scrubbed from the mounter's logs, and the id resolver's it calls, whichever logger it is
+	// called with
+	return nfsv3driver.NewRedactingMounter(mounter, config.RedactKeys), kerberos
+}
+
+// restoreKerberos takes over the credential caches of the volumes that are mounted on the mount points that match
+// pattern, and destroys the caches of the others.
+func restoreKerberos(logger lager.Logger, kerberos *nfsv3driver.KerberosTicketManager, mountChecker mountchecker.MountChecker, pattern *regexp.Regexp) {
+	mountPoints, err := mountChecker.List(pattern)
+	exitOnFailure(logger, err)
+
+	kerberos.Restore(driverhttp.NewHttpDriverEnv(logger, context.TODO()), mountPoints)
+}
+
+func newKinitClient(config driverConfig) nfsv3driver.KerberosClient {
+	return nfsv3driver.NewKinitClient(
+		config.Kerberos.KinitPath,
+		config.Kerberos.KdestroyPath,
+		time.Duration(config.Kerberos.RenewableLifetime)*time.Second,
+	)
+}
+
+// newTranscriptKinitClient returns the kinit client, recording the commands it runs in transcript.
+func newTranscriptKinitClient(transcript *nfsv3driver.CommandTranscript, config driverConfig) nfsv3driver.KerberosClient {
+	return transcript.KerberosClient(
+		newKinitClient(config),
+		config.Kerberos.KinitPath,
+		config.Kerberos.KdestroyPath,
+		time.Duration(config.Kerberos.RenewableLifetime)*time.Second,
+	)
+}
+
+// newIdResolver returns the resolver for the sources in config, or nil if there are none. Without configured sources
+// the LDAP directories are the only one. Failed logins against them are counted by throttle, which outlives the
+// resolver so that reloading the configuration does not reset it, and each directory it asks is timed by
+// driverMetrics, unless that is nil. Users are remembered in offlineStore, unless that is nil or the offline cache
+// has since been disabled; like throttle it is opened once, so that the resolvers of successive configurations
+// share one cache.
+func newIdResolver(config driverConfig, throttle nfsv3driver.LoginThrottle, offlineStore nfsv3driver.OfflineIdentityStore, driverMetrics *nfsv3driver.DriverMetrics) nfsv3driver.IdResolver {
+	// the configuration has been validated, so the id mapping settings are known to be good
+	idMapper, _ := config.LDAP.IdMapping.mapper()
+
+	sources := config.LDAP.Sources
+	if len(sources) == 0 {
+		if config.LDAP.Host == "" && len(config.LDAP.Domains) == 0 {
+			return nil
+		}
+		sources = []idSourceConfig{{Name: "ldap", Type: "ldap"}}
+	}
+
+	var chain []nfsv3driver.IdResolverSource
+	for _, source := range sources {
+		var resolver nfsv3driver.IdResolver
+		switch source.Type {
+		case "local":
+			var users []nfsv3driver.LocalUser
+			for _, user := range source.Users {
+				users = append(users, user.localUser())
+			}
+			resolver = nfsv3driver.NewLocalIdResolver(users...)
+		case "ldap":
+			if source.Directory == "" {
+				resolver = newDirectoriesIdResolver(config.LDAP, idMapper, throttle, driverMetrics)
+			} else {
+				// the configuration has been validated, so the directory is known to be configured
+				directory, _ := config.LDAP.directory(source.Directory)
+				resolver = newLdapIdResolver(config.LDAP, directory, idMapper, throttle, driverMetrics)
+			}
+		}
+		chain = append(chain, nfsv3driver.IdResolverSource{Name: source.Name, Resolver: resolver})
+	}
+
+	resolver := nfsv3driver.NewChainedIdResolver(chain...)
+
+	if offlineStore != nil && config.LDAP.OfflineCache.Enabled {
+		resolver = nfsv3driver.NewOfflineIdResolver(
+			resolver,
+			offlineStore,
+			clock.NewClock(),
+			time.Duration(config.LDAP.OfflineCache.GracePeriod)*time.Second,
+			throttle,
+		)
+	}
+
+	return nfsv3driver.NewRedactingIdResolver(resolver, config.RedactKeys)
+}
+
+// newDirectoriesIdResolver returns a resolver for every configured LDAP directory, routing usernames that name a
+// domain to its directory and the rest to the top level one. When there are several directories, each counts failed
+// logins against throttle by the account names of its own domain.
+func newDirectoriesIdResolver(config ldapConfig, idMapper nfsv3driver.IdMapper, throttle nfsv3driver.LoginThrottle, driverMetrics *nfsv3driver.DriverMetrics) nfsv3driver.IdResolver {
+	if len(config.Domains) == 0 {
+		if config.Host == "" {
+			return nil
+		}
+		return newLdapIdResolver(config, config.defaultDomain(), idMapper, throttle, driverMetrics)
+	}
+
+	var resolver nfsv3driver.IdResolver
+	if config.Host != "" {
+		resolver = newLdapIdResolver(config, config.defaultDomain(), idMapper, domainThrottle(throttle, config.Domain, config.NetbiosName), driverMetrics)
+	}
+
+	var domains []nfsv3driver.IdResolverDomain
+	if resolver != nil {
+		domains = append(domains, nfsv3driver.IdResolverDomain{
+			Names:    []string{config.Domain, config.NetbiosName},
+			Resolver: resolver,
+		})
+	}
+	for _, domain := range config.Domains {
+		domains = append(domains, nfsv3driver.IdResolverDomain{
+			Names:    []string{domain.Name, domain.NetbiosName},
+			Resolver: newLdapIdResolver(config, domain, idMapper, domainThrottle(throttle, domain.Name, domain.NetbiosName), driverMetrics),
+		})
+	}
+
+	return nfsv3driver.NewDomainIdResolver(resolver, domains...)
+}
+
+// domainThrottle returns the view of throttle for the directory of the domain with the given name, or NetBIOS name
+// if it has none.
+func domainThrottle(throttle nfsv3driver.LoginThrottle, name, netbiosName string) nfsv3driver.LoginThrottle {
+	if throttle == nil {
+		return nil
+	}
+	if name == "" {
+		name = netbiosName
+	}
+	return nfsv3driver.NewDomainLoginThrottle(throttle, name)
+}
+
+func newAutomountResolver(config driverConfig) nfsv3driver.AutomountResolver {
+	if config.LDAP.AutomountMapDN == "" {
+		return nil
+	}
+
+	domain := config.LDAP.defaultDomain()
+	return nfsv3driver.NewLdapAutomountResolver(
+		domain.SvcUser,
+		domain.svcPassCredential(),
+		domain.Hosts,
+		domain.Port,
+		domain.Proto,
+		domain.CACert,
+		&ldapshim.LdapShim{},
+		time.Duration(config.LDAP.Timeout)*time.Second,
+		config.LDAP.AutomountMapDN,
+	)
+}
+
+func newLdapIdResolver(config ldapConfig, domain ldapDomainConfig, idMapper nfsv3driver.IdMapper, throttle nfsv3driver.LoginThrottle, driverMetrics *nfsv3driver.DriverMetrics) nfsv3driver.IdResolver {
+	resolver := nfsv3driver.NewLdapIdResolver(
+		domain.SvcUser,
+		domain.svcPassCredential(),
+		domain.Hosts,
+		domain.Port,
+		domain.Proto,
+		domain.UserFqdn,
+		domain.Filter,
+		domain.CACert,
+		&ldapshim.LdapShim{},
+		time.Duration(config.Timeout)*time.Second,
+		throttle,
+		uint32(config.PageSize),
+		config.MaxReferralHops,
+		idMapper,
+	)
+	if driverMetrics != nil {
+		resolver = driverMetrics.IdResolver(resolver)
+	}
+	return resolver
+}
+
+// newReadinessChecks returns the checks /ready runs on the host. In simulation mode nothing is mounted, so mapfs,
+// FUSE and the NFS mount helper are not needed.
+func newReadinessChecks(config driverConfig) []driveradmin.ReadinessCheck {
+	var checks []driveradmin.ReadinessCheck
+	if !config.Simulation.Enabled {
+		checks = append(checks,
+			nfsv3driver.NewMapfsReadinessCheck(invoker.NewProcessGroupInvoker(), &osshim.OsShim{}, config.MapfsPath),
+			nfsv3driver.NewFuseReadinessCheck(&osshim.OsShim{}),
+			nfsv3driver.NewMountNfsReadinessCheck(&osshim.OsShim{}),
+		)
+	}
+	checks = append(checks, nfsv3driver.NewMountDirReadinessCheck(&osshim.OsShim{}, config.MountDir))
+
+	// the unix and plugin transports are found by their sockets rather than by a spec file
+	switch config.Transport {
+	case "tcp":
+		checks = append(checks, nfsv3driver.NewSpecFileReadinessCheck(&osshim.OsShim{}, filepath.Join(config.DriversPath, "nfsv3driver.spec")))
+	case "tcp-json":
+		checks = append(checks, nfsv3driver.NewSpecFileReadinessCheck(&osshim.OsShim{}, filepath.Join(config.DriversPath, "nfsv3driver.json")))
+	}
+
+	return checks
+}
+
+// newLdapReadinessChecks returns a check that the service account of each configured directory can bind.
+func newLdapReadinessChecks(config driverConfig) []driveradmin.ReadinessCheck {
+	domains := config.LDAP.Domains
+	if config.LDAP.Host != "" {
+		domains = append([]ldapDomainConfig{config.LDAP.defaultDomain()}, domains...)
+	}
+
+	var checks []driveradmin.ReadinessCheck
+	for _, domain := range domains {
+		name := domain.Name
+		if name == "" {
+			name = domain.Hosts[0]
+		}
+
+		checks = append(checks, nfsv3driver.NewLdapReadinessCheck(
+			name,
+			domain.SvcUser,
+			domain.svcPassCredential(),
+			domain.Hosts,
+			domain.Port,
+			domain.Proto,
+			domain.CACert,
+			&ldapshim.LdapShim{},
+			time.Duration(config.LDAP.Timeout)*time.Second,
+		))
+	}
+	return checks
+}
+
 func exitOnFailure(logger lager.Logger, err error) {
 	if err != nil {
 		logger.Fatal("fatal-err-aborting", err)
@@ -233,20 +666,21 @@ func processRunnerFor(servers grouper.Members) ifrit.Runner {
 	return sigmon.New(grouper.NewOrdered(os.Interrupt, servers))
 }
 
-func createNfsDriverServer(logger lager.Logger, client dockerdriver.Driver, atAddress, driversPath string, jsonSpec bool) ifrit.Runner {
+func createNfsDriverServer(logger lager.Logger, client dockerdriver.Driver, statuses driveradmin.VolumeStatusReporter, config driverConfig, jsonSpec bool) ifrit.Runner {
+	atAddress, driversPath := config.ListenAddr, config.DriversPath
 	advertisedUrl := "http://" + atAddress
 	logger.Info("writing-spec-file", lager.Data{"location": driversPath, "name": "nfsv3driver", "address": advertisedUrl})
 	if jsonSpec {
 		driverJsonSpec := dockerdriver.DriverSpec{Name: "nfsv3driver", Address: advertisedUrl, UniqueVolumeIds: true}
 
-		if *requireSSL {
-			absCaFile, err := filepath.Abs(*caFile)
+		if config.RequireSSL {
+			absCaFile, err := filepath.Abs(config.CAFile)
 			exitOnFailure(logger, err)
-			absClientCertFile, err := filepath.Abs(*clientCertFile)
+			absClientCertFile, err := filepath.Abs(config.ClientCertFile)
 			exitOnFailure(logger, err)
-			absClientKeyFile, err := filepath.Abs(*clientKeyFile)
+			absClientKeyFile, err := filepath.Abs(config.ClientKeyFile)
 			exitOnFailure(logger, err)
-			driverJsonSpec.TLSConfig = &dockerdriver.TLSConfig{InsecureSkipVerify: *insecureSkipVerify, CAFile: absCaFile, CertFile: absClientCertFile, KeyFile: absClientKeyFile}
+			driverJsonSpec.TLSConfig = &dockerdriver.TLSConfig{InsecureSkipVerify: config.InsecureSkipVerify, CAFile: absCaFile, CertFile: absClientCertFile, KeyFile: absClientKeyFile}
 			driverJsonSpec.Address = "https://" + atAddress
 		}
 
@@ -263,10 +697,11 @@ func createNfsDriverServer(logger lager.Logger, client dockerdriver.Driver, atAd
 	handler, err := driverhttp.NewHandler(logger, client)
 
 	exitOnFailure(logger, err)
+	handler = nfsv3driver.NewVolumeStatusHandler(logger, handler, client, statuses)
 
 	var server ifrit.Runner
-	if *requireSSL {
-		tlsConfig, err := cf_http.NewTLSConfig(*certFile, *keyFile, *caFile)
+	if config.RequireSSL {
+		tlsConfig, err := cf_http.NewTLSConfig(config.CertFile, config.KeyFile, config.CAFile)
 		if err != nil {
 			logger.Fatal("tls-configuration-failed", err)
 		}
@@ -278,17 +713,41 @@ func createNfsDriverServer(logger lager.Logger, client dockerdriver.Driver, atAd
 	return server
 }
 
-func createNfsDriverUnixServer(logger lager.Logger, client dockerdriver.Driver, atAddress string) ifrit.Runner {
+func createNfsDriverUnixServer(logger lager.Logger, client dockerdriver.Driver, statuses driveradmin.VolumeStatusReporter, atAddress string) ifrit.Runner {
 	handler, err := driverhttp.NewHandler(logger, client)
 	exitOnFailure(logger, err)
+	handler = nfsv3driver.NewVolumeStatusHandler(logger, handler, client, statuses)
 	return http_server.NewUnixServer(atAddress, handler)
 }
 
-func newLogger() (lager.Logger, *lager.ReconfigurableSink) {
+// createNfsDriverPluginServer serves the driver on the socket the Docker daemon looks for a managed plugin on. The
+// daemon finds the plugin by its manifest, so no spec file is written.
+func createNfsDriverPluginServer(logger lager.Logger, client dockerdriver.Driver, statuses driveradmin.VolumeStatusReporter, config pluginConfig) ifrit.Runner {
+	socketPath := config.socketPath()
+	logger.Info("serving-plugin-socket", lager.Data{"socket": socketPath, "scope": config.Scope})
+
+	err := os.MkdirAll(config.SocketDir, 0755)
+	exitOnFailure(logger, err)
+
+	// a socket left behind by a plugin that did not shut down cleanly would keep the server from listening
+	err = os.Remove(socketPath)
+	if err != nil && !os.IsNotExist(err) {
+		exitOnFailure(logger, err)
+	}
+
+	return createNfsDriverUnixServer(logger, client, statuses, socketPath)
+}
+
+func newLogger(config driverConfig) (lager.Logger, *lager.ReconfigurableSink) {
 	lagerConfig := lagerflags.ConfigFromFlags()
 	lagerConfig.RedactSecrets = true
+	if config.LogLevel != "" {
+		lagerConfig.LogLevel = config.LogLevel
+	}
+
+	logger, logSink := lagerflags.NewFromConfig("nfs-driver-server", lagerConfig)
 
-	return lagerflags.NewFromConfig("nfs-driver-server", lagerConfig)
+	return nfsv3driver.NewRedactingLogger(logger, config.RedactKeys), logSink
 }
 
 func parseCommandLine() {
@@ -296,33 +755,3 @@ func parseCommandLine() {
 	cf_debug_server.AddFlags(flag.CommandLine)
 	flag.Parse()
 }
-
-func parseEnvironment() {
-	ldapSvcUser, _ = os.LookupEnv("LDAP_SVC_USER")
-	ldapSvcPass, _ = os.LookupEnv("LDAP_SVC_PASS")
-	ldapUserFqdn, _ = os.LookupEnv("LDAP_USER_FQDN")
-	ldapHost, _ = os.LookupEnv("LDAP_HOST")
-	port, _ := os.LookupEnv("LDAP_PORT")
-	ldapPort, _ = strconv.Atoi(port)
-	ldapCACert, _ = os.LookupEnv("LDAP_CA_CERT")
-	ldapProto, _ = os.LookupEnv("LDAP_PROTO")
-	timeout, _ := os.LookupEnv("LDAP_TIMEOUT")
-	ldapTimeout, _ = strconv.Atoi(timeout)
-
-	if ldapProto == "" {
-		ldapProto = "tcp"
-	}
-
-	if ldapHost != "" && (ldapSvcUser == "" || ldapSvcPass == "" || ldapUserFqdn == "" || ldapPort == 0) {
-		panic("LDAP is enabled but required LDAP parameters are not set.")
-	}
-
-	if ldapTimeout < 0 {
-		panic("LDAP_TIMEOUT is set to negtive value")
-	}
-
-	// if ldapTimeout is not set, use default value
-	if ldapTimeout == 0 {
-		ldapTimeout = 120
-	}
-}
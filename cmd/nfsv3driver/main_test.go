@@ -1,12 +1,17 @@
 package main_test
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"github.com/onsi/gomega/gbytes"
 	"io/ioutil"
 	"net"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"syscall"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -197,5 +202,642 @@ var _ = Describe("Main", func() {
 				}, 5).ShouldNot(HaveOccurred())
 			})
 		})
+
+		Context("given a config file", func() {
+			var configFile string
+
+			BeforeEach(func() {
+				configFile = filepath.Join(dir, "config.yml")
+				Expect(ioutil.WriteFile(configFile, []byte(`
+listen_addr: 0.0.0.0:7597
+admin_addr: 0.0.0.0:7598
+log_level: info
+mount:
+  allowed_options: [uid, gid, readonly]
+  mapfs_mount_timeout: 30
+  share_policy:
+    unmatched: deny
+    shares:
+    - export: filer:/finance
+      groups: [Finance]
+revalidation:
+  interval: 300
+  action: flag
+`), 0600)).To(Succeed())
+
+				command.Args = append(command.Args, "-configFile="+configFile)
+			})
+
+			It("listens on the configured addresses", func() {
+				EventuallyWithOffset(1, func() error {
+					_, err := net.Dial("tcp", "0.0.0.0:7597")
+					return err
+				}, 5).ShouldNot(HaveOccurred())
+			})
+
+			It("reports unhealthy mounts on the admin address", func() {
+				var resp *http.Response
+				Eventually(func() error {
+					var err error
+					resp, err = http.Get("http://127.0.0.1:7598/mounts/unhealthy")
+					return err
+				}, 5).ShouldNot(HaveOccurred())
+				defer resp.Body.Close()
+
+				body, err := ioutil.ReadAll(resp.Body)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+				Expect(body).To(MatchJSON(`{"Mounts":[],"Err":""}`))
+			})
+
+			Context("when the driver receives SIGHUP", func() {
+				It("reloads the config file", func() {
+					Expect(ioutil.WriteFile(configFile, []byte(`
+listen_addr: 0.0.0.0:7599
+admin_addr: 0.0.0.0:7598
+log_level: debug
+`), 0600)).To(Succeed())
+
+					session.Signal(syscall.SIGHUP)
+
+					Eventually(session.Out).Should(gbytes.Say("restart-required.*listen_addr"))
+					Eventually(session.Out).Should(gbytes.Say("config-reloaded"))
+				})
+
+				It("reports that enabling the offline cache needs a restart", func() {
+					keyFile := filepath.Join(dir, "offline-cache.key")
+					Expect(ioutil.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString(make([]byte, 32))), 0600)).To(Succeed())
+					Expect(ioutil.WriteFile(configFile, []byte(`
+listen_addr: 0.0.0.0:7597
+admin_addr: 0.0.0.0:7598
+ldap:
+  offline_cache:
+    enabled: true
+    path: `+filepath.Join(dir, "offline-cache")+`
+    key_file: `+keyFile+`
+    grace_period: 3600
+`), 0600)).To(Succeed())
+
+					session.Signal(syscall.SIGHUP)
+
+					Eventually(session.Out).Should(gbytes.Say("restart-required.*ldap.offline_cache"))
+					Eventually(session.Out).Should(gbytes.Say("config-reloaded"))
+				})
+
+				It("keeps the running config when the new one is invalid", func() {
+					Expect(ioutil.WriteFile(configFile, []byte(`
+log_level: verbose
+`), 0600)).To(Succeed())
+
+					session.Signal(syscall.SIGHUP)
+
+					Eventually(session.Out).Should(gbytes.Say("log_level must be one of"))
+					Eventually(session.Out).Should(gbytes.Say("config-rejected"))
+					Consistently(session).ShouldNot(gexec.Exit())
+				})
+			})
+
+			Context("when the config file is invalid", func() {
+				BeforeEach(func() {
+					Expect(ioutil.WriteFile(configFile, []byte(`
+listen_addr: 0.0.0.0:7597
+transport: carrier-pigeon
+ldap:
+  automount_map_dn: automountMapName=auto.home,dc=corp
+  offline_cache:
+    enabled: true
+    path: offline-cache
+    key_file: /no/such/key
+  id_mapping:
+    enabled: true
+    range_size: 0
+  sources:
+  - name: corp
+    type: ldap
+    directory: emea
+  - name: corp
+    type: local
+mount:
+  allowed_options: [uid, gid, nolock]
+  share_policy:
+    shares:
+    - export: filer:/finance
+revalidation:
+  action: delete
+token:
+  issuer: https://uaa.example.com
+kerberos:
+  enabled: true
+  ccache_dir: tmp
+reconciliation:
+  interval: -1
+mount_records:
+  enabled: true
+  path: records
+  key_file: /no/such/key
+csi:
+  endpoint: unix://csi.sock
+plugin:
+  name: nfs/v3
+  socket_dir: run/docker/plugins
+  scope: cluster
+simulation:
+  enabled: true
+  scratch_dir: scratch
+`), 0600)).To(Succeed())
+					expectedStartOutput = ""
+					expectedStartErrOutput = "transport must be one of"
+				})
+
+				It("reports every problem and fails to start", func() {
+					Eventually(session.Err).Should(gbytes.Say("ldap.offline_cache.path must be an absolute path, got 'offline-cache'"))
+					Eventually(session.Err).Should(gbytes.Say("ldap.offline_cache: open /no/such/key: no such file or directory"))
+					Eventually(session.Err).Should(gbytes.Say("ldap.automount_map_dn requires ldap.host to be set"))
+					Eventually(session.Err).Should(gbytes.Say("ldap.id_mapping: id mapping range is empty"))
+					Eventually(session.Err).Should(gbytes.Say(`ldap.sources\[0\]: directory 'emea' is not configured`))
+					Eventually(session.Err).Should(gbytes.Say(`ldap.sources\[1\]: source name 'corp' is configured more than once`))
+					Eventually(session.Err).Should(gbytes.Say(`ldap.sources\[1\]: a local source must have users`))
+					Eventually(session.Err).Should(gbytes.Say("unknown option 'nolock'"))
+					Eventually(session.Err).Should(gbytes.Say("mount.share_policy: rule 0: no groups are allowed to mount 'filer:/finance'"))
+					Eventually(session.Err).Should(gbytes.Say("revalidation.action must be one of 'log', 'flag' or 'unmount', got 'delete'"))
+					Eventually(session.Err).Should(gbytes.Say("token.audience and token.issuer require token.public_key_file or token.jwks_file"))
+					Eventually(session.Err).Should(gbytes.Say("kerberos.ccache_dir must be an absolute path, got 'tmp'"))
+					Eventually(session.Err).Should(gbytes.Say("reconciliation.interval must not be negative, got -1"))
+					Eventually(session.Err).Should(gbytes.Say("mount_records.path must be an absolute path, got 'records'"))
+					Eventually(session.Err).Should(gbytes.Say("mount_records: open /no/such/key: no such file or directory"))
+					Eventually(session.Err).Should(gbytes.Say("csi.endpoint must be an absolute path or unix:// URL, got 'unix://csi.sock'"))
+					Eventually(session.Err).Should(gbytes.Say("plugin.name must be set and must not contain '/' or ':', got 'nfs/v3'"))
+					Eventually(session.Err).Should(gbytes.Say("plugin.socket_dir must be an absolute path, got 'run/docker/plugins'"))
+					Eventually(session.Err).Should(gbytes.Say("plugin.scope must be one of 'local' or 'global', got 'cluster'"))
+					Eventually(session.Err).Should(gbytes.Say("simulation.scratch_dir must be an absolute path, got 'scratch'"))
+					Eventually(session).Should(gexec.Exit(1))
+				})
+			})
+
+			Context("when the config file has LDAP domains", func() {
+				BeforeEach(func() {
+					Expect(ioutil.WriteFile(configFile, []byte(`
+listen_addr: 0.0.0.0:7597
+admin_addr: 0.0.0.0:7598
+ldap:
+  domains:
+  - name: emea.corp
+    netbios_name: EMEA
+    hosts: [dc1.emea.corp, dc2.emea.corp]
+    port: 389
+    user_fqdn: cn=Users,dc=emea,dc=corp
+    svc_user: svc
+    svc_pass: pw
+    filter: (&(objectClass=User)(sAMAccountName=%s))
+`), 0600)).To(Succeed())
+				})
+
+				It("starts", func() {
+					EventuallyWithOffset(1, func() error {
+						_, err := net.Dial("tcp", "0.0.0.0:7597")
+						return err
+					}, 5).ShouldNot(HaveOccurred())
+				})
+
+				Context("when a domain is incomplete", func() {
+					BeforeEach(func() {
+						Expect(ioutil.WriteFile(configFile, []byte(`
+ldap:
+  domains:
+  - netbios_name: EMEA
+    port: 389
+`), 0600)).To(Succeed())
+						expectedStartOutput = ""
+						expectedStartErrOutput = `ldap.domains\[0\]: required LDAP parameters are not set: hosts, svc_user`
+					})
+
+					It("fails to start", func() {
+						Eventually(session).Should(gexec.Exit(1))
+					})
+				})
+			})
+
+			Context("when the config file has unknown settings", func() {
+				BeforeEach(func() {
+					Expect(ioutil.WriteFile(configFile, []byte(`
+listen_adr: 0.0.0.0:7597
+`), 0600)).To(Succeed())
+					expectedStartOutput = ""
+					expectedStartErrOutput = "field listen_adr not found"
+				})
+
+				It("fails to start", func() {
+					Eventually(session).Should(gexec.Exit(1))
+				})
+			})
+		})
+	})
+
+	Context("with the plugin transport", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "plugin")
+			Expect(err).ToNot(HaveOccurred())
+
+			configFile := filepath.Join(dir, "config.yml")
+			Expect(ioutil.WriteFile(configFile, []byte(`
+plugin:
+  socket_dir: `+dir+`
+`), 0600)).To(Succeed())
+
+			Expect(os.Setenv("PLUGIN_SCOPE", "global")).To(Succeed())
+
+			command.Args = append(command.Args, "-transport=plugin", "-configFile="+configFile)
+		})
+
+		AfterEach(func() {
+			Expect(os.Unsetenv("PLUGIN_SCOPE")).To(Succeed())
+			Expect(os.RemoveAll(dir)).To(Succeed())
+		})
+
+		It("serves the volume plugin API on the plugin's socket", func() {
+			client := &http.Client{
+				Transport: &http.Transport{
+					Dial: func(string, string) (net.Conn, error) {
+						return net.Dial("unix", filepath.Join(dir, "nfsv3driver.sock"))
+					},
+				},
+			}
+
+			var resp *http.Response
+			Eventually(func() error {
+				var err error
+				resp, err = client.Post("http://plugin/VolumeDriver.Capabilities", "application/json", nil)
+				return err
+			}, 5).ShouldNot(HaveOccurred())
+			defer resp.Body.Close()
+
+			body, err := ioutil.ReadAll(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(body).To(MatchJSON(`{"Capabilities":{"Scope":"global"}}`))
+		})
+
+		It("matches the manifest the plugin is shipped with", func() {
+			contents, err := ioutil.ReadFile(filepath.Join("..", "..", "docker-plugin", "config.json"))
+			Expect(err).NotTo(HaveOccurred())
+
+			var manifest struct {
+				Entrypoint []string
+				Interface  struct {
+					Socket string
+				}
+				PropagatedMount string
+				Env             []struct {
+					Name string
+				}
+			}
+			Expect(json.Unmarshal(contents, &manifest)).To(Succeed())
+
+			Expect(manifest.Entrypoint).To(ContainElement("-transport=plugin"))
+			Expect(manifest.Entrypoint).To(ContainElement("-mountDir=" + manifest.PropagatedMount))
+			Expect(manifest.Interface.Socket).To(Equal("nfsv3driver.sock"))
+			for _, env := range manifest.Env {
+				Expect(env.Name).To(MatchRegexp("^(LDAP|MOUNT|PLUGIN)_"))
+			}
+		})
+	})
+
+	Context("in simulation mode", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "simulation")
+			Expect(err).ToNot(HaveOccurred())
+
+			configFile := filepath.Join(dir, "config.yml")
+			Expect(ioutil.WriteFile(configFile, []byte(`
+listen_addr: 0.0.0.0:7600
+admin_addr: 0.0.0.0:7601
+transport: tcp-json
+mapfs_path: /bin/mapfs
+simulation:
+  enabled: true
+  scratch_dir: `+filepath.Join(dir, "volumes")+`
+`), 0600)).To(Succeed())
+
+			command.Args = append(command.Args, "-driversPath="+dir, "-configFile="+configFile)
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(dir)).To(Succeed())
+		})
+
+		It("is ready without mapfs, FUSE or the NFS mount helper", func() {
+			var resp *http.Response
+			Eventually(func() error {
+				var err error
+				resp, err = http.Get("http://127.0.0.1:7601/ready")
+				return err
+			}, 5).ShouldNot(HaveOccurred())
+			defer resp.Body.Close()
+
+			var ready struct {
+				Ready  bool
+				Checks []struct {
+					Name  string
+					Ready bool
+				}
+			}
+			Expect(json.NewDecoder(resp.Body).Decode(&ready)).To(Succeed())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(ready.Ready).To(BeTrue())
+
+			var names []string
+			for _, check := range ready.Checks {
+				names = append(names, check.Name)
+			}
+			Expect(names).To(Equal([]string{"mount-dir", "spec-file", "ldap"}))
+		})
+
+		It("mounts volumes in the scratch directory and reports the commands it would have run", func() {
+			post := func(path, body string) map[string]interface{} {
+				var resp *http.Response
+				Eventually(func() error {
+					var err error
+					resp, err = http.Post("http://127.0.0.1:7600"+path, "application/json", strings.NewReader(body))
+					return err
+				}, 5).ShouldNot(HaveOccurred())
+				defer resp.Body.Close()
+
+				var response map[string]interface{}
+				Expect(json.NewDecoder(resp.Body).Decode(&response)).To(Succeed())
+				return response
+			}
+
+			Expect(post("/VolumeDriver.Create", `{"Name":"vol1","Opts":{"source":"nfs://filer/export","uid":"1000","gid":"1001"}}`)).To(HaveKeyWithValue("Err", ""))
+
+			mountpoint := filepath.Join(dir, "volumes", "vol1")
+			response := post("/VolumeDriver.Mount", `{"Name":"vol1","ID":"container-1"}`)
+			Expect(response).To(HaveKeyWithValue("Err", ""))
+			Expect(response).To(HaveKeyWithValue("Mountpoint", mountpoint))
+
+			resp, err := http.Get("http://127.0.0.1:7601/transcript")
+			Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close()
+
+			var transcript struct {
+				Entries []struct {
+					Command []string
+					Err     string
+				}
+				Err string
+			}
+			Expect(json.NewDecoder(resp.Body).Decode(&transcript)).To(Succeed())
+
+			var commands [][]string
+			for _, entry := range transcript.Entries {
+				Expect(entry.Err).To(BeEmpty())
+				commands = append(commands, entry.Command)
+			}
+			Expect(commands).To(ContainElement([]string{"mount", "-t", "nfs", "-o", "rsize=1048576,wsize=1048576,hard,timeo=600,retrans=2,actimeo=0", "filer:/export", mountpoint + "_mapfs"}))
+			Expect(commands).To(ContainElement([]string{"/bin/mapfs", "-uid", "1000", "-gid", "1001", "-auto_cache", mountpoint, mountpoint + "_mapfs"}))
+
+			resp, err = http.Get("http://127.0.0.1:7601/metrics")
+			Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.Header.Get("Content-Type")).To(HavePrefix("text/plain"))
+
+			metrics, err := ioutil.ReadAll(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(metrics)).To(ContainSubstring(`nfsv3driver_mounts_total{result="success",server="filer"} 1`))
+			Expect(string(metrics)).To(ContainSubstring("nfsv3driver_volumes 1\n"))
+			Expect(string(metrics)).To(ContainSubstring(`nfsv3driver_active_volumes{health="healthy"} 1`))
+
+			Expect(post("/VolumeDriver.Unmount", `{"Name":"vol1","ID":"container-1"}`)).To(HaveKeyWithValue("Err", ""))
+			Expect(post("/VolumeDriver.Remove", `{"Name":"vol1"}`)).To(HaveKeyWithValue("Err", ""))
+			Expect(mountpoint).NotTo(BeADirectory())
+
+			resp, err = http.Get("http://127.0.0.1:7601/transcript")
+			Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(json.NewDecoder(resp.Body).Decode(&transcript)).To(Succeed())
+
+			commands = nil
+			for _, entry := range transcript.Entries {
+				Expect(entry.Err).To(BeEmpty())
+				commands = append(commands, entry.Command)
+			}
+			Expect(commands).To(ContainElement([]string{"umount", "-l", mountpoint}))
+			Expect(commands).To(ContainElement([]string{"umount", "-l", mountpoint + "_mapfs"}))
+		})
+	})
+
+	Context("with the csi command", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "csi")
+			Expect(err).ToNot(HaveOccurred())
+
+			command.Args = append(command.Args, "-csiEndpoint=unix://"+filepath.Join(dir, "csi.sock"), "-nodeId=node-1", "csi")
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(dir)).To(Succeed())
+		})
+
+		It("serves the CSI services on the socket", func() {
+			Eventually(session.Out).Should(gbytes.Say(`"node-id":"node-1"`))
+			EventuallyWithOffset(1, func() error {
+				_, err := net.Dial("unix", filepath.Join(dir, "csi.sock"))
+				return err
+			}, 5).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Context("with an operator command", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "operator")
+			Expect(err).ToNot(HaveOccurred())
+
+			expectedStartOutput = ""
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(dir)).To(Succeed())
+		})
+
+		Context("when mounting in a dry run", func() {
+			BeforeEach(func() {
+				command.Args = append(command.Args, "-mapfsPath=/bin/mapfs", "mount", "--dry-run", "--json", "filer:/export", filepath.Join(dir, "vol"), "uid=1000", "gid=1001", "readonly")
+			})
+
+			It("reports the commands that would mount the volume without running them", func() {
+				Eventually(session).Should(gexec.Exit(0))
+
+				var report struct {
+					Command  string
+					DryRun   bool `json:"dry_run"`
+					Commands []struct {
+						Args []string
+					}
+					Result map[string]string
+				}
+				Expect(json.Unmarshal(session.Out.Contents(), &report)).To(Succeed())
+
+				target := filepath.Join(dir, "vol")
+				Expect(report.Command).To(Equal("mount"))
+				Expect(report.DryRun).To(BeTrue())
+				Expect(report.Commands).To(HaveLen(4))
+				Expect(report.Commands[0].Args).To(Equal([]string{"mkdir", "-p", "-m", "777", target}))
+				Expect(report.Commands[1].Args).To(Equal([]string{"mkdir", "-p", "-m", "777", target + "_mapfs"}))
+				Expect(report.Commands[2].Args).To(Equal([]string{"mount", "-t", "nfs", "-o", "rsize=1048576,wsize=1048576,hard,timeo=600,retrans=2", "filer:/export", target + "_mapfs"}))
+				Expect(report.Commands[3].Args).To(Equal([]string{"/bin/mapfs", "-uid", "1000", "-gid", "1001", "-auto_cache", target, target + "_mapfs"}))
+				Expect(report.Result).To(Equal(map[string]string{"source": "filer:/export", "target": target, "uid": "1000", "gid": "1001"}))
+
+				_, err := os.Stat(target)
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+		})
+
+		Context("when an option is given without a value", func() {
+			BeforeEach(func() {
+				command.Args = append(command.Args, "mount", "--dry-run", "filer:/export", filepath.Join(dir, "vol"), "uid")
+			})
+
+			It("fails", func() {
+				Eventually(session).Should(gexec.Exit(1))
+				Expect(session.Err).To(gbytes.Say("mount failed: option 'uid' needs a value"))
+			})
+		})
+
+		Context("when checking a directory that is not mounted", func() {
+			BeforeEach(func() {
+				command.Args = append(command.Args, "check", dir)
+			})
+
+			It("prints the command it ran and fails", func() {
+				Eventually(session).Should(gexec.Exit(1))
+				Expect(session.Out).To(gbytes.Say("mountpoint -q " + dir))
+				Expect(session.Err).To(gbytes.Say(dir + " is not mounted"))
+			})
+		})
+
+		Context("when purging in a dry run", func() {
+			BeforeEach(func() {
+				command.Args = append(command.Args, "purge", "--dry-run", dir)
+			})
+
+			It("prints the commands that would run", func() {
+				Eventually(session).Should(gexec.Exit(0))
+				Expect(session.Out).To(gbytes.Say("# dry run, the host was not changed"))
+				Expect(session.Out).To(gbytes.Say("pkill mapfs"))
+				Expect(session.Out).To(gbytes.Say("pgrep mapfs"))
+				Expect(session.Out).To(gbytes.Say("# purged the mounts under " + dir))
+			})
+		})
+
+		Context("when resolving a user without LDAP", func() {
+			BeforeEach(func() {
+				command.Args = append(command.Args, "resolve", "--dry-run", "alice")
+			})
+
+			It("fails", func() {
+				Eventually(session).Should(gexec.Exit(1))
+				Expect(session.Err).To(gbytes.Say("resolve failed: LDAP is not configured"))
+			})
+		})
+
+		Context("when resolving a user with several sources", func() {
+			BeforeEach(func() {
+				configFile := filepath.Join(dir, "config.yml")
+				Expect(ioutil.WriteFile(configFile, []byte(`
+ldap:
+  sources:
+  - name: builders
+    type: local
+    users:
+    - username: ci
+      password: first
+      uid: 3000
+      gid: 3000
+  - name: fallback
+    type: local
+    users:
+    - username: ci
+      password: second
+      uid: 4000
+      gid: 4000
+    - username: backup
+      password: pw
+      uid: 5000
+      gid: 5001
+      groups: [Backup]
+`), 0600)).To(Succeed())
+
+				command.Args = append(command.Args, "-configFile="+configFile)
+			})
+
+			Context("when the user is only in a later source", func() {
+				BeforeEach(func() {
+					command.Args = append(command.Args, "resolve", "backup")
+					command.Stdin = strings.NewReader("pw\n")
+				})
+
+				It("falls through to it", func() {
+					Eventually(session).Should(gexec.Exit(0))
+					Expect(session.Out).To(gbytes.Say("backup resolved to uid 5000, gid 5001, groups Backup"))
+				})
+			})
+
+			Context("when the user is in more than one source", func() {
+				BeforeEach(func() {
+					command.Args = append(command.Args, "resolve", "ci")
+					command.Stdin = strings.NewReader("first\n")
+				})
+
+				It("resolves them in the first", func() {
+					Eventually(session).Should(gexec.Exit(0))
+					Expect(session.Out).To(gbytes.Say("ci resolved to uid 3000, gid 3000"))
+				})
+			})
+
+			Context("when the first source rejects the password", func() {
+				BeforeEach(func() {
+					command.Args = append(command.Args, "resolve", "ci")
+					command.Stdin = strings.NewReader("second\n")
+				})
+
+				It("does not fall through", func() {
+					Eventually(session).Should(gexec.Exit(1))
+					Expect(session.Err).To(gbytes.Say("resolve failed: Invalid credentials"))
+				})
+			})
+		})
+
+		Context("when the arguments are missing", func() {
+			BeforeEach(func() {
+				command.Args = append(command.Args, "unmount")
+			})
+
+			It("prints the usage", func() {
+				Eventually(session).Should(gexec.Exit(2))
+				Expect(session.Err).To(gbytes.Say(`usage: nfsv3driver \[flags\] unmount`))
+			})
+		})
+	})
+
+	Context("with an unknown command", func() {
+		BeforeEach(func() {
+			command.Args = append(command.Args, "frobnicate")
+			expectedStartOutput = ""
+			expectedStartErrOutput = "unknown command 'frobnicate'"
+		})
+
+		It("fails to start", func() {
+			Eventually(session).Should(gexec.Exit(1))
+		})
 	})
 })
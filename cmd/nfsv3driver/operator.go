@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/goshims/bufioshim"
+	"code.cloudfoundry.org/goshims/osshim"
+	"code.cloudfoundry.org/goshims/timeshim"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/nfsv3driver"
+	"code.cloudfoundry.org/volumedriver/invoker"
+	"code.cloudfoundry.org/volumedriver/mountchecker"
+)
+
+// operatorCommands are the commands operators debug a cell's mounts with. They drive the mapfs mounter and the id
+// resolver directly, configured as the driver would be, and report every command they run. With --dry-run the
+// commands are simulated as in the driver's simulation mode, so the ones that merely inspect the host find nothing.
+var operatorCommands = map[string]operatorCommand{
+	"mount": {
+		usage:   "mount [--dry-run] [--json] <source> <target> [option=value ...]",
+		minArgs: 2,
+		maxArgs: -1,
+		run:     runMount,
+	},
+	"unmount": {
+		usage:   "unmount [--dry-run] [--json] <target>",
+		minArgs: 1,
+		maxArgs: 1,
+		run:     runUnmount,
+	},
+	"check": {
+		usage:   "check [--dry-run] [--json] <target>",
+		minArgs: 1,
+		maxArgs: 1,
+		run:     runCheck,
+	},
+	"purge": {
+		usage:   "purge [--dry-run] [--json] <path>",
+		minArgs: 1,
+		maxArgs: 1,
+		run:     runPurge,
+	},
+	"resolve": {
+		usage:   "resolve [--dry-run] [--json] <username>",
+		minArgs: 1,
+		maxArgs: 1,
+		run:     runResolve,
+	},
+}
+
+var plainShellWord = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+type operatorCommand struct {
+	usage   string
+	minArgs int
+	maxArgs int
+	run     func(operator *operator, args []string) (interface{}, error)
+}
+
+type operator struct {
+	env        dockerdriver.Env
+	mounter    nfsv3driver.ReloadableMounter
+	idResolver nfsv3driver.IdResolver
+	os         osshim.Os
+	stdin      io.Reader
+	dryRun     bool
+}
+
+// operatorReport is what --json prints.
+type operatorReport struct {
+	Command  string          `json:"command"`
+	DryRun   bool            `json:"dry_run"`
+	Commands []commandRecord `json:"commands"`
+	Result   interface{}     `json:"result,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// commandRecord is a command that was run, or would have been in a dry run. Stdin says what was written to the
+// command's standard input, never what it was.
+type commandRecord struct {
+	Args  []string `json:"args"`
+	Stdin string   `json:"stdin,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+type mountResult struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Uid    string `json:"uid,omitempty"`
+	Gid    string `json:"gid,omitempty"`
+}
+
+func (r mountResult) String() string {
+	if r.Uid == "" {
+		return fmt.Sprintf("mounted %s on %s", r.Source, r.Target)
+	}
+	return fmt.Sprintf("mounted %s on %s as uid %s, gid %s", r.Source, r.Target, r.Uid, r.Gid)
+}
+
+type unmountResult struct {
+	Target string `json:"target"`
+}
+
+func (r unmountResult) String() string {
+	return fmt.Sprintf("unmounted %s", r.Target)
+}
+
+type checkResult struct {
+	Target  string `json:"target"`
+	Mounted *bool  `json:"mounted,omitempty"`
+}
+
+func (r checkResult) String() string {
+	if r.Mounted == nil {
+		return fmt.Sprintf("%s was not checked", r.Target)
+	}
+	if !*r.Mounted {
+		return fmt.Sprintf("%s is not mounted", r.Target)
+	}
+	return fmt.Sprintf("%s is mounted", r.Target)
+}
+
+type purgeResult struct {
+	Path string `json:"path"`
+}
+
+func (r purgeResult) String() string {
+	return fmt.Sprintf("purged the mounts under %s", r.Path)
+}
+
+type resolveResult struct {
+	Username string   `json:"username"`
+	Exists   bool     `json:"exists"`
+	Uid      string   `json:"uid,omitempty"`
+	Gid      string   `json:"gid,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
+}
+
+func (r resolveResult) String() string {
+	if r.Uid == "" {
+		return fmt.Sprintf("%s exists, their password was not checked", r.Username)
+	}
+	return fmt.Sprintf("%s resolved to uid %s, gid %s, groups %s", r.Username, r.Uid, r.Gid, strings.Join(r.Groups, ","))
+}
+
+// runOperatorCommand runs the operator command name with args and returns the exit code: 0 if it succeeded, 1 if it
+// failed and 2 if it was used wrongly.
+func runOperatorCommand(name string, args []string, config driverConfig, stdin io.Reader, stdout, stderr io.Writer) int {
+	command := operatorCommands[name]
+
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	dryRun := flags.Bool("dry-run", false, "print the commands that would change the host instead of running them")
+	jsonOutput := flags.Bool("json", false, "print a JSON report")
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: nfsv3driver [flags] %s\n", command.usage)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() < command.minArgs || (command.maxArgs >= 0 && flags.NArg() > command.maxArgs) {
+		flags.Usage()
+		return 2
+	}
+
+	level := lager.ERROR
+	if config.LogLevel != "" {
+		level, _ = lager.LogLevelFromString(config.LogLevel)
+	}
+	logger := lager.NewLogger("nfsv3driver")
+	logger.RegisterSink(lager.NewWriterSink(stderr, level))
+	env := driverhttp.NewHttpDriverEnv(nfsv3driver.NewRedactingLogger(logger, config.RedactKeys), context.Background())
+
+	transcript := nfsv3driver.NewCommandTranscript(clock.NewClock(), *dryRun, config.MapfsPath)
+	fileSystem := transcript.Os(&osshim.OsShim{})
+	// the configuration has been validated, so the offline cache key is known to be good
+	offlineStore, _ := config.LDAP.OfflineCache.store()
+	idResolver := newIdResolver(config, nfsv3driver.NewLoginThrottle(&timeshim.TimeShim{}, config.LDAP.loginThrottleConfig()), offlineStore, nil)
+	mounter, _ := newMapfsMounter(
+		env.Logger(),
+		config,
+		nfsv3driver.NewReloadableIdResolver(idResolver),
+		transcript.Invoker(invoker.NewProcessGroupInvoker()),
+		fileSystem,
+		transcript.MountChecker(mountchecker.NewChecker(&bufioshim.BufioShim{}, &osshim.OsShim{})),
+		newTranscriptKinitClient(transcript, config),
+	)
+
+	operator := &operator{
+		env:        env,
+		mounter:    mounter,
+		idResolver: idResolver,
+		os:         fileSystem,
+		stdin:      stdin,
+		dryRun:     *dryRun,
+	}
+	result, err := command.run(operator, flags.Args())
+
+	report := operatorReport{Command: name, DryRun: *dryRun, Commands: []commandRecord{}, Result: result}
+	for _, entry := range transcript.TranscriptEntries() {
+		report.Commands = append(report.Commands, commandRecord{Args: entry.Command, Stdin: entry.Stdin, Error: entry.Err})
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	} else {
+		printReport(stdout, stderr, report)
+	}
+
+	if err != nil {
+		return 1
+	}
+	return 0
+}
+
+// printReport prints the commands of report so that they can be run again as a shell script.
+func printReport(stdout, stderr io.Writer, report operatorReport) {
+	if report.DryRun {
+		fmt.Fprintln(stdout, "# dry run, the host was not changed")
+	}
+	for _, command := range report.Commands {
+		words := make([]string, len(command.Args))
+		for i, arg := range command.Args {
+			words[i] = shellQuote(arg)
+		}
+		fmt.Fprintln(stdout, strings.Join(words, " "))
+		if command.Stdin != "" {
+			fmt.Fprintf(stdout, "# with %s on standard input\n", command.Stdin)
+		}
+		if command.Error != "" {
+			fmt.Fprintf(stdout, "# failed: %s\n", command.Error)
+		}
+	}
+
+	if report.Error != "" {
+		fmt.Fprintf(stderr, "%s failed: %s\n", report.Command, report.Error)
+	} else if report.Result != nil {
+		fmt.Fprintf(stdout, "# %s\n", report.Result)
+	}
+}
+
+func shellQuote(word string) string {
+	if plainShellWord.MatchString(word) {
+		return word
+	}
+	return "'" + strings.Replace(word, "'", `'\''`, -1) + "'"
+}
+
+func runMount(operator *operator, args []string) (interface{}, error) {
+	source, target := args[0], strings.TrimSuffix(filepath.Clean(args[1]), "/")
+
+	opts := map[string]interface{}{"source": source}
+	for _, arg := range args[2:] {
+		parts := strings.SplitN(arg, "=", 2)
+		switch {
+		case len(parts) == 2 && parts[1] != "":
+			opts[parts[0]] = parts[1]
+		case len(parts) == 1 && contains(nfsv3driver.DockerFlagOptions, parts[0]):
+			opts[parts[0]] = "true"
+		default:
+			return nil, fmt.Errorf("option '%s' needs a value", parts[0])
+		}
+	}
+
+	// the password is read from standard input so that it does not show up in the process list
+	if opts["password"] == "-" {
+		password, err := readLine(operator.stdin)
+		if err != nil {
+			return nil, fmt.Errorf("reading the password from standard input: %s", err.Error())
+		}
+		opts["password"] = password
+	}
+
+	// the driver creates its mount points open to everyone, so that the mapped user can reach the volume
+	orig := syscall.Umask(000)
+	err := operator.os.MkdirAll(target, os.ModePerm)
+	syscall.Umask(orig)
+	if err != nil {
+		return nil, err
+	}
+
+	err = operator.mounter.Mount(operator.env, source, target, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := mountResult{Source: source, Target: target}
+	if uid, ok := opts["uid"]; ok {
+		result.Uid, result.Gid = fmt.Sprint(uid), fmt.Sprint(opts["gid"])
+	}
+	return result, nil
+}
+
+func runUnmount(operator *operator, args []string) (interface{}, error) {
+	target := strings.TrimSuffix(filepath.Clean(args[0]), "/")
+
+	err := operator.mounter.Unmount(operator.env, target)
+	if err != nil {
+		return nil, err
+	}
+	return unmountResult{Target: target}, nil
+}
+
+func runCheck(operator *operator, args []string) (interface{}, error) {
+	target := strings.TrimSuffix(filepath.Clean(args[0]), "/")
+
+	mounted := operator.mounter.Check(operator.env, filepath.Base(target), target)
+	if operator.dryRun {
+		return checkResult{Target: target}, nil
+	}
+
+	result := checkResult{Target: target, Mounted: &mounted}
+	if !mounted {
+		return result, fmt.Errorf("%s is not mounted", target)
+	}
+	return result, nil
+}
+
+func runPurge(operator *operator, args []string) (interface{}, error) {
+	path := filepath.Clean(args[0])
+
+	operator.mounter.Purge(operator.env, path)
+	return purgeResult{Path: path}, nil
+}
+
+// runResolve resolves a user as a mount with their username would. A dry run only looks them up with the service
+// account, so that a wrong password cannot count towards locking them out.
+func runResolve(operator *operator, args []string) (interface{}, error) {
+	username := args[0]
+
+	if operator.idResolver == nil {
+		return nil, errors.New("LDAP is not configured")
+	}
+
+	if operator.dryRun {
+		if err := operator.idResolver.Validate(operator.env, username); err != nil {
+			return nil, err
+		}
+		return resolveResult{Username: username, Exists: true}, nil
+	}
+
+	password, err := readLine(operator.stdin)
+	if err != nil {
+		return nil, fmt.Errorf("reading the password from standard input: %s", err.Error())
+	}
+
+	uid, gid, groups, err := operator.idResolver.Resolve(operator.env, username, password)
+	if err != nil {
+		return nil, err
+	}
+	return resolveResult{Username: username, Exists: true, Uid: uid, Gid: gid, Groups: groups}, nil
+}
+
+func readLine(reader io.Reader) (string, error) {
+	line, err := bufio.NewReader(reader).ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
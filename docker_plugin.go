@@ -0,0 +1,81 @@
+package nfsv3driver
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/lager"
+)
+
+// DockerPluginScopes are the scopes a managed plugin may report for its volumes. Volumes of a global plugin are
+// created once for the whole swarm, which suits shares that every node can mount.
+var DockerPluginScopes = []string{"local", "global"}
+
+// DockerFlagOptions are the options that may be given without a value, to `docker volume create -o` or to the
+// mount command, which turns them on.
+var DockerFlagOptions = []string{"auto_cache", "cache", "experimental", "readonly"}
+
+type dockerPluginDriver struct {
+	dockerdriver.Driver
+	scope string
+}
+
+// NewDockerPluginDriver adapts driver to the Docker daemon, which runs it as a managed plugin. The options of
+// `docker volume create -o` all arrive as strings, so those given without a value are turned on if they are flags
+// and rejected otherwise, and options the mounter does not understand are rejected when the volume is created
+// rather than when it is first mounted. The volumes are reported in scope.
+func NewDockerPluginDriver(driver dockerdriver.Driver, scope string) dockerdriver.Driver {
+	return &dockerPluginDriver{Driver: driver, scope: scope}
+}
+
+func (d *dockerPluginDriver) Create(env dockerdriver.Env, createRequest dockerdriver.CreateRequest) dockerdriver.ErrorResponse {
+	logger := env.Logger().Session("docker-plugin-create", lager.Data{"volume": createRequest.Name})
+
+	opts := map[string]interface{}{}
+	var unknown, missing []string
+	for name, value := range createRequest.Opts {
+		if !isOneOf(MapfsAllowedOptions, name) {
+			unknown = append(unknown, name)
+			continue
+		}
+		if value == nil || value == "" {
+			if !isOneOf(DockerFlagOptions, name) {
+				missing = append(missing, name)
+				continue
+			}
+			value = "true"
+		}
+		opts[name] = value
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		logger.Info("unknown-options", lager.Data{"options": unknown})
+		return dockerdriver.ErrorResponse{Err: fmt.Sprintf("unknown options: %s", strings.Join(unknown, ", "))}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		logger.Info("options-without-values", lager.Data{"options": missing})
+		return dockerdriver.ErrorResponse{Err: fmt.Sprintf("options need a value: %s", strings.Join(missing, ", "))}
+	}
+
+	createRequest.Opts = opts
+	return d.Driver.Create(env, createRequest)
+}
+
+func (d *dockerPluginDriver) Capabilities(env dockerdriver.Env) dockerdriver.CapabilitiesResponse {
+	return dockerdriver.CapabilitiesResponse{
+		Capabilities: dockerdriver.CapabilityInfo{Scope: d.scope},
+	}
+}
+
+func isOneOf(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package nfsv3driver_test
+
+import (
+	"context"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nfsv3driver"
+	"code.cloudfoundry.org/nfsv3driver/nfsdriverfakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DockerPluginDriver", func() {
+	var (
+		env        dockerdriver.Env
+		fakeDriver *nfsdriverfakes.FakeDriver
+		driver     dockerdriver.Driver
+	)
+
+	BeforeEach(func() {
+		env = driverhttp.NewHttpDriverEnv(lagertest.NewTestLogger("docker-plugin"), context.TODO())
+
+		fakeDriver = &nfsdriverfakes.FakeDriver{}
+		fakeDriver.CapabilitiesReturns(dockerdriver.CapabilitiesResponse{Capabilities: dockerdriver.CapabilityInfo{Scope: "local"}})
+
+		driver = nfsv3driver.NewDockerPluginDriver(fakeDriver, "global")
+	})
+
+	Describe("Create", func() {
+		var (
+			opts     map[string]interface{}
+			response dockerdriver.ErrorResponse
+		)
+
+		BeforeEach(func() {
+			opts = map[string]interface{}{
+				"source":   "nfs://filer/export",
+				"uid":      "2000",
+				"gid":      "2000",
+				"readonly": "",
+			}
+		})
+
+		JustBeforeEach(func() {
+			response = driver.Create(env, dockerdriver.CreateRequest{Name: "vol1", Opts: opts})
+		})
+
+		It("turns on the flags given without a value", func() {
+			Expect(response.Err).To(BeEmpty())
+			Expect(fakeDriver.CreateCallCount()).To(Equal(1))
+
+			_, createRequest := fakeDriver.CreateArgsForCall(0)
+			Expect(createRequest.Name).To(Equal("vol1"))
+			Expect(createRequest.Opts).To(Equal(map[string]interface{}{
+				"source":   "nfs://filer/export",
+				"uid":      "2000",
+				"gid":      "2000",
+				"readonly": "true",
+			}))
+		})
+
+		It("returns the driver's response", func() {
+			fakeDriver.CreateReturns(dockerdriver.ErrorResponse{Err: "Missing mandatory 'source' field in 'Opts'"})
+
+			response = driver.Create(env, dockerdriver.CreateRequest{Name: "vol1", Opts: opts})
+			Expect(response.Err).To(Equal("Missing mandatory 'source' field in 'Opts'"))
+		})
+
+		Context("when options the mounter does not understand are given", func() {
+			BeforeEach(func() {
+				opts["nolock"] = ""
+				opts["rsize"] = "8192"
+			})
+
+			It("rejects the volume", func() {
+				Expect(response.Err).To(Equal("unknown options: nolock, rsize"))
+				Expect(fakeDriver.CreateCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when an option that is not a flag is given without a value", func() {
+			BeforeEach(func() {
+				opts["uid"] = ""
+				opts["version"] = ""
+			})
+
+			It("rejects the volume", func() {
+				Expect(response.Err).To(Equal("options need a value: uid, version"))
+				Expect(fakeDriver.CreateCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when no options are given", func() {
+			BeforeEach(func() {
+				opts = nil
+			})
+
+			It("leaves it to the driver to require a source", func() {
+				Expect(fakeDriver.CreateCallCount()).To(Equal(1))
+
+				_, createRequest := fakeDriver.CreateArgsForCall(0)
+				Expect(createRequest.Opts).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("Capabilities", func() {
+		It("reports the plugin's scope", func() {
+			Expect(driver.Capabilities(env).Capabilities.Scope).To(Equal("global"))
+		})
+	})
+
+	It("passes the other requests on to the driver", func() {
+		fakeDriver.GetReturns(dockerdriver.GetResponse{Volume: dockerdriver.VolumeInfo{Name: "vol1", Mountpoint: "/mnt/vol1"}})
+
+		response := driver.Get(env, dockerdriver.GetRequest{Name: "vol1"})
+		Expect(response.Volume.Mountpoint).To(Equal("/mnt/vol1"))
+		Expect(fakeDriver.GetCallCount()).To(Equal(1))
+	})
+})
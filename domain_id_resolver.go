@@ -0,0 +1,101 @@
+package nfsv3driver
+
+import (
+	"fmt"
+	"strings"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/lager"
+)
+
+const (
+	InvalidUsernameErrorMessage        = "Invalid 'username' option"
+	UsernameRequiresDomainErrorMessage = "Username must include a domain, e.g. user@domain or DOMAIN\\user"
+	UnknownDomainErrorMessage          = "Unknown LDAP domain"
+)
+
+// IdResolverDomain is a directory that owns the accounts of one or more domains. Names are matched
+// case-insensitively against the UPN suffix ("alice@emea.corp") or down-level domain ("EMEA\alice") of a username.
+type IdResolverDomain struct {
+	Names    []string
+	Resolver IdResolver
+}
+
+type domainIdResolver struct {
+	defaultResolver IdResolver
+	domains         map[string]IdResolver
+}
+
+// NewDomainIdResolver routes each lookup to the resolver of the domain named in the username, passing on the bare
+// account name. Usernames without a domain go to defaultResolver, which may be nil if every user must name their
+// domain.
+func NewDomainIdResolver(defaultResolver IdResolver, domains ...IdResolverDomain) IdResolver {
+	r := &domainIdResolver{
+		defaultResolver: defaultResolver,
+		domains:         map[string]IdResolver{},
+	}
+
+	for _, domain := range domains {
+		for _, name := range domain.Names {
+			if name == "" {
+				continue
+			}
+			r.domains[strings.ToLower(name)] = domain.Resolver
+		}
+	}
+
+	return r
+}
+
+func (r *domainIdResolver) Resolve(env dockerdriver.Env, username string, password string) (uid string, gid string, groups []string, err error) {
+	resolver, account, err := r.route(env.Logger().Session("domain-resolve"), username)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	return resolver.Resolve(env, account, password)
+}
+
+func (r *domainIdResolver) Validate(env dockerdriver.Env, username string) error {
+	resolver, account, err := r.route(env.Logger().Session("domain-validate"), username)
+	if err != nil {
+		return err
+	}
+
+	return resolver.Validate(env, account)
+}
+
+// route picks the resolver of the domain named in username and returns the bare account name to look up there.
+func (r *domainIdResolver) route(logger lager.Logger, username string) (IdResolver, string, error) {
+	account, domain := splitDomain(username)
+	if account == "" || (domain == "" && account != username) {
+		return nil, "", dockerdriver.SafeError{SafeDescription: InvalidUsernameErrorMessage}
+	}
+
+	resolver := r.defaultResolver
+	if domain != "" {
+		resolver = r.domains[strings.ToLower(domain)]
+	}
+	if resolver == nil {
+		if domain == "" {
+			return nil, "", dockerdriver.SafeError{SafeDescription: UsernameRequiresDomainErrorMessage}
+		}
+		logger.Info("unknown-domain", lager.Data{"domain": domain})
+		return nil, "", dockerdriver.SafeError{SafeDescription: fmt.Sprintf("%s '%s'", UnknownDomainErrorMessage, domain)}
+	}
+
+	logger.Debug("routing", lager.Data{"domain": domain, "account": account})
+	return resolver, account, nil
+}
+
+// splitDomain separates the account and domain of a username in UPN ("alice@emea.corp") or down-level logon
+// ("EMEA\alice") format. A plain username has no domain.
+func splitDomain(username string) (account string, domain string) {
+	if i := strings.Index(username, `\`); i >= 0 {
+		return username[i+1:], username[:i]
+	}
+	if i := strings.LastIndex(username, "@"); i >= 0 {
+		return username[:i], username[i+1:]
+	}
+	return username, ""
+}
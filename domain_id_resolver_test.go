@@ -0,0 +1,115 @@
+package nfsv3driver_test
+
+import (
+	"context"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nfsv3driver"
+	"code.cloudfoundry.org/nfsv3driver/nfsdriverfakes"
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DomainIdResolver", func() {
+	var (
+		env             dockerdriver.Env
+		defaultResolver *nfsdriverfakes.FakeIdResolver
+		emeaResolver    *nfsdriverfakes.FakeIdResolver
+		subject         nfsv3driver.IdResolver
+	)
+
+	BeforeEach(func() {
+		env = driverhttp.NewHttpDriverEnv(lagertest.NewTestLogger("domain-id-resolver"), context.TODO())
+
+		defaultResolver = &nfsdriverfakes.FakeIdResolver{}
+		defaultResolver.ResolveReturns("100", "100", nil, nil)
+		emeaResolver = &nfsdriverfakes.FakeIdResolver{}
+		emeaResolver.ResolveReturns("200", "200", nil, nil)
+	})
+
+	JustBeforeEach(func() {
+		subject = nfsv3driver.NewDomainIdResolver(
+			defaultResolver,
+			nfsv3driver.IdResolverDomain{Names: []string{"emea.corp", "EMEA"}, Resolver: emeaResolver},
+		)
+	})
+
+	table.DescribeTable("routes usernames with a domain to that domain's directory",
+		func(username string) {
+			uid, gid, _, err := subject.Resolve(env, username, "secret")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(uid).To(Equal("200"))
+			Expect(gid).To(Equal("200"))
+
+			Expect(defaultResolver.ResolveCallCount()).To(Equal(0))
+			Expect(emeaResolver.ResolveCallCount()).To(Equal(1))
+			_, account, password := emeaResolver.ResolveArgsForCall(0)
+			Expect(account).To(Equal("alice"))
+			Expect(password).To(Equal("secret"))
+		},
+		table.Entry("UPN", "alice@emea.corp"),
+		table.Entry("UPN with a differently cased suffix", "alice@EMEA.Corp"),
+		table.Entry("down-level logon name", `EMEA\alice`),
+		table.Entry("down-level logon name in lower case", `emea\alice`),
+	)
+
+	It("routes plain usernames to the default directory", func() {
+		uid, _, _, err := subject.Resolve(env, "bob", "secret")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(uid).To(Equal("100"))
+
+		_, account, _ := defaultResolver.ResolveArgsForCall(0)
+		Expect(account).To(Equal("bob"))
+		Expect(emeaResolver.ResolveCallCount()).To(Equal(0))
+	})
+
+	It("returns a safe error for an unknown domain", func() {
+		_, _, _, err := subject.Resolve(env, "carol@apac.corp", "secret")
+		Expect(err).To(MatchError("Unknown LDAP domain 'apac.corp'"))
+		Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+		Expect(defaultResolver.ResolveCallCount()).To(Equal(0))
+		Expect(emeaResolver.ResolveCallCount()).To(Equal(0))
+	})
+
+	table.DescribeTable("rejects malformed usernames",
+		func(username string) {
+			_, _, _, err := subject.Resolve(env, username, "secret")
+			Expect(err).To(MatchError("Invalid 'username' option"))
+			Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+		},
+		table.Entry("empty account in UPN", "@emea.corp"),
+		table.Entry("empty domain in UPN", "alice@"),
+		table.Entry("empty account in down-level name", `EMEA\`),
+		table.Entry("empty domain in down-level name", `\alice`),
+	)
+
+	Context("when there is no default directory", func() {
+		BeforeEach(func() {
+			defaultResolver = nil
+		})
+
+		JustBeforeEach(func() {
+			subject = nfsv3driver.NewDomainIdResolver(
+				nil,
+				nfsv3driver.IdResolverDomain{Names: []string{"emea.corp"}, Resolver: emeaResolver},
+			)
+		})
+
+		It("requires usernames to name their domain", func() {
+			_, _, _, err := subject.Resolve(env, "bob", "secret")
+			Expect(err).To(MatchError(`Username must include a domain, e.g. user@domain or DOMAIN\user`))
+			Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+		})
+	})
+
+	It("routes validation to the user's domain", func() {
+		Expect(subject.Validate(env, `EMEA\alice`)).To(Succeed())
+
+		_, account := emeaResolver.ValidateArgsForCall(0)
+		Expect(account).To(Equal("alice"))
+		Expect(defaultResolver.ValidateCallCount()).To(Equal(0))
+	})
+})
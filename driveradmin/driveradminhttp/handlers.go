@@ -8,6 +8,7 @@ import (
 	"code.cloudfoundry.org/dockerdriver/driverhttp"
 	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/nfsv3driver/driveradmin"
+	"code.cloudfoundry.org/nfsv3driver/metrics"
 	"github.com/tedsuo/rata"
 )
 
@@ -17,8 +18,15 @@ func NewHandler(logger lager.Logger, client driveradmin.DriverAdmin) (http.Handl
 	defer logger.Info("end")
 
 	var handlers = rata.Handlers{
-		driveradmin.EvacuateRoute: newEvacuateHandler(logger, client),
-		driveradmin.PingRoute:     newPingHandler(logger, client),
+		driveradmin.EvacuateRoute:        newEvacuateHandler(logger, client),
+		driveradmin.PingRoute:            newPingHandler(logger, client),
+		driveradmin.UnhealthyMountsRoute: newUnhealthyMountsHandler(logger, client),
+		driveradmin.ReconciliationRoute:  newReconciliationHandler(logger, client),
+		driveradmin.VolumesRoute:         newVolumesHandler(logger, client),
+		driveradmin.VolumeRoute:          newVolumeHandler(logger, client),
+		driveradmin.TranscriptRoute:      newTranscriptHandler(logger, client),
+		driveradmin.ReadyRoute:           newReadyHandler(logger, client),
+		driveradmin.MetricsRoute:         newMetricsHandler(logger, client),
 	}
 
 	return rata.NewRouter(driveradmin.Routes, handlers)
@@ -61,3 +69,148 @@ func newPingHandler(logger lager.Logger, client driveradmin.DriverAdmin) http.Ha
 		cf_http_handlers.WriteJSONResponse(w, http.StatusOK, response)
 	}
 }
+
+func newUnhealthyMountsHandler(logger lager.Logger, client driveradmin.DriverAdmin) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		logger := logger.Session("handle-unhealthy-mounts")
+		logger.Info("start")
+		defer logger.Info("end")
+
+		env := driverhttp.EnvWithMonitor(logger, req.Context(), w)
+
+		response := client.UnhealthyMounts(env)
+		if response.Err != "" {
+			logger.Error("failed-listing-unhealthy-mounts", errors.New(response.Err))
+			cf_http_handlers.WriteJSONResponse(w, http.StatusInternalServerError, response)
+			return
+		}
+
+		cf_http_handlers.WriteJSONResponse(w, http.StatusOK, response)
+	}
+}
+
+func newReconciliationHandler(logger lager.Logger, client driveradmin.DriverAdmin) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		logger := logger.Session("handle-reconciliation")
+		logger.Info("start")
+		defer logger.Info("end")
+
+		env := driverhttp.EnvWithMonitor(logger, req.Context(), w)
+
+		response := client.Reconciliation(env)
+		if response.Err != "" {
+			logger.Error("failed-listing-reconciliation-actions", errors.New(response.Err))
+			cf_http_handlers.WriteJSONResponse(w, http.StatusInternalServerError, response)
+			return
+		}
+
+		cf_http_handlers.WriteJSONResponse(w, http.StatusOK, response)
+	}
+}
+
+func newVolumesHandler(logger lager.Logger, client driveradmin.DriverAdmin) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		logger := logger.Session("handle-volumes")
+		logger.Info("start")
+		defer logger.Info("end")
+
+		env := driverhttp.EnvWithMonitor(logger, req.Context(), w)
+
+		response := client.Volumes(env)
+		if response.Err != "" {
+			logger.Error("failed-listing-volumes", errors.New(response.Err))
+			cf_http_handlers.WriteJSONResponse(w, http.StatusInternalServerError, response)
+			return
+		}
+
+		cf_http_handlers.WriteJSONResponse(w, http.StatusOK, response)
+	}
+}
+
+func newVolumeHandler(logger lager.Logger, client driveradmin.DriverAdmin) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		name := rata.Param(req, "name")
+		logger := logger.Session("handle-volume", lager.Data{"volume": name})
+		logger.Info("start")
+		defer logger.Info("end")
+
+		env := driverhttp.EnvWithMonitor(logger, req.Context(), w)
+
+		response := client.Volume(env, name)
+		if response.Err == driveradmin.VolumeNotFound {
+			cf_http_handlers.WriteJSONResponse(w, http.StatusNotFound, response)
+			return
+		}
+		if response.Err != "" {
+			logger.Error("failed-getting-volume", errors.New(response.Err))
+			cf_http_handlers.WriteJSONResponse(w, http.StatusInternalServerError, response)
+			return
+		}
+
+		cf_http_handlers.WriteJSONResponse(w, http.StatusOK, response)
+	}
+}
+
+func newTranscriptHandler(logger lager.Logger, client driveradmin.DriverAdmin) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		logger := logger.Session("handle-transcript")
+		logger.Info("start")
+		defer logger.Info("end")
+
+		env := driverhttp.EnvWithMonitor(logger, req.Context(), w)
+
+		response := client.Transcript(env)
+		if response.Err != "" {
+			logger.Error("failed-listing-transcript", errors.New(response.Err))
+			cf_http_handlers.WriteJSONResponse(w, http.StatusInternalServerError, response)
+			return
+		}
+
+		cf_http_handlers.WriteJSONResponse(w, http.StatusOK, response)
+	}
+}
+
+func newReadyHandler(logger lager.Logger, client driveradmin.DriverAdmin) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		logger := logger.Session("handle-ready")
+		logger.Info("start")
+		defer logger.Info("end")
+
+		env := driverhttp.EnvWithMonitor(logger, req.Context(), w)
+
+		response := client.Ready(env)
+		if response.Err != "" {
+			logger.Error("failed-checking-readiness", errors.New(response.Err))
+			cf_http_handlers.WriteJSONResponse(w, http.StatusInternalServerError, response)
+			return
+		}
+		if !response.Ready {
+			cf_http_handlers.WriteJSONResponse(w, http.StatusServiceUnavailable, response)
+			return
+		}
+
+		cf_http_handlers.WriteJSONResponse(w, http.StatusOK, response)
+	}
+}
+
+// newMetricsHandler serves the metrics as text, for Prometheus to scrape, and only errors as JSON.
+func newMetricsHandler(logger lager.Logger, client driveradmin.DriverAdmin) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		logger := logger.Session("handle-metrics")
+		logger.Debug("start")
+		defer logger.Debug("end")
+
+		env := driverhttp.EnvWithMonitor(logger, req.Context(), w)
+
+		response := client.Metrics(env)
+		if response.Err != "" {
+			logger.Error("failed-writing-metrics", errors.New(response.Err))
+			cf_http_handlers.WriteJSONResponse(w, http.StatusInternalServerError, response)
+			return
+		}
+
+		w.Header().Set("Content-Type", metrics.ContentType)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(response.Metrics))
+	}
+}
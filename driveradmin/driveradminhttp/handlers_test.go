@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 
 	"fmt"
+	"time"
 
 	"code.cloudfoundry.org/lager/lagertest"
 	"code.cloudfoundry.org/nfsv3driver/driveradmin"
@@ -99,5 +100,359 @@ var _ = Describe("Volman Driver Handlers", func() {
 			})
 		})
 
+		Context("UnhealthyMounts", func() {
+			BeforeEach(func() {
+				fakeDriverAdmin.UnhealthyMountsReturns(driveradmin.UnhealthyMountsResponse{
+					Mounts: []driveradmin.UnhealthyMount{{
+						Target:   "/mnt/vol1",
+						Username: "alice",
+						Reason:   "account disabled (error code ACCOUNT_DISABLED)",
+						Since:    time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC),
+					}},
+				})
+
+				var found bool
+				route, found = driveradmin.Routes.FindRouteByName(driveradmin.UnhealthyMountsRoute)
+				Expect(found).To(BeTrue())
+			})
+
+			It("should produce a handler that lists the unhealthy mounts", func() {
+				Expect(httpResponseRecorder.Code).To(Equal(200))
+				Expect(httpResponseRecorder.Body).Should(MatchJSON(`{
+					"Mounts": [{
+						"Target": "/mnt/vol1",
+						"Username": "alice",
+						"Reason": "account disabled (error code ACCOUNT_DISABLED)",
+						"Since": "2020-09-13T12:26:40Z"
+					}],
+					"Err": ""
+				}`))
+			})
+
+			Context("when listing the unhealthy mounts returns an error", func() {
+				BeforeEach(func() {
+					fakeDriverAdmin.UnhealthyMountsReturns(driveradmin.UnhealthyMountsResponse{
+						Err: "unable to list",
+					})
+				})
+
+				It("should return an http 500 response and an error string", func() {
+					Expect(httpResponseRecorder.Code).To(Equal(500))
+					Expect(httpResponseRecorder.Body).Should(MatchJSON(`{"Mounts":null,"Err":"unable to list"}`))
+				})
+			})
+		})
+
+		Context("Reconciliation", func() {
+			BeforeEach(func() {
+				fakeDriverAdmin.ReconciliationReturns(driveradmin.ReconciliationResponse{
+					Actions: []driveradmin.ReconciliationAction{{
+						Time:   time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC),
+						Action: "orphan-unmounted",
+						Target: "/var/vcap/data/volumes/nfs/vol1",
+						Detail: "not a mount of any volume",
+					}},
+				})
+
+				var found bool
+				route, found = driveradmin.Routes.FindRouteByName(driveradmin.ReconciliationRoute)
+				Expect(found).To(BeTrue())
+			})
+
+			It("should produce a handler that lists the reconciliation actions", func() {
+				Expect(httpResponseRecorder.Code).To(Equal(200))
+				Expect(httpResponseRecorder.Body).Should(MatchJSON(`{
+					"Actions": [{
+						"Time": "2020-09-13T12:26:40Z",
+						"Action": "orphan-unmounted",
+						"Volume": "",
+						"Target": "/var/vcap/data/volumes/nfs/vol1",
+						"Detail": "not a mount of any volume",
+						"Err": ""
+					}],
+					"Err": ""
+				}`))
+			})
+
+			Context("when listing the reconciliation actions returns an error", func() {
+				BeforeEach(func() {
+					fakeDriverAdmin.ReconciliationReturns(driveradmin.ReconciliationResponse{
+						Err: "unable to list",
+					})
+				})
+
+				It("should return an http 500 response and an error string", func() {
+					Expect(httpResponseRecorder.Code).To(Equal(500))
+					Expect(httpResponseRecorder.Body).Should(MatchJSON(`{"Actions":null,"Err":"unable to list"}`))
+				})
+			})
+		})
+		Context("Transcript", func() {
+			BeforeEach(func() {
+				fakeDriverAdmin.TranscriptReturns(driveradmin.TranscriptResponse{
+					Entries: []driveradmin.TranscriptEntry{{
+						Time:    time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC),
+						Command: []string{"mountpoint", "-q", "/var/vcap/data/volumes/nfs/vol1"},
+						Err:     "exit status 1",
+					}},
+				})
+
+				var found bool
+				route, found = driveradmin.Routes.FindRouteByName(driveradmin.TranscriptRoute)
+				Expect(found).To(BeTrue())
+			})
+
+			It("should produce a handler that lists the commands", func() {
+				Expect(httpResponseRecorder.Code).To(Equal(200))
+				Expect(httpResponseRecorder.Body).Should(MatchJSON(`{
+					"Entries": [{
+						"Time": "2020-09-13T12:26:40Z",
+						"Command": ["mountpoint", "-q", "/var/vcap/data/volumes/nfs/vol1"],
+						"Err": "exit status 1"
+					}],
+					"Err": ""
+				}`))
+			})
+
+			Context("when listing the commands returns an error", func() {
+				BeforeEach(func() {
+					fakeDriverAdmin.TranscriptReturns(driveradmin.TranscriptResponse{
+						Err: "unable to list",
+					})
+				})
+
+				It("should return an http 500 response and an error string", func() {
+					Expect(httpResponseRecorder.Code).To(Equal(500))
+					Expect(httpResponseRecorder.Body).Should(MatchJSON(`{"Entries":null,"Err":"unable to list"}`))
+				})
+			})
+		})
+		Context("Ready", func() {
+			BeforeEach(func() {
+				fakeDriverAdmin.ReadyReturns(driveradmin.ReadyResponse{
+					Ready: true,
+					Checks: []driveradmin.ReadinessCheckResult{{
+						Name:           "mapfs",
+						Ready:          true,
+						Detail:         "/var/vcap/packages/mapfs/bin/mapfs, version unknown",
+						LatencySeconds: 0.5,
+					}},
+				})
+
+				var found bool
+				route, found = driveradmin.Routes.FindRouteByName(driveradmin.ReadyRoute)
+				Expect(found).To(BeTrue())
+			})
+
+			It("should produce a handler that reports each check", func() {
+				Expect(httpResponseRecorder.Code).To(Equal(200))
+				Expect(httpResponseRecorder.Body).Should(MatchJSON(`{
+					"Ready": true,
+					"Checks": [{
+						"Name": "mapfs",
+						"Ready": true,
+						"Detail": "/var/vcap/packages/mapfs/bin/mapfs, version unknown",
+						"LatencySeconds": 0.5,
+						"Err": ""
+					}],
+					"Err": ""
+				}`))
+			})
+
+			Context("when a check fails", func() {
+				BeforeEach(func() {
+					fakeDriverAdmin.ReadyReturns(driveradmin.ReadyResponse{
+						Ready: false,
+						Checks: []driveradmin.ReadinessCheckResult{{
+							Name: "fuse",
+							Err:  "stat /dev/fuse: no such file or directory",
+						}},
+					})
+				})
+
+				It("should return an http 503 response", func() {
+					Expect(httpResponseRecorder.Code).To(Equal(503))
+					Expect(httpResponseRecorder.Body).Should(MatchJSON(`{
+						"Ready": false,
+						"Checks": [{
+							"Name": "fuse",
+							"Ready": false,
+							"Detail": "",
+							"LatencySeconds": 0,
+							"Err": "stat /dev/fuse: no such file or directory"
+						}],
+						"Err": ""
+					}`))
+				})
+			})
+
+			Context("when checking readiness returns an error", func() {
+				BeforeEach(func() {
+					fakeDriverAdmin.ReadyReturns(driveradmin.ReadyResponse{
+						Err: "unable to check",
+					})
+				})
+
+				It("should return an http 500 response and an error string", func() {
+					Expect(httpResponseRecorder.Code).To(Equal(500))
+					Expect(httpResponseRecorder.Body).Should(MatchJSON(`{"Ready":false,"Checks":null,"Err":"unable to check"}`))
+				})
+			})
+		})
+		Context("Metrics", func() {
+			BeforeEach(func() {
+				fakeDriverAdmin.MetricsReturns(driveradmin.MetricsResponse{
+					Metrics: "# HELP nfsv3driver_mounts_total Mounts.\n# TYPE nfsv3driver_mounts_total counter\nnfsv3driver_mounts_total 1\n",
+				})
+
+				var found bool
+				route, found = driveradmin.Routes.FindRouteByName(driveradmin.MetricsRoute)
+				Expect(found).To(BeTrue())
+			})
+
+			It("should produce a handler that serves the metrics as text", func() {
+				Expect(httpResponseRecorder.Code).To(Equal(200))
+				Expect(httpResponseRecorder.Header().Get("Content-Type")).To(Equal("text/plain; version=0.0.4; charset=utf-8"))
+				Expect(httpResponseRecorder.Body.String()).To(Equal("# HELP nfsv3driver_mounts_total Mounts.\n# TYPE nfsv3driver_mounts_total counter\nnfsv3driver_mounts_total 1\n"))
+			})
+
+			Context("when writing the metrics returns an error", func() {
+				BeforeEach(func() {
+					fakeDriverAdmin.MetricsReturns(driveradmin.MetricsResponse{
+						Err: "metrics are not enabled",
+					})
+				})
+
+				It("should return an http 500 response and an error string", func() {
+					Expect(httpResponseRecorder.Code).To(Equal(500))
+					Expect(httpResponseRecorder.Body).Should(MatchJSON(`{"Metrics":"","Err":"metrics are not enabled"}`))
+				})
+			})
+		})
+		Context("Volumes", func() {
+			BeforeEach(func() {
+				mountedAt := time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC)
+				fakeDriverAdmin.VolumesReturns(driveradmin.VolumesResponse{
+					Volumes: []driveradmin.VolumeStatus{{
+						Name:          "vol1",
+						Mountpoint:    "/var/vcap/data/volumes/nfs/vol1",
+						MountCount:    1,
+						Source:        "nfs://server/export",
+						KernelOptions: "rw,relatime",
+						NfsVersion:    "3",
+						Uid:           "2000",
+						Gid:           "2000",
+						MapfsPid:      42,
+						MountedAt:     &mountedAt,
+						Health:        "healthy",
+					}},
+				})
+
+				var found bool
+				route, found = driveradmin.Routes.FindRouteByName(driveradmin.VolumesRoute)
+				Expect(found).To(BeTrue())
+			})
+
+			It("should produce a handler that lists the volumes", func() {
+				Expect(httpResponseRecorder.Code).To(Equal(200))
+				Expect(httpResponseRecorder.Body).Should(MatchJSON(`{
+					"Volumes": [{
+						"Name": "vol1",
+						"Mountpoint": "/var/vcap/data/volumes/nfs/vol1",
+						"MountCount": 1,
+						"Source": "nfs://server/export",
+						"KernelOptions": "rw,relatime",
+						"NfsVersion": "3",
+						"Uid": "2000",
+						"Gid": "2000",
+						"MapfsPid": 42,
+						"MountedAt": "2020-09-13T12:26:40Z",
+						"Health": "healthy",
+						"LastError": ""
+					}],
+					"Err": ""
+				}`))
+			})
+
+			Context("when listing the volumes returns an error", func() {
+				BeforeEach(func() {
+					fakeDriverAdmin.VolumesReturns(driveradmin.VolumesResponse{
+						Err: "unable to list",
+					})
+				})
+
+				It("should return an http 500 response and an error string", func() {
+					Expect(httpResponseRecorder.Code).To(Equal(500))
+					Expect(httpResponseRecorder.Body).Should(MatchJSON(`{"Volumes":null,"Err":"unable to list"}`))
+				})
+			})
+		})
+
+		Context("Volume", func() {
+			BeforeEach(func() {
+				fakeDriverAdmin.VolumeReturns(driveradmin.VolumeResponse{
+					Volume: driveradmin.VolumeStatus{
+						Name:       "vol1",
+						Mountpoint: "/var/vcap/data/volumes/nfs/vol1",
+						Source:     "nfs://server/export",
+						Health:     "unhealthy",
+						LastError:  "mapfs is not running",
+					},
+				})
+
+				var found bool
+				route, found = driveradmin.Routes.FindRouteByName(driveradmin.VolumeRoute)
+				Expect(found).To(BeTrue())
+
+				var err error
+				route.Path, err = driveradmin.Routes.CreatePathForRoute(driveradmin.VolumeRoute, rata.Params{"name": "vol1"})
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("should produce a handler that shows the named volume", func() {
+				Expect(fakeDriverAdmin.VolumeCallCount()).NotTo(BeZero())
+				_, name := fakeDriverAdmin.VolumeArgsForCall(fakeDriverAdmin.VolumeCallCount() - 1)
+				Expect(name).To(Equal("vol1"))
+
+				Expect(httpResponseRecorder.Code).To(Equal(200))
+				Expect(httpResponseRecorder.Body).Should(MatchJSON(`{
+					"Volume": {
+						"Name": "vol1",
+						"Mountpoint": "/var/vcap/data/volumes/nfs/vol1",
+						"MountCount": 0,
+						"Source": "nfs://server/export",
+						"KernelOptions": "",
+						"NfsVersion": "",
+						"Health": "unhealthy",
+						"LastError": "mapfs is not running"
+					},
+					"Err": ""
+				}`))
+			})
+
+			Context("when the volume is not found", func() {
+				BeforeEach(func() {
+					fakeDriverAdmin.VolumeReturns(driveradmin.VolumeResponse{
+						Err: driveradmin.VolumeNotFound,
+					})
+				})
+
+				It("should return an http 404 response", func() {
+					Expect(httpResponseRecorder.Code).To(Equal(404))
+				})
+			})
+
+			Context("when getting the volume returns an error", func() {
+				BeforeEach(func() {
+					fakeDriverAdmin.VolumeReturns(driveradmin.VolumeResponse{
+						Err: "unable to get",
+					})
+				})
+
+				It("should return an http 500 response and an error string", func() {
+					Expect(httpResponseRecorder.Code).To(Equal(500))
+				})
+			})
+		})
 	})
 })
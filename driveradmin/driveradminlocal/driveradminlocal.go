@@ -1,16 +1,35 @@
 package driveradminlocal
 
 import (
+	"bytes"
+	"context"
 	"os"
+	"time"
 
 	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/nfsv3driver/driveradmin"
+	"code.cloudfoundry.org/nfsv3driver/metrics"
 	"github.com/tedsuo/ifrit"
 )
 
+// ReadinessCheckTimeout is how long the readiness checks are given to finish.
+const ReadinessCheckTimeout = 10 * time.Second
+
 type DriverAdminLocal struct {
-	serverProcess ifrit.Process
-	drainables    []driveradmin.Drainable
+	serverProcess   ifrit.Process
+	drainables      []driveradmin.Drainable
+	healthReporters []driveradmin.MountHealthReporter
+	reconcilers     []driveradmin.ReconciliationReporter
+	volumeReporters []driveradmin.VolumeStatusReporter
+	transcripts     []driveradmin.TranscriptReporter
+	readinessChecks []driveradmin.ReadinessCheck
+
+	metrics          *metrics.Registry
+	evacuateDuration *metrics.Histogram
+	checkReady       *metrics.Gauge
+	checkDuration    *metrics.Gauge
 }
 
 func NewDriverAdminLocal() *DriverAdminLocal {
@@ -23,10 +42,51 @@ func (d *DriverAdminLocal) SetServerProc(p ifrit.Process) {
 	d.serverProcess = p
 }
 
+// SetMetrics sets the registry /metrics serves, and adds to it how long evacuations take and the results of the
+// readiness checks the last time they were run.
+func (d *DriverAdminLocal) SetMetrics(registry *metrics.Registry) {
+	d.metrics = registry
+	d.evacuateDuration = registry.NewHistogram(
+		"nfsv3driver_evacuate_duration_seconds",
+		"How long draining the driver's volumes took when it was evacuated.",
+		[]float64{1, 5, 10, 30, 60, 120, 300},
+	)
+	d.checkReady = registry.NewGauge(
+		"nfsv3driver_readiness_check_ready",
+		"Whether each readiness check passed the last time /ready was asked for.",
+		"check",
+	)
+	d.checkDuration = registry.NewGauge(
+		"nfsv3driver_readiness_check_duration_seconds",
+		"How long each readiness check took the last time /ready was asked for.",
+		"check",
+	)
+}
+
 func (d *DriverAdminLocal) RegisterDrainable(rhs driveradmin.Drainable) {
 	d.drainables = append(d.drainables, rhs)
 }
 
+func (d *DriverAdminLocal) RegisterMountHealthReporter(rhs driveradmin.MountHealthReporter) {
+	d.healthReporters = append(d.healthReporters, rhs)
+}
+
+func (d *DriverAdminLocal) RegisterReconciliationReporter(rhs driveradmin.ReconciliationReporter) {
+	d.reconcilers = append(d.reconcilers, rhs)
+}
+
+func (d *DriverAdminLocal) RegisterVolumeStatusReporter(rhs driveradmin.VolumeStatusReporter) {
+	d.volumeReporters = append(d.volumeReporters, rhs)
+}
+
+func (d *DriverAdminLocal) RegisterTranscriptReporter(rhs driveradmin.TranscriptReporter) {
+	d.transcripts = append(d.transcripts, rhs)
+}
+
+func (d *DriverAdminLocal) RegisterReadinessCheck(rhs driveradmin.ReadinessCheck) {
+	d.readinessChecks = append(d.readinessChecks, rhs)
+}
+
 func (d *DriverAdminLocal) Evacuate(env dockerdriver.Env) driveradmin.ErrorResponse {
 	logger := env.Logger().Session("evacuate")
 	logger.Info("start")
@@ -36,11 +96,15 @@ func (d *DriverAdminLocal) Evacuate(env dockerdriver.Env) driveradmin.ErrorRespo
 		return driveradmin.ErrorResponse{Err: "unexpected error: server process not found"}
 	}
 
+	start := time.Now()
 	for _, svr := range d.drainables {
 		if err := svr.Drain(env); err != nil {
 			logger.Error("failed-draining", err)
 		}
 	}
+	if d.evacuateDuration != nil {
+		d.evacuateDuration.Observe(time.Since(start).Seconds())
+	}
 
 	d.serverProcess.Signal(os.Interrupt)
 
@@ -54,3 +118,165 @@ func (d *DriverAdminLocal) Ping(env dockerdriver.Env) driveradmin.ErrorResponse
 
 	return driveradmin.ErrorResponse{}
 }
+
+func (d *DriverAdminLocal) UnhealthyMounts(env dockerdriver.Env) driveradmin.UnhealthyMountsResponse {
+	logger := env.Logger().Session("unhealthy-mounts")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	mounts := []driveradmin.UnhealthyMount{}
+	for _, reporter := range d.healthReporters {
+		mounts = append(mounts, reporter.UnhealthyMounts()...)
+	}
+
+	return driveradmin.UnhealthyMountsResponse{Mounts: mounts}
+}
+
+func (d *DriverAdminLocal) Reconciliation(env dockerdriver.Env) driveradmin.ReconciliationResponse {
+	logger := env.Logger().Session("reconciliation")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	actions := []driveradmin.ReconciliationAction{}
+	for _, reporter := range d.reconcilers {
+		actions = append(actions, reporter.ReconciliationActions()...)
+	}
+
+	return driveradmin.ReconciliationResponse{Actions: actions}
+}
+
+func (d *DriverAdminLocal) Volumes(env dockerdriver.Env) driveradmin.VolumesResponse {
+	logger := env.Logger().Session("volumes")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	volumes := []driveradmin.VolumeStatus{}
+	for _, reporter := range d.volumeReporters {
+		volumes = append(volumes, reporter.VolumeStatuses(env)...)
+	}
+
+	return driveradmin.VolumesResponse{Volumes: volumes}
+}
+
+func (d *DriverAdminLocal) Volume(env dockerdriver.Env, name string) driveradmin.VolumeResponse {
+	logger := env.Logger().Session("volume", lager.Data{"volume": name})
+	logger.Info("start")
+	defer logger.Info("end")
+
+	for _, volume := range d.Volumes(env).Volumes {
+		if volume.Name == name {
+			return driveradmin.VolumeResponse{Volume: volume}
+		}
+	}
+
+	return driveradmin.VolumeResponse{Err: driveradmin.VolumeNotFound}
+}
+
+func (d *DriverAdminLocal) Transcript(env dockerdriver.Env) driveradmin.TranscriptResponse {
+	logger := env.Logger().Session("transcript")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	entries := []driveradmin.TranscriptEntry{}
+	for _, reporter := range d.transcripts {
+		entries = append(entries, reporter.TranscriptEntries()...)
+	}
+
+	return driveradmin.TranscriptResponse{Entries: entries}
+}
+
+// Ready runs the readiness checks concurrently and is ready only when every one of them passes. A check that has
+// not finished within ReadinessCheckTimeout is reported as failed rather than holding up the response.
+func (d *DriverAdminLocal) Ready(env dockerdriver.Env) driveradmin.ReadyResponse {
+	logger := env.Logger().Session("ready")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	ctx, cancel := context.WithTimeout(env.Context(), ReadinessCheckTimeout)
+	defer cancel()
+	env = driverhttp.EnvWithContext(ctx, env)
+
+	type checked struct {
+		index  int
+		result driveradmin.ReadinessCheckResult
+	}
+	done := make(chan checked, len(d.readinessChecks))
+
+	results := make([]driveradmin.ReadinessCheckResult, len(d.readinessChecks))
+	for i, check := range d.readinessChecks {
+		results[i] = driveradmin.ReadinessCheckResult{
+			Name:           check.Name(),
+			LatencySeconds: ReadinessCheckTimeout.Seconds(),
+			Err:            "check timed out",
+		}
+
+		go func(i int, check driveradmin.ReadinessCheck) {
+			start := time.Now()
+			detail, err := check.Check(env)
+			result := driveradmin.ReadinessCheckResult{
+				Name:           check.Name(),
+				Ready:          err == nil,
+				Detail:         detail,
+				LatencySeconds: time.Since(start).Seconds(),
+			}
+			if err != nil {
+				result.Err = err.Error()
+			}
+			done <- checked{index: i, result: result}
+		}(i, check)
+	}
+
+wait:
+	for remaining := len(d.readinessChecks); remaining > 0; remaining-- {
+		select {
+		case c := <-done:
+			results[c.index] = c.result
+		case <-ctx.Done():
+			break wait
+		}
+	}
+
+	ready := true
+	for _, result := range results {
+		if !result.Ready {
+			logger.Info("not-ready", lager.Data{"check": result.Name, "err": result.Err})
+			ready = false
+		}
+	}
+	d.recordReadiness(results)
+
+	return driveradmin.ReadyResponse{Ready: ready, Checks: results}
+}
+
+func (d *DriverAdminLocal) recordReadiness(results []driveradmin.ReadinessCheckResult) {
+	if d.metrics == nil {
+		return
+	}
+
+	for _, result := range results {
+		passed := 0.0
+		if result.Ready {
+			passed = 1
+		}
+		d.checkReady.Set(passed, result.Name)
+		d.checkDuration.Set(result.LatencySeconds, result.Name)
+	}
+}
+
+func (d *DriverAdminLocal) Metrics(env dockerdriver.Env) driveradmin.MetricsResponse {
+	logger := env.Logger().Session("metrics")
+	logger.Debug("start")
+	defer logger.Debug("end")
+
+	if d.metrics == nil {
+		return driveradmin.MetricsResponse{Err: "metrics are not enabled"}
+	}
+
+	var out bytes.Buffer
+	if err := d.metrics.Write(env, &out); err != nil {
+		logger.Error("failed-writing-metrics", err)
+		return driveradmin.MetricsResponse{Err: err.Error()}
+	}
+
+	return driveradmin.MetricsResponse{Metrics: out.String()}
+}
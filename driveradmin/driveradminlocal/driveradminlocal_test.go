@@ -2,6 +2,7 @@ package driveradminlocal_test
 
 import (
 	"context"
+	"errors"
 
 	"code.cloudfoundry.org/dockerdriver"
 	"code.cloudfoundry.org/dockerdriver/driverhttp"
@@ -9,6 +10,7 @@ import (
 	"code.cloudfoundry.org/lager/lagertest"
 	"code.cloudfoundry.org/nfsv3driver/driveradmin"
 	"code.cloudfoundry.org/nfsv3driver/driveradmin/driveradminlocal"
+	"code.cloudfoundry.org/nfsv3driver/metrics"
 	"code.cloudfoundry.org/nfsv3driver/nfsdriverfakes"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -78,5 +80,279 @@ var _ = Describe("Driver Admin Local", func() {
 				})
 			})
 		})
+
+		Describe("UnhealthyMounts", func() {
+			var response driveradmin.UnhealthyMountsResponse
+
+			JustBeforeEach(func() {
+				response = driverAdminLocal.UnhealthyMounts(env)
+			})
+
+			Context("when no health reporters are registered", func() {
+				It("returns an empty list", func() {
+					Expect(response.Err).To(BeEmpty())
+					Expect(response.Mounts).To(BeEmpty())
+					Expect(response.Mounts).NotTo(BeNil())
+				})
+			})
+
+			Context("when health reporters are registered", func() {
+				BeforeEach(func() {
+					for _, target := range []string{"/mnt/vol1", "/mnt/vol2"} {
+						fakeReporter := &nfsdriverfakes.FakeMountHealthReporter{}
+						fakeReporter.UnhealthyMountsReturns([]driveradmin.UnhealthyMount{{Target: target}})
+						driverAdminLocal.RegisterMountHealthReporter(fakeReporter)
+					}
+				})
+
+				It("combines their reports", func() {
+					Expect(response.Mounts).To(ConsistOf(
+						driveradmin.UnhealthyMount{Target: "/mnt/vol1"},
+						driveradmin.UnhealthyMount{Target: "/mnt/vol2"},
+					))
+				})
+			})
+		})
+
+		Describe("Reconciliation", func() {
+			var response driveradmin.ReconciliationResponse
+
+			JustBeforeEach(func() {
+				response = driverAdminLocal.Reconciliation(env)
+			})
+
+			Context("when no reconcilers are registered", func() {
+				It("returns an empty list", func() {
+					Expect(response.Err).To(BeEmpty())
+					Expect(response.Actions).To(BeEmpty())
+					Expect(response.Actions).NotTo(BeNil())
+				})
+			})
+
+			Context("when a reconciler is registered", func() {
+				BeforeEach(func() {
+					fakeReporter := &nfsdriverfakes.FakeReconciliationReporter{}
+					fakeReporter.ReconciliationActionsReturns([]driveradmin.ReconciliationAction{{Action: "adopted", Target: "/mnt/vol1"}})
+					driverAdminLocal.RegisterReconciliationReporter(fakeReporter)
+				})
+
+				It("reports its actions", func() {
+					Expect(response.Actions).To(ConsistOf(driveradmin.ReconciliationAction{Action: "adopted", Target: "/mnt/vol1"}))
+				})
+			})
+		})
+		Describe("Transcript", func() {
+			var response driveradmin.TranscriptResponse
+
+			JustBeforeEach(func() {
+				response = driverAdminLocal.Transcript(env)
+			})
+
+			Context("when no transcripts are registered", func() {
+				It("returns an empty list", func() {
+					Expect(response.Err).To(BeEmpty())
+					Expect(response.Entries).To(BeEmpty())
+					Expect(response.Entries).NotTo(BeNil())
+				})
+			})
+
+			Context("when a transcript is registered", func() {
+				BeforeEach(func() {
+					fakeReporter := &nfsdriverfakes.FakeTranscriptReporter{}
+					fakeReporter.TranscriptEntriesReturns([]driveradmin.TranscriptEntry{{Command: []string{"pkill", "mapfs"}}})
+					driverAdminLocal.RegisterTranscriptReporter(fakeReporter)
+				})
+
+				It("reports its commands", func() {
+					Expect(response.Entries).To(ConsistOf(driveradmin.TranscriptEntry{Command: []string{"pkill", "mapfs"}}))
+				})
+			})
+		})
+		Describe("Ready", func() {
+			var response driveradmin.ReadyResponse
+
+			JustBeforeEach(func() {
+				response = driverAdminLocal.Ready(env)
+			})
+
+			Context("when no checks are registered", func() {
+				It("is ready", func() {
+					Expect(response.Err).To(BeEmpty())
+					Expect(response.Ready).To(BeTrue())
+					Expect(response.Checks).To(BeEmpty())
+					Expect(response.Checks).NotTo(BeNil())
+				})
+			})
+
+			Context("when checks are registered", func() {
+				var fuseCheck *nfsdriverfakes.FakeReadinessCheck
+
+				BeforeEach(func() {
+					mapfsCheck := &nfsdriverfakes.FakeReadinessCheck{}
+					mapfsCheck.NameReturns("mapfs")
+					mapfsCheck.CheckReturns("/bin/mapfs, version unknown", nil)
+					driverAdminLocal.RegisterReadinessCheck(mapfsCheck)
+
+					fuseCheck = &nfsdriverfakes.FakeReadinessCheck{}
+					fuseCheck.NameReturns("fuse")
+					fuseCheck.CheckReturns("/dev/fuse", nil)
+					driverAdminLocal.RegisterReadinessCheck(fuseCheck)
+				})
+
+				It("reports each check in the order they were registered", func() {
+					Expect(response.Ready).To(BeTrue())
+					Expect(response.Checks).To(HaveLen(2))
+					Expect(response.Checks[0].Name).To(Equal("mapfs"))
+					Expect(response.Checks[0].Ready).To(BeTrue())
+					Expect(response.Checks[0].Detail).To(Equal("/bin/mapfs, version unknown"))
+					Expect(response.Checks[0].LatencySeconds).To(BeNumerically(">=", 0))
+					Expect(response.Checks[1].Name).To(Equal("fuse"))
+				})
+
+				Context("when a check fails", func() {
+					BeforeEach(func() {
+						fuseCheck.CheckReturns("", errors.New("stat /dev/fuse: no such file or directory"))
+					})
+
+					It("is not ready", func() {
+						Expect(response.Ready).To(BeFalse())
+						Expect(response.Checks[0].Ready).To(BeTrue())
+						Expect(response.Checks[1].Ready).To(BeFalse())
+						Expect(response.Checks[1].Err).To(Equal("stat /dev/fuse: no such file or directory"))
+					})
+				})
+
+				Context("when a check does not finish in time", func() {
+					var release chan struct{}
+
+					BeforeEach(func() {
+						release = make(chan struct{})
+						fuseCheck.CheckStub = func(dockerdriver.Env) (string, error) {
+							<-release
+							return "/dev/fuse", nil
+						}
+
+						cancelled, cancel := context.WithCancel(ctx)
+						cancel()
+						env = driverhttp.NewHttpDriverEnv(logger, cancelled)
+					})
+
+					AfterEach(func() {
+						close(release)
+					})
+
+					It("reports it as failed", func() {
+						Expect(response.Ready).To(BeFalse())
+						Expect(response.Checks[1].Name).To(Equal("fuse"))
+						Expect(response.Checks[1].Err).To(Equal("check timed out"))
+					})
+				})
+			})
+		})
+		Describe("Metrics", func() {
+			var response driveradmin.MetricsResponse
+
+			JustBeforeEach(func() {
+				response = driverAdminLocal.Metrics(env)
+			})
+
+			Context("when no registry is set", func() {
+				It("fails", func() {
+					Expect(response.Err).To(Equal("metrics are not enabled"))
+				})
+			})
+
+			Context("when a registry is set", func() {
+				BeforeEach(func() {
+					registry := metrics.NewRegistry()
+					registry.NewCounter("nfsv3driver_mounts_total", "Mounts.").Inc()
+					driverAdminLocal.SetMetrics(registry)
+				})
+
+				It("writes the registry's metrics", func() {
+					Expect(response.Err).To(BeEmpty())
+					Expect(response.Metrics).To(ContainSubstring("\nnfsv3driver_mounts_total 1\n"))
+				})
+
+				Context("when the readiness checks have run", func() {
+					BeforeEach(func() {
+						fuseCheck := &nfsdriverfakes.FakeReadinessCheck{}
+						fuseCheck.NameReturns("fuse")
+						fuseCheck.CheckReturns("", errors.New("stat /dev/fuse: no such file or directory"))
+						driverAdminLocal.RegisterReadinessCheck(fuseCheck)
+
+						driverAdminLocal.Ready(env)
+					})
+
+					It("reports their results", func() {
+						Expect(response.Metrics).To(ContainSubstring(`nfsv3driver_readiness_check_ready{check="fuse"} 0`))
+						Expect(response.Metrics).To(ContainSubstring(`nfsv3driver_readiness_check_duration_seconds{check="fuse"}`))
+					})
+				})
+
+				Context("when the driver has been evacuated", func() {
+					BeforeEach(func() {
+						driverAdminLocal.SetServerProc(&nfsdriverfakes.FakeProcess{})
+						driverAdminLocal.RegisterDrainable(&nfsdriverfakes.FakeDrainable{})
+
+						driverAdminLocal.Evacuate(env)
+					})
+
+					It("reports how long draining took", func() {
+						Expect(response.Metrics).To(ContainSubstring("nfsv3driver_evacuate_duration_seconds_count 1\n"))
+					})
+				})
+			})
+		})
+		Describe("Volumes", func() {
+			var response driveradmin.VolumesResponse
+
+			JustBeforeEach(func() {
+				response = driverAdminLocal.Volumes(env)
+			})
+
+			Context("when no reporters are registered", func() {
+				It("returns an empty list", func() {
+					Expect(response.Err).To(BeEmpty())
+					Expect(response.Volumes).To(BeEmpty())
+					Expect(response.Volumes).NotTo(BeNil())
+				})
+			})
+
+			Context("when a reporter is registered", func() {
+				BeforeEach(func() {
+					fakeReporter := &nfsdriverfakes.FakeVolumeStatusReporter{}
+					fakeReporter.VolumeStatusesReturns([]driveradmin.VolumeStatus{{Name: "vol1", Health: "healthy"}})
+					driverAdminLocal.RegisterVolumeStatusReporter(fakeReporter)
+				})
+
+				It("reports its volumes", func() {
+					Expect(response.Volumes).To(ConsistOf(driveradmin.VolumeStatus{Name: "vol1", Health: "healthy"}))
+				})
+			})
+		})
+
+		Describe("Volume", func() {
+			var response driveradmin.VolumeResponse
+
+			BeforeEach(func() {
+				fakeReporter := &nfsdriverfakes.FakeVolumeStatusReporter{}
+				fakeReporter.VolumeStatusesReturns([]driveradmin.VolumeStatus{{Name: "vol1"}, {Name: "vol2", MountCount: 2}})
+				driverAdminLocal.RegisterVolumeStatusReporter(fakeReporter)
+			})
+
+			It("returns the named volume", func() {
+				response = driverAdminLocal.Volume(env, "vol2")
+				Expect(response.Err).To(BeEmpty())
+				Expect(response.Volume).To(Equal(driveradmin.VolumeStatus{Name: "vol2", MountCount: 2}))
+			})
+
+			Context("when the volume is not known", func() {
+				It("returns a not found error", func() {
+					response = driverAdminLocal.Volume(env, "vol3")
+					Expect(response.Err).To(Equal(driveradmin.VolumeNotFound))
+				})
+			})
+		})
 	})
 })
@@ -1,18 +1,37 @@
 package driveradmin
 
 import (
+	"time"
+
 	"code.cloudfoundry.org/dockerdriver"
 	"github.com/tedsuo/rata"
 )
 
 const (
-	EvacuateRoute = "evacuate"
-	PingRoute     = "ping"
+	EvacuateRoute        = "evacuate"
+	PingRoute            = "ping"
+	UnhealthyMountsRoute = "unhealthy-mounts"
+	ReconciliationRoute  = "reconciliation"
+	VolumesRoute         = "volumes"
+	VolumeRoute          = "volume"
+	TranscriptRoute      = "transcript"
+	ReadyRoute           = "ready"
+	MetricsRoute         = "metrics"
 )
 
+// VolumeNotFound is the error returned when the volume asked for is not known to the driver.
+const VolumeNotFound = "volume not found"
+
 var Routes = rata.Routes{
 	{Path: "/evacuate", Method: "GET", Name: EvacuateRoute},
 	{Path: "/ping", Method: "GET", Name: PingRoute},
+	{Path: "/mounts/unhealthy", Method: "GET", Name: UnhealthyMountsRoute},
+	{Path: "/reconciliation", Method: "GET", Name: ReconciliationRoute},
+	{Path: "/volumes", Method: "GET", Name: VolumesRoute},
+	{Path: "/volumes/:name", Method: "GET", Name: VolumeRoute},
+	{Path: "/transcript", Method: "GET", Name: TranscriptRoute},
+	{Path: "/ready", Method: "GET", Name: ReadyRoute},
+	{Path: "/metrics", Method: "GET", Name: MetricsRoute},
 }
 
 //go:generate counterfeiter -o ../nfsdriverfakes/fake_driver_admin.go . DriverAdmin
@@ -20,12 +39,143 @@ var Routes = rata.Routes{
 type DriverAdmin interface {
 	Evacuate(env dockerdriver.Env) ErrorResponse
 	Ping(env dockerdriver.Env) ErrorResponse
+	UnhealthyMounts(env dockerdriver.Env) UnhealthyMountsResponse
+	Reconciliation(env dockerdriver.Env) ReconciliationResponse
+	Volumes(env dockerdriver.Env) VolumesResponse
+	Volume(env dockerdriver.Env, name string) VolumeResponse
+	Transcript(env dockerdriver.Env) TranscriptResponse
+	Ready(env dockerdriver.Env) ReadyResponse
+	Metrics(env dockerdriver.Env) MetricsResponse
 }
 
 type ErrorResponse struct {
 	Err string
 }
 
+// UnhealthyMount is a mount whose user no longer passes validation against the directory.
+type UnhealthyMount struct {
+	Target   string
+	Username string
+	Reason   string
+	Since    time.Time
+}
+
+type UnhealthyMountsResponse struct {
+	Mounts []UnhealthyMount
+	Err    string
+}
+
+// ReconciliationAction is something the reconciler found or did while bringing the driver's state and the host's
+// mounts and mapfs processes back in line.
+type ReconciliationAction struct {
+	Time   time.Time
+	Action string
+	Volume string
+	Target string
+	Detail string
+	Err    string
+}
+
+type ReconciliationResponse struct {
+	Actions []ReconciliationAction
+	Err     string
+}
+
+// VolumeStatus is what the driver knows about a volume and its mount. The source has any credentials in it
+// redacted, and the kernel options, NFS version and mapfs pid are read from the host when the status is asked for.
+type VolumeStatus struct {
+	Name          string
+	Mountpoint    string
+	MountCount    int
+	Source        string
+	KernelOptions string
+	NfsVersion    string
+	Username      string     `json:",omitempty"`
+	Uid           string     `json:",omitempty"`
+	Gid           string     `json:",omitempty"`
+	MapfsPid      int        `json:",omitempty"`
+	MountedAt     *time.Time `json:",omitempty"`
+	Health        string
+	CheckedAt     *time.Time `json:",omitempty"`
+	LastError     string
+}
+
+type VolumesResponse struct {
+	Volumes []VolumeStatus
+	Err     string
+}
+
+type VolumeResponse struct {
+	Volume VolumeStatus
+	Err    string
+}
+
+// TranscriptEntry is a command the driver ran, or would have run in simulation mode. Stdin says what was written to
+// the command's standard input, never what it was.
+type TranscriptEntry struct {
+	Time    time.Time
+	Command []string
+	Stdin   string `json:",omitempty"`
+	Err     string
+}
+
+type TranscriptResponse struct {
+	Entries []TranscriptEntry
+	Err     string
+}
+
+// ReadinessCheckResult is the outcome of a readiness check. Detail says what the check found, such as the version
+// of a binary or the host it reached, and the latency is how long the check took, in seconds.
+type ReadinessCheckResult struct {
+	Name           string
+	Ready          bool
+	Detail         string
+	LatencySeconds float64
+	Err            string
+}
+
+// ReadyResponse reports whether every readiness check passed, and the result of each.
+type ReadyResponse struct {
+	Ready  bool
+	Checks []ReadinessCheckResult
+	Err    string
+}
+
+// MetricsResponse carries the driver's metrics in the Prometheus text exposition format.
+type MetricsResponse struct {
+	Metrics string
+	Err     string
+}
+
+//go:generate counterfeiter -o ../nfsdriverfakes/fake_mount_health_reporter.go . MountHealthReporter
+type MountHealthReporter interface {
+	UnhealthyMounts() []UnhealthyMount
+}
+
+//go:generate counterfeiter -o ../nfsdriverfakes/fake_reconciliation_reporter.go . ReconciliationReporter
+type ReconciliationReporter interface {
+	ReconciliationActions() []ReconciliationAction
+}
+
+//go:generate counterfeiter -o ../nfsdriverfakes/fake_volume_status_reporter.go . VolumeStatusReporter
+type VolumeStatusReporter interface {
+	VolumeStatuses(env dockerdriver.Env) []VolumeStatus
+}
+
+//go:generate counterfeiter -o ../nfsdriverfakes/fake_transcript_reporter.go . TranscriptReporter
+type TranscriptReporter interface {
+	TranscriptEntries() []TranscriptEntry
+}
+
+// ReadinessCheck checks one of the things the driver needs to mount volumes. Check returns an error when the
+// dependency is missing or unusable, and otherwise a short description of what it found.
+//
+//go:generate counterfeiter -o ../nfsdriverfakes/fake_readiness_check.go . ReadinessCheck
+type ReadinessCheck interface {
+	Name() string
+	Check(env dockerdriver.Env) (string, error)
+}
+
 //go:generate counterfeiter -o ../nfsdriverfakes/fake_drainable.go . Drainable
 type Drainable interface {
 	Drain(env dockerdriver.Env) error
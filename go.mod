@@ -2,17 +2,22 @@ module code.cloudfoundry.org/nfsv3driver
 
 require (
 	code.cloudfoundry.org/cfhttp v2.0.0+incompatible
+	code.cloudfoundry.org/clock v1.0.0
 	code.cloudfoundry.org/debugserver v0.0.0-20200131002057-141d5fa0e064
 	code.cloudfoundry.org/dockerdriver v0.0.0-20200131001834-1b34132928c1
 	code.cloudfoundry.org/goshims v0.5.0
 	code.cloudfoundry.org/lager v2.0.0+incompatible
 	code.cloudfoundry.org/volume-mount-options v1.1.0
 	code.cloudfoundry.org/volumedriver v0.26.0
+	github.com/container-storage-interface/spec v1.2.0
+	github.com/golang/protobuf v1.5.2
 	github.com/onsi/ginkgo v1.16.4
 	github.com/onsi/gomega v1.14.0
 	github.com/tedsuo/ifrit v0.0.0-20191009134036-9a97d0632f00
 	github.com/tedsuo/rata v1.0.0
+	google.golang.org/grpc v1.29.1
 	gopkg.in/ldap.v2 v2.5.1
+	gopkg.in/yaml.v2 v2.4.0
 )
 
 go 1.13
@@ -4,126 +4,524 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"fmt"
 
 	"code.cloudfoundry.org/dockerdriver"
 	"code.cloudfoundry.org/goshims/ldapshim"
+	"code.cloudfoundry.org/lager"
 	"gopkg.in/ldap.v2"
 )
 
 //go:generate counterfeiter -o nfsdriverfakes/fake_id_resolver.go . IdResolver
 type IdResolver interface {
-	Resolve(env dockerdriver.Env, username string, password string) (uid string, gid string, err error)
+	Resolve(env dockerdriver.Env, username string, password string) (uid string, gid string, groups []string, err error)
+
+	// Validate checks that username still exists and is enabled, without needing their password. It returns an
+	// AccountStatusError or the "User does not exist" SafeError when the identity has been revoked, and any other
+	// error when the directory could not answer.
+	Validate(env dockerdriver.Env, username string) error
 }
 
+const (
+	MissingUidNumberErrorMessage = "User has no uidNumber, please contact your system administrator"
+	InvalidUidNumberErrorMessage = "User has an invalid uidNumber, please contact your system administrator"
+	InvalidGidNumberErrorMessage = "User has an invalid gidNumber, please contact your system administrator"
+	LdapUnreachableErrorMessage  = "LDAP server could not be reached, please contact your system administrator"
+	AmbiguousSearchErrorMessage  = "Ambiguous search--too many results"
+)
+
+// DefaultLdapUserFilter is the search filter used to find a user when none is configured. The escaped username is
+// substituted for %s.
+const DefaultLdapUserFilter = "(&(objectClass=User)(cn=%s))"
+
 type ldapIdResolver struct {
 	svcUser     string
-	svcPass     string
-	ldapHost    string
+	svcPass     Credential
+	ldapHosts   []string // tried in order until one can be reached
 	ldapPort    int
 	ldapProto   string
 	ldapFqdn    string // ldap domain to search for users .in, e.g. "cn=Users,dc=corp,dc=persi,dc=cf-app,dc=com"
+	ldapFilter  string
 	ldapCACert  string
 	ldap        ldapshim.Ldap
 	ldapTimeout time.Duration
+	throttle    LoginThrottle
+
+	ldapPageSize        uint32
+	ldapMaxReferralHops int
+
+	idMapper IdMapper
 }
 
 func NewLdapIdResolver(
 	svcUser string,
-	svcPass string,
-	ldapHost string,
+	svcPass Credential,
+	ldapHosts []string,
 	ldapPort int,
 	ldapProto string,
 	ldapFqdn string,
+	ldapFilter string,
 	ldapCACert string,
 	ldap ldapshim.Ldap,
 	ldapTimeout time.Duration,
+	throttle LoginThrottle,
+	ldapPageSize uint32,
+	ldapMaxReferralHops int,
+	idMapper IdMapper,
 ) IdResolver {
+	if ldapFilter == "" {
+		ldapFilter = DefaultLdapUserFilter
+	}
+
 	return &ldapIdResolver{
 		svcUser:     svcUser,
 		svcPass:     svcPass,
-		ldapHost:    ldapHost,
+		ldapHosts:   ldapHosts,
 		ldapPort:    ldapPort,
 		ldapProto:   ldapProto,
 		ldapFqdn:    ldapFqdn,
+		ldapFilter:  ldapFilter,
 		ldapCACert:  ldapCACert,
 		ldap:        ldap,
 		ldapTimeout: ldapTimeout,
+		throttle:    throttle,
+
+		ldapPageSize:        ldapPageSize,
+		ldapMaxReferralHops: ldapMaxReferralHops,
+
+		idMapper: idMapper,
+	}
+}
+
+func (d *ldapIdResolver) Resolve(env dockerdriver.Env, username string, password string) (uid string, gid string, groups []string, err error) {
+	env = redactEnv(env, nil)
+	logger := env.Logger().Session("ldap-resolve")
+
+	if d.throttle != nil {
+		if err = d.throttle.Allow(LoginSource(env), username); err != nil {
+			d.audit(logger, "throttled", username, "", "")
+			return "", "", nil, err
+		}
+	}
+
+	match, host, release, err := d.lookup(logger, username)
+	if err != nil {
+		// a directory that could not be reached has not turned anyone down, so it is not held against the source
+		result := lookupFailureResult(err)
+		if d.throttle != nil && result != "unreachable" {
+			d.throttle.RecordSourceFailure(LoginSource(env))
+		}
+		d.audit(logger, result, username, "", host)
+		return "", "", nil, err
+	}
+	defer release()
+
+	userdn := match.entry.DN
+
+	// Bind as the user to verify their password, on the connection to the directory that holds the account
+	err = match.conn.Bind(userdn, password)
+	if err != nil {
+		if status, ok := bindFailureStatus(err, match.entry); ok {
+			d.audit(logger, status.Code, username, userdn, host)
+			return "", "", nil, status.SafeError()
+		}
+
+		if d.throttle != nil {
+			d.throttle.RecordFailure(LoginSource(env), username)
+		}
+		d.audit(logger, "failure", username, userdn, host)
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return "", "", nil, dockerdriver.SafeError{SafeDescription: InvalidCredentialsErrorMessage}
+		}
+		return "", "", nil, dockerdriver.SafeError{SafeDescription: err.Error()}
+	}
+
+	if d.throttle != nil {
+		d.throttle.RecordSuccess(LoginSource(env), username)
+	}
+
+	if status, ok := accountStatus(d.reread(logger, match), time.Now()); ok {
+		d.audit(logger, status.Code, username, userdn, host)
+		return "", "", nil, status.SafeError()
+	}
+
+	uid, gid, err = d.ids(match.entry)
+	if err != nil {
+		logger.Error("invalid-user-ids", err, lager.Data{"user-dn": userdn})
+		return "", "", nil, err
+	}
+	d.audit(logger, "success", username, userdn, host)
+
+	return uid, gid, match.entry.GetAttributeValues("memberOf"), nil
+}
+
+func (d *ldapIdResolver) Validate(env dockerdriver.Env, username string) error {
+	logger := env.Logger().Session("ldap-validate")
+
+	match, _, release, err := d.lookup(logger, username)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if status, ok := accountRevoked(match.entry, time.Now()); ok {
+		logger.Info("account-revoked", lager.Data{"username": username, "user-dn": match.entry.DN, "code": status.Code})
+		return status
+	}
+
+	return nil
+}
+
+// lookup finds the entry of username using the service account. The returned release function closes every
+// connection opened for the search, including the one the entry was found on.
+func (d *ldapIdResolver) lookup(logger lager.Logger, username string) (ldapMatch, string, func(), error) {
+	l, host, err := d.dialAny(logger)
+	if err == errInvalidCACert {
+		return ldapMatch{}, "", nil, err
+	}
+	if err != nil {
+		return ldapMatch{}, "", nil, dockerdriver.SafeError{SafeDescription: LdapUnreachableErrorMessage}
+	}
+
+	var referralConns []ldapshim.LdapConnection
+	release := func() {
+		for _, rl := range referralConns {
+			rl.Close()
+		}
+		l.Close()
+	}
+
+	// The service account password is read on every lookup so that rotations take effect without a restart
+	svcPass, err := d.svcPass.Value()
+	if err != nil {
+		logger.Error("read-service-account-password-failed", err)
+		release()
+		return ldapMatch{}, "", nil, err
+	}
+
+	// First bind with a read only user
+	err = l.Bind(d.svcUser, svcPass)
+	if err != nil {
+		release()
+		return ldapMatch{}, "", nil, err
+	}
+
+	// Search for the given username
+	filter := fmt.Sprintf(d.ldapFilter, ldap.EscapeFilter(username))
+	matches, err := d.find(logger, l, d.ldapFqdn, filter, svcPass, 0, &referralConns)
+	if err != nil {
+		release()
+		return ldapMatch{}, "", nil, err
+	}
+
+	if len(matches) == 0 {
+		release()
+		return ldapMatch{}, "", nil, dockerdriver.SafeError{SafeDescription: UserDoesNotExistErrorMessage}
+	}
+	if len(matches) > 1 {
+		release()
+		return ldapMatch{}, "", nil, dockerdriver.SafeError{SafeDescription: AmbiguousSearchErrorMessage}
+	}
+
+	return matches[0], host, release, nil
+}
+
+// ids returns the POSIX ids of a user, from their RFC2307 attributes or, when id mapping is enabled, derived from
+// their objectSid. Users without a usable id are refused here rather than failing obscurely later in the mount.
+func (d *ldapIdResolver) ids(entry *ldap.Entry) (uid string, gid string, err error) {
+	if d.idMapper != nil {
+		uid, gid, err = d.idMapper.Map(entry.GetRawAttributeValue("objectSid"), entry.GetAttributeValue("primaryGroupID"))
+		if err != nil {
+			return "", "", err
+		}
+	} else {
+		uid = entry.GetAttributeValue("uidNumber")
+		gid = entry.GetAttributeValue("gidNumber")
+		if gid == "" {
+			gid = uid
+		}
+	}
+
+	if uid == "" {
+		return "", "", dockerdriver.SafeError{SafeDescription: MissingUidNumberErrorMessage}
+	}
+	if !isPosixId(uid) {
+		return "", "", dockerdriver.SafeError{SafeDescription: InvalidUidNumberErrorMessage}
+	}
+	if !isPosixId(gid) {
+		return "", "", dockerdriver.SafeError{SafeDescription: InvalidGidNumberErrorMessage}
 	}
+
+	return uid, gid, nil
 }
 
-func (d *ldapIdResolver) Resolve(env dockerdriver.Env, username string, password string) (uid string, gid string, err error) {
-	addr := fmt.Sprintf("%s:%d", d.ldapHost, d.ldapPort)
+// isPosixId accepts ids that can be used to map a mount: neither root nor the 32 bit "no id" values.
+func isPosixId(id string) bool {
+	value, err := strconv.ParseUint(id, 10, 32)
+	return err == nil && value > 0 && uint32(value) != NobodyId && uint32(value) != UnknownId
+}
+
+var errInvalidCACert = errors.New("Failed to load CA certificate")
+
+type ldapMatch struct {
+	entry *ldap.Entry
+	conn  ldapshim.LdapConnection
+}
+
+// dialAny connects to the first of the configured hosts that can be reached.
+func (d *ldapIdResolver) dialAny(logger lager.Logger) (ldapshim.LdapConnection, string, error) {
+	err := errors.New("no LDAP hosts configured")
+	for _, host := range d.ldapHosts {
+		var l ldapshim.LdapConnection
+		l, err = d.dial(host, d.ldapPort, d.ldapCACert != "")
+		if err == nil || err == errInvalidCACert {
+			return l, host, err
+		}
+		logger.Error("dial-failed", err, lager.Data{"ldap-host": host})
+	}
+	return nil, "", err
+}
+
+func (d *ldapIdResolver) dial(host string, port int, useTLS bool) (ldapshim.LdapConnection, error) {
+	addr := fmt.Sprintf("%s:%d", host, port)
 
 	var l ldapshim.LdapConnection
-	if d.ldapCACert != "" {
-		roots := x509.NewCertPool()
-		ok := roots.AppendCertsFromPEM([]byte(d.ldapCACert))
-		if !ok {
-			return "", "", errors.New("Failed to load CA certificate")
+	var err error
+	if useTLS {
+		var roots *x509.CertPool
+		if d.ldapCACert != "" {
+			roots = x509.NewCertPool()
+			ok := roots.AppendCertsFromPEM([]byte(d.ldapCACert))
+			if !ok {
+				return nil, errInvalidCACert
+			}
 		}
 
 		// #nosec G402
 		l, err = d.ldap.DialTLS(d.ldapProto, addr, &tls.Config{
-			ServerName: d.ldapHost,
+			ServerName: host,
 			RootCAs:    roots,
 		})
 	} else {
 		l, err = d.ldap.Dial(d.ldapProto, addr)
 	}
 	if err != nil {
-		return "", "", dockerdriver.SafeError{SafeDescription: "LDAP server could not be reached, please contact your system administrator"}
+		return nil, err
 	}
 
 	l.SetTimeout(d.ldapTimeout)
-	defer l.Close()
+	return l, nil
+}
 
-	// First bind with a read only user
-	err = l.Bind(d.svcUser, d.svcPass)
+// find searches baseDN on l and, when referral chasing is enabled, follows any continuation references to the
+// servers that hold the rest of the subtree. Each match carries the connection it was found on, so that the user
+// bind goes to the directory that owns the account. Referral connections reuse the service account credentials.
+func (d *ldapIdResolver) find(logger lager.Logger, l ldapshim.LdapConnection, baseDN string, filter string, svcPass string, hops int, referralConns *[]ldapshim.LdapConnection) ([]ldapMatch, error) {
+	sr, err := d.search(l, baseDN, filter)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
-	// Search for the given username
+	var matches []ldapMatch
+	for _, entry := range sr.Entries {
+		matches = append(matches, ldapMatch{entry: entry, conn: l})
+	}
+
+	if d.ldapMaxReferralHops == 0 {
+		return matches, nil
+	}
+
+	for _, referral := range sr.Referrals {
+		if hops >= d.ldapMaxReferralHops {
+			logger.Info("referral-hop-limit-reached", lager.Data{"referral": referral, "hops": hops})
+			continue
+		}
+
+		host, port, useTLS, referralDN, err := parseReferral(referral)
+		if err != nil {
+			logger.Error("invalid-referral", err, lager.Data{"referral": referral})
+			continue
+		}
+		if referralDN == "" {
+			referralDN = baseDN
+		}
+
+		logger.Info("following-referral", lager.Data{"referral": referral, "hops": hops + 1})
+
+		rl, err := d.dial(host, port, useTLS || d.ldapCACert != "")
+		if err != nil {
+			logger.Error("referral-dial-failed", err, lager.Data{"referral": referral})
+			continue
+		}
+		*referralConns = append(*referralConns, rl)
+
+		err = rl.Bind(d.svcUser, svcPass)
+		if err != nil {
+			logger.Error("referral-bind-failed", err, lager.Data{"referral": referral})
+			continue
+		}
+
+		referralMatches, err := d.find(logger, rl, referralDN, filter, svcPass, hops+1, referralConns)
+		if err != nil {
+			logger.Error("referral-search-failed", err, lager.Data{"referral": referral})
+			continue
+		}
+
+		matches = append(matches, referralMatches...)
+	}
+
+	return matches, nil
+}
+
+// reread fetches the account attributes of a matched user again, once they have bound, with a base search of their
+// entry. Active Directory only returns constructed attributes such as msDS-User-Account-Control-Computed to base
+// searches, and the account may have been locked since it was looked up. Attributes the user may not read keep the
+// values the lookup found.
+func (d *ldapIdResolver) reread(logger lager.Logger, match ldapMatch) *ldap.Entry {
 	searchRequest := d.ldap.NewSearchRequest(
-		d.ldapFqdn,
-		ldap.ScopeWholeSubtree,
+		match.entry.DN,
+		ldap.ScopeBaseObject,
 		ldap.NeverDerefAliases,
 		0,
 		0,
 		false,
-		fmt.Sprintf("(&(objectClass=User)(cn=%s))", ldap.EscapeFilter(username)),
-		[]string{"dn", "uidNumber", "gidNumber"},
+		"(objectClass=*)",
+		accountStatusAttributes,
 		nil,
 	)
 
-	sr, err := l.Search(searchRequest)
+	sr, err := match.conn.Search(searchRequest)
 	if err != nil {
-		return "", "", err
+		logger.Error("reread-account-status-failed", err, lager.Data{"user-dn": match.entry.DN})
+		return match.entry
+	}
+	if len(sr.Entries) != 1 {
+		logger.Info("reread-account-status-not-found", lager.Data{"user-dn": match.entry.DN})
+		return match.entry
 	}
 
-	if len(sr.Entries) == 0 {
-		return "", "", dockerdriver.SafeError{SafeDescription: "User does not exist"}
+	entry := &ldap.Entry{DN: match.entry.DN}
+	for _, name := range accountStatusAttributes {
+		values := sr.Entries[0].GetAttributeValues(name)
+		if len(values) == 0 {
+			values = match.entry.GetAttributeValues(name)
+		}
+		if len(values) > 0 {
+			entry.Attributes = append(entry.Attributes, &ldap.EntryAttribute{Name: name, Values: values})
+		}
 	}
-	if len(sr.Entries) > 1 {
-		return "", "", dockerdriver.SafeError{SafeDescription: "Ambiguous search--too many results"}
+	return entry
+}
+
+// search runs a subtree search for filter, fetching the results a page at a time when paging is enabled so that
+// directories enforcing a size limit return the complete result.
+func (d *ldapIdResolver) search(l ldapshim.LdapConnection, baseDN string, filter string) (*ldap.SearchResult, error) {
+	var controls []ldap.Control
+	var paging *ldap.ControlPaging
+	if d.ldapPageSize > 0 {
+		paging = ldap.NewControlPaging(d.ldapPageSize)
+		controls = []ldap.Control{paging}
+	}
+
+	searchRequest := d.ldap.NewSearchRequest(
+		baseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		0,
+		0,
+		false,
+		filter,
+		d.attributes(),
+		controls,
+	)
+
+	if paging == nil {
+		return l.Search(searchRequest)
 	}
 
-	userdn := sr.Entries[0].DN
+	result := &ldap.SearchResult{}
+	for {
+		page, err := l.Search(searchRequest)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Entries = append(result.Entries, page.Entries...)
+		result.Referrals = append(result.Referrals, page.Referrals...)
 
-	uid = sr.Entries[0].GetAttributeValue("uidNumber")
-	gid = sr.Entries[0].GetAttributeValue("gidNumber")
-	if gid == "" {
-		gid = uid
+		control, ok := ldap.FindControl(page.Controls, ldap.ControlTypePaging).(*ldap.ControlPaging)
+		if !ok || len(control.Cookie) == 0 {
+			return result, nil
+		}
+		paging.SetCookie(control.Cookie)
 	}
+}
+
+func (d *ldapIdResolver) attributes() []string {
+	attributes := append([]string{"dn", "uidNumber", "gidNumber", "memberOf"}, accountStatusAttributes...)
+	if d.idMapper != nil {
+		attributes = append(attributes, "objectSid", "primaryGroupID")
+	}
+	return attributes
+}
 
-	// Bind as the user to verify their password
-	err = l.Bind(userdn, password)
+func parseReferral(referral string) (host string, port int, useTLS bool, baseDN string, err error) {
+	u, err := url.Parse(referral)
 	if err != nil {
-		return "", "", dockerdriver.SafeError{SafeDescription: err.Error()}
+		return "", 0, false, "", err
 	}
 
-	return uid, gid, nil
+	switch strings.ToLower(u.Scheme) {
+	case "ldap":
+		port = 389
+	case "ldaps":
+		port = 636
+		useTLS = true
+	default:
+		return "", 0, false, "", fmt.Errorf("unsupported referral scheme '%s'", u.Scheme)
+	}
+
+	host = u.Hostname()
+	if host == "" {
+		return "", 0, false, "", errors.New("referral has no host")
+	}
+	if u.Port() != "" {
+		port, err = strconv.Atoi(u.Port())
+		if err != nil {
+			return "", 0, false, "", err
+		}
+	}
+
+	return host, port, useTLS, strings.TrimPrefix(u.Path, "/"), nil
+}
+
+// lookupFailureResult is the audited result of a login whose user could not be looked up.
+func lookupFailureResult(err error) string {
+	if err == errInvalidCACert {
+		return "unreachable"
+	}
+	switch err.Error() {
+	case LdapUnreachableErrorMessage:
+		return "unreachable"
+	case UserDoesNotExistErrorMessage:
+		return "user-not-found"
+	case AmbiguousSearchErrorMessage:
+		return "ambiguous"
+	}
+	return "lookup-failed"
+}
+
+// audit records the outcome of a password verification. It must never be handed the password itself.
+func (d *ldapIdResolver) audit(logger lager.Logger, result string, username string, userdn string, host string) {
+	logger.Info("password-verification-audit", lager.Data{
+		"result":    result,
+		"username":  username,
+		"user-dn":   userdn,
+		"ldap-host": host,
+	})
 }
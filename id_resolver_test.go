@@ -11,9 +11,12 @@ import (
 
 	"code.cloudfoundry.org/dockerdriver"
 	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/goshims/ioutilshim/ioutil_fake"
 	"code.cloudfoundry.org/goshims/ldapshim/ldap_fake"
 	"code.cloudfoundry.org/lager/lagertest"
 	"code.cloudfoundry.org/nfsv3driver"
+	"code.cloudfoundry.org/nfsv3driver/nfsdriverfakes"
+	"github.com/onsi/gomega/gbytes"
 	"gopkg.in/ldap.v2"
 )
 
@@ -28,28 +31,50 @@ var _ = Describe("IdResolverTest", func() {
 	var ldapCACert string
 	var ldapTimeout time.Duration
 	var user string
+	var logger *lagertest.TestLogger
+	var throttle nfsv3driver.LoginThrottle
+	var svcPass nfsv3driver.Credential
+	var pageSize uint32
+	var maxReferralHops int
+	var fakeIoutil *ioutil_fake.FakeIoutil
+	var hosts []string
+	var filter string
+	var idMapper nfsv3driver.IdMapper
 
 	BeforeEach(func() {
-		logger := lagertest.NewTestLogger("nfs-mounter")
+		logger = lagertest.NewTestLogger("nfs-mounter")
 		testContext := context.TODO()
 		env = driverhttp.NewHttpDriverEnv(logger, testContext)
 
 		user = "user"
+		throttle = nil
+		pageSize = 0
+		maxReferralHops = 0
+		svcPass = nfsv3driver.StaticCredential("svcpw")
+		fakeIoutil = &ioutil_fake.FakeIoutil{}
+		hosts = []string{"host"}
+		filter = ""
+		idMapper = nil
 	})
 
 	JustBeforeEach(func() {
 		ldapIdResolver = nfsv3driver.NewLdapIdResolver(
 			"svcuser",
-			"svcpw",
-			"host",
+			svcPass,
+			hosts,
 			111,
 			"tcp",
 			"cn=Users,dc=test,dc=com",
+			filter,
 			ldapCACert,
 			ldapFake,
 			ldapTimeout,
+			throttle,
+			pageSize,
+			maxReferralHops,
+			idMapper,
 		)
-		uid, gid, err = ldapIdResolver.Resolve(env, user, "pw")
+		uid, gid, _, err = ldapIdResolver.Resolve(env, user, "pw")
 	})
 
 	Context("when the connection is successful", func() {
@@ -136,10 +161,37 @@ z6sbK6WkL0AwPEcI/HzUOrsAUBtyY8cfy6yVcuQ=
 				Expect(timeLimit).To(Equal(0))
 				Expect(typesOnly).To(BeFalse())
 				Expect(filter).To(Equal("(&(objectClass=User)(cn=user))"))
-				Expect(attributes).To(ConsistOf("dn", "uidNumber", "gidNumber"))
+				Expect(attributes).To(ConsistOf("dn", "uidNumber", "gidNumber", "memberOf", "userAccountControl", "msDS-User-Account-Control-Computed", "pwdLastSet", "accountExpires", "pwdAccountLockedTime", "pwdReset"))
 				Expect(controls).To(BeNil())
 			})
 
+			Context("when a search filter is configured", func() {
+				BeforeEach(func() {
+					filter = "(&(objectClass=person)(sAMAccountName=%s))"
+					user = "us(er"
+				})
+
+				It("searches with the configured filter and an escaped username", func() {
+					_, _, _, _, _, _, filter, _, _ := ldapFake.NewSearchRequestArgsForCall(0)
+					Expect(filter).To(Equal(`(&(objectClass=person)(sAMAccountName=us\28er))`))
+				})
+			})
+
+			Context("when the first host cannot be reached", func() {
+				BeforeEach(func() {
+					hosts = []string{"host", "backup-host"}
+					ldapFake.DialReturnsOnCall(0, nil, errors.New("connection refused"))
+				})
+
+				It("fails over to the next host", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(ldapFake.DialCallCount()).To(Equal(2))
+					_, addr := ldapFake.DialArgsForCall(1)
+					Expect(addr).To(Equal("backup-host:111"))
+					Expect(logger.Buffer()).To(gbytes.Say(`password-verification-audit.*"ldap-host":"backup-host"`))
+				})
+			})
+
 			It("set timeout for connection", func() {
 				Expect(ldapConnectionFake.SetTimeoutCallCount()).To(Equal(1))
 			})
@@ -153,6 +205,69 @@ z6sbK6WkL0AwPEcI/HzUOrsAUBtyY8cfy6yVcuQ=
 				Expect(gid).To(Equal("100"))
 			})
 
+			It("writes an audit record without the password", func() {
+				Expect(logger.Buffer()).To(gbytes.Say(`password-verification-audit.*"result":"success".*"user-dn":"foo".*"username":"user"`))
+				Expect(logger.Buffer()).NotTo(gbytes.Say("pw"))
+			})
+
+			Context("when a login throttle is configured", func() {
+				var fakeThrottle *nfsdriverfakes.FakeLoginThrottle
+
+				BeforeEach(func() {
+					fakeThrottle = &nfsdriverfakes.FakeLoginThrottle{}
+					throttle = fakeThrottle
+					env = nfsv3driver.WithLoginSource(env, "vol1")
+				})
+
+				It("records the success for the login source", func() {
+					Expect(fakeThrottle.AllowCallCount()).To(Equal(1))
+					source, username := fakeThrottle.AllowArgsForCall(0)
+					Expect(source).To(Equal("vol1"))
+					Expect(username).To(Equal("user"))
+					Expect(fakeThrottle.RecordSuccessCallCount()).To(Equal(1))
+					source, username = fakeThrottle.RecordSuccessArgsForCall(0)
+					Expect(source).To(Equal("vol1"))
+					Expect(username).To(Equal("user"))
+					Expect(fakeThrottle.RecordFailureCallCount()).To(Equal(0))
+				})
+
+				Context("when the credentials are not good", func() {
+					BeforeEach(func() {
+						ldapConnectionFake.BindStub = func(u, p string) error {
+							if u == "svcuser" {
+								return nil
+							}
+							return errors.New("badness")
+						}
+					})
+
+					It("records the failure", func() {
+						Expect(err).To(HaveOccurred())
+						Expect(fakeThrottle.RecordFailureCallCount()).To(Equal(1))
+						source, username := fakeThrottle.RecordFailureArgsForCall(0)
+						Expect(source).To(Equal("vol1"))
+						Expect(username).To(Equal("user"))
+						Expect(fakeThrottle.RecordSuccessCallCount()).To(Equal(0))
+					})
+				})
+
+				Context("when the throttle refuses the attempt", func() {
+					BeforeEach(func() {
+						fakeThrottle.AllowReturns(dockerdriver.SafeError{SafeDescription: nfsv3driver.TooManyFailedLoginsErrorMessage})
+					})
+
+					It("fails without contacting the LDAP server", func() {
+						Expect(err).To(MatchError(nfsv3driver.TooManyFailedLoginsErrorMessage))
+						Expect(ldapFake.DialCallCount()).To(Equal(0))
+						Expect(fakeThrottle.RecordFailureCallCount()).To(Equal(0))
+					})
+
+					It("writes an audit record", func() {
+						Expect(logger.Buffer()).To(gbytes.Say(`password-verification-audit.*"result":"throttled"`))
+					})
+				})
+			})
+
 			Context("when the credentials are not good", func() {
 				BeforeEach(func() {
 					ldapConnectionFake.BindStub = func(u, p string) error {
@@ -170,6 +285,441 @@ z6sbK6WkL0AwPEcI/HzUOrsAUBtyY8cfy6yVcuQ=
 					Expect(ldapConnectionFake.SearchCallCount()).To(Equal(1))
 					Expect(uid).To(BeEmpty())
 				})
+
+				It("writes an audit record for the failure", func() {
+					Expect(logger.Buffer()).To(gbytes.Say(`password-verification-audit.*"result":"failure".*"username":"user"`))
+				})
+			})
+
+			Context("when Active Directory explains why the bind failed", func() {
+				var fakeThrottle *nfsdriverfakes.FakeLoginThrottle
+
+				BeforeEach(func() {
+					fakeThrottle = &nfsdriverfakes.FakeLoginThrottle{}
+					throttle = fakeThrottle
+				})
+
+				bindFailsWith := func(data string) {
+					ldapConnectionFake.BindStub = func(u, p string) error {
+						if u == "svcuser" {
+							return nil
+						}
+						return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("80090308: LdapErr: DSID-0C09042F, comment: AcceptSecurityContext error, data "+data+", v2580"))
+					}
+				}
+
+				Context("when the account is disabled", func() {
+					BeforeEach(func() {
+						bindFailsWith("533")
+					})
+
+					It("returns a specific safe error with its code", func() {
+						Expect(err).To(MatchError("account disabled (error code ACCOUNT_DISABLED)"))
+						Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+					})
+
+					It("does not count it as a failed password", func() {
+						Expect(fakeThrottle.RecordFailureCallCount()).To(Equal(0))
+					})
+
+					It("writes an audit record", func() {
+						Expect(logger.Buffer()).To(gbytes.Say(`password-verification-audit.*"result":"ACCOUNT_DISABLED"`))
+					})
+				})
+
+				Context("when the account is locked", func() {
+					BeforeEach(func() {
+						bindFailsWith("775")
+					})
+
+					It("returns a specific safe error with its code", func() {
+						Expect(err).To(MatchError("account locked (error code ACCOUNT_LOCKED)"))
+					})
+				})
+
+				Context("when the password has expired", func() {
+					BeforeEach(func() {
+						bindFailsWith("532")
+					})
+
+					It("returns a specific safe error with its code", func() {
+						Expect(err).To(MatchError("password expired (error code PASSWORD_EXPIRED)"))
+					})
+				})
+
+				Context("when the password is simply wrong", func() {
+					BeforeEach(func() {
+						bindFailsWith("52e")
+					})
+
+					It("returns the invalid credentials error and counts the failure", func() {
+						Expect(err).To(Equal(dockerdriver.SafeError{SafeDescription: nfsv3driver.InvalidCredentialsErrorMessage}))
+						Expect(fakeThrottle.RecordFailureCallCount()).To(Equal(1))
+					})
+				})
+			})
+
+			Context("when the user's ids cannot be used", func() {
+				returnEntryWith := func(attributes ...*ldap.EntryAttribute) {
+					ldapConnectionFake.SearchReturns(&ldap.SearchResult{Entries: []*ldap.Entry{{DN: "foo", Attributes: attributes}}}, nil)
+				}
+
+				Context("when the user has no uidNumber", func() {
+					BeforeEach(func() {
+						returnEntryWith()
+					})
+
+					It("rejects the user", func() {
+						Expect(err).To(MatchError(nfsv3driver.MissingUidNumberErrorMessage))
+						Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+					})
+				})
+
+				Context("when the user's uidNumber is 0", func() {
+					BeforeEach(func() {
+						returnEntryWith(&ldap.EntryAttribute{Name: "uidNumber", Values: []string{"0"}})
+					})
+
+					It("rejects the user", func() {
+						Expect(err).To(MatchError(nfsv3driver.InvalidUidNumberErrorMessage))
+					})
+				})
+
+				Context("when the user's gidNumber is out of range", func() {
+					BeforeEach(func() {
+						returnEntryWith(
+							&ldap.EntryAttribute{Name: "uidNumber", Values: []string{"100"}},
+							&ldap.EntryAttribute{Name: "gidNumber", Values: []string{"4294967296"}},
+						)
+					})
+
+					It("rejects the user", func() {
+						Expect(err).To(MatchError(nfsv3driver.InvalidGidNumberErrorMessage))
+					})
+				})
+			})
+
+			Context("when id mapping is enabled", func() {
+				BeforeEach(func() {
+					idMapper, err = nfsv3driver.NewSidIdMapper(nfsv3driver.SidIdMapperConfig{
+						RangeMin:         200000,
+						RangeMax:         2000200000,
+						RangeSize:        200000,
+						DefaultDomainSid: "S-1-5-21-1-2-3",
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					ldapConnectionFake.SearchReturns(&ldap.SearchResult{Entries: []*ldap.Entry{{
+						DN: "foo",
+						Attributes: []*ldap.EntryAttribute{
+							{Name: "uidNumber", Values: []string{"100"}},
+							{Name: "objectSid", ByteValues: [][]byte{binarySid(21, 1, 2, 3, 1105)}},
+							{Name: "primaryGroupID", Values: []string{"513"}},
+						},
+					}}}, nil)
+				})
+
+				It("requests the objectSid and primaryGroupID", func() {
+					_, _, _, _, _, _, _, attributes, _ := ldapFake.NewSearchRequestArgsForCall(0)
+					Expect(attributes).To(ContainElement("objectSid"))
+					Expect(attributes).To(ContainElement("primaryGroupID"))
+				})
+
+				It("derives the ids from the objectSid", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(uid).To(Equal("201105"))
+					Expect(gid).To(Equal("200513"))
+				})
+			})
+
+			Context("when the account attributes say it may not be used", func() {
+				returnEntryWith := func(attributes ...*ldap.EntryAttribute) {
+					ldapConnectionFake.SearchReturns(&ldap.SearchResult{Entries: []*ldap.Entry{{
+						DN: "foo",
+						Attributes: append([]*ldap.EntryAttribute{
+							{Name: "uidNumber", Values: []string{"100"}},
+							{Name: "gidNumber", Values: []string{"100"}},
+						}, attributes...),
+					}}}, nil)
+				}
+
+				rejectsWhen := func(description string, attribute *ldap.EntryAttribute, expected string) {
+					Context(description, func() {
+						BeforeEach(func() {
+							returnEntryWith(attribute)
+						})
+
+						It("returns a specific safe error with its code", func() {
+							Expect(err).To(MatchError(expected))
+							Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+							Expect(uid).To(BeEmpty())
+						})
+					})
+				}
+
+				rejectsWhen("when userAccountControl has ACCOUNTDISABLE", &ldap.EntryAttribute{Name: "userAccountControl", Values: []string{"514"}}, "account disabled (error code ACCOUNT_DISABLED)")
+				rejectsWhen("when the computed account control has LOCKOUT", &ldap.EntryAttribute{Name: "msDS-User-Account-Control-Computed", Values: []string{"16"}}, "account locked (error code ACCOUNT_LOCKED)")
+				rejectsWhen("when the computed account control has PASSWORD_EXPIRED", &ldap.EntryAttribute{Name: "msDS-User-Account-Control-Computed", Values: []string{"8388608"}}, "password expired (error code PASSWORD_EXPIRED)")
+				rejectsWhen("when accountExpires is in the past", &ldap.EntryAttribute{Name: "accountExpires", Values: []string{"131592384000000000"}}, "account expired (error code ACCOUNT_EXPIRED)")
+				rejectsWhen("when pwdLastSet is 0", &ldap.EntryAttribute{Name: "pwdLastSet", Values: []string{"0"}}, "password must be changed before first use (error code PASSWORD_MUST_CHANGE)")
+				rejectsWhen("when ppolicy has locked the account", &ldap.EntryAttribute{Name: "pwdAccountLockedTime", Values: []string{"20200101000000Z"}}, "account locked (error code ACCOUNT_LOCKED)")
+				rejectsWhen("when ppolicy requires a password reset", &ldap.EntryAttribute{Name: "pwdReset", Values: []string{"TRUE"}}, "password must be changed before first use (error code PASSWORD_MUST_CHANGE)")
+
+				Context("when the computed account control is only returned to a base search", func() {
+					var computed string
+
+					BeforeEach(func() {
+						computed = "16"
+						ldapFake.NewSearchRequestStub = ldap.NewSearchRequest
+						ldapConnectionFake.SearchStub = func(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+							entry := &ldap.Entry{
+								DN: "foo",
+								Attributes: []*ldap.EntryAttribute{
+									{Name: "uidNumber", Values: []string{"100"}},
+									{Name: "gidNumber", Values: []string{"100"}},
+								},
+							}
+							if request.Scope == ldap.ScopeBaseObject {
+								entry.Attributes = append(entry.Attributes, &ldap.EntryAttribute{Name: "msDS-User-Account-Control-Computed", Values: []string{computed}})
+							}
+							return &ldap.SearchResult{Entries: []*ldap.Entry{entry}}, nil
+						}
+					})
+
+					It("re-reads the user's entry after they have bound", func() {
+						Expect(ldapConnectionFake.SearchCallCount()).To(Equal(2))
+						request := ldapConnectionFake.SearchArgsForCall(1)
+						Expect(request.BaseDN).To(Equal("foo"))
+						Expect(request.Scope).To(Equal(ldap.ScopeBaseObject))
+						Expect(request.Attributes).To(ContainElement("msDS-User-Account-Control-Computed"))
+					})
+
+					It("sees the lockout", func() {
+						Expect(err).To(MatchError("account locked (error code ACCOUNT_LOCKED)"))
+						Expect(uid).To(BeEmpty())
+					})
+
+					Context("when the account is not locked", func() {
+						BeforeEach(func() {
+							computed = "0"
+						})
+
+						It("resolves the user", func() {
+							Expect(err).NotTo(HaveOccurred())
+							Expect(uid).To(Equal("100"))
+						})
+					})
+
+					Context("when the entry cannot be re-read", func() {
+						BeforeEach(func() {
+							ldapConnectionFake.SearchStub = nil
+							ldapConnectionFake.SearchReturnsOnCall(1, nil, errors.New("insufficient access"))
+							returnEntryWith(&ldap.EntryAttribute{Name: "userAccountControl", Values: []string{"514"}})
+						})
+
+						It("goes by the entry it looked up", func() {
+							Expect(err).To(MatchError("account disabled (error code ACCOUNT_DISABLED)"))
+							Expect(logger.Buffer()).To(gbytes.Say("reread-account-status-failed"))
+						})
+					})
+				})
+
+				Context("when the account is enabled and never expires", func() {
+					BeforeEach(func() {
+						returnEntryWith(
+							&ldap.EntryAttribute{Name: "userAccountControl", Values: []string{"66048"}},
+							&ldap.EntryAttribute{Name: "accountExpires", Values: []string{"9223372036854775807"}},
+							&ldap.EntryAttribute{Name: "pwdLastSet", Values: []string{"0"}},
+						)
+					})
+
+					It("resolves the user", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(uid).To(Equal("100"))
+					})
+				})
+
+				Context("when accountExpires is in the future", func() {
+					BeforeEach(func() {
+						returnEntryWith(&ldap.EntryAttribute{Name: "accountExpires", Values: []string{"441481536000000000"}})
+					})
+
+					It("resolves the user", func() {
+						Expect(err).NotTo(HaveOccurred())
+					})
+				})
+			})
+		})
+
+		Context("when paging is enabled", func() {
+			var entry *ldap.Entry
+
+			BeforeEach(func() {
+				pageSize = 2
+				ldapFake.NewSearchRequestStub = ldap.NewSearchRequest
+
+				entry = &ldap.Entry{
+					DN: "foo",
+					Attributes: []*ldap.EntryAttribute{
+						{Name: "uidNumber", Values: []string{"100"}},
+						{Name: "gidNumber", Values: []string{"200"}},
+					},
+				}
+
+				ldapConnectionFake.SearchReturnsOnCall(0, &ldap.SearchResult{
+					Controls: []ldap.Control{&ldap.ControlPaging{PagingSize: 2, Cookie: []byte("next-page")}},
+				}, nil)
+				ldapConnectionFake.SearchReturnsOnCall(1, &ldap.SearchResult{
+					Entries:  []*ldap.Entry{entry},
+					Controls: []ldap.Control{&ldap.ControlPaging{PagingSize: 2}},
+				}, nil)
+			})
+
+			It("requests a paged search", func() {
+				_, _, _, _, _, _, _, _, controls := ldapFake.NewSearchRequestArgsForCall(0)
+				Expect(controls).To(HaveLen(1))
+				Expect(controls[0].(*ldap.ControlPaging).PagingSize).To(Equal(uint32(2)))
+			})
+
+			It("fetches pages until the server stops returning a cookie", func() {
+				// the third search re-reads the account status of the user once they have bound
+				Expect(ldapConnectionFake.SearchCallCount()).To(Equal(3))
+				request := ldapConnectionFake.SearchArgsForCall(1)
+				Expect(string(request.Controls[0].(*ldap.ControlPaging).Cookie)).To(Equal("next-page"))
+			})
+
+			It("finds the user on a later page", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(uid).To(Equal("100"))
+				Expect(gid).To(Equal("200"))
+			})
+
+			Context("when several pages contain the user", func() {
+				BeforeEach(func() {
+					ldapConnectionFake.SearchReturnsOnCall(0, &ldap.SearchResult{
+						Entries:  []*ldap.Entry{entry},
+						Controls: []ldap.Control{&ldap.ControlPaging{PagingSize: 2, Cookie: []byte("next-page")}},
+					}, nil)
+				})
+
+				It("reports an ambiguous search", func() {
+					Expect(err).To(MatchError("Ambiguous search--too many results"))
+				})
+			})
+		})
+
+		Context("when the search returns a referral", func() {
+			var referralConnectionFake *ldap_fake.FakeLdapConnection
+
+			BeforeEach(func() {
+				referralConnectionFake = &ldap_fake.FakeLdapConnection{}
+				ldapFake.DialReturnsOnCall(1, referralConnectionFake, nil)
+
+				ldapConnectionFake.SearchReturns(&ldap.SearchResult{
+					Referrals: []string{"ldap://child.test.com/DC=child,DC=test,DC=com"},
+				}, nil)
+				referralConnectionFake.SearchReturns(&ldap.SearchResult{
+					Entries: []*ldap.Entry{{
+						DN: "cn=user,DC=child,DC=test,DC=com",
+						Attributes: []*ldap.EntryAttribute{
+							{Name: "uidNumber", Values: []string{"300"}},
+							{Name: "gidNumber", Values: []string{"400"}},
+						},
+					}},
+				}, nil)
+			})
+
+			Context("when referral chasing is disabled", func() {
+				It("does not follow the referral", func() {
+					Expect(err).To(MatchError(nfsv3driver.UserDoesNotExistErrorMessage))
+					Expect(ldapFake.DialCallCount()).To(Equal(1))
+				})
+			})
+
+			Context("when referral chasing is enabled", func() {
+				BeforeEach(func() {
+					maxReferralHops = 1
+				})
+
+				It("connects to the referred server", func() {
+					Expect(ldapFake.DialCallCount()).To(Equal(2))
+					protocol, addr := ldapFake.DialArgsForCall(1)
+					Expect(protocol).To(Equal("tcp"))
+					Expect(addr).To(Equal("child.test.com:389"))
+					Expect(referralConnectionFake.SetTimeoutCallCount()).To(Equal(1))
+				})
+
+				It("reuses the service account credentials", func() {
+					user, password := referralConnectionFake.BindArgsForCall(0)
+					Expect(user).To(Equal("svcuser"))
+					Expect(password).To(Equal("svcpw"))
+				})
+
+				It("searches the referred base DN", func() {
+					baseDN, _, _, _, _, _, filter, _, _ := ldapFake.NewSearchRequestArgsForCall(1)
+					Expect(baseDN).To(Equal("DC=child,DC=test,DC=com"))
+					Expect(filter).To(Equal("(&(objectClass=User)(cn=user))"))
+				})
+
+				It("verifies the password against the server holding the account", func() {
+					Expect(ldapConnectionFake.BindCallCount()).To(Equal(1))
+					Expect(referralConnectionFake.BindCallCount()).To(Equal(2))
+					user, password := referralConnectionFake.BindArgsForCall(1)
+					Expect(user).To(Equal("cn=user,DC=child,DC=test,DC=com"))
+					Expect(password).To(Equal("pw"))
+				})
+
+				It("returns the referred user's ids", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(uid).To(Equal("300"))
+					Expect(gid).To(Equal("400"))
+				})
+
+				It("closes the referral connection", func() {
+					Expect(referralConnectionFake.CloseCallCount()).To(Equal(1))
+				})
+
+				Context("when the referred server refers again beyond the hop limit", func() {
+					BeforeEach(func() {
+						referralConnectionFake.SearchReturns(&ldap.SearchResult{
+							Referrals: []string{"ldaps://grandchild.test.com:3269/DC=grandchild,DC=test,DC=com"},
+						}, nil)
+					})
+
+					It("stops following referrals", func() {
+						Expect(err).To(MatchError(nfsv3driver.UserDoesNotExistErrorMessage))
+						Expect(ldapFake.DialCallCount()).To(Equal(2))
+						Expect(ldapFake.DialTLSCallCount()).To(Equal(0))
+						Expect(logger.Buffer()).To(gbytes.Say("referral-hop-limit-reached"))
+					})
+
+					Context("when the hop limit allows it", func() {
+						BeforeEach(func() {
+							maxReferralHops = 2
+							grandchildConnectionFake := &ldap_fake.FakeLdapConnection{}
+							grandchildConnectionFake.SearchReturns(&ldap.SearchResult{}, nil)
+							ldapFake.DialTLSReturns(grandchildConnectionFake, nil)
+						})
+
+						It("connects to ldaps referrals over TLS", func() {
+							Expect(ldapFake.DialTLSCallCount()).To(Equal(1))
+							_, addr, config := ldapFake.DialTLSArgsForCall(0)
+							Expect(addr).To(Equal("grandchild.test.com:3269"))
+							Expect(config.ServerName).To(Equal("grandchild.test.com"))
+						})
+					})
+				})
+
+				Context("when the referred server cannot be reached", func() {
+					BeforeEach(func() {
+						ldapFake.DialReturnsOnCall(1, nil, errors.New("unreachable"))
+					})
+
+					It("skips the referral", func() {
+						Expect(err).To(MatchError(nfsv3driver.UserDoesNotExistErrorMessage))
+						Expect(logger.Buffer()).To(gbytes.Say("referral-dial-failed"))
+					})
+				})
 			})
 		})
 
@@ -248,6 +798,26 @@ z6sbK6WkL0AwPEcI/HzUOrsAUBtyY8cfy6yVcuQ=
 				Expect(err.Error()).To(ContainSubstring("User does not exist"))
 				Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
 			})
+
+			It("writes an audit record", func() {
+				Expect(logger.Buffer()).To(gbytes.Say(`password-verification-audit.*"result":"user-not-found".*"username":"user"`))
+			})
+
+			Context("when a login throttle is configured", func() {
+				var fakeThrottle *nfsdriverfakes.FakeLoginThrottle
+
+				BeforeEach(func() {
+					fakeThrottle = &nfsdriverfakes.FakeLoginThrottle{}
+					throttle = fakeThrottle
+					env = nfsv3driver.WithLoginSource(env, "vol1")
+				})
+
+				It("counts the attempt against the login source", func() {
+					Expect(fakeThrottle.RecordSourceFailureCallCount()).To(Equal(1))
+					Expect(fakeThrottle.RecordSourceFailureArgsForCall(0)).To(Equal("vol1"))
+					Expect(fakeThrottle.RecordFailureCallCount()).To(Equal(0))
+				})
+			})
 		})
 
 		Context("when the search returns multiple results", func() {
@@ -272,6 +842,43 @@ z6sbK6WkL0AwPEcI/HzUOrsAUBtyY8cfy6yVcuQ=
 				Expect(err.Error()).To(ContainSubstring("Ambiguous search--too many results"))
 				Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
 			})
+
+			It("writes an audit record", func() {
+				Expect(logger.Buffer()).To(gbytes.Say(`password-verification-audit.*"result":"ambiguous"`))
+			})
+		})
+	})
+
+	Context("when the service account password cannot be read", func() {
+		BeforeEach(func() {
+			ldapFake = &ldap_fake.FakeLdap{}
+			ldapConnectionFake = &ldap_fake.FakeLdapConnection{}
+			ldapFake.DialReturns(ldapConnectionFake, nil)
+			ldapCACert = ""
+			svcPass = nfsv3driver.NewFileCredential(fakeIoutil, "/some/file")
+			fakeIoutil.ReadFileReturns(nil, errors.New("no such file"))
+		})
+
+		It("returns an error without binding", func() {
+			Expect(err).To(MatchError("no such file"))
+			Expect(ldapConnectionFake.BindCallCount()).To(Equal(0))
+		})
+
+		It("writes an audit record", func() {
+			Expect(logger.Buffer()).To(gbytes.Say(`password-verification-audit.*"result":"lookup-failed"`))
+		})
+
+		Context("when the file is readable", func() {
+			BeforeEach(func() {
+				fakeIoutil.ReadFileReturns([]byte("rotated-pw\n"), nil)
+				ldapConnectionFake.SearchReturns(&ldap.SearchResult{}, nil)
+			})
+
+			It("binds with the password read from the file", func() {
+				user, password := ldapConnectionFake.BindArgsForCall(0)
+				Expect(user).To(Equal("svcuser"))
+				Expect(password).To(Equal("rotated-pw"))
+			})
 		})
 	})
 
@@ -291,5 +898,118 @@ z6sbK6WkL0AwPEcI/HzUOrsAUBtyY8cfy6yVcuQ=
 			Expect(err).To(MatchError("LDAP server could not be reached, please contact your system administrator"))
 			Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
 		})
+
+		It("writes an audit record", func() {
+			Expect(logger.Buffer()).To(gbytes.Say(`password-verification-audit.*"result":"unreachable"`))
+		})
+
+		Context("when a login throttle is configured", func() {
+			var fakeThrottle *nfsdriverfakes.FakeLoginThrottle
+
+			BeforeEach(func() {
+				fakeThrottle = &nfsdriverfakes.FakeLoginThrottle{}
+				throttle = fakeThrottle
+				env = nfsv3driver.WithLoginSource(env, "vol1")
+			})
+
+			It("does not hold the outage against the login source", func() {
+				Expect(fakeThrottle.RecordSourceFailureCallCount()).To(Equal(0))
+				Expect(fakeThrottle.RecordFailureCallCount()).To(Equal(0))
+			})
+		})
+	})
+})
+
+var _ = Describe("IdResolver Validate", func() {
+	var (
+		ldapFake           *ldap_fake.FakeLdap
+		ldapConnectionFake *ldap_fake.FakeLdapConnection
+		env                dockerdriver.Env
+		attributes         []*ldap.EntryAttribute
+		err                error
+	)
+
+	BeforeEach(func() {
+		env = driverhttp.NewHttpDriverEnv(lagertest.NewTestLogger("ldap-validate"), context.TODO())
+
+		ldapFake = &ldap_fake.FakeLdap{}
+		ldapConnectionFake = &ldap_fake.FakeLdapConnection{}
+		ldapFake.DialReturns(ldapConnectionFake, nil)
+		attributes = nil
+	})
+
+	JustBeforeEach(func() {
+		ldapConnectionFake.SearchReturns(&ldap.SearchResult{Entries: []*ldap.Entry{{
+			DN: "cn=user,cn=Users,dc=test,dc=com",
+			Attributes: append([]*ldap.EntryAttribute{
+				{Name: "uidNumber", Values: []string{"100"}},
+			}, attributes...),
+		}}}, nil)
+
+		resolver := nfsv3driver.NewLdapIdResolver("svcuser", nfsv3driver.StaticCredential("svcpw"), []string{"host"}, 111, "tcp", "cn=Users,dc=test,dc=com", "", "", ldapFake, time.Minute, nil, 0, 0, nil)
+		err = resolver.Validate(env, "user")
+	})
+
+	It("accepts an enabled user using only the service account", func() {
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ldapConnectionFake.BindCallCount()).To(Equal(1))
+		bindUser, _ := ldapConnectionFake.BindArgsForCall(0)
+		Expect(bindUser).To(Equal("svcuser"))
+		Expect(ldapConnectionFake.CloseCallCount()).To(Equal(1))
+	})
+
+	Context("when the account has been disabled", func() {
+		BeforeEach(func() {
+			attributes = []*ldap.EntryAttribute{{Name: "userAccountControl", Values: []string{"514"}}}
+		})
+
+		It("reports the identity as revoked", func() {
+			Expect(err).To(MatchError("account disabled (error code ACCOUNT_DISABLED)"))
+			Expect(nfsv3driver.IsIdentityRevoked(err)).To(BeTrue())
+		})
+	})
+
+	Context("when the account has expired", func() {
+		BeforeEach(func() {
+			attributes = []*ldap.EntryAttribute{{Name: "accountExpires", Values: []string{"131592384000000000"}}}
+		})
+
+		It("reports the identity as revoked", func() {
+			Expect(nfsv3driver.IsIdentityRevoked(err)).To(BeTrue())
+		})
+	})
+
+	Context("when the account is only locked out", func() {
+		BeforeEach(func() {
+			attributes = []*ldap.EntryAttribute{{Name: "msDS-User-Account-Control-Computed", Values: []string{"16"}}}
+		})
+
+		It("accepts the user", func() {
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("when the user has been removed", func() {
+		JustBeforeEach(func() {
+			ldapConnectionFake.SearchReturns(&ldap.SearchResult{}, nil)
+			resolver := nfsv3driver.NewLdapIdResolver("svcuser", nfsv3driver.StaticCredential("svcpw"), []string{"host"}, 111, "tcp", "cn=Users,dc=test,dc=com", "", "", ldapFake, time.Minute, nil, 0, 0, nil)
+			err = resolver.Validate(env, "user")
+		})
+
+		It("reports the identity as revoked", func() {
+			Expect(err).To(MatchError(nfsv3driver.UserDoesNotExistErrorMessage))
+			Expect(nfsv3driver.IsIdentityRevoked(err)).To(BeTrue())
+		})
+	})
+
+	Context("when the directory cannot be reached", func() {
+		BeforeEach(func() {
+			ldapFake.DialReturns(nil, errors.New("unable to reach ldap server"))
+		})
+
+		It("does not report the identity as revoked", func() {
+			Expect(err).To(HaveOccurred())
+			Expect(nfsv3driver.IsIdentityRevoked(err)).To(BeFalse())
+		})
 	})
 })
@@ -0,0 +1,264 @@
+package nfsv3driver
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/nfsv3driver/driveradmin"
+)
+
+// RevalidationAction is what the revalidator does with a mount whose user has been disabled or removed.
+type RevalidationAction string
+
+const (
+	RevalidationActionLog     RevalidationAction = "log"
+	RevalidationActionFlag    RevalidationAction = "flag"
+	RevalidationActionUnmount RevalidationAction = "unmount"
+)
+
+// VolumeUnmounter releases a volume through the driver, so that the driver's own bookkeeping stays in step.
+//
+//go:generate counterfeiter -o nfsdriverfakes/fake_volume_unmounter.go . VolumeUnmounter
+type VolumeUnmounter interface {
+	Unmount(env dockerdriver.Env, unmountRequest dockerdriver.UnmountRequest) dockerdriver.ErrorResponse
+}
+
+type trackedMount struct {
+	username  string
+	unhealthy *driveradmin.UnhealthyMount
+}
+
+// IdentityRevalidator periodically checks that the users behind LDAP-backed mounts still exist and are enabled,
+// and acts on the mounts of those that do not. Failures to reach the directory are logged and never acted on.
+type IdentityRevalidator struct {
+	logger   lager.Logger
+	clock    clock.Clock
+	resolver IdResolver
+	interval time.Duration
+	action   RevalidationAction
+
+	lock      sync.Mutex
+	mounts    map[string]*trackedMount
+	unmounter VolumeUnmounter
+}
+
+func NewIdentityRevalidator(logger lager.Logger, clock clock.Clock, resolver IdResolver, interval time.Duration, action RevalidationAction) *IdentityRevalidator {
+	return &IdentityRevalidator{
+		logger:   logger.Session("identity-revalidator"),
+		clock:    clock,
+		resolver: resolver,
+		interval: interval,
+		action:   action,
+		mounts:   map[string]*trackedMount{},
+	}
+}
+
+// SetVolumeUnmounter supplies the driver that revoked mounts are released through. It is needed for the unmount
+// action only, and is set once the driver has been created around the mounter.
+func (r *IdentityRevalidator) SetVolumeUnmounter(unmounter VolumeUnmounter) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.unmounter = unmounter
+}
+
+func (r *IdentityRevalidator) Track(target string, username string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.mounts[target] = &trackedMount{username: username}
+}
+
+// TrackRestored tracks the volumes that volumes, the driver, restored from its state still mounted and that recorder
+// recorded as mounted with the 'username' option, so that the mounts made before a restart are revalidated too.
+func (r *IdentityRevalidator) TrackRestored(env dockerdriver.Env, volumes VolumeLister, recorder *MountRecorder) {
+	logger := env.Logger().Session("track-restored")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	records := recorder.records(logger)
+	for _, volume := range volumes.List(env).Volumes {
+		record, ok := records[volume.Name]
+		if !ok || record.Username == "" || volume.Mountpoint == "" || volume.MountCount < 1 {
+			continue
+		}
+
+		logger.Info("tracking", lager.Data{"target": volume.Mountpoint, "username": record.Username})
+		r.Track(volume.Mountpoint, record.Username)
+	}
+}
+
+func (r *IdentityRevalidator) Forget(target string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.mounts, target)
+}
+
+func (r *IdentityRevalidator) UnhealthyMounts() []driveradmin.UnhealthyMount {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	mounts := []driveradmin.UnhealthyMount{}
+	for _, mount := range r.mounts {
+		if mount.unhealthy != nil {
+			mounts = append(mounts, *mount.unhealthy)
+		}
+	}
+	sort.Slice(mounts, func(i, j int) bool { return mounts[i].Target < mounts[j].Target })
+
+	return mounts
+}
+
+func (r *IdentityRevalidator) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	ticker := r.clock.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	close(ready)
+
+	for {
+		select {
+		case <-ticker.C():
+			r.Revalidate(driverhttp.NewHttpDriverEnv(r.logger, context.Background()))
+		case <-signals:
+			return nil
+		}
+	}
+}
+
+// Revalidate checks the user behind every tracked mount once.
+func (r *IdentityRevalidator) Revalidate(env dockerdriver.Env) {
+	logger := env.Logger().Session("revalidate")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	r.lock.Lock()
+	usernames := map[string]string{}
+	for target, mount := range r.mounts {
+		usernames[target] = mount.username
+	}
+	r.lock.Unlock()
+
+	for target, username := range usernames {
+		data := lager.Data{"target": target, "username": username}
+
+		err := r.resolver.Validate(env, username)
+		if err != nil && !IsIdentityRevoked(err) {
+			logger.Error("validate-failed", err, data)
+			continue
+		}
+
+		if err == nil {
+			r.markHealthy(target)
+			continue
+		}
+
+		logger.Info("identity-revoked", lager.Data{"target": target, "username": username, "reason": err.Error(), "action": r.action})
+
+		switch r.action {
+		case RevalidationActionFlag:
+			r.markUnhealthy(target, err.Error())
+		case RevalidationActionUnmount:
+			if err := r.unmount(env, target); err != nil {
+				logger.Error("unmount-failed", err, data)
+				r.markUnhealthy(target, err.Error())
+			}
+		}
+	}
+}
+
+func (r *IdentityRevalidator) markHealthy(target string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if mount, ok := r.mounts[target]; ok {
+		mount.unhealthy = nil
+	}
+}
+
+func (r *IdentityRevalidator) markUnhealthy(target string, reason string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	mount, ok := r.mounts[target]
+	if !ok {
+		return
+	}
+
+	since := r.clock.Now()
+	if mount.unhealthy != nil {
+		since = mount.unhealthy.Since
+	}
+	mount.unhealthy = &driveradmin.UnhealthyMount{Target: target, Username: mount.username, Reason: reason, Since: since}
+}
+
+func (r *IdentityRevalidator) tracked(target string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	_, ok := r.mounts[target]
+	return ok
+}
+
+// unmount releases every reference the driver holds on the volume mounted at target. The driver names the mount
+// point after the volume, and forgets the mount once the last reference is gone.
+func (r *IdentityRevalidator) unmount(env dockerdriver.Env, target string) error {
+	r.lock.Lock()
+	unmounter := r.unmounter
+	r.lock.Unlock()
+
+	if unmounter == nil {
+		return errors.New("no driver to unmount through")
+	}
+
+	for r.tracked(target) {
+		response := unmounter.Unmount(env, dockerdriver.UnmountRequest{Name: filepath.Base(target)})
+		if response.Err != "" {
+			return errors.New(response.Err)
+		}
+	}
+
+	return nil
+}
+
+type revalidatingMounter struct {
+	ReloadableMounter
+	revalidator *IdentityRevalidator
+}
+
+// NewRevalidatingMounter registers every mount made with the 'username' option with revalidator, and forgets it
+// again once it has been unmounted.
+func NewRevalidatingMounter(mounter ReloadableMounter, revalidator *IdentityRevalidator) ReloadableMounter {
+	return &revalidatingMounter{ReloadableMounter: mounter, revalidator: revalidator}
+}
+
+func (m *revalidatingMounter) Mount(env dockerdriver.Env, remote string, target string, opts map[string]interface{}) error {
+	err := m.ReloadableMounter.Mount(env, remote, target, opts)
+	if err != nil {
+		return err
+	}
+
+	if username, ok := opts["username"].(string); ok {
+		m.revalidator.Track(target, username)
+	}
+	return nil
+}
+
+func (m *revalidatingMounter) Unmount(env dockerdriver.Env, target string) error {
+	err := m.ReloadableMounter.Unmount(env, target)
+	if err != nil {
+		return err
+	}
+
+	m.revalidator.Forget(target)
+	return nil
+}
@@ -0,0 +1,297 @@
+package nfsv3driver_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nfsv3driver"
+	"code.cloudfoundry.org/nfsv3driver/nfsdriverfakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("IdentityRevalidator", func() {
+	var (
+		logger        *lagertest.TestLogger
+		env           dockerdriver.Env
+		fakeClock     *fakeclock.FakeClock
+		fakeResolver  *nfsdriverfakes.FakeIdResolver
+		fakeMounter   *nfsdriverfakes.FakeReloadableMounter
+		fakeUnmounter *nfsdriverfakes.FakeVolumeUnmounter
+		action        nfsv3driver.RevalidationAction
+		revalidator   *nfsv3driver.IdentityRevalidator
+		mounter       nfsv3driver.ReloadableMounter
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("identity-revalidator")
+		env = driverhttp.NewHttpDriverEnv(logger, context.TODO())
+		fakeClock = fakeclock.NewFakeClock(time.Unix(1600000000, 0))
+		fakeResolver = &nfsdriverfakes.FakeIdResolver{}
+		fakeMounter = &nfsdriverfakes.FakeReloadableMounter{}
+		fakeUnmounter = &nfsdriverfakes.FakeVolumeUnmounter{}
+		action = nfsv3driver.RevalidationActionLog
+	})
+
+	JustBeforeEach(func() {
+		revalidator = nfsv3driver.NewIdentityRevalidator(logger, fakeClock, fakeResolver, time.Minute, action)
+		revalidator.SetVolumeUnmounter(fakeUnmounter)
+		mounter = nfsv3driver.NewRevalidatingMounter(fakeMounter, revalidator)
+	})
+
+	mount := func(target string, opts map[string]interface{}) {
+		Expect(mounter.Mount(env, "filer:/share", target, opts)).To(Succeed())
+	}
+
+	Describe("tracking mounts", func() {
+		It("revalidates mounts made with a username", func() {
+			mount("/mnt/vol1", map[string]interface{}{"username": "alice", "password": "pw"})
+			mount("/mnt/vol2", map[string]interface{}{"uid": "100", "gid": "100"})
+
+			revalidator.Revalidate(env)
+
+			Expect(fakeResolver.ValidateCallCount()).To(Equal(1))
+			_, username := fakeResolver.ValidateArgsForCall(0)
+			Expect(username).To(Equal("alice"))
+		})
+
+		It("does not track mounts that failed", func() {
+			fakeMounter.MountReturns(errors.New("mount failed"))
+			Expect(mounter.Mount(env, "filer:/share", "/mnt/vol1", map[string]interface{}{"username": "alice"})).NotTo(Succeed())
+
+			revalidator.Revalidate(env)
+			Expect(fakeResolver.ValidateCallCount()).To(Equal(0))
+		})
+
+		It("stops revalidating a mount once it is unmounted", func() {
+			mount("/mnt/vol1", map[string]interface{}{"username": "alice"})
+			Expect(mounter.Unmount(env, "/mnt/vol1")).To(Succeed())
+
+			revalidator.Revalidate(env)
+			Expect(fakeResolver.ValidateCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("TrackRestored", func() {
+		var (
+			fakeLister *nfsdriverfakes.FakeVolumeLister
+			fakeStore  *nfsdriverfakes.FakeMountRecordStore
+		)
+
+		BeforeEach(func() {
+			fakeLister = &nfsdriverfakes.FakeVolumeLister{}
+			fakeLister.ListReturns(dockerdriver.ListResponse{Volumes: []dockerdriver.VolumeInfo{
+				{Name: "vol1", Mountpoint: "/mnt/vol1", MountCount: 1},
+				{Name: "vol2", Mountpoint: "/mnt/vol2", MountCount: 2},
+				{Name: "vol3"},
+				{Name: "vol4", Mountpoint: "/mnt/vol4", MountCount: 1},
+			}})
+
+			fakeStore = &nfsdriverfakes.FakeMountRecordStore{}
+			fakeStore.LoadReturns(map[string]nfsv3driver.MountRecord{
+				"vol1": {Remote: "filer:/share", Username: "alice", Uid: "100", Gid: "100"},
+				"vol2": {Remote: "filer:/share", Uid: "200", Gid: "200"},
+				"vol3": {Remote: "filer:/share", Username: "carol", Uid: "300", Gid: "300"},
+			}, nil)
+		})
+
+		JustBeforeEach(func() {
+			revalidator.TrackRestored(env, fakeLister, nfsv3driver.NewMountRecorder(fakeStore))
+		})
+
+		It("revalidates the restored mounts that were made with a username", func() {
+			revalidator.Revalidate(env)
+
+			Expect(fakeResolver.ValidateCallCount()).To(Equal(1))
+			_, username := fakeResolver.ValidateArgsForCall(0)
+			Expect(username).To(Equal("alice"))
+		})
+
+		Context("when the user of a restored mount has been disabled", func() {
+			BeforeEach(func() {
+				action = nfsv3driver.RevalidationActionFlag
+				fakeResolver.ValidateReturns(nfsv3driver.AccountStatusError{Code: nfsv3driver.AccountDisabledErrorCode, Description: nfsv3driver.AccountDisabledErrorMessage})
+			})
+
+			It("acts on the mount", func() {
+				revalidator.Revalidate(env)
+
+				unhealthy := revalidator.UnhealthyMounts()
+				Expect(unhealthy).To(HaveLen(1))
+				Expect(unhealthy[0].Target).To(Equal("/mnt/vol1"))
+				Expect(unhealthy[0].Username).To(Equal("alice"))
+			})
+		})
+
+		It("stops revalidating a restored mount once it is unmounted", func() {
+			Expect(mounter.Unmount(env, "/mnt/vol1")).To(Succeed())
+
+			revalidator.Revalidate(env)
+			Expect(fakeResolver.ValidateCallCount()).To(Equal(0))
+		})
+
+		Context("when the mount records cannot be loaded", func() {
+			BeforeEach(func() {
+				fakeStore.LoadReturns(nil, errors.New("corrupt"))
+			})
+
+			It("tracks nothing", func() {
+				revalidator.Revalidate(env)
+				Expect(fakeResolver.ValidateCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Context("when the user is still valid", func() {
+		BeforeEach(func() {
+			action = nfsv3driver.RevalidationActionUnmount
+		})
+
+		It("leaves the mount alone", func() {
+			mount("/mnt/vol1", map[string]interface{}{"username": "alice"})
+			revalidator.Revalidate(env)
+
+			Expect(fakeUnmounter.UnmountCallCount()).To(Equal(0))
+			Expect(revalidator.UnhealthyMounts()).To(BeEmpty())
+		})
+	})
+
+	Context("when the directory cannot be reached", func() {
+		BeforeEach(func() {
+			action = nfsv3driver.RevalidationActionUnmount
+			fakeResolver.ValidateReturns(dockerdriver.SafeError{SafeDescription: "LDAP server could not be reached, please contact your system administrator"})
+		})
+
+		It("logs the failure and does not act on the mount", func() {
+			mount("/mnt/vol1", map[string]interface{}{"username": "alice"})
+			revalidator.Revalidate(env)
+
+			Expect(logger.Buffer()).To(gbytes.Say("validate-failed"))
+			Expect(fakeUnmounter.UnmountCallCount()).To(Equal(0))
+			Expect(revalidator.UnhealthyMounts()).To(BeEmpty())
+		})
+	})
+
+	Context("when the user has been disabled", func() {
+		BeforeEach(func() {
+			fakeResolver.ValidateReturns(nfsv3driver.AccountStatusError{Code: nfsv3driver.AccountDisabledErrorCode, Description: nfsv3driver.AccountDisabledErrorMessage})
+		})
+
+		JustBeforeEach(func() {
+			mount("/mnt/vol1", map[string]interface{}{"username": "alice"})
+		})
+
+		Context("when the action is log", func() {
+			It("only logs", func() {
+				revalidator.Revalidate(env)
+
+				Expect(logger.Buffer()).To(gbytes.Say(`identity-revoked.*"action":"log"`))
+				Expect(revalidator.UnhealthyMounts()).To(BeEmpty())
+				Expect(fakeUnmounter.UnmountCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the action is flag", func() {
+			BeforeEach(func() {
+				action = nfsv3driver.RevalidationActionFlag
+			})
+
+			It("reports the mount as unhealthy", func() {
+				revalidator.Revalidate(env)
+
+				unhealthy := revalidator.UnhealthyMounts()
+				Expect(unhealthy).To(HaveLen(1))
+				Expect(unhealthy[0].Target).To(Equal("/mnt/vol1"))
+				Expect(unhealthy[0].Username).To(Equal("alice"))
+				Expect(unhealthy[0].Reason).To(Equal("account disabled (error code ACCOUNT_DISABLED)"))
+				Expect(unhealthy[0].Since).To(Equal(time.Unix(1600000000, 0)))
+			})
+
+			It("keeps the time the mount was first flagged", func() {
+				revalidator.Revalidate(env)
+				fakeClock.Increment(time.Hour)
+				revalidator.Revalidate(env)
+
+				Expect(revalidator.UnhealthyMounts()[0].Since).To(Equal(time.Unix(1600000000, 0)))
+			})
+
+			It("clears the flag when the user is enabled again", func() {
+				revalidator.Revalidate(env)
+				fakeResolver.ValidateReturns(nil)
+				revalidator.Revalidate(env)
+
+				Expect(revalidator.UnhealthyMounts()).To(BeEmpty())
+			})
+		})
+
+		Context("when the action is unmount", func() {
+			BeforeEach(func() {
+				action = nfsv3driver.RevalidationActionUnmount
+
+				// the driver unmounts once its last reference is released
+				fakeUnmounter.UnmountStub = func(env dockerdriver.Env, request dockerdriver.UnmountRequest) dockerdriver.ErrorResponse {
+					if fakeUnmounter.UnmountCallCount() == 2 {
+						Expect(mounter.Unmount(env, "/mnt/vol1")).To(Succeed())
+					}
+					return dockerdriver.ErrorResponse{}
+				}
+			})
+
+			It("releases every reference to the volume through the driver", func() {
+				revalidator.Revalidate(env)
+
+				Expect(fakeUnmounter.UnmountCallCount()).To(Equal(2))
+				_, request := fakeUnmounter.UnmountArgsForCall(0)
+				Expect(request.Name).To(Equal("vol1"))
+				Expect(fakeMounter.UnmountCallCount()).To(Equal(1))
+				Expect(revalidator.UnhealthyMounts()).To(BeEmpty())
+			})
+
+			Context("when the driver fails to unmount", func() {
+				BeforeEach(func() {
+					fakeUnmounter.UnmountStub = nil
+					fakeUnmounter.UnmountReturns(dockerdriver.ErrorResponse{Err: "Error unmounting volume: busy"})
+				})
+
+				It("flags the mount as unhealthy", func() {
+					revalidator.Revalidate(env)
+
+					Expect(logger.Buffer()).To(gbytes.Say("unmount-failed"))
+					unhealthy := revalidator.UnhealthyMounts()
+					Expect(unhealthy).To(HaveLen(1))
+					Expect(unhealthy[0].Reason).To(Equal("Error unmounting volume: busy"))
+				})
+			})
+		})
+	})
+
+	Describe("Run", func() {
+		var process ifrit.Process
+
+		JustBeforeEach(func() {
+			mount("/mnt/vol1", map[string]interface{}{"username": "alice"})
+			process = ifrit.Invoke(revalidator)
+		})
+
+		AfterEach(func() {
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+		})
+
+		It("revalidates every interval", func() {
+			fakeClock.WaitForWatcherAndIncrement(time.Minute)
+			Eventually(fakeResolver.ValidateCallCount).Should(Equal(1))
+
+			fakeClock.Increment(time.Minute)
+			Eventually(fakeResolver.ValidateCallCount).Should(Equal(2))
+		})
+	})
+})
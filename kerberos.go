@@ -0,0 +1,417 @@
+package nfsv3driver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/goshims/osshim"
+	"code.cloudfoundry.org/lager"
+)
+
+const InvalidSecErrorMessage = "Invalid 'sec' option (must be one of 'sys', 'krb5', 'krb5i' or 'krb5p')"
+const KerberosNotConfiguredErrorMessage = "Kerberos security is specified but Kerberos is not configured"
+const KerberosRequiresCredentialsErrorMessage = "Kerberos security requires the 'username' and 'password' options"
+const KerberosTicketErrorMessage = "Unable to obtain a Kerberos ticket for the user"
+
+// KerberosSecurityFlavors are the values of the 'sec' option that need a ticket for the bound user.
+var KerberosSecurityFlavors = []string{"krb5", "krb5i", "krb5p"}
+
+// KerberosClient obtains, renews and destroys the tickets in a credential cache.
+//
+//go:generate counterfeiter -o nfsdriverfakes/fake_kerberos_client.go . KerberosClient
+type KerberosClient interface {
+	Kinit(env dockerdriver.Env, principal, password, ccache string) error
+	Renew(env dockerdriver.Env, ccache string) error
+	Destroy(env dockerdriver.Env, ccache string) error
+}
+
+type kinitClient struct {
+	kinitPath         string
+	kdestroyPath      string
+	renewableLifetime time.Duration
+}
+
+// NewKinitClient returns a KerberosClient that runs the MIT kinit and kdestroy commands. The password is written to
+// kinit's standard input so that it never appears in a command line.
+func NewKinitClient(kinitPath, kdestroyPath string, renewableLifetime time.Duration) KerberosClient {
+	return &kinitClient{
+		kinitPath:         kinitPath,
+		kdestroyPath:      kdestroyPath,
+		renewableLifetime: renewableLifetime,
+	}
+}
+
+func (c *kinitClient) Kinit(env dockerdriver.Env, principal, password, ccache string) error {
+	args := []string{"-c", ccache}
+	if c.renewableLifetime > 0 {
+		args = append(args, "-r", fmt.Sprintf("%ds", int64(c.renewableLifetime/time.Second)))
+	}
+	args = append(args, principal)
+
+	cmd := exec.CommandContext(env.Context(), c.kinitPath, args...)
+	cmd.Stdin = strings.NewReader(password + "\n")
+	return c.run(cmd)
+}
+
+func (c *kinitClient) Renew(env dockerdriver.Env, ccache string) error {
+	return c.run(exec.CommandContext(env.Context(), c.kinitPath, "-R", "-c", ccache))
+}
+
+func (c *kinitClient) Destroy(env dockerdriver.Env, ccache string) error {
+	return c.run(exec.CommandContext(env.Context(), c.kdestroyPath, "-c", ccache))
+}
+
+func (c *kinitClient) run(cmd *exec.Cmd) error {
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %s", err.Error(), strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// KerberosCredentials keeps a credential cache for the user behind each Kerberos secured mount.
+//
+//go:generate counterfeiter -o nfsdriverfakes/fake_kerberos_credentials.go . KerberosCredentials
+type KerberosCredentials interface {
+	Acquire(env dockerdriver.Env, target, username, password string, uid int) error
+	Adopt(env dockerdriver.Env, target, username string, uid int) error
+	Release(env dockerdriver.Env, target string)
+}
+
+type kerberosCache struct {
+	principal string
+	ccache    string
+}
+
+// KerberosTicketManager obtains a ticket for the user behind each Kerberos secured mount, stores it in a credential
+// cache owned by the mapped uid where rpc.gssd looks for user credentials, and renews it until the volume is
+// unmounted. Tickets can only be renewed up to the renewable lifetime the KDC grants. The caches are named after
+// the volume they are for, so that the ones left by an earlier run can be taken over with Restore.
+//
+// The credential cache directory must only be accessible by the user the driver runs as, so that no one else can
+// plant a cache, or a link, where the driver writes one; rpc.gssd has to be pointed at it with its -d flag.
+type KerberosTicketManager struct {
+	logger    lager.Logger
+	clock     clock.Clock
+	client    KerberosClient
+	osshim    osshim.Os
+	ccacheDir string
+	realm     string
+	interval  time.Duration
+
+	lock   sync.Mutex
+	caches map[string]kerberosCache // by volume, the base name of the mount's target
+}
+
+func NewKerberosTicketManager(logger lager.Logger, clock clock.Clock, client KerberosClient, osshim osshim.Os, ccacheDir, realm string, renewInterval time.Duration) *KerberosTicketManager {
+	return &KerberosTicketManager{
+		logger:    logger.Session("kerberos-ticket-manager"),
+		clock:     clock,
+		client:    client,
+		osshim:    osshim,
+		ccacheDir: ccacheDir,
+		realm:     realm,
+		interval:  renewInterval,
+		caches:    map[string]kerberosCache{},
+	}
+}
+
+// Acquire obtains a ticket for username into a credential cache for the mount at target. rpc.gssd only uses a
+// cache in its credential cache directory whose name starts with krb5cc_ and that is owned by the uid accessing
+// the share. kinit writes the ticket to a hidden file, which rpc.gssd and Restore ignore, that is handed to the uid
+// and then renamed over the cache, so that a cache is never written or handed over through a link.
+func (k *KerberosTicketManager) Acquire(env dockerdriver.Env, target, username, password string, uid int) error {
+	logger := env.Logger().Session("acquire")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	principal := username
+	if k.realm != "" && !strings.Contains(principal, "@") {
+		principal = principal + "@" + k.realm
+	}
+	ccache := filepath.Join(k.ccacheDir, fmt.Sprintf("krb5cc_%d_%s", uid, filepath.Base(target)))
+	temporary := filepath.Join(k.ccacheDir, "."+filepath.Base(ccache))
+	data := lager.Data{"target": target, "principal": principal, "ccache": ccache}
+
+	err := k.checkCcacheDir()
+	if err != nil {
+		logger.Error("unsafe-ccache-dir", err, data)
+		return dockerdriver.SafeError{SafeDescription: KerberosTicketErrorMessage}
+	}
+	err = k.checkCcache(ccache, uid)
+	if err != nil {
+		logger.Error("unsafe-ccache", err, data)
+		return dockerdriver.SafeError{SafeDescription: KerberosTicketErrorMessage}
+	}
+	if err = k.osshim.Remove(temporary); err != nil && !k.osshim.IsNotExist(err) {
+		logger.Error("remove-temporary-ccache-failed", err, data)
+		return dockerdriver.SafeError{SafeDescription: KerberosTicketErrorMessage}
+	}
+
+	err = k.client.Kinit(env, principal, password, "FILE:"+temporary)
+	if err != nil {
+		logger.Error("kinit-failed", err, data)
+		return dockerdriver.SafeError{SafeDescription: KerberosTicketErrorMessage}
+	}
+
+	err = k.osshim.Lchown(temporary, uid, -1)
+	if err != nil {
+		logger.Error("chown-ccache-failed", err, data)
+		k.destroy(env, logger, kerberosCache{principal: principal, ccache: temporary})
+		return dockerdriver.SafeError{SafeDescription: KerberosTicketErrorMessage}
+	}
+
+	err = k.osshim.Rename(temporary, ccache)
+	if err != nil {
+		logger.Error("rename-ccache-failed", err, data)
+		k.destroy(env, logger, kerberosCache{principal: principal, ccache: temporary})
+		return dockerdriver.SafeError{SafeDescription: KerberosTicketErrorMessage}
+	}
+
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	k.caches[filepath.Base(target)] = kerberosCache{principal: principal, ccache: ccache}
+	logger.Info("ticket-acquired", data)
+	return nil
+}
+
+// Adopt makes the credential cache an earlier run of the driver left for the mount at target that of the new mount
+// there, for a volume mounted again as the identity it was recorded with, whose password is not known. The cache
+// must have been restored, and still be a regular file owned by uid.
+func (k *KerberosTicketManager) Adopt(env dockerdriver.Env, target, username string, uid int) error {
+	logger := env.Logger().Session("adopt")
+
+	principal := username
+	if k.realm != "" && !strings.Contains(principal, "@") {
+		principal = principal + "@" + k.realm
+	}
+	ccache := filepath.Join(k.ccacheDir, fmt.Sprintf("krb5cc_%d_%s", uid, filepath.Base(target)))
+	data := lager.Data{"target": target, "principal": principal, "ccache": ccache}
+
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	cache, ok := k.caches[filepath.Base(target)]
+	if !ok || cache.ccache != ccache {
+		logger.Info("no-ccache", data)
+		return dockerdriver.SafeError{SafeDescription: KerberosRequiresCredentialsErrorMessage}
+	}
+	if err := k.checkRestorable(ccache, uid); err != nil {
+		logger.Error("unusable-ccache", err, data)
+		delete(k.caches, filepath.Base(target))
+		return dockerdriver.SafeError{SafeDescription: KerberosRequiresCredentialsErrorMessage}
+	}
+
+	k.caches[filepath.Base(target)] = kerberosCache{principal: principal, ccache: ccache}
+	logger.Info("ccache-adopted", data)
+	return nil
+}
+
+// Release destroys the credential cache of the mount at target, if it has one.
+func (k *KerberosTicketManager) Release(env dockerdriver.Env, target string) {
+	logger := env.Logger().Session("release")
+
+	k.lock.Lock()
+	cache, ok := k.caches[filepath.Base(target)]
+	delete(k.caches, filepath.Base(target))
+	k.lock.Unlock()
+
+	if ok {
+		k.destroy(env, logger, cache)
+	}
+}
+
+// Restore takes over the credential caches an earlier run of the driver left in the credential cache directory for
+// the volumes that are still mounted, so that their tickets keep being renewed and are destroyed once the volumes
+// are unmounted. mountPoints are the mount points on the host, which are looked at once the mounts have been
+// reconciled, so that a cache is only taken over for a mount that survived. A cache is taken over only if it is a
+// regular file owned by the uid in its name; the caches of volumes that are no longer mounted are destroyed, and
+// those that fail the check are removed without being looked at. Caches that the driver did not name, such as ones
+// rpc.gssd keeps for itself, are left alone.
+func (k *KerberosTicketManager) Restore(env dockerdriver.Env, mountPoints []string) {
+	logger := env.Logger().Session("restore")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	if err := k.checkCcacheDir(); err != nil {
+		logger.Error("unsafe-ccache-dir", err)
+		return
+	}
+
+	mounted := map[string]bool{}
+	for _, mountPoint := range mountPoints {
+		mounted[strings.TrimSuffix(filepath.Base(mountPoint), MapfsDirectorySuffix)] = true
+	}
+
+	// the hidden caches that an interrupted Acquire left were never handed to anyone
+	temporaries, err := filepath.Glob(filepath.Join(k.ccacheDir, ".krb5cc_*_*"))
+	if err != nil {
+		logger.Error("list-temporary-ccaches-failed", err)
+	}
+	for _, path := range temporaries {
+		k.remove(logger, kerberosCache{ccache: path})
+	}
+
+	paths, err := filepath.Glob(filepath.Join(k.ccacheDir, "krb5cc_*_*"))
+	if err != nil {
+		logger.Error("list-ccaches-failed", err)
+		return
+	}
+
+	for _, path := range paths {
+		parts := strings.SplitN(strings.TrimPrefix(filepath.Base(path), "krb5cc_"), "_", 2)
+		uid, err := strconv.Atoi(parts[0])
+		if err != nil || parts[1] == "" {
+			continue
+		}
+		data := lager.Data{"volume": parts[1], "ccache": path}
+
+		if err := k.checkRestorable(path, uid); err != nil {
+			logger.Error("ccache-refused", err, data)
+			k.remove(logger, kerberosCache{ccache: path})
+			continue
+		}
+		if !mounted[parts[1]] {
+			logger.Info("ccache-of-unmounted-volume-destroyed", data)
+			k.destroy(env, logger, kerberosCache{ccache: path})
+			continue
+		}
+
+		k.lock.Lock()
+		if _, ok := k.caches[parts[1]]; !ok {
+			k.caches[parts[1]] = kerberosCache{ccache: path}
+			logger.Info("ccache-restored", data)
+		}
+		k.lock.Unlock()
+	}
+}
+
+// checkRestorable makes sure that a credential cache left by an earlier run is a regular file owned by uid, rather
+// than something planted, or a link, that the driver would be renewing tickets in.
+func (k *KerberosTicketManager) checkRestorable(ccache string, uid int) error {
+	info, err := k.osshim.Lstat(ccache)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", ccache)
+	}
+	if owner, ok := fileOwner(info); !ok || owner != uid {
+		return fmt.Errorf("%s is not owned by uid %d", ccache, uid)
+	}
+	return nil
+}
+
+// checkCcacheDir creates the credential cache directory if it is missing, and makes sure it is a directory, not a
+// link to one, that belongs to the user the driver runs as and that no one else can get into.
+func (k *KerberosTicketManager) checkCcacheDir() error {
+	err := k.osshim.MkdirAll(k.ccacheDir, 0700)
+	if err != nil {
+		return err
+	}
+
+	info, err := k.osshim.Lstat(k.ccacheDir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", k.ccacheDir)
+	}
+	if owner, ok := fileOwner(info); !ok || owner != k.osshim.Geteuid() {
+		return fmt.Errorf("%s is not owned by the driver", k.ccacheDir)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("%s is accessible by other users", k.ccacheDir)
+	}
+	return nil
+}
+
+// checkCcache refuses a credential cache that is there already unless it is a regular file owned by the driver or
+// by uid, such as the cache of an earlier mount of the volume.
+func (k *KerberosTicketManager) checkCcache(ccache string, uid int) error {
+	info, err := k.osshim.Lstat(ccache)
+	if err != nil {
+		if k.osshim.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", ccache)
+	}
+	if owner, ok := fileOwner(info); !ok || (owner != uid && owner != k.osshim.Geteuid()) {
+		return fmt.Errorf("%s is owned by another user", ccache)
+	}
+	return nil
+}
+
+func fileOwner(info os.FileInfo) (int, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int(stat.Uid), true
+}
+
+func (k *KerberosTicketManager) destroy(env dockerdriver.Env, logger lager.Logger, cache kerberosCache) {
+	if err := k.client.Destroy(env, "FILE:"+cache.ccache); err != nil {
+		logger.Error("kdestroy-failed", err, lager.Data{"principal": cache.principal, "ccache": cache.ccache})
+	}
+	k.remove(logger, cache)
+}
+
+// remove removes a credential cache without kdestroy, which would follow a link.
+func (k *KerberosTicketManager) remove(logger lager.Logger, cache kerberosCache) {
+	if err := k.osshim.Remove(cache.ccache); err != nil && !k.osshim.IsNotExist(err) {
+		logger.Error("remove-ccache-failed", err, lager.Data{"principal": cache.principal, "ccache": cache.ccache})
+	}
+}
+
+func (k *KerberosTicketManager) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	ticker := k.clock.NewTicker(k.interval)
+	defer ticker.Stop()
+
+	close(ready)
+
+	for {
+		select {
+		case <-ticker.C():
+			k.Renew(driverhttp.NewHttpDriverEnv(k.logger, context.Background()))
+		case <-signals:
+			return nil
+		}
+	}
+}
+
+// Renew renews the ticket in every credential cache once.
+func (k *KerberosTicketManager) Renew(env dockerdriver.Env) {
+	logger := env.Logger().Session("renew")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	k.lock.Lock()
+	caches := map[string]kerberosCache{}
+	for volume, cache := range k.caches {
+		caches[volume] = cache
+	}
+	k.lock.Unlock()
+
+	for volume, cache := range caches {
+		err := k.client.Renew(env, "FILE:"+cache.ccache)
+		if err != nil {
+			logger.Error("renew-failed", err, lager.Data{"volume": volume, "principal": cache.principal, "ccache": cache.ccache})
+		}
+	}
+}
@@ -0,0 +1,472 @@
+package nfsv3driver_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/goshims/osshim/os_fake"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nfsv3driver"
+	"code.cloudfoundry.org/nfsv3driver/nfsdriverfakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/tedsuo/ifrit"
+)
+
+type ownedInfo struct {
+	os.FileInfo
+	mode os.FileMode
+	uid  uint32
+}
+
+func (i ownedInfo) Mode() os.FileMode { return i.mode }
+func (i ownedInfo) IsDir() bool       { return i.mode.IsDir() }
+func (i ownedInfo) Sys() interface{}  { return &syscall.Stat_t{Uid: i.uid} }
+
+var _ = Describe("KerberosTicketManager", func() {
+	const ccacheDir = "/var/vcap/data/nfsv3driver/ccaches"
+
+	var (
+		logger     *lagertest.TestLogger
+		env        dockerdriver.Env
+		fakeClock  *fakeclock.FakeClock
+		fakeClient *nfsdriverfakes.FakeKerberosClient
+		fakeOs     *os_fake.FakeOs
+		entries    map[string]os.FileInfo
+		realm      string
+		manager    *nfsv3driver.KerberosTicketManager
+		err        error
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("kerberos-ticket-manager")
+		env = driverhttp.NewHttpDriverEnv(logger, context.TODO())
+		fakeClock = fakeclock.NewFakeClock(time.Unix(1600000000, 0))
+		fakeClient = &nfsdriverfakes.FakeKerberosClient{}
+		fakeOs = &os_fake.FakeOs{}
+		entries = map[string]os.FileInfo{ccacheDir: ownedInfo{mode: os.ModeDir | 0700}}
+		fakeOs.LstatStub = func(name string) (os.FileInfo, error) {
+			if info, ok := entries[name]; ok {
+				return info, nil
+			}
+			return nil, os.ErrNotExist
+		}
+		fakeOs.IsNotExistStub = os.IsNotExist
+		realm = "CORP.EXAMPLE.COM"
+	})
+
+	JustBeforeEach(func() {
+		manager = nfsv3driver.NewKerberosTicketManager(logger, fakeClock, fakeClient, fakeOs, ccacheDir, realm, time.Hour)
+		err = manager.Acquire(env, "/var/vcap/data/volumes/nfs/vol1", "alice", "secret", 1000)
+	})
+
+	Describe("Acquire", func() {
+		It("obtains a ticket into a cache owned by the mapped uid", func() {
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeClient.KinitCallCount()).To(Equal(1))
+			_, principal, password, ccache := fakeClient.KinitArgsForCall(0)
+			Expect(principal).To(Equal("alice@CORP.EXAMPLE.COM"))
+			Expect(password).To(Equal("secret"))
+			Expect(ccache).To(Equal("FILE:" + ccacheDir + "/.krb5cc_1000_vol1"))
+
+			Expect(fakeOs.ChownCallCount()).To(Equal(0))
+			Expect(fakeOs.LchownCallCount()).To(Equal(1))
+			path, uid, gid := fakeOs.LchownArgsForCall(0)
+			Expect(path).To(Equal(ccacheDir + "/.krb5cc_1000_vol1"))
+			Expect(uid).To(Equal(1000))
+			Expect(gid).To(Equal(-1))
+
+			Expect(fakeOs.RenameCallCount()).To(Equal(1))
+			from, to := fakeOs.RenameArgsForCall(0)
+			Expect(from).To(Equal(ccacheDir + "/.krb5cc_1000_vol1"))
+			Expect(to).To(Equal(ccacheDir + "/krb5cc_1000_vol1"))
+		})
+
+		It("creates the credential cache directory for the driver alone", func() {
+			dir, perm := fakeOs.MkdirAllArgsForCall(0)
+			Expect(dir).To(Equal(ccacheDir))
+			Expect(perm).To(Equal(os.FileMode(0700)))
+		})
+
+		Context("when the credential cache directory is accessible by other users", func() {
+			BeforeEach(func() {
+				entries[ccacheDir] = ownedInfo{mode: os.ModeDir | os.ModeSticky | 0777}
+			})
+
+			It("refuses to obtain a ticket", func() {
+				Expect(err).To(MatchError(nfsv3driver.KerberosTicketErrorMessage))
+				Expect(fakeClient.KinitCallCount()).To(Equal(0))
+				Expect(logger.Buffer()).To(gbytes.Say("unsafe-ccache-dir.*is accessible by other users"))
+			})
+		})
+
+		Context("when the credential cache directory belongs to another user", func() {
+			BeforeEach(func() {
+				entries[ccacheDir] = ownedInfo{mode: os.ModeDir | 0700, uid: 1000}
+			})
+
+			It("refuses to obtain a ticket", func() {
+				Expect(err).To(MatchError(nfsv3driver.KerberosTicketErrorMessage))
+				Expect(fakeClient.KinitCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the credential cache directory is a link", func() {
+			BeforeEach(func() {
+				entries[ccacheDir] = ownedInfo{mode: os.ModeSymlink | 0777}
+			})
+
+			It("refuses to obtain a ticket", func() {
+				Expect(err).To(MatchError(nfsv3driver.KerberosTicketErrorMessage))
+				Expect(fakeClient.KinitCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when a link has been planted in place of the cache", func() {
+			BeforeEach(func() {
+				entries[ccacheDir+"/krb5cc_1000_vol1"] = ownedInfo{mode: os.ModeSymlink | 0777, uid: 1000}
+			})
+
+			It("refuses to obtain a ticket", func() {
+				Expect(err).To(MatchError(nfsv3driver.KerberosTicketErrorMessage))
+				Expect(fakeClient.KinitCallCount()).To(Equal(0))
+				Expect(fakeOs.LchownCallCount()).To(Equal(0))
+				Expect(logger.Buffer()).To(gbytes.Say("unsafe-ccache.*is not a regular file"))
+			})
+		})
+
+		Context("when the cache belongs to another user", func() {
+			BeforeEach(func() {
+				entries[ccacheDir+"/krb5cc_1000_vol1"] = ownedInfo{mode: 0600, uid: 2000}
+			})
+
+			It("refuses to obtain a ticket", func() {
+				Expect(err).To(MatchError(nfsv3driver.KerberosTicketErrorMessage))
+				Expect(fakeClient.KinitCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the cache of an earlier mount is still there", func() {
+			BeforeEach(func() {
+				entries[ccacheDir+"/krb5cc_1000_vol1"] = ownedInfo{mode: 0600, uid: 1000}
+			})
+
+			It("replaces it", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fakeOs.RenameCallCount()).To(Equal(1))
+			})
+		})
+
+		It("does not log the password", func() {
+			Expect(string(logger.Buffer().Contents())).NotTo(ContainSubstring("secret"))
+		})
+
+		Context("when the username has a realm", func() {
+			BeforeEach(func() {
+				realm = ""
+			})
+
+			It("uses the username as the principal", func() {
+				_, principal, _, _ := fakeClient.KinitArgsForCall(0)
+				Expect(principal).To(Equal("alice"))
+			})
+		})
+
+		Context("when kinit fails", func() {
+			BeforeEach(func() {
+				fakeClient.KinitReturns(errors.New("kinit: Password incorrect while getting initial credentials"))
+			})
+
+			It("returns a safe error and logs the details", func() {
+				Expect(err).To(MatchError(nfsv3driver.KerberosTicketErrorMessage))
+				Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+				Expect(logger.Buffer()).To(gbytes.Say("kinit-failed.*Password incorrect"))
+			})
+		})
+
+		Context("when the cache cannot be handed to the uid", func() {
+			BeforeEach(func() {
+				fakeOs.LchownReturns(errors.New("operation not permitted"))
+			})
+
+			It("destroys the cache", func() {
+				Expect(err).To(MatchError(nfsv3driver.KerberosTicketErrorMessage))
+				Expect(fakeClient.DestroyCallCount()).To(Equal(1))
+				_, ccache := fakeClient.DestroyArgsForCall(0)
+				Expect(ccache).To(Equal("FILE:" + ccacheDir + "/.krb5cc_1000_vol1"))
+				Expect(fakeOs.RenameCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the cache cannot be moved into place", func() {
+			BeforeEach(func() {
+				fakeOs.RenameReturns(errors.New("no space left on device"))
+			})
+
+			It("destroys the cache", func() {
+				Expect(err).To(MatchError(nfsv3driver.KerberosTicketErrorMessage))
+				Expect(fakeClient.DestroyCallCount()).To(Equal(1))
+				_, ccache := fakeClient.DestroyArgsForCall(0)
+				Expect(ccache).To(Equal("FILE:" + ccacheDir + "/.krb5cc_1000_vol1"))
+			})
+		})
+	})
+
+	Describe("Release", func() {
+		It("destroys the cache of the mount", func() {
+			manager.Release(env, "/var/vcap/data/volumes/nfs/vol1")
+
+			Expect(fakeClient.DestroyCallCount()).To(Equal(1))
+			_, ccache := fakeClient.DestroyArgsForCall(0)
+			Expect(ccache).To(Equal("FILE:" + ccacheDir + "/krb5cc_1000_vol1"))
+			Expect(fakeOs.RemoveArgsForCall(1)).To(Equal(ccacheDir + "/krb5cc_1000_vol1"))
+		})
+
+		It("stops renewing the ticket", func() {
+			manager.Release(env, "/var/vcap/data/volumes/nfs/vol1")
+			manager.Renew(env)
+
+			Expect(fakeClient.RenewCallCount()).To(Equal(0))
+		})
+
+		It("ignores mounts without a cache", func() {
+			manager.Release(env, "/var/vcap/data/volumes/nfs/vol2")
+
+			Expect(fakeClient.DestroyCallCount()).To(Equal(0))
+		})
+
+		Context("when kdestroy has already removed the cache", func() {
+			BeforeEach(func() {
+				fakeOs.RemoveReturns(os.ErrNotExist)
+				fakeOs.IsNotExistReturns(true)
+			})
+
+			It("does not log an error", func() {
+				manager.Release(env, "/var/vcap/data/volumes/nfs/vol1")
+
+				Expect(string(logger.Buffer().Contents())).NotTo(ContainSubstring("remove-ccache-failed"))
+			})
+		})
+	})
+
+	Describe("Renew", func() {
+		It("renews every cache", func() {
+			manager.Renew(env)
+
+			Expect(fakeClient.RenewCallCount()).To(Equal(1))
+			_, ccache := fakeClient.RenewArgsForCall(0)
+			Expect(ccache).To(Equal("FILE:" + ccacheDir + "/krb5cc_1000_vol1"))
+		})
+
+		Context("when the ticket can no longer be renewed", func() {
+			BeforeEach(func() {
+				fakeClient.RenewReturns(errors.New("kinit: Ticket expired while renewing credentials"))
+			})
+
+			It("logs the failure", func() {
+				manager.Renew(env)
+
+				Expect(logger.Buffer()).To(gbytes.Say(`renew-failed.*"principal":"alice@CORP.EXAMPLE.COM"`))
+			})
+		})
+	})
+
+	Describe("Restore", func() {
+		var (
+			restoreDir string
+			restarted  *nfsv3driver.KerberosTicketManager
+		)
+
+		BeforeEach(func() {
+			var err error
+			restoreDir, err = ioutil.TempDir("", "ccaches")
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, name := range []string{"krb5cc_1000_vol1", "krb5cc_2000_vol2", "krb5cc_3000_vol3", "krb5cc_4000_vol4", "krb5cc_5000_vol5", ".krb5cc_1000_vol6", "krb5cc_0", "krb5cc_machine_CORP.EXAMPLE.COM"} {
+				Expect(ioutil.WriteFile(filepath.Join(restoreDir, name), []byte("ticket"), 0600)).To(Succeed())
+			}
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(restoreDir)).To(Succeed())
+		})
+
+		JustBeforeEach(func() {
+			entries = map[string]os.FileInfo{
+				restoreDir: ownedInfo{mode: os.ModeDir | 0700},
+				filepath.Join(restoreDir, "krb5cc_1000_vol1"): ownedInfo{mode: 0600, uid: 1000},
+				filepath.Join(restoreDir, "krb5cc_2000_vol2"): ownedInfo{mode: 0600, uid: 2000},
+				filepath.Join(restoreDir, "krb5cc_3000_vol3"): ownedInfo{mode: 0600, uid: 1000},
+				filepath.Join(restoreDir, "krb5cc_4000_vol4"): ownedInfo{mode: 0600, uid: 4000},
+				filepath.Join(restoreDir, "krb5cc_5000_vol5"): ownedInfo{mode: os.ModeSymlink | 0777, uid: 5000},
+			}
+			fakeClient = &nfsdriverfakes.FakeKerberosClient{}
+			lstat := fakeOs.LstatStub
+			fakeOs = &os_fake.FakeOs{}
+			fakeOs.LstatStub = lstat
+			fakeOs.IsNotExistStub = os.IsNotExist
+
+			restarted = nfsv3driver.NewKerberosTicketManager(logger, fakeClock, fakeClient, fakeOs, restoreDir, realm, time.Hour)
+			restarted.Restore(env, []string{
+				"/var/vcap/data/volumes/nfs/vol1",
+				"/var/vcap/data/volumes/nfs/vol1_mapfs",
+				"/var/vcap/data/volumes/nfs/vol2_mapfs",
+				"/var/vcap/data/volumes/nfs/vol3",
+				"/var/vcap/data/volumes/nfs/vol5",
+			})
+		})
+
+		removed := func() []string {
+			var paths []string
+			for i := 0; i < fakeOs.RemoveCallCount(); i++ {
+				paths = append(paths, fakeOs.RemoveArgsForCall(i))
+			}
+			return paths
+		}
+
+		It("keeps renewing the caches of the volumes still mounted", func() {
+			restarted.Renew(env)
+
+			Expect(fakeClient.RenewCallCount()).To(Equal(2))
+			var ccaches []string
+			for i := 0; i < fakeClient.RenewCallCount(); i++ {
+				_, ccache := fakeClient.RenewArgsForCall(i)
+				ccaches = append(ccaches, ccache)
+			}
+			Expect(ccaches).To(ConsistOf(
+				"FILE:"+filepath.Join(restoreDir, "krb5cc_1000_vol1"),
+				"FILE:"+filepath.Join(restoreDir, "krb5cc_2000_vol2"),
+			))
+		})
+
+		It("destroys the caches of volumes that are no longer mounted", func() {
+			Expect(fakeClient.DestroyCallCount()).To(Equal(1))
+			_, ccache := fakeClient.DestroyArgsForCall(0)
+			Expect(ccache).To(Equal("FILE:" + filepath.Join(restoreDir, "krb5cc_4000_vol4")))
+			Expect(removed()).To(ContainElement(filepath.Join(restoreDir, "krb5cc_4000_vol4")))
+		})
+
+		It("removes the caches that are not owned by the uid in their name, or are not files, without kdestroy", func() {
+			Expect(removed()).To(ContainElement(filepath.Join(restoreDir, "krb5cc_3000_vol3")))
+			Expect(removed()).To(ContainElement(filepath.Join(restoreDir, "krb5cc_5000_vol5")))
+			Expect(logger.Buffer()).To(gbytes.Say("ccache-refused.*is not owned by uid 3000"))
+		})
+
+		It("removes the caches an interrupted Acquire left", func() {
+			Expect(removed()).To(ContainElement(filepath.Join(restoreDir, ".krb5cc_1000_vol6")))
+		})
+
+		It("leaves the caches it did not name alone", func() {
+			Expect(removed()).To(ConsistOf(
+				filepath.Join(restoreDir, ".krb5cc_1000_vol6"),
+				filepath.Join(restoreDir, "krb5cc_3000_vol3"),
+				filepath.Join(restoreDir, "krb5cc_4000_vol4"),
+				filepath.Join(restoreDir, "krb5cc_5000_vol5"),
+			))
+
+			restarted.Release(env, "/var/vcap/data/volumes/nfs/0")
+			restarted.Release(env, "/var/vcap/data/volumes/nfs/CORP.EXAMPLE.COM")
+			Expect(fakeClient.DestroyCallCount()).To(Equal(1))
+		})
+
+		It("destroys a restored cache once its volume is unmounted", func() {
+			restarted.Release(env, "/var/vcap/data/volumes/nfs/vol2")
+
+			Expect(fakeClient.DestroyCallCount()).To(Equal(2))
+			_, ccache := fakeClient.DestroyArgsForCall(1)
+			Expect(ccache).To(Equal("FILE:" + filepath.Join(restoreDir, "krb5cc_2000_vol2")))
+			Expect(removed()).To(ContainElement(filepath.Join(restoreDir, "krb5cc_2000_vol2")))
+
+			restarted.Renew(env)
+			Expect(fakeClient.RenewCallCount()).To(Equal(1))
+		})
+
+		Context("when the credential cache directory is not the driver's alone", func() {
+			JustBeforeEach(func() {
+				entries[restoreDir] = ownedInfo{mode: os.ModeDir | 0777}
+				fakeClient = &nfsdriverfakes.FakeKerberosClient{}
+				restarted = nfsv3driver.NewKerberosTicketManager(logger, fakeClock, fakeClient, fakeOs, restoreDir, realm, time.Hour)
+				restarted.Restore(env, []string{"/var/vcap/data/volumes/nfs/vol1"})
+			})
+
+			It("restores nothing", func() {
+				restarted.Renew(env)
+				Expect(fakeClient.RenewCallCount()).To(Equal(0))
+				Expect(fakeClient.DestroyCallCount()).To(Equal(0))
+			})
+		})
+
+		Describe("Adopt", func() {
+			It("lets the volume be mounted again with its restored cache", func() {
+				Expect(restarted.Adopt(env, "/var/vcap/data/volumes/nfs/vol1", "alice", 1000)).To(Succeed())
+				Expect(fakeClient.KinitCallCount()).To(Equal(0))
+			})
+
+			It("refuses a cache that belongs to another uid", func() {
+				err := restarted.Adopt(env, "/var/vcap/data/volumes/nfs/vol2", "alice", 1000)
+				Expect(err).To(MatchError(nfsv3driver.KerberosRequiresCredentialsErrorMessage))
+			})
+
+			It("refuses a volume without a cache", func() {
+				err := restarted.Adopt(env, "/var/vcap/data/volumes/nfs/vol4", "alice", 4000)
+				Expect(err).To(MatchError(nfsv3driver.KerberosRequiresCredentialsErrorMessage))
+			})
+
+			Context("when the cache has been removed since", func() {
+				JustBeforeEach(func() {
+					delete(entries, filepath.Join(restoreDir, "krb5cc_1000_vol1"))
+				})
+
+				It("refuses it and stops renewing it", func() {
+					err := restarted.Adopt(env, "/var/vcap/data/volumes/nfs/vol1", "alice", 1000)
+					Expect(err).To(MatchError(nfsv3driver.KerberosRequiresCredentialsErrorMessage))
+
+					restarted.Renew(env)
+					Expect(fakeClient.RenewCallCount()).To(Equal(1))
+				})
+			})
+
+			Context("when the cache has been replaced by a link since", func() {
+				JustBeforeEach(func() {
+					entries[filepath.Join(restoreDir, "krb5cc_1000_vol1")] = ownedInfo{mode: os.ModeSymlink | 0777, uid: 1000}
+				})
+
+				It("refuses it", func() {
+					err := restarted.Adopt(env, "/var/vcap/data/volumes/nfs/vol1", "alice", 1000)
+					Expect(err).To(MatchError(nfsv3driver.KerberosRequiresCredentialsErrorMessage))
+				})
+			})
+		})
+	})
+
+	Describe("Run", func() {
+		var process ifrit.Process
+
+		JustBeforeEach(func() {
+			process = ifrit.Invoke(manager)
+		})
+
+		AfterEach(func() {
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+		})
+
+		It("renews every interval", func() {
+			fakeClock.WaitForWatcherAndIncrement(time.Hour)
+			Eventually(fakeClient.RenewCallCount).Should(Equal(1))
+
+			fakeClock.Increment(time.Hour)
+			Eventually(fakeClient.RenewCallCount).Should(Equal(2))
+		})
+	})
+})
@@ -0,0 +1,63 @@
+package nfsv3driver
+
+import (
+	"crypto/subtle"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/lager"
+)
+
+// InvalidCredentialsErrorMessage is returned when a user exists but their password is wrong.
+const InvalidCredentialsErrorMessage = "Invalid credentials"
+
+// LocalUser is an account that is resolved without a directory, such as a service account that must keep
+// mounting while LDAP is down.
+type LocalUser struct {
+	Username string
+	Password Credential
+	Uid      string
+	Gid      string
+	Groups   []string
+}
+
+type localIdResolver struct {
+	users map[string]LocalUser
+}
+
+// NewLocalIdResolver returns a resolver for a fixed set of users. Usernames are matched exactly; users that are not
+// in the set are reported as not existing, so that a chained resolver moves on to its next source.
+func NewLocalIdResolver(users ...LocalUser) IdResolver {
+	r := &localIdResolver{users: map[string]LocalUser{}}
+	for _, user := range users {
+		r.users[user.Username] = user
+	}
+	return r
+}
+
+func (r *localIdResolver) Resolve(env dockerdriver.Env, username string, password string) (uid string, gid string, groups []string, err error) {
+	logger := env.Logger().Session("local-resolve", lager.Data{"username": username})
+
+	user, ok := r.users[username]
+	if !ok {
+		return "", "", nil, dockerdriver.SafeError{SafeDescription: UserDoesNotExistErrorMessage}
+	}
+
+	expected, err := user.Password.Value()
+	if err != nil {
+		logger.Error("read-password-failed", err)
+		return "", "", nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(password)) != 1 {
+		logger.Info("invalid-credentials")
+		return "", "", nil, dockerdriver.SafeError{SafeDescription: InvalidCredentialsErrorMessage}
+	}
+
+	return user.Uid, user.Gid, user.Groups, nil
+}
+
+func (r *localIdResolver) Validate(env dockerdriver.Env, username string) error {
+	if _, ok := r.users[username]; !ok {
+		return dockerdriver.SafeError{SafeDescription: UserDoesNotExistErrorMessage}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package nfsv3driver_test
+
+import (
+	"context"
+	"errors"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nfsv3driver"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type failingCredential struct{}
+
+func (failingCredential) Value() (string, error) { return "", errors.New("permission denied") }
+
+var _ = Describe("LocalIdResolver", func() {
+	var (
+		env     dockerdriver.Env
+		subject nfsv3driver.IdResolver
+	)
+
+	BeforeEach(func() {
+		env = driverhttp.NewHttpDriverEnv(lagertest.NewTestLogger("local-id-resolver"), context.TODO())
+		subject = nfsv3driver.NewLocalIdResolver(
+			nfsv3driver.LocalUser{
+				Username: "ci",
+				Password: nfsv3driver.StaticCredential("secret"),
+				Uid:      "3000",
+				Gid:      "3001",
+				Groups:   []string{"Builders"},
+			},
+			nfsv3driver.LocalUser{Username: "broken", Password: failingCredential{}},
+		)
+	})
+
+	It("resolves a user with the right password", func() {
+		uid, gid, groups, err := subject.Resolve(env, "ci", "secret")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(uid).To(Equal("3000"))
+		Expect(gid).To(Equal("3001"))
+		Expect(groups).To(Equal([]string{"Builders"}))
+	})
+
+	It("rejects a wrong password", func() {
+		_, _, _, err := subject.Resolve(env, "ci", "guess")
+		Expect(err).To(Equal(dockerdriver.SafeError{SafeDescription: nfsv3driver.InvalidCredentialsErrorMessage}))
+	})
+
+	It("reports unknown users as not existing", func() {
+		_, _, _, err := subject.Resolve(env, "alice", "secret")
+		Expect(err).To(Equal(dockerdriver.SafeError{SafeDescription: nfsv3driver.UserDoesNotExistErrorMessage}))
+		Expect(subject.Validate(env, "alice")).To(Equal(dockerdriver.SafeError{SafeDescription: nfsv3driver.UserDoesNotExistErrorMessage}))
+		Expect(subject.Validate(env, "ci")).To(Succeed())
+	})
+
+	It("fails when the password cannot be read", func() {
+		_, _, _, err := subject.Resolve(env, "broken", "secret")
+		Expect(err).To(MatchError("permission denied"))
+	})
+})
@@ -0,0 +1,237 @@
+package nfsv3driver
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/goshims/timeshim"
+)
+
+const TooManyFailedLoginsErrorMessage = "Too many failed login attempts, please try again later"
+
+// MaxThrottledLogins is how many usernames, and how many sources, failures are kept for. Once there are as many,
+// failures that no longer block anything are forgotten, and then those whose block ends first, so that failing
+// logins for random usernames, or from many sources, cannot grow the throttle without bounds.
+const MaxThrottledLogins = 10000
+
+//go:generate counterfeiter -o nfsdriverfakes/fake_login_throttle.go . LoginThrottle
+type LoginThrottle interface {
+	Allow(source, username string) error
+	RecordSuccess(source, username string)
+	RecordFailure(source, username string)
+	RecordSourceFailure(source string)
+	Reload(config LoginThrottleConfig)
+}
+
+type loginSourceKey struct{}
+
+// WithLoginSource returns env carrying the client that logins made with it are for, such as the volume being
+// mounted. The platform creates a volume for every binding, so a source stands for one app.
+func WithLoginSource(env dockerdriver.Env, source string) dockerdriver.Env {
+	return driverhttp.EnvWithContext(context.WithValue(env.Context(), loginSourceKey{}, source), env)
+}
+
+// LoginSource returns the client env was given by WithLoginSource, or nothing.
+func LoginSource(env dockerdriver.Env) string {
+	source, _ := env.Context().Value(loginSourceKey{}).(string)
+	return source
+}
+
+type LoginThrottleConfig struct {
+	UserMaxFailures   int           // consecutive failures for one username before it is locked out
+	SourceMaxFailures int           // consecutive failures from one source, across usernames, before it is locked out
+	BaseBackoff       time.Duration // delay imposed after the first failure, doubled for every further failure
+	MaxBackoff        time.Duration
+	LockoutDuration   time.Duration
+}
+
+type failureCounter struct {
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+}
+
+// expired tells whether the counter no longer blocks logins and has been quiet for long enough that its failures
+// are forgotten.
+func (c *failureCounter) expired(now time.Time, quietPeriod time.Duration) bool {
+	return !now.Before(c.blockedUntil) && !now.Before(c.lastFailure.Add(quietPeriod))
+}
+
+type loginThrottle struct {
+	clock  timeshim.Time
+	config LoginThrottleConfig
+
+	lock    sync.Mutex
+	users   map[string]*failureCounter
+	sources map[string]*failureCounter
+}
+
+// NewLoginThrottle returns a throttle that tracks password verification failures by username and by the source,
+// the client or app, that they come from. Every failure blocks further attempts for the username for an
+// exponentially growing backoff, and reaching a max failures setting locks out the username, or the source for
+// every username, for the lockout duration; other sources can still log in. A max failures setting of 0 disables
+// the corresponding lockout. Failures are forgotten once they no longer block and none has followed for the lockout
+// duration, or the max backoff if there is no lockout.
+func NewLoginThrottle(clock timeshim.Time, config LoginThrottleConfig) LoginThrottle {
+	return &loginThrottle{
+		clock:   clock,
+		config:  config,
+		users:   map[string]*failureCounter{},
+		sources: map[string]*failureCounter{},
+	}
+}
+
+// Reload changes the settings that later failures are counted with, keeping the failures already recorded.
+func (t *loginThrottle) Reload(config LoginThrottleConfig) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.config = config
+}
+
+func (t *loginThrottle) Allow(source, username string) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := t.clock.Now()
+	if counter, ok := t.sources[source]; ok && now.Before(counter.blockedUntil) {
+		return dockerdriver.SafeError{SafeDescription: TooManyFailedLoginsErrorMessage}
+	}
+
+	if counter, ok := t.users[username]; ok && now.Before(counter.blockedUntil) {
+		return dockerdriver.SafeError{SafeDescription: TooManyFailedLoginsErrorMessage}
+	}
+
+	return nil
+}
+
+func (t *loginThrottle) RecordSuccess(source, username string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.users, username)
+	delete(t.sources, source)
+}
+
+func (t *loginThrottle) RecordFailure(source, username string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := t.clock.Now()
+
+	counter := t.fail(t.users, username, now)
+	if t.config.UserMaxFailures > 0 && counter.failures >= t.config.UserMaxFailures {
+		counter.blockedUntil = now.Add(t.config.LockoutDuration)
+	} else {
+		counter.blockedUntil = now.Add(t.backoff(counter.failures))
+	}
+
+	// a source is only ever locked out; backing it off would let a single bad password block the source's other users
+	sourceCounter := t.fail(t.sources, source, now)
+	if t.config.SourceMaxFailures > 0 && sourceCounter.failures >= t.config.SourceMaxFailures {
+		sourceCounter.blockedUntil = now.Add(t.config.LockoutDuration)
+	}
+}
+
+// RecordSourceFailure counts a failed login that did not get as far as a password being checked, such as one for a
+// username that does not exist, against the source alone.
+func (t *loginThrottle) RecordSourceFailure(source string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	sourceCounter := t.fail(t.sources, source, t.clock.Now())
+	if t.config.SourceMaxFailures > 0 && sourceCounter.failures >= t.config.SourceMaxFailures {
+		sourceCounter.blockedUntil = t.clock.Now().Add(t.config.LockoutDuration)
+	}
+}
+
+// fail counts a failure for key in counters, starting over if its earlier failures have expired. The caller must
+// hold the lock.
+func (t *loginThrottle) fail(counters map[string]*failureCounter, key string, now time.Time) *failureCounter {
+	counter, ok := counters[key]
+	if ok && counter.expired(now, t.quietPeriod()) {
+		ok = false
+	}
+	if !ok {
+		if _, exists := counters[key]; !exists && len(counters) >= MaxThrottledLogins {
+			t.prune(counters, now)
+		}
+		counter = &failureCounter{}
+		counters[key] = counter
+	}
+
+	counter.failures++
+	counter.lastFailure = now
+	return counter
+}
+
+// prune forgets the expired counters, and if that leaves no room, the one whose block ends first. The caller must
+// hold the lock.
+func (t *loginThrottle) prune(counters map[string]*failureCounter, now time.Time) {
+	var first *failureCounter
+	firstKey := ""
+	for key, counter := range counters {
+		if counter.expired(now, t.quietPeriod()) {
+			delete(counters, key)
+			continue
+		}
+		if first == nil || counter.blockedUntil.Before(first.blockedUntil) {
+			first, firstKey = counter, key
+		}
+	}
+
+	if len(counters) >= MaxThrottledLogins {
+		delete(counters, firstKey)
+	}
+}
+
+func (t *loginThrottle) quietPeriod() time.Duration {
+	if t.config.LockoutDuration > 0 {
+		return t.config.LockoutDuration
+	}
+	return t.config.MaxBackoff
+}
+
+type domainLoginThrottle struct {
+	LoginThrottle
+	domain string
+}
+
+// NewDomainLoginThrottle returns a view of throttle for the directory of one domain, whose resolver is only given
+// bare account names. It counts failures by the account name qualified with domain, so that the same account name in
+// different domains is throttled apart; sources are still counted across domains, as a source is one app wherever its
+// users are.
+func NewDomainLoginThrottle(throttle LoginThrottle, domain string) LoginThrottle {
+	return &domainLoginThrottle{LoginThrottle: throttle, domain: strings.ToLower(domain)}
+}
+
+func (t *domainLoginThrottle) Allow(source, username string) error {
+	return t.LoginThrottle.Allow(source, t.qualify(username))
+}
+
+func (t *domainLoginThrottle) RecordSuccess(source, username string) {
+	t.LoginThrottle.RecordSuccess(source, t.qualify(username))
+}
+
+func (t *domainLoginThrottle) RecordFailure(source, username string) {
+	t.LoginThrottle.RecordFailure(source, t.qualify(username))
+}
+
+func (t *domainLoginThrottle) qualify(username string) string {
+	return username + "@" + t.domain
+}
+
+func (t *loginThrottle) backoff(failures int) time.Duration {
+	backoff := t.config.BaseBackoff
+	for i := 1; i < failures && backoff < t.config.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if t.config.MaxBackoff > 0 && backoff > t.config.MaxBackoff {
+		backoff = t.config.MaxBackoff
+	}
+	return backoff
+}
@@ -0,0 +1,264 @@
+package nfsv3driver_test
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/goshims/timeshim/time_fake"
+	"code.cloudfoundry.org/nfsv3driver"
+)
+
+var _ = Describe("LoginThrottle", func() {
+	var (
+		fakeTime *time_fake.FakeTime
+		now      time.Time
+		config   nfsv3driver.LoginThrottleConfig
+		subject  nfsv3driver.LoginThrottle
+	)
+
+	advance := func(d time.Duration) {
+		now = now.Add(d)
+	}
+
+	BeforeEach(func() {
+		now = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		fakeTime = &time_fake.FakeTime{}
+		fakeTime.NowStub = func() time.Time { return now }
+
+		config = nfsv3driver.LoginThrottleConfig{
+			UserMaxFailures:   3,
+			SourceMaxFailures: 10,
+			BaseBackoff:       time.Second,
+			MaxBackoff:        time.Minute,
+			LockoutDuration:   time.Hour,
+		}
+	})
+
+	JustBeforeEach(func() {
+		subject = nfsv3driver.NewLoginThrottle(fakeTime, config)
+	})
+
+	It("allows a username with no failures", func() {
+		Expect(subject.Allow("vol1", "alice")).To(Succeed())
+	})
+
+	Context("after a failure", func() {
+		JustBeforeEach(func() {
+			subject.RecordFailure("vol1", "alice")
+		})
+
+		It("blocks the username for the base backoff", func() {
+			err := subject.Allow("vol1", "alice")
+			Expect(err).To(MatchError(nfsv3driver.TooManyFailedLoginsErrorMessage))
+			Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+
+			advance(time.Second)
+			Expect(subject.Allow("vol1", "alice")).To(Succeed())
+		})
+
+		It("does not block other usernames", func() {
+			Expect(subject.Allow("vol1", "bob")).To(Succeed())
+		})
+
+		It("doubles the backoff on the next failure", func() {
+			advance(time.Second)
+			subject.RecordFailure("vol1", "alice")
+
+			advance(time.Second)
+			Expect(subject.Allow("vol1", "alice")).NotTo(Succeed())
+			advance(time.Second)
+			Expect(subject.Allow("vol1", "alice")).To(Succeed())
+		})
+
+		It("forgets the failures after a success", func() {
+			subject.RecordSuccess("vol1", "alice")
+			Expect(subject.Allow("vol1", "alice")).To(Succeed())
+		})
+
+		Context("when the backoff exceeds the maximum", func() {
+			BeforeEach(func() {
+				config.UserMaxFailures = 0
+				config.MaxBackoff = 3 * time.Second
+			})
+
+			It("caps the backoff", func() {
+				for i := 0; i < 5; i++ {
+					subject.RecordFailure("vol1", "alice")
+				}
+
+				advance(3 * time.Second)
+				Expect(subject.Allow("vol1", "alice")).To(Succeed())
+			})
+		})
+	})
+
+	Context("when a username reaches the max failures", func() {
+		JustBeforeEach(func() {
+			for i := 0; i < 3; i++ {
+				subject.RecordFailure("vol1", "alice")
+			}
+		})
+
+		It("locks the username out for the lockout duration", func() {
+			advance(time.Minute)
+			Expect(subject.Allow("vol1", "alice")).NotTo(Succeed())
+
+			advance(time.Hour)
+			Expect(subject.Allow("vol1", "alice")).To(Succeed())
+		})
+	})
+
+	Context("when a source reaches the max failures", func() {
+		JustBeforeEach(func() {
+			for i := 0; i < 10; i++ {
+				subject.RecordFailure("vol1", string(rune('a'+i)))
+			}
+		})
+
+		It("locks out every username from the source for the lockout duration", func() {
+			advance(time.Minute)
+			Expect(subject.Allow("vol1", "zed")).NotTo(Succeed())
+
+			advance(time.Hour)
+			Expect(subject.Allow("vol1", "zed")).To(Succeed())
+		})
+
+		It("does not block other sources", func() {
+			advance(time.Minute)
+			Expect(subject.Allow("vol2", "zed")).To(Succeed())
+			Expect(subject.Allow("vol2", "a")).To(Succeed())
+		})
+
+		It("forgets the source's failures after a success from it", func() {
+			subject.RecordSuccess("vol1", "zed")
+			Expect(subject.Allow("vol1", "zed")).To(Succeed())
+		})
+	})
+
+	Context("when failures are counted against a source alone", func() {
+		JustBeforeEach(func() {
+			for i := 0; i < 10; i++ {
+				subject.RecordSourceFailure("vol1")
+			}
+		})
+
+		It("locks the source out", func() {
+			advance(time.Minute)
+			Expect(subject.Allow("vol1", "alice")).NotTo(Succeed())
+			Expect(subject.Allow("vol2", "alice")).To(Succeed())
+		})
+	})
+
+	Context("when a username has been quiet for the lockout duration", func() {
+		JustBeforeEach(func() {
+			subject.RecordFailure("vol1", "alice")
+			subject.RecordFailure("vol1", "alice")
+			advance(time.Hour)
+		})
+
+		It("forgets its failures", func() {
+			subject.RecordFailure("vol1", "alice")
+
+			advance(time.Second)
+			Expect(subject.Allow("vol1", "alice")).To(Succeed())
+		})
+	})
+
+	Context("when failures are kept for as many usernames as it can", func() {
+		BeforeEach(func() {
+			config.UserMaxFailures = 1
+			config.SourceMaxFailures = 0
+		})
+
+		JustBeforeEach(func() {
+			for i := 0; i < nfsv3driver.MaxThrottledLogins; i++ {
+				subject.RecordFailure("vol1", fmt.Sprintf("user%d", i))
+				advance(time.Millisecond)
+			}
+		})
+
+		It("forgets the username whose lockout ends first", func() {
+			subject.RecordFailure("vol1", "alice")
+
+			Expect(subject.Allow("vol1", "user0")).To(Succeed())
+			Expect(subject.Allow("vol1", "user1")).NotTo(Succeed())
+			Expect(subject.Allow("vol1", "alice")).NotTo(Succeed())
+		})
+
+		Context("when some of them have expired", func() {
+			JustBeforeEach(func() {
+				advance(time.Hour - time.Duration(nfsv3driver.MaxThrottledLogins/2)*time.Millisecond)
+			})
+
+			It("forgets those instead", func() {
+				subject.RecordFailure("vol1", "alice")
+				subject.RecordFailure("vol1", "bob")
+
+				last := fmt.Sprintf("user%d", nfsv3driver.MaxThrottledLogins-1)
+				Expect(subject.Allow("vol1", last)).NotTo(Succeed())
+				Expect(subject.Allow("vol1", "alice")).NotTo(Succeed())
+				Expect(subject.Allow("vol1", "bob")).NotTo(Succeed())
+			})
+		})
+	})
+
+	Context("when the settings are reloaded", func() {
+		JustBeforeEach(func() {
+			subject.RecordFailure("vol1", "alice")
+			subject.RecordFailure("vol1", "alice")
+
+			config.UserMaxFailures = 3
+			config.LockoutDuration = 2 * time.Hour
+			subject.Reload(config)
+		})
+
+		It("keeps the failures already recorded", func() {
+			subject.RecordFailure("vol1", "alice")
+
+			advance(time.Hour)
+			Expect(subject.Allow("vol1", "alice")).NotTo(Succeed())
+			advance(time.Hour)
+			Expect(subject.Allow("vol1", "alice")).To(Succeed())
+		})
+	})
+
+	Describe("NewDomainLoginThrottle", func() {
+		var emea, apac nfsv3driver.LoginThrottle
+
+		JustBeforeEach(func() {
+			emea = nfsv3driver.NewDomainLoginThrottle(subject, "EMEA.corp")
+			apac = nfsv3driver.NewDomainLoginThrottle(subject, "apac.corp")
+
+			for i := 0; i < 3; i++ {
+				emea.RecordFailure("vol1", "alice")
+			}
+		})
+
+		It("locks out the account only in its own domain", func() {
+			advance(time.Minute)
+			Expect(emea.Allow("vol2", "alice")).NotTo(Succeed())
+			Expect(apac.Allow("vol2", "alice")).To(Succeed())
+			Expect(subject.Allow("vol2", "alice@emea.corp")).NotTo(Succeed())
+		})
+
+		It("does not reset the account in other domains on a success", func() {
+			apac.RecordSuccess("vol2", "alice")
+
+			advance(time.Minute)
+			Expect(emea.Allow("vol2", "alice")).NotTo(Succeed())
+		})
+
+		It("counts the failures of a source across domains", func() {
+			for i := 0; i < 7; i++ {
+				apac.RecordFailure("vol1", string(rune('a'+i)))
+			}
+
+			advance(time.Minute)
+			Expect(apac.Allow("vol1", "zed")).NotTo(Succeed())
+		})
+	})
+})
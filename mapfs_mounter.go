@@ -6,9 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -29,6 +31,26 @@ const NobodyId = uint32(65534)
 const UnknownId = uint32(4294967294)
 const InvalidUidValueErrorMessage = "Invalid 'uid' option (0, negative, or non-integer)"
 const InvalidGidValueErrorMessage = "Invalid 'gid' option (0, negative, or non-integer)"
+const NotAllowedOptionsErrorMessage = "Not allowed options"
+const MissingGidErrorMessage = "required 'gid' option is missing"
+const InvalidShareErrorMessage = "Invalid 'share' option"
+const InvalidCacheErrorMessage = "Invalid 'cache' option"
+const InvalidVersionErrorMessage = "\"version\" must be a positive numeric value"
+const LdapNotConfiguredErrorMessage = "LDAP username is specified but LDAP is not configured"
+const AmbiguousPasswordErrorMessage = "Only one of 'password' and 'password_file' may be specified"
+const MissingPasswordErrorMessage = "LDAP username is specified but LDAP password is missing"
+const SecretsNotConfiguredErrorMessage = "LDAP password is given by reference but no secrets directory is configured"
+const UnreadableSecretErrorMessage = "LDAP password secret could not be read"
+const ForeignSecretErrorMessage = "LDAP password secret must be named after the LDAP username"
+
+// ReloadableMounter is a mounter whose option allowlist, mapfs mount timeout, share policy and automount maps can be
+// replaced while volumes are mounted.
+//
+//go:generate counterfeiter -o nfsdriverfakes/fake_reloadable_mounter.go . ReloadableMounter
+type ReloadableMounter interface {
+	volumedriver.Mounter
+	Reload(mask vmo.MountOptsMask, mountTimeout time.Duration, authorizer ShareAuthorizer, automounts AutomountResolver)
+}
 
 type mapfsMounter struct {
 	invoker      invoker.Invoker
@@ -41,6 +63,14 @@ type mapfsMounter struct {
 	resolver     IdResolver
 	mask         vmo.MountOptsMask
 	mapfsPath    string
+	secrets      SecretStore
+	tokens       TokenVerifier
+	kerberos     KerberosCredentials
+
+	settingsLock sync.RWMutex
+	mountTimeout time.Duration
+	authorizer   ShareAuthorizer
+	automounts   AutomountResolver
 }
 
 var legacyNfsSharePattern *regexp.Regexp
@@ -62,48 +92,156 @@ func NewMapfsMounter(
 	resolver IdResolver,
 	mask vmo.MountOptsMask,
 	mapfsPath string,
-) volumedriver.Mounter {
-	return &mapfsMounter{invoker, osshim, syscallshim, ioutilshim, mountChecker, fstype, defaultOpts, resolver, mask, mapfsPath}
+	secrets SecretStore,
+	authorizer ShareAuthorizer,
+	tokens TokenVerifier,
+	kerberos KerberosCredentials,
+) ReloadableMounter {
+	return &mapfsMounter{
+		invoker:      invoker,
+		osshim:       osshim,
+		syscallshim:  syscallshim,
+		ioutilshim:   ioutilshim,
+		mountChecker: mountChecker,
+		fstype:       fstype,
+		defaultOpts:  defaultOpts,
+		resolver:     resolver,
+		mask:         mask,
+		mapfsPath:    mapfsPath,
+		secrets:      secrets,
+		tokens:       tokens,
+		kerberos:     kerberos,
+		mountTimeout: MapfsMountTimeout,
+		authorizer:   authorizer,
+	}
+}
+
+func (m *mapfsMounter) Reload(mask vmo.MountOptsMask, mountTimeout time.Duration, authorizer ShareAuthorizer, automounts AutomountResolver) {
+	m.settingsLock.Lock()
+	defer m.settingsLock.Unlock()
+
+	m.mask = mask
+	m.mountTimeout = mountTimeout
+	m.authorizer = authorizer
+	m.automounts = automounts
 }
 
 func (m *mapfsMounter) Mount(env dockerdriver.Env, remote string, target string, opts map[string]interface{}) error {
+	env = redactEnv(env, nil)
 	logger := env.Logger().Session("mount")
 	logger.Info("mount-start")
 	defer logger.Info("mount-end")
 
-	if username, ok := opts["username"]; ok {
+	m.settingsLock.RLock()
+	mask, mountTimeout, authorizer, automounts := m.mask, m.mountTimeout, m.authorizer, m.automounts
+	m.settingsLock.RUnlock()
+
+	// an automount key takes the place of the source, and the options of its map entry override the bind options
+	readOnly := false
+	if key, ok := opts["automount_key"]; ok {
+		if automounts == nil {
+			return dockerdriver.SafeError{SafeDescription: AutomountNotConfiguredErrorMessage}
+		}
+
+		entry, err := automounts.Resolve(env, uniformData(key))
+		if err != nil {
+			return err
+		}
+
+		remote = entry.Remote
+		for name, value := range entry.Options {
+			opts[name] = value
+		}
+		readOnly = entry.ReadOnly
+	}
+
+	sec := ""
+	if val, ok := opts["sec"]; ok {
+		sec = uniformData(val)
+		if sec != "sys" && !isKerberosFlavor(sec) {
+			return dockerdriver.SafeError{SafeDescription: InvalidSecErrorMessage}
+		}
+	}
+	if isKerberosFlavor(sec) {
+		if m.kerberos == nil {
+			return dockerdriver.SafeError{SafeDescription: KerberosNotConfiguredErrorMessage}
+		}
+		if _, ok := opts["username"]; !ok {
+			return dockerdriver.SafeError{SafeDescription: KerberosRequiresCredentialsErrorMessage}
+		}
+	}
+
+	var account, password string
+	var groups []string
+	identity, restored := opts[restoredIdentityOption].(mountIdentity)
+	if restored {
+		// a volume given back its recorded options after a restart is mounted as the identity recorded for it, as
+		// the credentials it was mounted with are not kept
+		account, groups = identity.account(), identity.Groups
+		opts["uid"] = identity.Uid
+		opts["gid"] = identity.Gid
+	} else if token, ok := opts["token"]; ok {
+		for _, option := range []string{"uid", "gid", "username", "password", "password_file"} {
+			if _, found := opts[option]; found {
+				return dockerdriver.SafeError{SafeDescription: NotAllowedOptionsErrorMessage}
+			}
+		}
+
+		if m.tokens == nil {
+			return dockerdriver.SafeError{SafeDescription: TokenNotConfiguredErrorMessage}
+		}
+
+		claims, err := m.tokens.Verify(env, uniformData(token))
+		if err != nil {
+			return err
+		}
+
+		account, groups = claims.Subject, claims.Groups
+		identity = mountIdentity{Subject: claims.Subject, Uid: claims.Uid, Gid: claims.Gid, Groups: claims.Groups}
+		opts["uid"] = claims.Uid
+		opts["gid"] = claims.Gid
+	} else if username, ok := opts["username"]; ok {
 		if _, found := opts["uid"]; found {
-			return dockerdriver.SafeError{SafeDescription: "Not allowed options"}
+			return dockerdriver.SafeError{SafeDescription: NotAllowedOptionsErrorMessage}
 		}
 
 		if _, found := opts["gid"]; found {
-			return dockerdriver.SafeError{SafeDescription: "Not allowed options"}
+			return dockerdriver.SafeError{SafeDescription: NotAllowedOptionsErrorMessage}
 		}
 
 		if m.resolver == nil {
-			return dockerdriver.SafeError{SafeDescription: "LDAP username is specified but LDAP is not configured"}
+			return dockerdriver.SafeError{SafeDescription: LdapNotConfiguredErrorMessage}
 		}
-		password, ok := opts["password"]
-		if !ok {
-			return dockerdriver.SafeError{SafeDescription: "LDAP username is specified but LDAP password is missing"}
+		account = uniformData(username)
+		var err error
+		password, err = m.password(logger, account, opts)
+		if err != nil {
+			return err
 		}
 
-		uid, gid, err := m.resolver.Resolve(env, username.(string), password.(string))
+		var uid, gid string
+		// failed logins are throttled by the volume they come from, so that one app with a wrong password cannot lock
+		// out the others
+		uid, gid, groups, err = m.resolver.Resolve(WithLoginSource(env, filepath.Base(target)), account, password)
 		if err != nil {
 			return err
 		}
 
+		identity = mountIdentity{Username: account, Uid: uid, Gid: gid, Groups: groups}
 		opts["uid"] = uid
 		opts["gid"] = gid
 	}
+	if identity.Uid != "" {
+		opts[resolvedIdentityOption] = identity
+	}
 
 	_, uidok := opts["uid"]
 	_, gidok := opts["gid"]
 	if uidok && !gidok {
-		return dockerdriver.SafeError{SafeDescription: "required 'gid' option is missing"}
+		return dockerdriver.SafeError{SafeDescription: MissingGidErrorMessage}
 	}
 
-	optsToUse, err := vmo.NewMountOpts(opts, m.mask)
+	optsToUse, err := vmo.NewMountOpts(userOptions(opts, identity.Uid != "", restored), mask)
 	if err != nil {
 		logger.Debug("mount-options-failed", lager.Data{
 			"source":  remote,
@@ -112,13 +250,17 @@ func (m *mapfsMounter) Mount(env dockerdriver.Env, remote string, target string,
 		})
 		return dockerdriver.SafeError{SafeDescription: err.Error()}
 	}
+	if identity.Uid != "" {
+		optsToUse["uid"] = identity.Uid
+		optsToUse["gid"] = identity.Gid
+	}
 
 	// check for legacy URL formatted mounts and rewrite to standard nfs format as necessary
 	match := legacyNfsSharePattern.FindStringSubmatch(remote)
 
 	if len(match) > 2 {
 		if strings.TrimSpace(match[1]) == "" {
-			return dockerdriver.SafeError{SafeDescription: "Invalid 'share' option"}
+			return dockerdriver.SafeError{SafeDescription: InvalidShareErrorMessage}
 		}
 		if match[2] == "" {
 			remote = match[1] + ":/"
@@ -127,8 +269,37 @@ func (m *mapfsMounter) Mount(env dockerdriver.Env, remote string, target string,
 		}
 	}
 
+	if authorizer != nil {
+		err = authorizer.Authorize(env, remote, account, groups)
+		if err != nil {
+			return err
+		}
+	}
+
 	target = strings.TrimSuffix(target, "/")
 
+	mounted := false
+	if isKerberosFlavor(sec) {
+		uid, err := strconv.Atoi(uniformData(opts["uid"]))
+		if err != nil || uid <= 0 {
+			return dockerdriver.SafeError{SafeDescription: InvalidUidValueErrorMessage}
+		}
+
+		if restored {
+			err = m.kerberos.Adopt(env, target, account, uid)
+		} else {
+			err = m.kerberos.Acquire(env, target, account, password, uid)
+		}
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if !mounted {
+				m.kerberos.Release(env, target)
+			}
+		}()
+	}
+
 	intermediateMount := target + MapfsDirectorySuffix
 	orig := syscall.Umask(000)
 	defer syscall.Umask(orig)
@@ -149,7 +320,7 @@ func (m *mapfsMounter) Mount(env dockerdriver.Env, remote string, target string,
 		cache, err = strconv.ParseBool(fmt.Sprintf("%v", val))
 		if err != nil {
 			logger.Error("invalid-cache-option", err)
-			return dockerdriver.SafeError{SafeDescription: "Invalid 'cache' option"}
+			return dockerdriver.SafeError{SafeDescription: InvalidCacheErrorMessage}
 		}
 	}
 
@@ -160,16 +331,24 @@ func (m *mapfsMounter) Mount(env dockerdriver.Env, remote string, target string,
 	if version, ok := opts["version"].(string); ok {
 		versionFloat, err := strconv.ParseFloat(version, 64)
 		if err != nil {
-			return dockerdriver.SafeError{SafeDescription: "\"version\" must be a positive numeric value"}
+			return dockerdriver.SafeError{SafeDescription: InvalidVersionErrorMessage}
 		}
 
 		if versionFloat <= 0 {
-			return dockerdriver.SafeError{SafeDescription: "\"version\" must be a positive numeric value"}
+			return dockerdriver.SafeError{SafeDescription: InvalidVersionErrorMessage}
 		}
 
 		mountOptions = mountOptions + ",vers=" + version
 	}
 
+	if sec != "" {
+		mountOptions = mountOptions + ",sec=" + sec
+	}
+
+	if readOnly {
+		mountOptions = mountOptions + ",ro"
+	}
+
 	t := intermediateMount
 	if !uidok {
 		t = target
@@ -237,7 +416,7 @@ func (m *mapfsMounter) Mount(env dockerdriver.Env, remote string, target string,
 
 		args := mapfsOptions(optsToUse)
 		args = append(args, target, intermediateMount)
-		mountError := m.invoker.Invoke(env, m.mapfsPath, args).WaitFor("Mounted!", MapfsMountTimeout)
+		mountError := m.invoker.Invoke(env, m.mapfsPath, args).WaitFor("Mounted!", mountTimeout)
 		if mountError != nil {
 			logger.Error("background-invoke-mount-failed", err)
 			err = m.invoker.Invoke(env, "umount", []string{intermediateMount}).Wait()
@@ -257,10 +436,12 @@ func (m *mapfsMounter) Mount(env dockerdriver.Env, remote string, target string,
 
 	}
 
+	mounted = true
 	return nil
 }
 
 func (m *mapfsMounter) Unmount(env dockerdriver.Env, target string) error {
+	env = redactEnv(env, nil)
 	logger := env.Logger().Session("unmount")
 	logger.Info("unmount-start")
 	defer logger.Info("unmount-end")
@@ -273,6 +454,10 @@ func (m *mapfsMounter) Unmount(env dockerdriver.Env, target string) error {
 		return dockerdriver.SafeError{SafeDescription: waitError.Error()}
 	}
 
+	if m.kerberos != nil {
+		m.kerberos.Release(env, target)
+	}
+
 	if exists, err := m.mountChecker.Exists(intermediateMount); exists {
 		err = m.invoker.Invoke(env, "umount", []string{"-l", intermediateMount}).Wait()
 		if err != nil {
@@ -295,6 +480,7 @@ func (m *mapfsMounter) Unmount(env dockerdriver.Env, target string) error {
 }
 
 func (m *mapfsMounter) Check(env dockerdriver.Env, name, mountPoint string) bool {
+	env = redactEnv(env, nil)
 	logger := env.Logger().Session("check")
 	logger.Info("check-start")
 	defer logger.Info("check-end")
@@ -311,6 +497,7 @@ func (m *mapfsMounter) Check(env dockerdriver.Env, name, mountPoint string) bool
 }
 
 func (m *mapfsMounter) Purge(env dockerdriver.Env, path string) {
+	env = redactEnv(env, nil)
 	logger := env.Logger().Session("purge")
 	logger.Info("purge-start")
 	defer logger.Info("purge-end")
@@ -380,8 +567,57 @@ func (m *mapfsMounter) Purge(env dockerdriver.Env, path string) {
 	}
 }
 
-func NewMapFsVolumeMountMask() (vmo.MountOptsMask, error) {
-	allowed := []string{"auto_cache", "mount", "source", "experimental", "uid", "gid", "username", "password", "readonly", "version", "cache"}
+// password returns the LDAP password of account from the bind options, reading it from the secret store when it is
+// given as a password_file name or a secret:// reference so that it never has to travel through the bind options in
+// clear. A binding may only refer to the secret named after its own account, so that the secrets of other users
+// cannot be used to mount as them.
+func (m *mapfsMounter) password(logger lager.Logger, account string, opts map[string]interface{}) (string, error) {
+	password, hasPassword := opts["password"]
+	passwordFile, hasPasswordFile := opts["password_file"]
+
+	if hasPassword && hasPasswordFile {
+		return "", dockerdriver.SafeError{SafeDescription: AmbiguousPasswordErrorMessage}
+	}
+	if !hasPassword && !hasPasswordFile {
+		return "", dockerdriver.SafeError{SafeDescription: MissingPasswordErrorMessage}
+	}
+
+	var secretName string
+	if hasPasswordFile {
+		secretName = uniformData(passwordFile)
+	} else if value := uniformData(password); strings.HasPrefix(value, SecretReferencePrefix) {
+		secretName = strings.TrimPrefix(value, SecretReferencePrefix)
+	} else {
+		return value, nil
+	}
+
+	if m.secrets == nil {
+		return "", dockerdriver.SafeError{SafeDescription: SecretsNotConfiguredErrorMessage}
+	}
+
+	if secretName != account {
+		logger.Info("password-secret-of-another-account-refused", lager.Data{"secret": secretName, "username": account})
+		return "", dockerdriver.SafeError{SafeDescription: ForeignSecretErrorMessage}
+	}
+
+	value, err := m.secrets.Read(secretName)
+	if err != nil {
+		logger.Error("read-password-secret-failed", err, lager.Data{"secret": secretName})
+		return "", dockerdriver.SafeError{SafeDescription: UnreadableSecretErrorMessage}
+	}
+
+	return value, nil
+}
+
+// MapfsAllowedOptions are all of the options the mapfs mounter understands. Operators may narrow them down.
+var MapfsAllowedOptions = []string{"auto_cache", "mount", "source", "experimental", "uid", "gid", "username", "password", "password_file", "token", "readonly", "version", "cache", "sec", "automount_key"}
+
+// NewMapFsVolumeMountMask returns the mount options mask for the given allowed options, or for all
+// MapfsAllowedOptions if none are given.
+func NewMapFsVolumeMountMask(allowed ...string) (vmo.MountOptsMask, error) {
+	if len(allowed) == 0 {
+		allowed = MapfsAllowedOptions
+	}
 
 	defaultMap := map[string]interface{}{
 		"auto_cache": "true",
@@ -409,6 +645,25 @@ func uniformData(data interface{}) string {
 	return ""
 }
 
+// userOptions returns the options of a mount that the mount options mask applies to: the ones the user gave, without
+// the uid and gid the driver resolved from their credentials, or the username it restored.
+func userOptions(opts map[string]interface{}, resolved bool, restored bool) map[string]interface{} {
+	userOpts := map[string]interface{}{}
+	for name, value := range opts {
+		userOpts[name] = value
+	}
+	delete(userOpts, restoredIdentityOption)
+	delete(userOpts, resolvedIdentityOption)
+	if resolved {
+		delete(userOpts, "uid")
+		delete(userOpts, "gid")
+	}
+	if restored {
+		delete(userOpts, "username")
+	}
+	return userOpts
+}
+
 func mapfsOptions(opts vmo.MountOpts) []string {
 	var ret []string
 	if uid, ok := opts["uid"]; ok {
@@ -422,3 +677,12 @@ func mapfsOptions(opts vmo.MountOpts) []string {
 	}
 	return ret
 }
+
+func isKerberosFlavor(sec string) bool {
+	for _, flavor := range KerberosSecurityFlavors {
+		if sec == flavor {
+			return true
+		}
+	}
+	return false
+}
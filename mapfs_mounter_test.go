@@ -18,6 +18,7 @@ import (
 	"code.cloudfoundry.org/goshims/ioutilshim/ioutil_fake"
 	"code.cloudfoundry.org/goshims/osshim/os_fake"
 	"code.cloudfoundry.org/goshims/syscallshim/syscall_fake"
+	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/lager/lagertest"
 	"code.cloudfoundry.org/nfsv3driver"
 	"code.cloudfoundry.org/nfsv3driver/nfsdriverfakes"
@@ -86,7 +87,7 @@ var _ = Describe("MapfsMounter", func() {
 		mask, err = nfsv3driver.NewMapFsVolumeMountMask()
 		Expect(err).NotTo(HaveOccurred())
 
-		subject = nfsv3driver.NewMapfsMounter(fakeInvoker, fakeOs, fakeSyscall, fakeIoutil, fakeMountChecker, "my-fs", "my-mount-options,timeo=600,retrans=2,actimeo=0", nil, mask, mapfsPath)
+		subject = nfsv3driver.NewMapfsMounter(fakeInvoker, fakeOs, fakeSyscall, fakeIoutil, fakeMountChecker, "my-fs", "my-mount-options,timeo=600,retrans=2,actimeo=0", nil, mask, mapfsPath, nil, nil, nil, nil)
 	})
 
 	Context("#Mount", func() {
@@ -321,7 +322,7 @@ var _ = Describe("MapfsMounter", func() {
 			table.DescribeTable("when the mount has a legacy format", func(legacySourceFormat string, expectedShareFormat string) {
 				fakeInvoker = &invokerfakes.FakeInvoker{}
 				fakeInvoker.InvokeReturns(fakeInvokeResult)
-				subject = nfsv3driver.NewMapfsMounter(fakeInvoker, fakeOs, fakeSyscall, fakeIoutil, fakeMountChecker, "my-fs", "my-mount-options,timeo=600,retrans=2,actimeo=0", nil, mask, mapfsPath)
+				subject = nfsv3driver.NewMapfsMounter(fakeInvoker, fakeOs, fakeSyscall, fakeIoutil, fakeMountChecker, "my-fs", "my-mount-options,timeo=600,retrans=2,actimeo=0", nil, mask, mapfsPath, nil, nil, nil, nil)
 
 				err = subject.Mount(env, legacySourceFormat, target, opts)
 				Expect(err).NotTo(HaveOccurred())
@@ -368,6 +369,34 @@ var _ = Describe("MapfsMounter", func() {
 					Expect(args).To(ContainElement("-auto_cache"))
 				})
 			})
+
+			Context("when the settings are reloaded", func() {
+				BeforeEach(func() {
+					reloadedMask, err := nfsv3driver.NewMapFsVolumeMountMask("uid", "gid")
+					Expect(err).NotTo(HaveOccurred())
+
+					subject.(nfsv3driver.ReloadableMounter).Reload(reloadedMask, 30*time.Second, nil, nil)
+				})
+
+				It("should use the new mapfs mount timeout", func() {
+					Expect(err).NotTo(HaveOccurred())
+					_, duration := fakeInvokeResult.WaitForArgsForCall(0)
+					Expect(duration).To(Equal(30 * time.Second))
+				})
+
+				Context("when an option is no longer allowed", func() {
+					BeforeEach(func() {
+						opts["readonly"] = true
+					})
+
+					It("should reject it", func() {
+						Expect(err).To(HaveOccurred())
+						Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+						Expect(err.Error()).To(ContainSubstring("readonly"))
+						Expect(fakeInvoker.InvokeCallCount()).To(Equal(0))
+					})
+				})
+			})
 		})
 
 		Context("when there is no uid", func() {
@@ -680,12 +709,303 @@ var _ = Describe("MapfsMounter", func() {
 			})
 		})
 
+		Context("when an automount key is specified", func() {
+			var fakeAutomounts *nfsdriverfakes.FakeAutomountResolver
+
+			BeforeEach(func() {
+				fakeAutomounts = &nfsdriverfakes.FakeAutomountResolver{}
+				fakeAutomounts.ResolveReturns(nfsv3driver.AutomountEntry{
+					Remote:  "filer:/export/home/alice",
+					Options: map[string]interface{}{"version": "3"},
+				}, nil)
+				subject.(nfsv3driver.ReloadableMounter).Reload(mask, time.Minute, nil, fakeAutomounts)
+
+				opts["automount_key"] = "alice"
+				opts["version"] = "4.1"
+			})
+
+			It("mounts the share from the map in place of the source", func() {
+				Expect(err).NotTo(HaveOccurred())
+				_, key := fakeAutomounts.ResolveArgsForCall(0)
+				Expect(key).To(Equal("alice"))
+
+				_, cmd, args, _ := fakeInvoker.InvokeArgsForCall(0)
+				Expect(cmd).To(Equal("mount"))
+				Expect(args).To(ContainElement("filer:/export/home/alice"))
+				Expect(args).NotTo(ContainElement("source"))
+			})
+
+			It("lets the options of the map entry override the bind options", func() {
+				_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
+				Expect(strings.Join(args, " ")).To(ContainSubstring("vers=3"))
+				Expect(strings.Join(args, " ")).NotTo(ContainSubstring("vers=4.1"))
+			})
+
+			It("mounts the share read-write", func() {
+				_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
+				Expect(args[3]).NotTo(MatchRegexp(`(^|,)ro(,|$)`))
+			})
+
+			Context("when the map entry is read only", func() {
+				BeforeEach(func() {
+					fakeAutomounts.ResolveReturns(nfsv3driver.AutomountEntry{
+						Remote:   "filer:/export/home/alice",
+						Options:  map[string]interface{}{"readonly": true, "version": "3"},
+						ReadOnly: true,
+					}, nil)
+				})
+
+				It("mounts the share read only", func() {
+					Expect(err).NotTo(HaveOccurred())
+					_, cmd, args, _ := fakeInvoker.InvokeArgsForCall(0)
+					Expect(cmd).To(Equal("mount"))
+					Expect(args).To(HaveLen(6))
+					Expect(args[:2]).To(Equal([]string{"-t", "my-fs"}))
+					Expect(args[2]).To(Equal("-o"))
+					Expect(strings.Split(args[3], ",")).To(ContainElement("ro"))
+					Expect(args[4]).To(Equal("filer:/export/home/alice"))
+				})
+
+				Context("when the bind options ask for read-write", func() {
+					BeforeEach(func() {
+						opts["readonly"] = false
+					})
+
+					It("still mounts the share read only", func() {
+						_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
+						Expect(strings.Split(args[3], ",")).To(ContainElement("ro"))
+					})
+				})
+			})
+
+			Context("when the key cannot be resolved", func() {
+				BeforeEach(func() {
+					fakeAutomounts.ResolveReturns(nfsv3driver.AutomountEntry{}, dockerdriver.SafeError{SafeDescription: nfsv3driver.AutomountKeyDoesNotExistErrorMessage})
+				})
+
+				It("does not mount", func() {
+					Expect(err).To(MatchError(nfsv3driver.AutomountKeyDoesNotExistErrorMessage))
+					Expect(fakeInvoker.InvokeCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when automount maps are not configured", func() {
+				BeforeEach(func() {
+					subject.(nfsv3driver.ReloadableMounter).Reload(mask, time.Minute, nil, nil)
+				})
+
+				It("should error", func() {
+					Expect(err).To(MatchError(nfsv3driver.AutomountNotConfiguredErrorMessage))
+					Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+				})
+			})
+		})
+
+		Context("when the sec option is specified", func() {
+			var fakeKerberos *nfsdriverfakes.FakeKerberosCredentials
+
+			BeforeEach(func() {
+				fakeIdResolver = &nfsdriverfakes.FakeIdResolver{}
+				fakeIdResolver.ResolveReturns("100", "100", nil, nil)
+				fakeKerberos = &nfsdriverfakes.FakeKerberosCredentials{}
+
+				subject = nfsv3driver.NewMapfsMounter(fakeInvoker, fakeOs, fakeSyscall, fakeIoutil, fakeMountChecker, "my-fs", "my-mount-options", fakeIdResolver, mask, mapfsPath, nil, nil, nil, fakeKerberos)
+
+				delete(opts, "uid")
+				delete(opts, "gid")
+				opts["username"] = "test-user"
+				opts["password"] = "test-pw"
+				opts["sec"] = "krb5p"
+			})
+
+			It("obtains a ticket for the user before mounting with that flavor", func() {
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeKerberos.AcquireCallCount()).To(Equal(1))
+				_, target, username, password, uid := fakeKerberos.AcquireArgsForCall(0)
+				Expect(target).To(Equal("target"))
+				Expect(username).To(Equal("test-user"))
+				Expect(password).To(Equal("test-pw"))
+				Expect(uid).To(Equal(100))
+
+				_, cmd, args, _ := fakeInvoker.InvokeArgsForCall(0)
+				Expect(cmd).To(Equal("mount"))
+				Expect(strings.Join(args, " ")).To(ContainSubstring("my-mount-options,sec=krb5p"))
+				Expect(fakeKerberos.ReleaseCallCount()).To(Equal(0))
+			})
+
+			Context("when the ticket cannot be obtained", func() {
+				BeforeEach(func() {
+					fakeKerberos.AcquireReturns(dockerdriver.SafeError{SafeDescription: nfsv3driver.KerberosTicketErrorMessage})
+				})
+
+				It("does not mount", func() {
+					Expect(err).To(MatchError(nfsv3driver.KerberosTicketErrorMessage))
+					Expect(fakeInvoker.InvokeCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when the mount fails", func() {
+				BeforeEach(func() {
+					fakeInvokeResult.WaitReturns(errors.New("access denied"))
+				})
+
+				It("destroys the ticket", func() {
+					Expect(err).To(HaveOccurred())
+					Expect(fakeKerberos.ReleaseCallCount()).To(Equal(1))
+					_, target := fakeKerberos.ReleaseArgsForCall(0)
+					Expect(target).To(Equal("target"))
+				})
+			})
+
+			Context("when no username is passed", func() {
+				BeforeEach(func() {
+					delete(opts, "username")
+					delete(opts, "password")
+					opts["uid"] = "100"
+					opts["gid"] = "100"
+				})
+
+				It("should error", func() {
+					Expect(err).To(MatchError(nfsv3driver.KerberosRequiresCredentialsErrorMessage))
+				})
+			})
+
+			Context("when Kerberos is not configured", func() {
+				BeforeEach(func() {
+					subject = nfsv3driver.NewMapfsMounter(fakeInvoker, fakeOs, fakeSyscall, fakeIoutil, fakeMountChecker, "my-fs", "my-mount-options", fakeIdResolver, mask, mapfsPath, nil, nil, nil, nil)
+				})
+
+				It("should error", func() {
+					Expect(err).To(MatchError(nfsv3driver.KerberosNotConfiguredErrorMessage))
+					Expect(fakeIdResolver.ResolveCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when the flavor is sys", func() {
+				BeforeEach(func() {
+					opts["sec"] = "sys"
+				})
+
+				It("mounts without a ticket", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(fakeKerberos.AcquireCallCount()).To(Equal(0))
+
+					_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
+					Expect(strings.Join(args, " ")).To(ContainSubstring("my-mount-options,sec=sys"))
+				})
+			})
+
+			Context("when the flavor is unknown", func() {
+				BeforeEach(func() {
+					opts["sec"] = "lkey"
+				})
+
+				It("should error", func() {
+					Expect(err).To(MatchError(nfsv3driver.InvalidSecErrorMessage))
+				})
+			})
+		})
+
+		Context("when provided a signed identity token", func() {
+			var fakeTokens *nfsdriverfakes.FakeTokenVerifier
+
+			BeforeEach(func() {
+				fakeTokens = &nfsdriverfakes.FakeTokenVerifier{}
+				fakeTokens.VerifyReturns(nfsv3driver.TokenClaims{Subject: "alice", Uid: "1000", Gid: "1001", Groups: []string{"finance"}}, nil)
+
+				subject = nfsv3driver.NewMapfsMounter(fakeInvoker, fakeOs, fakeSyscall, fakeIoutil, fakeMountChecker, "my-fs", "my-mount-options", nil, mask, mapfsPath, nil, nil, fakeTokens, nil)
+
+				delete(opts, "uid")
+				delete(opts, "gid")
+				opts["token"] = "header.claims.signature"
+			})
+
+			It("maps to the uid and gid in the token", func() {
+				Expect(err).NotTo(HaveOccurred())
+				_, token := fakeTokens.VerifyArgsForCall(0)
+				Expect(token).To(Equal("header.claims.signature"))
+
+				_, _, args, _ := fakeInvoker.InvokeArgsForCall(1)
+				Expect(strings.Join(args, " ")).To(ContainSubstring("-uid 1000"))
+				Expect(strings.Join(args, " ")).To(ContainSubstring("-gid 1001"))
+			})
+
+			It("does not pass or log the token", func() {
+				Expect(err).NotTo(HaveOccurred())
+				for i := 0; i < fakeInvoker.InvokeCallCount(); i++ {
+					_, _, args, _ := fakeInvoker.InvokeArgsForCall(i)
+					Expect(strings.Join(args, " ")).NotTo(ContainSubstring("header.claims.signature"))
+				}
+				Expect(string(logger.Buffer().Contents())).NotTo(ContainSubstring("header.claims.signature"))
+			})
+
+			Context("when a share authorizer is configured", func() {
+				var fakeAuthorizer *nfsdriverfakes.FakeShareAuthorizer
+
+				BeforeEach(func() {
+					fakeAuthorizer = &nfsdriverfakes.FakeShareAuthorizer{}
+					subject = nfsv3driver.NewMapfsMounter(fakeInvoker, fakeOs, fakeSyscall, fakeIoutil, fakeMountChecker, "my-fs", "my-mount-options", nil, mask, mapfsPath, nil, fakeAuthorizer, fakeTokens, nil)
+				})
+
+				It("authorizes the token's subject and groups", func() {
+					Expect(err).NotTo(HaveOccurred())
+					_, _, username, groups := fakeAuthorizer.AuthorizeArgsForCall(0)
+					Expect(username).To(Equal("alice"))
+					Expect(groups).To(ConsistOf("finance"))
+				})
+			})
+
+			Context("when the token is invalid", func() {
+				BeforeEach(func() {
+					fakeTokens.VerifyReturns(nfsv3driver.TokenClaims{}, dockerdriver.SafeError{SafeDescription: nfsv3driver.TokenExpiredErrorMessage})
+				})
+
+				It("refuses the mount", func() {
+					Expect(err).To(MatchError(nfsv3driver.TokenExpiredErrorMessage))
+					Expect(fakeInvoker.InvokeCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when credentials are also passed", func() {
+				BeforeEach(func() {
+					opts["username"] = "test-user"
+				})
+
+				It("should error", func() {
+					Expect(err).To(MatchError("Not allowed options"))
+					Expect(fakeTokens.VerifyCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when uid is also passed", func() {
+				BeforeEach(func() {
+					opts["uid"] = "100"
+				})
+
+				It("should error", func() {
+					Expect(err).To(MatchError("Not allowed options"))
+				})
+			})
+
+			Context("when token verification is not configured", func() {
+				BeforeEach(func() {
+					subject = nfsv3driver.NewMapfsMounter(fakeInvoker, fakeOs, fakeSyscall, fakeIoutil, fakeMountChecker, "my-fs", "my-mount-options", nil, mask, mapfsPath, nil, nil, nil, nil)
+				})
+
+				It("should error", func() {
+					Expect(err).To(MatchError(nfsv3driver.TokenNotConfiguredErrorMessage))
+					Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+				})
+			})
+		})
+
 		Context("when provided a username to map to a uid", func() {
 			BeforeEach(func() {
 				fakeIdResolver = &nfsdriverfakes.FakeIdResolver{}
 
-				subject = nfsv3driver.NewMapfsMounter(fakeInvoker, fakeOs, fakeSyscall, fakeIoutil, fakeMountChecker, "my-fs", "my-mount-options", fakeIdResolver, mask, mapfsPath)
-				fakeIdResolver.ResolveReturns("100", "100", nil)
+				subject = nfsv3driver.NewMapfsMounter(fakeInvoker, fakeOs, fakeSyscall, fakeIoutil, fakeMountChecker, "my-fs", "my-mount-options", fakeIdResolver, mask, mapfsPath, nil, nil, nil, nil)
+				fakeIdResolver.ResolveReturns("100", "100", nil, nil)
 
 				delete(opts, "uid")
 				delete(opts, "gid")
@@ -707,6 +1027,180 @@ var _ = Describe("MapfsMounter", func() {
 				Expect(strings.Join(args, " ")).To(ContainSubstring("-gid 100"))
 			})
 
+			It("does not log the password", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(logger.Buffer().Contents())).NotTo(ContainSubstring("test-pw"))
+			})
+
+			It("hands the resolver an env that redacts secrets", func() {
+				resolverEnv, _, _ := fakeIdResolver.ResolveArgsForCall(0)
+				resolverEnv.Logger().Info("resolver-data", lager.Data{"password": "test-pw", "args": []string{"-o", "password=test-pw"}})
+				Expect(string(logger.Buffer().Contents())).To(ContainSubstring("resolver-data"))
+				Expect(string(logger.Buffer().Contents())).NotTo(ContainSubstring("test-pw"))
+			})
+
+			It("throttles the login by the volume it is for", func() {
+				resolverEnv, _, _ := fakeIdResolver.ResolveArgsForCall(0)
+				Expect(nfsv3driver.LoginSource(resolverEnv)).To(Equal("target"))
+			})
+
+			Context("when the options are invalid", func() {
+				BeforeEach(func() {
+					opts["not-allowed"] = "true"
+				})
+
+				It("logs the options without the password", func() {
+					Expect(err).To(HaveOccurred())
+					Expect(logger.Buffer()).To(gbytes.Say("mount-options-failed"))
+					Expect(string(logger.Buffer().Contents())).To(ContainSubstring(`"password":"*REDACTED*"`))
+					Expect(string(logger.Buffer().Contents())).NotTo(ContainSubstring("test-pw"))
+				})
+			})
+
+			Context("when the password is given as a password_file", func() {
+				var fakeSecretStore *nfsdriverfakes.FakeSecretStore
+
+				BeforeEach(func() {
+					delete(opts, "password")
+					opts["password_file"] = "test-user"
+
+					fakeSecretStore = &nfsdriverfakes.FakeSecretStore{}
+					fakeSecretStore.ReadReturns("secret-pw", nil)
+					subject = nfsv3driver.NewMapfsMounter(fakeInvoker, fakeOs, fakeSyscall, fakeIoutil, fakeMountChecker, "my-fs", "my-mount-options", fakeIdResolver, mask, mapfsPath, fakeSecretStore, nil, nil, nil)
+				})
+
+				It("resolves the user with the password read from the secret store", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(fakeSecretStore.ReadArgsForCall(0)).To(Equal("test-user"))
+					_, username, password := fakeIdResolver.ResolveArgsForCall(0)
+					Expect(username).To(Equal("test-user"))
+					Expect(password).To(Equal("secret-pw"))
+				})
+
+				Context("when the password is also passed inline", func() {
+					BeforeEach(func() {
+						opts["password"] = "test-pw"
+					})
+
+					It("should error", func() {
+						Expect(err).To(MatchError("Only one of 'password' and 'password_file' may be specified"))
+						Expect(fakeIdResolver.ResolveCallCount()).To(Equal(0))
+					})
+				})
+
+				Context("when the secret cannot be read", func() {
+					BeforeEach(func() {
+						fakeSecretStore.ReadReturns("", errors.New("no such file"))
+					})
+
+					It("should return a safe error", func() {
+						Expect(err).To(MatchError("LDAP password secret could not be read"))
+						Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+						Expect(fakeIdResolver.ResolveCallCount()).To(Equal(0))
+					})
+				})
+
+				Context("when no secret store is configured", func() {
+					BeforeEach(func() {
+						subject = nfsv3driver.NewMapfsMounter(fakeInvoker, fakeOs, fakeSyscall, fakeIoutil, fakeMountChecker, "my-fs", "my-mount-options", fakeIdResolver, mask, mapfsPath, nil, nil, nil, nil)
+					})
+
+					It("should error", func() {
+						Expect(err).To(MatchError("LDAP password is given by reference but no secrets directory is configured"))
+					})
+				})
+
+				Context("when the secret is another user's", func() {
+					BeforeEach(func() {
+						opts["password_file"] = "other-user"
+					})
+
+					It("refuses it without reading it", func() {
+						Expect(err).To(MatchError(nfsv3driver.ForeignSecretErrorMessage))
+						Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+						Expect(fakeSecretStore.ReadCallCount()).To(Equal(0))
+						Expect(fakeIdResolver.ResolveCallCount()).To(Equal(0))
+					})
+				})
+			})
+
+			Context("when the password is a secret reference", func() {
+				var fakeSecretStore *nfsdriverfakes.FakeSecretStore
+
+				BeforeEach(func() {
+					opts["password"] = "secret://test-user"
+
+					fakeSecretStore = &nfsdriverfakes.FakeSecretStore{}
+					fakeSecretStore.ReadReturns("secret-pw", nil)
+					subject = nfsv3driver.NewMapfsMounter(fakeInvoker, fakeOs, fakeSyscall, fakeIoutil, fakeMountChecker, "my-fs", "my-mount-options", fakeIdResolver, mask, mapfsPath, fakeSecretStore, nil, nil, nil)
+				})
+
+				It("resolves the user with the referenced secret", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(fakeSecretStore.ReadArgsForCall(0)).To(Equal("test-user"))
+					_, _, password := fakeIdResolver.ResolveArgsForCall(0)
+					Expect(password).To(Equal("secret-pw"))
+				})
+
+				Context("when the secret is another user's", func() {
+					BeforeEach(func() {
+						opts["password"] = "secret://other-user"
+					})
+
+					It("refuses it without reading it", func() {
+						Expect(err).To(MatchError(nfsv3driver.ForeignSecretErrorMessage))
+						Expect(fakeSecretStore.ReadCallCount()).To(Equal(0))
+						Expect(fakeIdResolver.ResolveCallCount()).To(Equal(0))
+					})
+				})
+			})
+
+			Context("when a share authorizer is configured", func() {
+				var fakeAuthorizer *nfsdriverfakes.FakeShareAuthorizer
+
+				BeforeEach(func() {
+					source = "nfs://filer/finance"
+					fakeIdResolver.ResolveReturns("100", "100", []string{"CN=Finance,OU=Groups,DC=corp"}, nil)
+
+					fakeAuthorizer = &nfsdriverfakes.FakeShareAuthorizer{}
+					subject = nfsv3driver.NewMapfsMounter(fakeInvoker, fakeOs, fakeSyscall, fakeIoutil, fakeMountChecker, "my-fs", "my-mount-options", fakeIdResolver, mask, mapfsPath, nil, fakeAuthorizer, nil, nil)
+				})
+
+				It("authorizes the resolved user's groups for the rewritten share", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(fakeAuthorizer.AuthorizeCallCount()).To(Equal(1))
+					_, remote, username, groups := fakeAuthorizer.AuthorizeArgsForCall(0)
+					Expect(remote).To(Equal("filer:/finance"))
+					Expect(username).To(Equal("test-user"))
+					Expect(groups).To(ConsistOf("CN=Finance,OU=Groups,DC=corp"))
+				})
+
+				Context("when the user is not authorized", func() {
+					BeforeEach(func() {
+						fakeAuthorizer.AuthorizeReturns(dockerdriver.SafeError{SafeDescription: nfsv3driver.ShareNotAuthorizedErrorMessage})
+					})
+
+					It("refuses the mount before touching the filesystem", func() {
+						Expect(err).To(MatchError(nfsv3driver.ShareNotAuthorizedErrorMessage))
+						Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+						Expect(fakeOs.MkdirAllCallCount()).To(Equal(0))
+						Expect(fakeInvoker.InvokeCallCount()).To(Equal(0))
+					})
+				})
+
+				Context("when the authorizer is removed by a reload", func() {
+					BeforeEach(func() {
+						fakeAuthorizer.AuthorizeReturns(dockerdriver.SafeError{SafeDescription: nfsv3driver.ShareNotAuthorizedErrorMessage})
+						subject.(nfsv3driver.ReloadableMounter).Reload(mask, time.Minute, nil, nil)
+					})
+
+					It("no longer consults it", func() {
+						Expect(err).NotTo(HaveOccurred())
+						Expect(fakeAuthorizer.AuthorizeCallCount()).To(Equal(0))
+					})
+				})
+			})
+
 			Context("when username is passed but password is not passed", func() {
 				BeforeEach(func() {
 					delete(opts, "password")
@@ -722,7 +1216,7 @@ var _ = Describe("MapfsMounter", func() {
 
 			Context("when uid is NaN", func() {
 				BeforeEach(func() {
-					fakeIdResolver.ResolveReturns("uid-not-a-number", "1", nil)
+					fakeIdResolver.ResolveReturns("uid-not-a-number", "1", nil, nil)
 				})
 
 				It("should error", func() {
@@ -733,7 +1227,7 @@ var _ = Describe("MapfsMounter", func() {
 
 			Context("when gid is NaN", func() {
 				BeforeEach(func() {
-					fakeIdResolver.ResolveReturns("1", "gid-not-a-number", nil)
+					fakeIdResolver.ResolveReturns("1", "gid-not-a-number", nil, nil)
 				})
 
 				It("should error", func() {
@@ -770,7 +1264,7 @@ var _ = Describe("MapfsMounter", func() {
 
 			Context("when unable to resolve username", func() {
 				BeforeEach(func() {
-					fakeIdResolver.ResolveReturns("", "", errors.New("unable to resolve"))
+					fakeIdResolver.ResolveReturns("", "", nil, errors.New("unable to resolve"))
 				})
 
 				It("return an error that is not a SafeError since it might contain sensitive information", func() {
@@ -841,6 +1335,22 @@ var _ = Describe("MapfsMounter", func() {
 				})
 			})
 
+			Context("when Kerberos is configured", func() {
+				var fakeKerberos *nfsdriverfakes.FakeKerberosCredentials
+
+				BeforeEach(func() {
+					fakeKerberos = &nfsdriverfakes.FakeKerberosCredentials{}
+					subject = nfsv3driver.NewMapfsMounter(fakeInvoker, fakeOs, fakeSyscall, fakeIoutil, fakeMountChecker, "my-fs", "my-mount-options", nil, mask, mapfsPath, nil, nil, nil, fakeKerberos)
+				})
+
+				It("destroys the mount's ticket", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(fakeKerberos.ReleaseCallCount()).To(Equal(1))
+					_, target := fakeKerberos.ReleaseArgsForCall(0)
+					Expect(target).To(Equal("target"))
+				})
+			})
+
 			Context("when uid mapping was not used for the mount", func() {
 				BeforeEach(func() {
 					fakeMountChecker.ExistsStub = func(s string) (bool, error) {
@@ -0,0 +1,359 @@
+package nfsv3driver
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/nfsv3driver/driveradmin"
+	"code.cloudfoundry.org/nfsv3driver/metrics"
+)
+
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// The classes of mount failures, which tell operators where to look: at the options an app was bound with, at the
+// LDAP directory, at the share policy, at mapfs, or at the NFS server.
+const (
+	MountFailureInvalidOptions = "invalid-options"
+	MountFailureLdap           = "ldap"
+	MountFailureMapfsTimeout   = "mapfs-timeout"
+	MountFailureNfsMount       = "nfs-mount"
+	MountFailurePolicyDenied   = "policy-denied"
+)
+
+// mapfsTimeoutErrorMessage is how the invoker reports a mapfs that did not mount within the mapfs mount timeout.
+const mapfsTimeoutErrorMessage = "command timed out"
+
+// MountDurationBuckets are the histogram buckets, in seconds, of mounts and unmounts, which wait for mapfs for up to
+// the mapfs mount timeout.
+var MountDurationBuckets = []float64{.1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120}
+
+// DriverMetrics are the metrics the driver serves on the admin server: what happens to mounts made through the
+// mounters it instruments, how the LDAP directories its id resolvers ask answer, and the volumes and mapfs processes
+// that are on the host whenever the metrics are scraped.
+type DriverMetrics struct {
+	clock clock.Clock
+
+	mounts          *metrics.Counter
+	mountFailures   *metrics.Counter
+	mountDuration   *metrics.Histogram
+	unmounts        *metrics.Counter
+	unmountDuration *metrics.Histogram
+	checks          *metrics.Counter
+	purgeDuration   *metrics.Histogram
+	ldapDuration    *metrics.Histogram
+	ldapFailures    *metrics.Counter
+	volumes         *metrics.Gauge
+	activeVolumes   *metrics.Gauge
+	mapfsProcesses  *metrics.Gauge
+	mapfsRestarts   *metrics.Counter
+
+	lock      sync.Mutex
+	reporter  driveradmin.VolumeStatusReporter
+	servers   map[string]string
+	mapfsPids map[string]int
+}
+
+func NewDriverMetrics(registry *metrics.Registry, clock clock.Clock) *DriverMetrics {
+	m := &DriverMetrics{
+		clock: clock,
+
+		mounts: registry.NewCounter(
+			"nfsv3driver_mounts_total",
+			"Mounts by result and NFS server.",
+			"result", "server",
+		),
+		mountFailures: registry.NewCounter(
+			"nfsv3driver_mount_failures_total",
+			"Failed mounts by reason and NFS server.",
+			"reason", "server",
+		),
+		mountDuration: registry.NewHistogram(
+			"nfsv3driver_mount_duration_seconds",
+			"How long mounts took, by result and NFS server.",
+			MountDurationBuckets,
+			"result", "server",
+		),
+		unmounts: registry.NewCounter(
+			"nfsv3driver_unmounts_total",
+			"Unmounts by result and NFS server.",
+			"result", "server",
+		),
+		unmountDuration: registry.NewHistogram(
+			"nfsv3driver_unmount_duration_seconds",
+			"How long unmounts took, by result and NFS server.",
+			MountDurationBuckets,
+			"result", "server",
+		),
+		checks: registry.NewCounter(
+			"nfsv3driver_mount_checks_total",
+			"Health checks of mounted volumes, by health.",
+			"health",
+		),
+		purgeDuration: registry.NewHistogram(
+			"nfsv3driver_purge_duration_seconds",
+			"How long purging the mount directory took.",
+			MountDurationBuckets,
+		),
+		ldapDuration: registry.NewHistogram(
+			"nfsv3driver_ldap_resolve_duration_seconds",
+			"How long resolving a user against LDAP took, by result.",
+			metrics.DefaultBuckets,
+			"result",
+		),
+		ldapFailures: registry.NewCounter(
+			"nfsv3driver_ldap_resolve_failures_total",
+			"Users LDAP could not resolve, by reason.",
+			"reason",
+		),
+		volumes: registry.NewGauge(
+			"nfsv3driver_volumes",
+			"Volumes known to the driver.",
+		),
+		activeVolumes: registry.NewGauge(
+			"nfsv3driver_active_volumes",
+			"Volumes mounted at least once, by the health of the mount.",
+			"health",
+		),
+		mapfsProcesses: registry.NewGauge(
+			"nfsv3driver_mapfs_processes",
+			"mapfs processes serving the driver's volumes.",
+		),
+		mapfsRestarts: registry.NewCounter(
+			"nfsv3driver_mapfs_restarts_total",
+			"Times a volume was found served by a different mapfs process than when last scraped.",
+		),
+
+		servers:   map[string]string{},
+		mapfsPids: map[string]int{},
+	}
+	registry.OnCollect(m.collect)
+	return m
+}
+
+// SetVolumeStatusReporter sets where the volume and mapfs process metrics come from. Like the status tracker it is
+// usually given, it cannot be known before the driver is created.
+func (m *DriverMetrics) SetVolumeStatusReporter(reporter driveradmin.VolumeStatusReporter) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.reporter = reporter
+}
+
+// Mounter returns a mounter that counts and times the mounts, unmounts, health checks and purges made through
+// mounter, and counts the mounts that fail by reason.
+func (m *DriverMetrics) Mounter(mounter ReloadableMounter) ReloadableMounter {
+	return &metricsMounter{ReloadableMounter: mounter, metrics: m}
+}
+
+// IdResolver returns a resolver that times the users resolver resolves and counts the ones it fails to, by reason.
+func (m *DriverMetrics) IdResolver(resolver IdResolver) IdResolver {
+	return &metricsIdResolver{IdResolver: resolver, metrics: m}
+}
+
+func (m *DriverMetrics) collect(env dockerdriver.Env) {
+	m.lock.Lock()
+	reporter := m.reporter
+	m.lock.Unlock()
+
+	if reporter == nil {
+		return
+	}
+	statuses := reporter.VolumeStatuses(env)
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	active := map[string]float64{}
+	processes := 0
+	pids := map[string]int{}
+	for _, status := range statuses {
+		if status.MountCount > 0 {
+			health := status.Health
+			if health == "" {
+				health = "unknown"
+			}
+			active[health]++
+		}
+
+		if status.MapfsPid > 0 {
+			processes++
+			pids[status.Name] = status.MapfsPid
+			if pid, ok := m.mapfsPids[status.Name]; ok && pid != status.MapfsPid {
+				m.mapfsRestarts.Inc()
+			}
+		}
+	}
+	m.mapfsPids = pids
+
+	m.volumes.Set(float64(len(statuses)))
+	m.activeVolumes.Reset()
+	for health, count := range active {
+		m.activeVolumes.Set(count, health)
+	}
+	m.mapfsProcesses.Set(float64(processes))
+}
+
+func (m *DriverMetrics) mounted(target, remote string, start time.Time, err error) {
+	server := remoteServer(remote)
+	duration := m.clock.Since(start).Seconds()
+
+	m.lock.Lock()
+	if err == nil {
+		m.servers[target] = server
+	}
+	m.lock.Unlock()
+
+	m.mounts.Inc(result(err), server)
+	m.mountDuration.Observe(duration, result(err), server)
+	if err != nil {
+		m.mountFailures.Inc(mountFailureReason(err), server)
+	}
+}
+
+func (m *DriverMetrics) unmounted(target string, start time.Time, err error) {
+	duration := m.clock.Since(start).Seconds()
+
+	m.lock.Lock()
+	server := m.servers[target]
+	if err == nil {
+		delete(m.servers, target)
+	}
+	m.lock.Unlock()
+
+	m.unmounts.Inc(result(err), server)
+	m.unmountDuration.Observe(duration, result(err), server)
+}
+
+type metricsMounter struct {
+	ReloadableMounter
+	metrics *DriverMetrics
+}
+
+func (m *metricsMounter) Mount(env dockerdriver.Env, remote string, target string, opts map[string]interface{}) error {
+	start := m.metrics.clock.Now()
+	err := m.ReloadableMounter.Mount(env, remote, target, opts)
+	m.metrics.mounted(target, remote, start, err)
+	return err
+}
+
+func (m *metricsMounter) Unmount(env dockerdriver.Env, target string) error {
+	start := m.metrics.clock.Now()
+	err := m.ReloadableMounter.Unmount(env, target)
+	m.metrics.unmounted(target, start, err)
+	return err
+}
+
+func (m *metricsMounter) Check(env dockerdriver.Env, name, mountPoint string) bool {
+	healthy := m.ReloadableMounter.Check(env, name, mountPoint)
+	if healthy {
+		m.metrics.checks.Inc(VolumeHealthy)
+	} else {
+		m.metrics.checks.Inc(VolumeUnhealthy)
+	}
+	return healthy
+}
+
+func (m *metricsMounter) Purge(env dockerdriver.Env, path string) {
+	start := m.metrics.clock.Now()
+	m.ReloadableMounter.Purge(env, path)
+	m.metrics.purgeDuration.Observe(m.metrics.clock.Since(start).Seconds())
+}
+
+type metricsIdResolver struct {
+	IdResolver
+	metrics *DriverMetrics
+}
+
+func (r *metricsIdResolver) Resolve(env dockerdriver.Env, username string, password string) (string, string, []string, error) {
+	start := r.metrics.clock.Now()
+	uid, gid, groups, err := r.IdResolver.Resolve(env, username, password)
+	r.metrics.ldapDuration.Observe(r.metrics.clock.Since(start).Seconds(), result(err))
+	if err != nil {
+		r.metrics.ldapFailures.Inc(resolveFailureReason(err))
+	}
+	return uid, gid, groups, err
+}
+
+func result(err error) string {
+	if err != nil {
+		return ResultFailure
+	}
+	return ResultSuccess
+}
+
+// resolveFailureReason tells apart the failures operators act on differently: a directory that cannot be reached,
+// users who are not in it or may not use their accounts, and throttled logins. Anything else, such as a wrong
+// password, is "rejected".
+func resolveFailureReason(err error) string {
+	switch err.Error() {
+	case LdapUnreachableErrorMessage:
+		return "unreachable"
+	case UserDoesNotExistErrorMessage:
+		return "user-not-found"
+	case TooManyFailedLoginsErrorMessage:
+		return "throttled"
+	}
+
+	if isAccountStatus(err) {
+		return "account-status"
+	}
+	return "rejected"
+}
+
+// mountFailureReason sorts a failed mount into one of the fixed classes by the description of its error. Errors that
+// are not the driver's own, such as those of mount.nfs and mapfs, are the NFS mount failing.
+func mountFailureReason(err error) string {
+	description := err.Error()
+	switch description {
+	case ShareRequiresUsernameErrorMessage, ShareNotAuthorizedErrorMessage, ShareNotPermittedErrorMessage:
+		return MountFailurePolicyDenied
+	case mapfsTimeoutErrorMessage:
+		return MountFailureMapfsTimeout
+	case LdapUnreachableErrorMessage, UserDoesNotExistErrorMessage, TooManyFailedLoginsErrorMessage,
+		InvalidCredentialsErrorMessage, MissingUidNumberErrorMessage, InvalidUidNumberErrorMessage,
+		InvalidGidNumberErrorMessage, AmbiguousSearchErrorMessage, AutomountKeyDoesNotExistErrorMessage,
+		UnsupportedAutomountEntryErrorMessage:
+		return MountFailureLdap
+	case NotAllowedOptionsErrorMessage, MissingGidErrorMessage, InvalidShareErrorMessage, InvalidCacheErrorMessage,
+		InvalidVersionErrorMessage, InvalidUidValueErrorMessage, InvalidGidValueErrorMessage, InvalidSecErrorMessage,
+		KerberosNotConfiguredErrorMessage, KerberosRequiresCredentialsErrorMessage, InvalidAutomountKeyErrorMessage,
+		AutomountNotConfiguredErrorMessage, LdapNotConfiguredErrorMessage, AmbiguousPasswordErrorMessage,
+		MissingPasswordErrorMessage, SecretsNotConfiguredErrorMessage, UnreadableSecretErrorMessage,
+		InvalidUsernameErrorMessage, UsernameRequiresDomainErrorMessage, InvalidTokenErrorMessage,
+		TokenExpiredErrorMessage, TokenNotYetValidErrorMessage, TokenAudienceErrorMessage, TokenIssuerErrorMessage,
+		TokenMissingUidErrorMessage, TokenNotConfiguredErrorMessage:
+		return MountFailureInvalidOptions
+	}
+
+	switch {
+	case isAccountStatus(err), strings.HasPrefix(description, "LDAP Result Code"):
+		return MountFailureLdap
+	case strings.HasPrefix(description, UnknownDomainErrorMessage), strings.HasPrefix(description, "- "):
+		// the options that volume-mount-options rejects are listed one per line, each starting with a dash
+		return MountFailureInvalidOptions
+	}
+	return MountFailureNfsMount
+}
+
+// remoteServer returns the NFS server of a share given as server:/export or nfs://server/export, without any
+// credentials, or nothing for an automounted volume whose share is not known until it is mounted.
+func remoteServer(remote string) string {
+	if match := legacyNfsSharePattern.FindStringSubmatch(remote); len(match) > 1 {
+		remote = match[1] + ":/"
+	}
+	if i := strings.Index(remote, ":/"); i >= 0 {
+		remote = remote[:i]
+	} else {
+		return ""
+	}
+	if i := strings.LastIndex(remote, "@"); i >= 0 {
+		remote = remote[i+1:]
+	}
+	return remote
+}
@@ -0,0 +1,311 @@
+// Package metrics keeps counters, gauges and histograms and writes them in the Prometheus text exposition format,
+// so that the driver can be scraped without taking on the Prometheus client and its dependencies.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"code.cloudfoundry.org/dockerdriver"
+)
+
+// ContentType is the content type of the text exposition format written by Registry.Write.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds, in seconds, of the histogram buckets used when none are given.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Registry holds the metrics of a process. Metrics are created once, when the process starts, and their names must
+// be unique.
+type Registry struct {
+	lock       sync.Mutex
+	families   map[string]family
+	collectors []func(env dockerdriver.Env)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: map[string]family{}}
+}
+
+type family interface {
+	write(w *bufio.Writer)
+}
+
+// NewCounter returns a counter called name with the given label names.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{vec: newVec(name, help, "counter", labels)}
+	r.register(name, c)
+	return c
+}
+
+// NewGauge returns a gauge called name with the given label names.
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{vec: newVec(name, help, "gauge", labels)}
+	r.register(name, g)
+	return g
+}
+
+// NewHistogram returns a histogram called name with the given bucket upper bounds, or DefaultBuckets when there are
+// none, and label names.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+
+	h := &Histogram{vec: newVec(name, help, "histogram", labels), buckets: buckets}
+	r.register(name, h)
+	return h
+}
+
+// OnCollect registers a function that is called every time the metrics are written, before they are, to bring the
+// metrics that describe the current state of the process up to date.
+func (r *Registry) OnCollect(collector func(env dockerdriver.Env)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.collectors = append(r.collectors, collector)
+}
+
+// Write brings the metrics up to date and writes them to w, ordered by name.
+func (r *Registry) Write(env dockerdriver.Env, w io.Writer) error {
+	r.lock.Lock()
+	collectors := append([]func(env dockerdriver.Env){}, r.collectors...)
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	families := r.families
+	r.lock.Unlock()
+
+	for _, collect := range collectors {
+		collect(env)
+	}
+
+	sort.Strings(names)
+	buffered := bufio.NewWriter(w)
+	for _, name := range names {
+		families[name].write(buffered)
+	}
+	return buffered.Flush()
+}
+
+func (r *Registry) register(name string, f family) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.families[name]; ok {
+		panic(fmt.Sprintf("metric %s is already registered", name))
+	}
+	r.families[name] = f
+}
+
+// vec holds the series of a metric, one for each combination of label values it has been given.
+type vec struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	lock   sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	counts      []uint64
+	count       uint64
+}
+
+func newVec(name, help, kind string, labels []string) vec {
+	return vec{name: name, help: help, kind: kind, labels: labels, series: map[string]*series{}}
+}
+
+// with returns the series for labelValues, creating it if needed. The caller must hold the lock.
+func (v *vec) with(labelValues []string) *series {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s has labels %v, got values %v", v.name, v.labels, labelValues))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string{}, labelValues...)}
+		v.series[key] = s
+	}
+	return s
+}
+
+// sorted returns the series ordered by their label values, always including the one series of a metric without
+// labels. The caller must hold the lock.
+func (v *vec) sorted() []*series {
+	if len(v.labels) == 0 {
+		v.with(nil)
+	}
+
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	sorted := make([]*series, len(keys))
+	for i, key := range keys {
+		sorted[i] = v.series[key]
+	}
+	return sorted
+}
+
+func (v *vec) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, escape(v.help, false))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.kind)
+}
+
+func (v *vec) writeSample(w *bufio.Writer, name string, labelValues []string, extraLabel, extraValue string, value float64) {
+	var pairs []string
+	for i, label := range v.labels {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, label, escape(labelValues[i], true)))
+	}
+	if extraLabel != "" {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extraLabel, extraValue))
+	}
+
+	if len(pairs) > 0 {
+		fmt.Fprintf(w, "%s{%s} %s\n", name, strings.Join(pairs, ","), formatFloat(value))
+	} else {
+		fmt.Fprintf(w, "%s %s\n", name, formatFloat(value))
+	}
+}
+
+// Counter is a value that only goes up, such as the number of mounts.
+type Counter struct {
+	vec
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds delta, which must not be negative, to the series for labelValues.
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic(fmt.Sprintf("counter %s cannot decrease", c.name))
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.with(labelValues).value += delta
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.writeHeader(w)
+	for _, s := range c.sorted() {
+		c.writeSample(w, c.name, s.labelValues, "", "", s.value)
+	}
+}
+
+// Gauge is a value that goes up and down, such as the number of volumes.
+type Gauge struct {
+	vec
+}
+
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.with(labelValues).value = value
+}
+
+// Reset drops every series, so that label values that no longer apply are not reported.
+func (g *Gauge) Reset() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.series = map[string]*series{}
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.writeHeader(w)
+	for _, s := range g.sorted() {
+		g.writeSample(w, g.name, s.labelValues, "", "", s.value)
+	}
+}
+
+// Histogram counts observations, such as how long mounts take, in buckets.
+type Histogram struct {
+	vec
+	buckets []float64
+}
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	s := h.with(labelValues)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(h.buckets))
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.value += value
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.writeHeader(w)
+	for _, s := range h.sorted() {
+		for i, bound := range h.buckets {
+			var count uint64
+			if s.counts != nil {
+				count = s.counts[i]
+			}
+			h.writeSample(w, h.name+"_bucket", s.labelValues, "le", formatFloat(bound), float64(count))
+		}
+		h.writeSample(w, h.name+"_bucket", s.labelValues, "le", "+Inf", float64(s.count))
+		h.writeSample(w, h.name+"_sum", s.labelValues, "", "", s.value)
+		h.writeSample(w, h.name+"_count", s.labelValues, "", "", float64(s.count))
+	}
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// escape escapes backslashes and line feeds, and double quotes in label values, as the exposition format requires.
+func escape(s string, quotes bool) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	if quotes {
+		s = strings.Replace(s, `"`, `\"`, -1)
+	}
+	return s
+}
@@ -0,0 +1,102 @@
+package metrics_test
+
+import (
+	"bytes"
+	"context"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nfsv3driver/metrics"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Registry", func() {
+	var (
+		env      dockerdriver.Env
+		registry *metrics.Registry
+	)
+
+	BeforeEach(func() {
+		env = driverhttp.NewHttpDriverEnv(lagertest.NewTestLogger("metrics"), context.TODO())
+		registry = metrics.NewRegistry()
+	})
+
+	write := func() string {
+		var out bytes.Buffer
+		Expect(registry.Write(env, &out)).To(Succeed())
+		return out.String()
+	}
+
+	It("writes counters by label, ordered by name", func() {
+		mounts := registry.NewCounter("mounts_total", "Mounts by result.", "result")
+		registry.NewCounter("evacuations_total", "Evacuations.")
+
+		mounts.Inc("success")
+		mounts.Inc("failure")
+		mounts.Add(2, "success")
+
+		Expect(write()).To(Equal(`# HELP evacuations_total Evacuations.
+# TYPE evacuations_total counter
+evacuations_total 0
+# HELP mounts_total Mounts by result.
+# TYPE mounts_total counter
+mounts_total{result="failure"} 1
+mounts_total{result="success"} 3
+`))
+	})
+
+	It("writes gauges, dropping the series that were reset", func() {
+		volumes := registry.NewGauge("volumes", "Volumes by health.", "health")
+		volumes.Set(3, "healthy")
+		volumes.Reset()
+		volumes.Set(1, "unhealthy")
+
+		Expect(write()).To(Equal(`# HELP volumes Volumes by health.
+# TYPE volumes gauge
+volumes{health="unhealthy"} 1
+`))
+	})
+
+	It("writes histograms with cumulative buckets", func() {
+		duration := registry.NewHistogram("mount_duration_seconds", "How long mounts take.", []float64{1, 0.1}, "server")
+		duration.Observe(0.05, "filer")
+		duration.Observe(0.5, "filer")
+		duration.Observe(5, "filer")
+
+		Expect(write()).To(Equal(`# HELP mount_duration_seconds How long mounts take.
+# TYPE mount_duration_seconds histogram
+mount_duration_seconds_bucket{server="filer",le="0.1"} 1
+mount_duration_seconds_bucket{server="filer",le="1"} 2
+mount_duration_seconds_bucket{server="filer",le="+Inf"} 3
+mount_duration_seconds_sum{server="filer"} 5.55
+mount_duration_seconds_count{server="filer"} 3
+`))
+	})
+
+	It("escapes label values", func() {
+		registry.NewGauge("checks", "Checks.", "check").Set(1, "say \"hi\"\\\n")
+
+		Expect(write()).To(ContainSubstring(`checks{check="say \"hi\"\\\n"} 1`))
+	})
+
+	It("runs the collectors before writing", func() {
+		processes := registry.NewGauge("processes", "Processes.")
+		registry.OnCollect(func(dockerdriver.Env) {
+			processes.Set(4)
+		})
+
+		Expect(write()).To(ContainSubstring("processes 4\n"))
+	})
+
+	It("rejects metrics registered twice", func() {
+		registry.NewCounter("mounts_total", "Mounts.")
+		Expect(func() { registry.NewGauge("mounts_total", "Mounts.") }).To(Panic())
+	})
+
+	It("rejects the wrong number of label values", func() {
+		mounts := registry.NewCounter("mounts_total", "Mounts.", "result", "server")
+		Expect(func() { mounts.Inc("success") }).To(Panic())
+	})
+})
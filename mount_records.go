@@ -0,0 +1,288 @@
+package nfsv3driver
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/goshims/ioutilshim"
+	"code.cloudfoundry.org/goshims/osshim"
+	"code.cloudfoundry.org/goshims/syscallshim"
+	"code.cloudfoundry.org/lager"
+)
+
+// MountRecordSecretOptions are the options that are never recorded. The identity they resolved to is recorded in
+// their place.
+var MountRecordSecretOptions = []string{"username", "password", "password_file", "token"}
+
+// MountRecord is what it took to mount a volume, with the user's credentials replaced by the identity they
+// resolved to, so that the volume can be mounted again after a restart without them.
+type MountRecord struct {
+	Remote   string                 `json:"remote"`
+	Options  map[string]interface{} `json:"options"`
+	Username string                 `json:"username,omitempty"`
+	Subject  string                 `json:"subject,omitempty"`
+	Uid      string                 `json:"uid,omitempty"`
+	Gid      string                 `json:"gid,omitempty"`
+	Groups   []string               `json:"groups,omitempty"`
+}
+
+// The options the mounter and the recorder pass identities in. Their values are mountIdentity values, which no
+// request can supply, as options arrive as JSON.
+const (
+	// resolvedIdentityOption is left in the options by the mounter, with the identity it resolved the user's
+	// credentials to
+	resolvedIdentityOption = "resolved_identity"
+	// restoredIdentityOption is given to the mounter by the recorder, with the identity a volume was recorded
+	// with, for the mounter to use without the credentials it was resolved from
+	restoredIdentityOption = "restored_identity"
+)
+
+// mountIdentity is who a volume was mounted as when the driver resolved it from the user's credentials: an LDAP
+// username or the subject of a token, and the ids and groups they resolved to.
+type mountIdentity struct {
+	Username string
+	Subject  string
+	Uid      string
+	Gid      string
+	Groups   []string
+}
+
+func (i mountIdentity) account() string {
+	if i.Username != "" {
+		return i.Username
+	}
+	return i.Subject
+}
+
+// MountRecordStore persists mount records, keyed by volume name.
+//
+//go:generate counterfeiter -o nfsdriverfakes/fake_mount_record_store.go . MountRecordStore
+type MountRecordStore interface {
+	Load() (map[string]MountRecord, error)
+	Save(records map[string]MountRecord) error
+}
+
+type encryptedMountRecordStore struct {
+	file *sealedFile
+}
+
+// NewEncryptedMountRecordStore returns a store that keeps the mount records in path, sealed with AES-256-GCM under
+// key.
+func NewEncryptedMountRecordStore(ioutil ioutilshim.Ioutil, os osshim.Os, syscall syscallshim.Syscall, path string, key []byte) (MountRecordStore, error) {
+	file, err := newSealedFile(ioutil, os, syscall, path, key, "mount records")
+	if err != nil {
+		return nil, err
+	}
+
+	return &encryptedMountRecordStore{file: file}, nil
+}
+
+func (s *encryptedMountRecordStore) Load() (map[string]MountRecord, error) {
+	records := map[string]MountRecord{}
+	if err := s.file.load(&records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (s *encryptedMountRecordStore) Save(records map[string]MountRecord) error {
+	return s.file.save(records)
+}
+
+// MountRecorder remembers how each volume was last mounted. The driver forgets the options of its volumes when it
+// restarts, so a volume that is still mounted cannot be remounted when its mount is found to be broken; the
+// recorder gives the driver back the recorded options of a volume the first time it is used after a restart,
+// together with the identity it was mounted as, which the mounter uses in place of the user's credentials. Kerberos
+// secured volumes are mounted again with the credential cache left by the earlier run, while it lasts.
+type MountRecorder struct {
+	store MountRecordStore
+
+	lock     sync.Mutex
+	restored map[string]bool
+}
+
+func NewMountRecorder(store MountRecordStore) *MountRecorder {
+	return &MountRecorder{
+		store:    store,
+		restored: map[string]bool{},
+	}
+}
+
+func (r *MountRecorder) record(logger lager.Logger, volume string, record MountRecord) {
+	r.update(logger, func(records map[string]MountRecord) {
+		records[volume] = record
+	})
+}
+
+func (r *MountRecorder) forget(logger lager.Logger, volume string) {
+	r.update(logger, func(records map[string]MountRecord) {
+		delete(records, volume)
+	})
+}
+
+func (r *MountRecorder) update(logger lager.Logger, change func(map[string]MountRecord)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	records, err := r.store.Load()
+	if err != nil {
+		logger.Error("load-mount-records-failed", err)
+		records = map[string]MountRecord{}
+	}
+
+	change(records)
+
+	if err := r.store.Save(records); err != nil {
+		logger.Error("save-mount-records-failed", err)
+	}
+}
+
+// lookup returns the record of volume if the driver has not been given its options since it started.
+func (r *MountRecorder) lookup(logger lager.Logger, volume string) (MountRecord, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.restored[volume] {
+		return MountRecord{}, false
+	}
+
+	records, err := r.store.Load()
+	if err != nil {
+		logger.Error("load-mount-records-failed", err)
+		return MountRecord{}, false
+	}
+
+	record, ok := records[volume]
+	return record, ok
+}
+
+// records returns every record, or none when they cannot be loaded.
+func (r *MountRecorder) records(logger lager.Logger) map[string]MountRecord {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	records, err := r.store.Load()
+	if err != nil {
+		logger.Error("load-mount-records-failed", err)
+		return map[string]MountRecord{}
+	}
+	return records
+}
+
+// created notes that the driver has been given the options of volume.
+func (r *MountRecorder) created(volume string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.restored[volume] = true
+}
+
+type recordingMounter struct {
+	ReloadableMounter
+	recorder *MountRecorder
+}
+
+// NewRecordingMounter records every successful mount with recorder, under the name of the volume, which the driver
+// uses as the name of the mount point. The mounter leaves the identity it resolved in the options.
+func NewRecordingMounter(mounter ReloadableMounter, recorder *MountRecorder) ReloadableMounter {
+	return &recordingMounter{ReloadableMounter: mounter, recorder: recorder}
+}
+
+func (m *recordingMounter) Mount(env dockerdriver.Env, remote string, target string, opts map[string]interface{}) error {
+	err := m.ReloadableMounter.Mount(env, remote, target, opts)
+	if err != nil {
+		return err
+	}
+
+	record := MountRecord{Remote: remote, Options: map[string]interface{}{}}
+	for name, value := range opts {
+		record.Options[name] = value
+	}
+	for _, name := range MountRecordSecretOptions {
+		delete(record.Options, name)
+	}
+	delete(record.Options, resolvedIdentityOption)
+	delete(record.Options, restoredIdentityOption)
+	if identity, ok := opts[resolvedIdentityOption].(mountIdentity); ok {
+		record.Username = identity.Username
+		record.Subject = identity.Subject
+		record.Groups = identity.Groups
+	} else if username, ok := opts["username"].(string); ok {
+		record.Username = username
+	}
+	record.Uid = uniformData(opts["uid"])
+	record.Gid = uniformData(opts["gid"])
+	if record.Uid != "" {
+		record.Options["uid"] = record.Uid
+	}
+	if record.Gid != "" {
+		record.Options["gid"] = record.Gid
+	}
+
+	m.recorder.record(env.Logger().Session("record-mount"), filepath.Base(target), record)
+	return nil
+}
+
+//go:generate counterfeiter -o nfsdriverfakes/fake_driver.go code.cloudfoundry.org/dockerdriver.Driver
+
+type recordingDriver struct {
+	dockerdriver.Driver
+	recorder *MountRecorder
+}
+
+// NewRecordingDriver gives driver back the recorded options of a volume before it is first mounted after a
+// restart, and forgets the record once the volume is removed.
+func NewRecordingDriver(driver dockerdriver.Driver, recorder *MountRecorder) dockerdriver.Driver {
+	return &recordingDriver{Driver: driver, recorder: recorder}
+}
+
+func (d *recordingDriver) Create(env dockerdriver.Env, createRequest dockerdriver.CreateRequest) dockerdriver.ErrorResponse {
+	response := d.Driver.Create(env, createRequest)
+	if response.Err == "" {
+		d.recorder.created(createRequest.Name)
+	}
+	return response
+}
+
+func (d *recordingDriver) Mount(env dockerdriver.Env, mountRequest dockerdriver.MountRequest) dockerdriver.MountResponse {
+	logger := env.Logger().Session("restore-mount-options", lager.Data{"volume": mountRequest.Name})
+
+	if record, ok := d.recorder.lookup(logger, mountRequest.Name); ok {
+		opts := map[string]interface{}{"source": record.Remote}
+		for name, value := range record.Options {
+			opts[name] = value
+		}
+		if (record.Username != "" || record.Subject != "") && record.Uid != "" {
+			opts[restoredIdentityOption] = mountIdentity{
+				Username: record.Username,
+				Subject:  record.Subject,
+				Uid:      record.Uid,
+				Gid:      record.Gid,
+				Groups:   record.Groups,
+			}
+			if record.Username != "" {
+				opts["username"] = record.Username
+			}
+		}
+
+		response := d.Driver.Create(env, dockerdriver.CreateRequest{Name: mountRequest.Name, Opts: opts})
+		if response.Err != "" {
+			logger.Error("create-failed", errors.New(response.Err))
+		} else {
+			logger.Info("restored", lager.Data{"remote": record.Remote, "username": record.Username, "uid": record.Uid, "gid": record.Gid})
+			d.recorder.created(mountRequest.Name)
+		}
+	}
+
+	return d.Driver.Mount(env, mountRequest)
+}
+
+func (d *recordingDriver) Remove(env dockerdriver.Env, removeRequest dockerdriver.RemoveRequest) dockerdriver.ErrorResponse {
+	response := d.Driver.Remove(env, removeRequest)
+	if response.Err == "" {
+		d.recorder.forget(env.Logger().Session("forget-mount"), removeRequest.Name)
+	}
+	return response
+}
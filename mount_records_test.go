@@ -0,0 +1,456 @@
+package nfsv3driver_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"syscall"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/goshims/ioutilshim/ioutil_fake"
+	"code.cloudfoundry.org/goshims/osshim/os_fake"
+	"code.cloudfoundry.org/goshims/syscallshim/syscall_fake"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nfsv3driver"
+	"code.cloudfoundry.org/nfsv3driver/nfsdriverfakes"
+	vmo "code.cloudfoundry.org/volume-mount-options"
+	"code.cloudfoundry.org/volumedriver/invokerfakes"
+	"code.cloudfoundry.org/volumedriver/volumedriverfakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("MountRecorder", func() {
+	var (
+		logger      *lagertest.TestLogger
+		env         dockerdriver.Env
+		records     map[string]nfsv3driver.MountRecord
+		fakeStore   *nfsdriverfakes.FakeMountRecordStore
+		fakeMounter *nfsdriverfakes.FakeReloadableMounter
+		fakeDriver  *nfsdriverfakes.FakeDriver
+		mounter     nfsv3driver.ReloadableMounter
+		driver      dockerdriver.Driver
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("mount-recorder")
+		env = driverhttp.NewHttpDriverEnv(logger, context.TODO())
+
+		records = map[string]nfsv3driver.MountRecord{}
+		fakeStore = &nfsdriverfakes.FakeMountRecordStore{}
+		fakeStore.LoadStub = func() (map[string]nfsv3driver.MountRecord, error) {
+			loaded := map[string]nfsv3driver.MountRecord{}
+			for volume, record := range records {
+				loaded[volume] = record
+			}
+			return loaded, nil
+		}
+		fakeStore.SaveStub = func(saved map[string]nfsv3driver.MountRecord) error {
+			records = saved
+			return nil
+		}
+
+		fakeMounter = &nfsdriverfakes.FakeReloadableMounter{}
+		fakeDriver = &nfsdriverfakes.FakeDriver{}
+	})
+
+	JustBeforeEach(func() {
+		recorder := nfsv3driver.NewMountRecorder(fakeStore)
+		mounter = nfsv3driver.NewRecordingMounter(fakeMounter, recorder)
+		driver = nfsv3driver.NewRecordingDriver(fakeDriver, recorder)
+	})
+
+	Describe("recording mounts", func() {
+		BeforeEach(func() {
+			fakeMounter.MountStub = func(_ dockerdriver.Env, _ string, _ string, opts map[string]interface{}) error {
+				if _, ok := opts["username"]; ok {
+					opts["uid"] = "1000"
+					opts["gid"] = "1001"
+				}
+				return nil
+			}
+		})
+
+		It("records the identity the credentials resolved to in their place", func() {
+			Expect(mounter.Mount(env, "filer:/export", "/var/vcap/data/volumes/nfs/vol1", map[string]interface{}{
+				"source":   "filer:/export",
+				"username": "alice",
+				"password": "secret",
+				"readonly": true,
+			})).To(Succeed())
+
+			Expect(records).To(Equal(map[string]nfsv3driver.MountRecord{
+				"vol1": {
+					Remote:   "filer:/export",
+					Options:  map[string]interface{}{"source": "filer:/export", "readonly": true, "uid": "1000", "gid": "1001"},
+					Username: "alice",
+					Uid:      "1000",
+					Gid:      "1001",
+				},
+			}))
+		})
+
+		It("records the uid and gid given in the options", func() {
+			Expect(mounter.Mount(env, "filer:/export", "/var/vcap/data/volumes/nfs/vol1", map[string]interface{}{
+				"uid": 2000,
+				"gid": "2000",
+			})).To(Succeed())
+
+			Expect(records["vol1"].Options).To(Equal(map[string]interface{}{"uid": "2000", "gid": "2000"}))
+		})
+
+		It("does not record mounts that failed", func() {
+			fakeMounter.MountStub = nil
+			fakeMounter.MountReturns(errors.New("mount failed"))
+
+			Expect(mounter.Mount(env, "filer:/export", "/var/vcap/data/volumes/nfs/vol1", map[string]interface{}{})).NotTo(Succeed())
+			Expect(fakeStore.SaveCallCount()).To(Equal(0))
+		})
+
+		Context("when the records cannot be saved", func() {
+			BeforeEach(func() {
+				fakeStore.SaveStub = nil
+				fakeStore.SaveReturns(errors.New("disk full"))
+			})
+
+			It("still mounts the volume", func() {
+				Expect(mounter.Mount(env, "filer:/export", "/var/vcap/data/volumes/nfs/vol1", map[string]interface{}{})).To(Succeed())
+				Expect(logger.Buffer()).To(gbytes.Say("save-mount-records-failed.*disk full"))
+			})
+		})
+	})
+
+	Describe("restoring options", func() {
+		BeforeEach(func() {
+			records["vol1"] = nfsv3driver.MountRecord{
+				Remote:   "filer:/export",
+				Options:  map[string]interface{}{"readonly": true, "uid": "1000", "gid": "1001"},
+				Username: "alice",
+				Uid:      "1000",
+				Gid:      "1001",
+			}
+			fakeDriver.MountReturns(dockerdriver.MountResponse{Mountpoint: "/var/vcap/data/volumes/nfs/vol1"})
+		})
+
+		It("gives the driver the recorded options before the volume is first mounted", func() {
+			response := driver.Mount(env, dockerdriver.MountRequest{Name: "vol1"})
+			Expect(response.Mountpoint).To(Equal("/var/vcap/data/volumes/nfs/vol1"))
+
+			Expect(fakeDriver.CreateCallCount()).To(Equal(1))
+			_, createRequest := fakeDriver.CreateArgsForCall(0)
+			Expect(createRequest.Name).To(Equal("vol1"))
+			Expect(createRequest.Opts).To(HaveKeyWithValue("source", "filer:/export"))
+			Expect(createRequest.Opts).To(HaveKeyWithValue("readonly", true))
+			Expect(createRequest.Opts).To(HaveKeyWithValue("username", "alice"))
+			Expect(createRequest.Opts).NotTo(HaveKey("password"))
+
+			driver.Mount(env, dockerdriver.MountRequest{Name: "vol1"})
+			Expect(fakeDriver.CreateCallCount()).To(Equal(1))
+			Expect(fakeDriver.MountCallCount()).To(Equal(2))
+		})
+
+		It("restores the options of volumes mounted without credentials as they were", func() {
+			records["vol2"] = nfsv3driver.MountRecord{
+				Remote:  "filer:/export",
+				Options: map[string]interface{}{"uid": "2000", "gid": "2000"},
+				Uid:     "2000",
+				Gid:     "2000",
+			}
+			driver.Mount(env, dockerdriver.MountRequest{Name: "vol2"})
+
+			_, createRequest := fakeDriver.CreateArgsForCall(0)
+			Expect(createRequest).To(Equal(dockerdriver.CreateRequest{
+				Name: "vol2",
+				Opts: map[string]interface{}{"source": "filer:/export", "uid": "2000", "gid": "2000"},
+			}))
+		})
+
+		It("leaves volumes the driver has been given options for alone", func() {
+			driver.Create(env, dockerdriver.CreateRequest{Name: "vol1", Opts: map[string]interface{}{"source": "filer:/export"}})
+			driver.Mount(env, dockerdriver.MountRequest{Name: "vol1"})
+
+			Expect(fakeDriver.CreateCallCount()).To(Equal(1))
+		})
+
+		It("leaves volumes without a record alone", func() {
+			driver.Mount(env, dockerdriver.MountRequest{Name: "vol2"})
+
+			Expect(fakeDriver.CreateCallCount()).To(Equal(0))
+			Expect(fakeDriver.MountCallCount()).To(Equal(1))
+		})
+
+		It("forgets the record once the volume is removed", func() {
+			driver.Remove(env, dockerdriver.RemoveRequest{Name: "vol1"})
+
+			Expect(records).To(BeEmpty())
+		})
+
+		It("keeps the record when the volume cannot be removed", func() {
+			fakeDriver.RemoveReturns(dockerdriver.ErrorResponse{Err: "volume is in use"})
+			driver.Remove(env, dockerdriver.RemoveRequest{Name: "vol1"})
+
+			Expect(records).To(HaveKey("vol1"))
+		})
+	})
+})
+
+var _ = Describe("MountRecorder with the mapfs mounter", func() {
+	const target = "/var/vcap/data/volumes/nfs/vol1"
+
+	var (
+		env          dockerdriver.Env
+		records      map[string]nfsv3driver.MountRecord
+		fakeStore    *nfsdriverfakes.FakeMountRecordStore
+		fakeInvoker  *invokerfakes.FakeInvoker
+		fakeResolver *nfsdriverfakes.FakeIdResolver
+		fakeKerberos *nfsdriverfakes.FakeKerberosCredentials
+		authorizer   nfsv3driver.ShareAuthorizer
+		mask         vmo.MountOptsMask
+
+		opts map[string]interface{}
+	)
+
+	BeforeEach(func() {
+		env = driverhttp.NewHttpDriverEnv(lagertest.NewTestLogger("mount-recorder"), context.TODO())
+
+		records = map[string]nfsv3driver.MountRecord{}
+		fakeStore = &nfsdriverfakes.FakeMountRecordStore{}
+		fakeStore.LoadStub = func() (map[string]nfsv3driver.MountRecord, error) {
+			loaded := map[string]nfsv3driver.MountRecord{}
+			for volume, record := range records {
+				loaded[volume] = record
+			}
+			return loaded, nil
+		}
+		fakeStore.SaveStub = func(saved map[string]nfsv3driver.MountRecord) error {
+			records = saved
+			return nil
+		}
+
+		fakeInvoker = &invokerfakes.FakeInvoker{}
+		fakeInvoker.InvokeReturns(&invokerfakes.FakeInvokeResult{})
+		fakeResolver = &nfsdriverfakes.FakeIdResolver{}
+		fakeResolver.ResolveReturns("1000", "1001", []string{"CN=Finance,OU=Groups,DC=corp"}, nil)
+		fakeKerberos = &nfsdriverfakes.FakeKerberosCredentials{}
+
+		var err error
+		authorizer, err = nfsv3driver.NewSharePolicy([]nfsv3driver.ShareRule{{Export: "filer:/finance", Groups: []string{"Finance"}}}, false)
+		Expect(err).NotTo(HaveOccurred())
+		mask, err = nfsv3driver.NewMapFsVolumeMountMask()
+		Expect(err).NotTo(HaveOccurred())
+
+		opts = map[string]interface{}{"source": "filer:/finance", "username": "alice", "password": "secret"}
+	})
+
+	// newMounter returns the mounter of a run of the driver, recording with a recorder of its own
+	newMounter := func() (nfsv3driver.ReloadableMounter, *nfsv3driver.MountRecorder) {
+		fakeSyscall := &syscall_fake.FakeSyscall{}
+		fakeSyscall.StatStub = func(path string, st *syscall.Stat_t) error {
+			st.Mode = 0777
+			return nil
+		}
+		mapfs := nfsv3driver.NewMapfsMounter(fakeInvoker, &os_fake.FakeOs{}, fakeSyscall, &ioutil_fake.FakeIoutil{}, &volumedriverfakes.FakeMountChecker{}, "nfs", "", fakeResolver, mask, "/var/vcap/packages/mapfs/bin/mapfs", nil, authorizer, nil, fakeKerberos)
+
+		recorder := nfsv3driver.NewMountRecorder(fakeStore)
+		return nfsv3driver.NewRecordingMounter(mapfs, recorder), recorder
+	}
+
+	// restore mounts the volume after a restart the way the driver does, with the options the recorder gives back
+	restore := func() error {
+		mounter, recorder := newMounter()
+
+		var mountErr error
+		fakeDriver := &nfsdriverfakes.FakeDriver{}
+		fakeDriver.CreateStub = func(env dockerdriver.Env, createRequest dockerdriver.CreateRequest) dockerdriver.ErrorResponse {
+			mountErr = mounter.Mount(env, createRequest.Opts["source"].(string), target, createRequest.Opts)
+			return dockerdriver.ErrorResponse{}
+		}
+
+		nfsv3driver.NewRecordingDriver(fakeDriver, recorder).Mount(env, dockerdriver.MountRequest{Name: "vol1"})
+		Expect(fakeDriver.CreateCallCount()).To(Equal(1))
+		return mountErr
+	}
+
+	JustBeforeEach(func() {
+		mounter, _ := newMounter()
+		Expect(mounter.Mount(env, "filer:/finance", target, opts)).To(Succeed())
+		fakeResolver.ResolveReturns("", "", nil, dockerdriver.SafeError{SafeDescription: nfsv3driver.LdapUnreachableErrorMessage})
+	})
+
+	It("records the groups the user resolved to", func() {
+		Expect(records["vol1"].Username).To(Equal("alice"))
+		Expect(records["vol1"].Groups).To(ConsistOf("CN=Finance,OU=Groups,DC=corp"))
+		Expect(records["vol1"].Options).NotTo(HaveKey("resolved_identity"))
+	})
+
+	It("mounts a share covered by the share policy again as the recorded user, without resolving them", func() {
+		Expect(restore()).To(Succeed())
+		Expect(fakeResolver.ResolveCallCount()).To(Equal(1))
+
+		_, command, args, _ := fakeInvoker.InvokeArgsForCall(fakeInvoker.InvokeCallCount() - 1)
+		Expect(command).To(Equal("/var/vcap/packages/mapfs/bin/mapfs"))
+		Expect(args).To(ContainElements("-uid", "1000", "-gid", "1001"))
+	})
+
+	Context("when the recorded user is no longer allowed the share", func() {
+		JustBeforeEach(func() {
+			var err error
+			authorizer, err = nfsv3driver.NewSharePolicy([]nfsv3driver.ShareRule{{Export: "filer:/finance", Groups: []string{"Payroll"}}}, false)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("refuses to mount it again", func() {
+			Expect(restore()).To(MatchError(nfsv3driver.ShareNotAuthorizedErrorMessage))
+		})
+	})
+
+	Context("when the allowed options do not include uid and gid", func() {
+		BeforeEach(func() {
+			var err error
+			mask, err = nfsv3driver.NewMapFsVolumeMountMask("source", "username", "password")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("mounts the volume again", func() {
+			Expect(restore()).To(Succeed())
+		})
+	})
+
+	Context("when the share is secured with Kerberos", func() {
+		BeforeEach(func() {
+			opts["sec"] = "krb5"
+		})
+
+		It("mounts it again with the credential cache of the earlier run", func() {
+			Expect(restore()).To(Succeed())
+
+			Expect(fakeKerberos.AcquireCallCount()).To(Equal(1))
+			Expect(fakeKerberos.AdoptCallCount()).To(Equal(1))
+			_, adoptedTarget, username, uid := fakeKerberos.AdoptArgsForCall(0)
+			Expect(adoptedTarget).To(Equal(target))
+			Expect(username).To(Equal("alice"))
+			Expect(uid).To(Equal(1000))
+		})
+
+		Context("when the credential cache is gone", func() {
+			BeforeEach(func() {
+				fakeKerberos.AdoptReturns(dockerdriver.SafeError{SafeDescription: nfsv3driver.KerberosRequiresCredentialsErrorMessage})
+			})
+
+			It("needs the user's credentials to mount it again", func() {
+				Expect(restore()).To(MatchError(nfsv3driver.KerberosRequiresCredentialsErrorMessage))
+			})
+		})
+	})
+
+	It("does not take an identity from the options of a request", func() {
+		mounter, _ := newMounter()
+		err := mounter.Mount(env, "filer:/finance", target, map[string]interface{}{
+			"source":            "filer:/finance",
+			"username":          "mallory",
+			"restored_identity": map[string]interface{}{"Username": "alice", "Uid": "1000", "Gid": "1001", "Groups": []interface{}{"CN=Finance,OU=Groups,DC=corp"}},
+		})
+		Expect(err).To(MatchError("LDAP username is specified but LDAP password is missing"))
+	})
+})
+
+var _ = Describe("EncryptedMountRecordStore", func() {
+	var (
+		files       map[string][]byte
+		fakeIoutil  *ioutil_fake.FakeIoutil
+		fakeOs      *os_fake.FakeOs
+		fakeSyscall *syscall_fake.FakeSyscall
+	)
+
+	BeforeEach(func() {
+		files = map[string][]byte{}
+		fakeIoutil = &ioutil_fake.FakeIoutil{}
+		fakeIoutil.ReadFileStub = func(path string) ([]byte, error) {
+			contents, ok := files[path]
+			if !ok {
+				return nil, os.ErrNotExist
+			}
+			return contents, nil
+		}
+		fakeOs = &os_fake.FakeOs{}
+		fakeOs.IsNotExistStub = os.IsNotExist
+		writeFilesThrough(fakeOs, files)
+		fakeSyscall = &syscall_fake.FakeSyscall{}
+	})
+
+	It("refuses keys that are not 256 bits", func() {
+		_, err := nfsv3driver.NewEncryptedMountRecordStore(fakeIoutil, fakeOs, fakeSyscall, "/records", []byte("short"))
+		Expect(err).To(MatchError("mount records key must be 32 bytes"))
+	})
+
+	It("keeps the records encrypted", func() {
+		store, err := nfsv3driver.NewEncryptedMountRecordStore(fakeIoutil, fakeOs, fakeSyscall, "/records", bytes.Repeat([]byte{1}, 32))
+		Expect(err).NotTo(HaveOccurred())
+
+		loaded, err := store.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded).To(BeEmpty())
+
+		saved := map[string]nfsv3driver.MountRecord{
+			"vol1": {Remote: "filer:/export", Options: map[string]interface{}{"uid": "1000"}, Username: "alice", Uid: "1000"},
+		}
+		Expect(store.Save(saved)).To(Succeed())
+		Expect(files).To(HaveKey("/records"))
+		Expect(string(files["/records"])).NotTo(ContainSubstring("alice"))
+
+		loaded, err = store.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded).To(Equal(saved))
+
+		other, err := nfsv3driver.NewEncryptedMountRecordStore(fakeIoutil, fakeOs, fakeSyscall, "/records", bytes.Repeat([]byte{2}, 32))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = other.Load()
+		Expect(err).To(MatchError("mount records cannot be decrypted with the configured key"))
+	})
+
+	It("syncs the records and their directory before and after replacing them", func() {
+		fakeFile := &os_fake.FakeFile{}
+		fakeFile.FdReturns(7)
+		fakeOs.OpenFileReturns(fakeFile, nil)
+		fakeDir := &os_fake.FakeFile{}
+		fakeDir.FdReturns(8)
+		fakeOs.OpenReturns(fakeDir, nil)
+		fakeOs.OpenFileStub = nil
+
+		store, err := nfsv3driver.NewEncryptedMountRecordStore(fakeIoutil, fakeOs, fakeSyscall, "/var/vcap/data/records", bytes.Repeat([]byte{1}, 32))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(store.Save(map[string]nfsv3driver.MountRecord{"vol1": {Remote: "filer:/export"}})).To(Succeed())
+
+		path, _, mode := fakeOs.OpenFileArgsForCall(0)
+		Expect(path).To(Equal("/var/vcap/data/records.tmp"))
+		Expect(mode).To(Equal(os.FileMode(0600)))
+		Expect(fakeFile.CloseCallCount()).To(Equal(1))
+
+		Expect(fakeSyscall.FsyncCallCount()).To(Equal(2))
+		Expect(fakeSyscall.FsyncArgsForCall(0)).To(Equal(7))
+		from, to := fakeOs.RenameArgsForCall(0)
+		Expect(from).To(Equal("/var/vcap/data/records.tmp"))
+		Expect(to).To(Equal("/var/vcap/data/records"))
+		Expect(fakeOs.OpenArgsForCall(0)).To(Equal("/var/vcap/data"))
+		Expect(fakeSyscall.FsyncArgsForCall(1)).To(Equal(8))
+		Expect(fakeDir.CloseCallCount()).To(Equal(1))
+	})
+
+	Context("when the records cannot be synced", func() {
+		BeforeEach(func() {
+			fakeSyscall.FsyncReturns(errors.New("input/output error"))
+		})
+
+		It("keeps the records they would have replaced", func() {
+			store, err := nfsv3driver.NewEncryptedMountRecordStore(fakeIoutil, fakeOs, fakeSyscall, "/records", bytes.Repeat([]byte{1}, 32))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(store.Save(map[string]nfsv3driver.MountRecord{"vol1": {Remote: "filer:/export"}})).To(MatchError("input/output error"))
+			Expect(fakeOs.RenameCallCount()).To(Equal(0))
+			Expect(fakeOs.RemoveArgsForCall(0)).To(Equal("/records.tmp"))
+		})
+	})
+})
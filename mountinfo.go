@@ -0,0 +1,121 @@
+package nfsv3driver
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/goshims/ioutilshim"
+)
+
+const procMountInfo = "/proc/self/mountinfo"
+
+// mountInfoEntry is a mount listed in /proc/self/mountinfo.
+type mountInfoEntry struct {
+	MountPoint   string
+	Options      string
+	FsType       string
+	Source       string
+	SuperOptions string
+}
+
+// option returns the value of the named per-mount or superblock option, and whether it is set.
+func (e mountInfoEntry) option(name string) (string, bool) {
+	for _, option := range strings.Split(e.Options+","+e.SuperOptions, ",") {
+		if option == name {
+			return "", true
+		}
+		if strings.HasPrefix(option, name+"=") {
+			return strings.TrimPrefix(option, name+"="), true
+		}
+	}
+	return "", false
+}
+
+func readMountInfo(ioutil ioutilshim.Ioutil) ([]mountInfoEntry, error) {
+	contents, err := ioutil.ReadFile(procMountInfo)
+	if err != nil {
+		return nil, err
+	}
+	return parseMountInfo(contents), nil
+}
+
+// parseMountInfo parses the contents of a mountinfo file. Each line holds the mount id, parent id, device, root,
+// mount point and per-mount options, a variable number of optional fields ended by '-', and then the file system
+// type, source and superblock options.
+func parseMountInfo(contents []byte) []mountInfoEntry {
+	var entries []mountInfoEntry
+	for _, line := range strings.Split(string(contents), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 6 {
+			continue
+		}
+
+		entry := mountInfoEntry{MountPoint: unescapeMountInfo(fields[4]), Options: fields[5]}
+		for i := 6; i < len(fields); i++ {
+			if fields[i] != "-" {
+				continue
+			}
+			if i+1 < len(fields) {
+				entry.FsType = fields[i+1]
+			}
+			if i+2 < len(fields) {
+				entry.Source = unescapeMountInfo(fields[i+2])
+			}
+			if i+3 < len(fields) {
+				entry.SuperOptions = fields[i+3]
+			}
+			break
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// unescapeMountInfo undoes the octal escaping of spaces, tabs, newlines and backslashes in mountinfo paths.
+func unescapeMountInfo(path string) string {
+	var unescaped strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+4 <= len(path) {
+			if value, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				unescaped.WriteByte(byte(value))
+				i += 3
+				continue
+			}
+		}
+		unescaped.WriteByte(path[i])
+	}
+	return unescaped.String()
+}
+
+// mapfsProcesses returns the pids of the running mapfs processes by the mount point they serve.
+func mapfsProcesses(ioutil ioutilshim.Ioutil, mapfsPath string) (map[string][]int, error) {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	processes := map[string][]int{}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		// processes may exit while the table is being read
+		cmdline, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+		if err != nil {
+			continue
+		}
+		args := strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00")
+		if len(args) < 3 || filepath.Base(args[0]) != filepath.Base(mapfsPath) {
+			continue
+		}
+		// mapfs is invoked with the target and the intermediate mount as its last arguments
+		target, intermediate := args[len(args)-2], args[len(args)-1]
+		if intermediate == target+MapfsDirectorySuffix {
+			processes[target] = append(processes[target], pid)
+		}
+	}
+	return processes, nil
+}
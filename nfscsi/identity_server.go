@@ -0,0 +1,33 @@
+package nfscsi
+
+import (
+	"context"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+// PluginName is the name the plugin registers with the container orchestrator under.
+const PluginName = "nfsv3driver.csi.cloudfoundry.org"
+
+type identityServer struct {
+	version string
+}
+
+// NewIdentityServer returns the CSI Identity service of a node-only plugin. It has no controller service, so it
+// advertises no plugin capabilities.
+func NewIdentityServer(version string) csi.IdentityServer {
+	return &identityServer{version: version}
+}
+
+func (s *identityServer) GetPluginInfo(context.Context, *csi.GetPluginInfoRequest) (*csi.GetPluginInfoResponse, error) {
+	return &csi.GetPluginInfoResponse{Name: PluginName, VendorVersion: s.version}, nil
+}
+
+func (s *identityServer) GetPluginCapabilities(context.Context, *csi.GetPluginCapabilitiesRequest) (*csi.GetPluginCapabilitiesResponse, error) {
+	return &csi.GetPluginCapabilitiesResponse{}, nil
+}
+
+func (s *identityServer) Probe(context.Context, *csi.ProbeRequest) (*csi.ProbeResponse, error) {
+	return &csi.ProbeResponse{Ready: &wrappers.BoolValue{Value: true}}, nil
+}
@@ -0,0 +1,37 @@
+package nfscsi_test
+
+import (
+	"context"
+
+	"code.cloudfoundry.org/nfsv3driver/nfscsi"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("IdentityServer", func() {
+	var identity csi.IdentityServer
+
+	BeforeEach(func() {
+		identity = nfscsi.NewIdentityServer("1.2.3")
+	})
+
+	It("reports the plugin name and version", func() {
+		response, err := identity.GetPluginInfo(context.TODO(), &csi.GetPluginInfoRequest{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.GetName()).To(Equal(nfscsi.PluginName))
+		Expect(response.GetVendorVersion()).To(Equal("1.2.3"))
+	})
+
+	It("advertises no controller service", func() {
+		response, err := identity.GetPluginCapabilities(context.TODO(), &csi.GetPluginCapabilitiesRequest{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.GetCapabilities()).To(BeEmpty())
+	})
+
+	It("is ready", func() {
+		response, err := identity.Probe(context.TODO(), &csi.ProbeRequest{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.GetReady().GetValue()).To(BeTrue())
+	})
+})
@@ -0,0 +1,13 @@
+package nfscsi_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestNfsCsi(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "NFS CSI Suite")
+}
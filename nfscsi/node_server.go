@@ -0,0 +1,285 @@
+package nfscsi
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/goshims/osshim"
+	"code.cloudfoundry.org/goshims/syscallshim"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/volumedriver"
+	"code.cloudfoundry.org/volumedriver/invoker"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SourceContextKeys are the volume context keys that name the share, in order of preference.
+var SourceContextKeys = []string{"share", "source"}
+
+// SecretKeys are the node publish secrets that are passed on to the mounter. They must not be given in the volume
+// context, which the orchestrator does not keep secret.
+var SecretKeys = []string{"username", "password", "token"}
+
+type nodeServer struct {
+	logger  lager.Logger
+	mounter volumedriver.Mounter
+	invoker invoker.Invoker
+	os      osshim.Os
+	syscall syscallshim.Syscall
+	nodeID  string
+}
+
+// NewNodeServer returns a CSI Node service that publishes volumes with mounter, translating the volume context and
+// node publish secrets of each request into the options of a driver bind. The volume context holds the share and
+// the plain options, such as uid, gid, version or automount_key; the secrets hold the username and password, or the
+// token, that the uid and gid are resolved from.
+func NewNodeServer(logger lager.Logger, mounter volumedriver.Mounter, invoker invoker.Invoker, os osshim.Os, syscall syscallshim.Syscall, nodeID string) csi.NodeServer {
+	return &nodeServer{
+		logger:  logger.Session("csi-node"),
+		mounter: mounter,
+		invoker: invoker,
+		os:      os,
+		syscall: syscall,
+		nodeID:  nodeID,
+	}
+}
+
+func (s *nodeServer) NodePublishVolume(ctx context.Context, request *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
+	logger := s.logger.Session("node-publish-volume", lager.Data{"volume": request.GetVolumeId(), "target": request.GetTargetPath()})
+	logger.Info("start")
+	defer logger.Info("end")
+
+	if request.GetVolumeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume_id is required")
+	}
+	if request.GetTargetPath() == "" {
+		return nil, status.Error(codes.InvalidArgument, "target_path is required")
+	}
+	capability := request.GetVolumeCapability()
+	if capability == nil {
+		return nil, status.Error(codes.InvalidArgument, "volume_capability is required")
+	}
+	if capability.GetMount() == nil {
+		return nil, status.Error(codes.InvalidArgument, "only the mount access type is supported")
+	}
+
+	remote, opts, err := mountOptions(request)
+	if err != nil {
+		return nil, err
+	}
+
+	env := driverhttp.NewHttpDriverEnv(logger, ctx)
+	target := filepath.Clean(request.GetTargetPath())
+
+	if s.mounter.Check(env, request.GetVolumeId(), target) {
+		logger.Info("already-published")
+		return &csi.NodePublishVolumeResponse{}, nil
+	}
+
+	if err := s.os.MkdirAll(target, 0750); err != nil {
+		logger.Error("mkdir-target-failed", err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	if err := s.mounter.Mount(env, remote, target, opts); err != nil {
+		logger.Error("mount-failed", err)
+		return nil, status.Error(codes.Internal, safeDescription(err, "failed to mount volume"))
+	}
+
+	if request.GetReadonly() {
+		err := s.invoker.Invoke(env, "mount", []string{"-o", "remount,bind,ro", target}).Wait()
+		if err != nil {
+			logger.Error("remount-read-only-failed", err)
+			if unmountErr := s.mounter.Unmount(env, target); unmountErr != nil {
+				logger.Error("unmount-failed", unmountErr)
+			}
+			return nil, status.Error(codes.Internal, "failed to make the volume read-only")
+		}
+	}
+
+	return &csi.NodePublishVolumeResponse{}, nil
+}
+
+func (s *nodeServer) NodeUnpublishVolume(ctx context.Context, request *csi.NodeUnpublishVolumeRequest) (*csi.NodeUnpublishVolumeResponse, error) {
+	logger := s.logger.Session("node-unpublish-volume", lager.Data{"volume": request.GetVolumeId(), "target": request.GetTargetPath()})
+	logger.Info("start")
+	defer logger.Info("end")
+
+	if request.GetVolumeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume_id is required")
+	}
+	if request.GetTargetPath() == "" {
+		return nil, status.Error(codes.InvalidArgument, "target_path is required")
+	}
+
+	env := driverhttp.NewHttpDriverEnv(logger, ctx)
+	target := filepath.Clean(request.GetTargetPath())
+
+	if s.mounter.Check(env, request.GetVolumeId(), target) {
+		if err := s.mounter.Unmount(env, target); err != nil {
+			logger.Error("unmount-failed", err)
+			return nil, status.Error(codes.Internal, safeDescription(err, "failed to unmount volume"))
+		}
+	} else {
+		logger.Info("not-published")
+	}
+
+	if err := s.os.Remove(target); err != nil && !os.IsNotExist(err) {
+		logger.Error("remove-target-failed", err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &csi.NodeUnpublishVolumeResponse{}, nil
+}
+
+func (s *nodeServer) NodeGetCapabilities(context.Context, *csi.NodeGetCapabilitiesRequest) (*csi.NodeGetCapabilitiesResponse, error) {
+	return &csi.NodeGetCapabilitiesResponse{
+		Capabilities: []*csi.NodeServiceCapability{{
+			Type: &csi.NodeServiceCapability_Rpc{
+				Rpc: &csi.NodeServiceCapability_RPC{Type: csi.NodeServiceCapability_RPC_GET_VOLUME_STATS},
+			},
+		}},
+	}, nil
+}
+
+func (s *nodeServer) NodeGetVolumeStats(ctx context.Context, request *csi.NodeGetVolumeStatsRequest) (*csi.NodeGetVolumeStatsResponse, error) {
+	logger := s.logger.Session("node-get-volume-stats", lager.Data{"volume": request.GetVolumeId(), "path": request.GetVolumePath()})
+
+	if request.GetVolumeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume_id is required")
+	}
+	if request.GetVolumePath() == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume_path is required")
+	}
+
+	env := driverhttp.NewHttpDriverEnv(logger, ctx)
+	path := filepath.Clean(request.GetVolumePath())
+
+	if _, err := s.os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return nil, status.Errorf(codes.NotFound, "volume path %s does not exist", path)
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if !s.mounter.Check(env, request.GetVolumeId(), path) {
+		return nil, status.Errorf(codes.NotFound, "volume %s is not published at %s", request.GetVolumeId(), path)
+	}
+
+	var stats syscall.Statfs_t
+	if err := s.syscall.Statfs(path, &stats); err != nil {
+		logger.Error("statfs-failed", err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	blockSize := int64(stats.Bsize)
+	return &csi.NodeGetVolumeStatsResponse{
+		Usage: []*csi.VolumeUsage{
+			{
+				Unit:      csi.VolumeUsage_BYTES,
+				Total:     int64(stats.Blocks) * blockSize,
+				Available: int64(stats.Bavail) * blockSize,
+				Used:      int64(stats.Blocks-stats.Bfree) * blockSize,
+			},
+			{
+				Unit:      csi.VolumeUsage_INODES,
+				Total:     int64(stats.Files),
+				Available: int64(stats.Ffree),
+				Used:      int64(stats.Files - stats.Ffree),
+			},
+		},
+	}, nil
+}
+
+func (s *nodeServer) NodeGetInfo(context.Context, *csi.NodeGetInfoRequest) (*csi.NodeGetInfoResponse, error) {
+	return &csi.NodeGetInfoResponse{NodeId: s.nodeID}, nil
+}
+
+func (s *nodeServer) NodeStageVolume(context.Context, *csi.NodeStageVolumeRequest) (*csi.NodeStageVolumeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "NodeStageVolume is not supported")
+}
+
+func (s *nodeServer) NodeUnstageVolume(context.Context, *csi.NodeUnstageVolumeRequest) (*csi.NodeUnstageVolumeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "NodeUnstageVolume is not supported")
+}
+
+func (s *nodeServer) NodeExpandVolume(context.Context, *csi.NodeExpandVolumeRequest) (*csi.NodeExpandVolumeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "NodeExpandVolume is not supported")
+}
+
+// mountOptions translates a publish request into the share and bind options the mounter takes.
+func mountOptions(request *csi.NodePublishVolumeRequest) (string, map[string]interface{}, error) {
+	opts := map[string]interface{}{}
+	remote := ""
+
+	for key, value := range request.GetVolumeContext() {
+		// the orchestrator adds its own keys, such as csi.storage.k8s.io/pod.name, which are not options
+		if strings.Contains(key, "/") {
+			continue
+		}
+		if contains(SecretKeys, key) && key != "username" {
+			return "", nil, status.Errorf(codes.InvalidArgument, "'%s' must be given as a node publish secret", key)
+		}
+		if contains(SourceContextKeys, key) {
+			if remote == "" || key == SourceContextKeys[0] {
+				remote = value
+			}
+			continue
+		}
+		opts[key] = value
+	}
+
+	for _, flag := range request.GetVolumeCapability().GetMount().GetMountFlags() {
+		parts := strings.SplitN(flag, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return "", nil, status.Errorf(codes.InvalidArgument, "mount flag '%s' is not supported, give options as key=value", flag)
+		}
+		if contains(SecretKeys, parts[0]) {
+			return "", nil, status.Errorf(codes.InvalidArgument, "'%s' must be given as a node publish secret", parts[0])
+		}
+		opts[parts[0]] = parts[1]
+	}
+
+	var unsupported []string
+	for key, value := range request.GetSecrets() {
+		if !contains(SecretKeys, key) {
+			unsupported = append(unsupported, key)
+			continue
+		}
+		opts[key] = value
+	}
+	if len(unsupported) > 0 {
+		sort.Strings(unsupported)
+		return "", nil, status.Errorf(codes.InvalidArgument, "unsupported node publish secrets: %s", strings.Join(unsupported, ", "))
+	}
+
+	if remote == "" {
+		if _, ok := opts["automount_key"]; !ok {
+			return "", nil, status.Errorf(codes.InvalidArgument, "volume context must set '%s' or 'automount_key'", SourceContextKeys[0])
+		}
+	}
+
+	return remote, opts, nil
+}
+
+func safeDescription(err error, fallback string) string {
+	if safeErr, ok := err.(dockerdriver.SafeError); ok {
+		return safeErr.SafeDescription
+	}
+	return fallback
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,380 @@
+package nfscsi_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/goshims/ioutilshim/ioutil_fake"
+	"code.cloudfoundry.org/goshims/osshim/os_fake"
+	"code.cloudfoundry.org/goshims/syscallshim/syscall_fake"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nfsv3driver"
+	"code.cloudfoundry.org/nfsv3driver/nfscsi"
+	"code.cloudfoundry.org/nfsv3driver/nfsdriverfakes"
+	"code.cloudfoundry.org/volumedriver/invoker"
+	"code.cloudfoundry.org/volumedriver/invokerfakes"
+	"code.cloudfoundry.org/volumedriver/volumedriverfakes"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("NodeServer", func() {
+	const mapfsPath = "/var/vcap/packages/mapfs/bin/mapfs"
+	const target = "/var/lib/kubelet/pods/pod1/volumes/kubernetes.io~csi/pv1/mount"
+
+	var (
+		logger           *lagertest.TestLogger
+		fakeInvoker      *invokerfakes.FakeInvoker
+		fakeOs           *os_fake.FakeOs
+		fakeSyscall      *syscall_fake.FakeSyscall
+		fakeIdResolver   *nfsdriverfakes.FakeIdResolver
+		fakeMountChecker *volumedriverfakes.FakeMountChecker
+
+		published   bool
+		mountResult error
+
+		node csi.NodeServer
+	)
+
+	invocations := func() [][]string {
+		var commands [][]string
+		for i := 0; i < fakeInvoker.InvokeCallCount(); i++ {
+			_, command, args, _ := fakeInvoker.InvokeArgsForCall(i)
+			commands = append(commands, append([]string{command}, args...))
+		}
+		return commands
+	}
+
+	capability := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+		AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER},
+	}
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("csi")
+		fakeInvoker = &invokerfakes.FakeInvoker{}
+		fakeOs = &os_fake.FakeOs{}
+		fakeSyscall = &syscall_fake.FakeSyscall{}
+		fakeIdResolver = &nfsdriverfakes.FakeIdResolver{}
+		fakeMountChecker = &volumedriverfakes.FakeMountChecker{}
+
+		published = false
+		mountResult = nil
+
+		fakeInvoker.InvokeStub = func(env dockerdriver.Env, command string, args []string, _ ...string) invoker.InvokeResult {
+			result := &invokerfakes.FakeInvokeResult{}
+			switch command {
+			case "mountpoint":
+				if !published {
+					result.WaitReturns(errors.New("exit status 32"))
+				}
+			case "mount":
+				result.WaitReturns(mountResult)
+			}
+			return result
+		}
+		fakeSyscall.StatStub = func(path string, st *syscall.Stat_t) error {
+			st.Mode = 0777
+			return nil
+		}
+
+		mask, err := nfsv3driver.NewMapFsVolumeMountMask()
+		Expect(err).NotTo(HaveOccurred())
+
+		mounter := nfsv3driver.NewMapfsMounter(fakeInvoker, fakeOs, fakeSyscall, &ioutil_fake.FakeIoutil{}, fakeMountChecker, "nfs", "hard,actimeo=0", fakeIdResolver, mask, mapfsPath, nil, nil, nil, nil)
+		node = nfscsi.NewNodeServer(logger, mounter, fakeInvoker, fakeOs, fakeSyscall, "node-1")
+	})
+
+	Describe("NodePublishVolume", func() {
+		var (
+			request  *csi.NodePublishVolumeRequest
+			response *csi.NodePublishVolumeResponse
+			err      error
+		)
+
+		BeforeEach(func() {
+			request = &csi.NodePublishVolumeRequest{
+				VolumeId:         "pv1",
+				TargetPath:       target + "/",
+				VolumeCapability: capability,
+				VolumeContext: map[string]string{
+					"share":                        "nfs://server/export",
+					"uid":                          "2000",
+					"gid":                          "3000",
+					"csi.storage.k8s.io/pod.name":  "pod1",
+					"csi.storage.k8s.io/ephemeral": "false",
+				},
+			}
+		})
+
+		JustBeforeEach(func() {
+			response, err = node.NodePublishVolume(context.TODO(), request)
+		})
+
+		It("creates the target and mounts the share with mapfs", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(response).NotTo(BeNil())
+
+			Expect(fakeOs.MkdirAllCallCount()).To(BeNumerically(">=", 1))
+			path, _ := fakeOs.MkdirAllArgsForCall(0)
+			Expect(path).To(Equal(target))
+
+			Expect(invocations()).To(ContainElement([]string{"mount", "-t", "nfs", "-o", "hard,actimeo=0", "server:/export", target + "_mapfs"}))
+			Expect(invocations()).To(ContainElement([]string{mapfsPath, "-uid", "2000", "-gid", "3000", "-auto_cache", target, target + "_mapfs"}))
+		})
+
+		Context("when the credentials are given as secrets", func() {
+			BeforeEach(func() {
+				delete(request.VolumeContext, "uid")
+				delete(request.VolumeContext, "gid")
+				request.Secrets = map[string]string{"username": "alice", "password": "secret"}
+				fakeIdResolver.ResolveReturns("4000", "5000", nil, nil)
+			})
+
+			It("resolves the uid and gid with LDAP", func() {
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeIdResolver.ResolveCallCount()).To(Equal(1))
+				_, username, password := fakeIdResolver.ResolveArgsForCall(0)
+				Expect(username).To(Equal("alice"))
+				Expect(password).To(Equal("secret"))
+
+				Expect(invocations()).To(ContainElement([]string{mapfsPath, "-uid", "4000", "-gid", "5000", "-auto_cache", target, target + "_mapfs"}))
+			})
+		})
+
+		Context("when the mount flags carry options", func() {
+			BeforeEach(func() {
+				request.VolumeCapability = &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{MountFlags: []string{"version=4.1"}}},
+				}
+			})
+
+			It("passes them on as options", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(invocations()).To(ContainElement([]string{"mount", "-t", "nfs", "-o", "hard,actimeo=0,vers=4.1", "server:/export", target + "_mapfs"}))
+			})
+		})
+
+		Context("when a mount flag is not an option", func() {
+			BeforeEach(func() {
+				request.VolumeCapability = &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{MountFlags: []string{"noatime"}}},
+				}
+			})
+
+			It("refuses the request", func() {
+				Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+				Expect(fakeInvoker.InvokeCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the password is given in the volume context", func() {
+			BeforeEach(func() {
+				request.VolumeContext["username"] = "alice"
+				request.VolumeContext["password"] = "secret"
+			})
+
+			It("refuses the request", func() {
+				Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+				Expect(err.Error()).To(ContainSubstring("'password' must be given as a node publish secret"))
+				Expect(fakeInvoker.InvokeCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when an unsupported secret is given", func() {
+			BeforeEach(func() {
+				request.Secrets = map[string]string{"keytab": "..."}
+			})
+
+			It("refuses the request", func() {
+				Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+				Expect(err.Error()).To(ContainSubstring("unsupported node publish secrets: keytab"))
+			})
+		})
+
+		Context("when the volume context does not name a share", func() {
+			BeforeEach(func() {
+				delete(request.VolumeContext, "share")
+			})
+
+			It("refuses the request", func() {
+				Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+			})
+		})
+
+		Context("when the volume is a block volume", func() {
+			BeforeEach(func() {
+				request.VolumeCapability = &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}},
+				}
+			})
+
+			It("refuses the request", func() {
+				Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+			})
+		})
+
+		Context("when the target path is missing", func() {
+			BeforeEach(func() {
+				request.TargetPath = ""
+			})
+
+			It("refuses the request", func() {
+				Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+			})
+		})
+
+		Context("when the volume is already published", func() {
+			BeforeEach(func() {
+				published = true
+			})
+
+			It("succeeds without mounting it again", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(invocations()).To(Equal([][]string{{"mountpoint", "-q", target}}))
+			})
+		})
+
+		Context("when the volume is published read-only", func() {
+			BeforeEach(func() {
+				request.Readonly = true
+			})
+
+			It("remounts the target read-only", func() {
+				Expect(err).NotTo(HaveOccurred())
+				commands := invocations()
+				Expect(commands[len(commands)-1]).To(Equal([]string{"mount", "-o", "remount,bind,ro", target}))
+			})
+		})
+
+		Context("when the mount fails", func() {
+			BeforeEach(func() {
+				mountResult = errors.New("access denied by server")
+			})
+
+			It("returns the error", func() {
+				Expect(status.Code(err)).To(Equal(codes.Internal))
+				Expect(status.Convert(err).Message()).To(Equal("access denied by server"))
+			})
+		})
+	})
+
+	Describe("NodeUnpublishVolume", func() {
+		var err error
+
+		JustBeforeEach(func() {
+			_, err = node.NodeUnpublishVolume(context.TODO(), &csi.NodeUnpublishVolumeRequest{VolumeId: "pv1", TargetPath: target})
+		})
+
+		Context("when the volume is published", func() {
+			BeforeEach(func() {
+				published = true
+				fakeMountChecker.ExistsReturns(true, nil)
+			})
+
+			It("unmounts it and removes the target", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(invocations()).To(ContainElement([]string{"umount", "-l", target}))
+				Expect(invocations()).To(ContainElement([]string{"umount", "-l", target + "_mapfs"}))
+
+				Expect(fakeOs.RemoveCallCount()).To(BeNumerically(">=", 1))
+				Expect(fakeOs.RemoveArgsForCall(fakeOs.RemoveCallCount() - 1)).To(Equal(target))
+			})
+		})
+
+		Context("when the volume is not published", func() {
+			BeforeEach(func() {
+				fakeOs.RemoveReturns(os.ErrNotExist)
+			})
+
+			It("succeeds without unmounting", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(invocations()).To(Equal([][]string{{"mountpoint", "-q", target}}))
+			})
+		})
+	})
+
+	Describe("NodeGetVolumeStats", func() {
+		var (
+			response *csi.NodeGetVolumeStatsResponse
+			err      error
+		)
+
+		BeforeEach(func() {
+			published = true
+			fakeSyscall.StatfsStub = func(path string, stats *syscall.Statfs_t) error {
+				stats.Bsize = 4096
+				stats.Blocks = 100
+				stats.Bfree = 40
+				stats.Bavail = 30
+				stats.Files = 1000
+				stats.Ffree = 600
+				return nil
+			}
+		})
+
+		JustBeforeEach(func() {
+			response, err = node.NodeGetVolumeStats(context.TODO(), &csi.NodeGetVolumeStatsRequest{VolumeId: "pv1", VolumePath: target})
+		})
+
+		It("reports the space and inodes of the share", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(response.GetUsage()).To(HaveLen(2))
+			Expect(response.GetUsage()[0].GetUnit()).To(Equal(csi.VolumeUsage_BYTES))
+			Expect(response.GetUsage()[0].GetTotal()).To(Equal(int64(409600)))
+			Expect(response.GetUsage()[0].GetAvailable()).To(Equal(int64(122880)))
+			Expect(response.GetUsage()[0].GetUsed()).To(Equal(int64(245760)))
+			Expect(response.GetUsage()[1].GetUnit()).To(Equal(csi.VolumeUsage_INODES))
+			Expect(response.GetUsage()[1].GetTotal()).To(Equal(int64(1000)))
+			Expect(response.GetUsage()[1].GetUsed()).To(Equal(int64(400)))
+
+			path, _ := fakeSyscall.StatfsArgsForCall(0)
+			Expect(path).To(Equal(target))
+		})
+
+		Context("when the volume path does not exist", func() {
+			BeforeEach(func() {
+				fakeOs.StatReturns(nil, os.ErrNotExist)
+			})
+
+			It("returns not found", func() {
+				Expect(status.Code(err)).To(Equal(codes.NotFound))
+			})
+		})
+
+		Context("when the volume is not mounted at the path", func() {
+			BeforeEach(func() {
+				published = false
+			})
+
+			It("returns not found", func() {
+				Expect(status.Code(err)).To(Equal(codes.NotFound))
+			})
+		})
+	})
+
+	It("advertises volume stats", func() {
+		response, err := node.NodeGetCapabilities(context.TODO(), &csi.NodeGetCapabilitiesRequest{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.GetCapabilities()).To(HaveLen(1))
+		Expect(response.GetCapabilities()[0].GetRpc().GetType()).To(Equal(csi.NodeServiceCapability_RPC_GET_VOLUME_STATS))
+	})
+
+	It("reports the node id", func() {
+		response, err := node.NodeGetInfo(context.TODO(), &csi.NodeGetInfoRequest{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.GetNodeId()).To(Equal("node-1"))
+	})
+
+	It("does not stage volumes", func() {
+		_, err := node.NodeStageVolume(context.TODO(), &csi.NodeStageVolumeRequest{})
+		Expect(status.Code(err)).To(Equal(codes.Unimplemented))
+	})
+})
@@ -0,0 +1,81 @@
+package nfscsi
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/tedsuo/ifrit"
+	"google.golang.org/grpc"
+)
+
+type server struct {
+	logger   lager.Logger
+	endpoint string
+	identity csi.IdentityServer
+	node     csi.NodeServer
+}
+
+// NewServer returns an ifrit runner that serves the identity and node services over the unix socket at endpoint,
+// which may be given as a path or as a unix:// URL. A socket left behind by an earlier run is replaced.
+func NewServer(logger lager.Logger, endpoint string, identity csi.IdentityServer, node csi.NodeServer) ifrit.Runner {
+	return &server{
+		logger:   logger.Session("csi-server", lager.Data{"endpoint": endpoint}),
+		endpoint: endpoint,
+		identity: identity,
+		node:     node,
+	}
+}
+
+func (s *server) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	path := SocketPath(s.endpoint)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(s.logErrors))
+	csi.RegisterIdentityServer(grpcServer, s.identity)
+	csi.RegisterNodeServer(grpcServer, s.node)
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- grpcServer.Serve(listener)
+	}()
+
+	s.logger.Info("started")
+	close(ready)
+
+	select {
+	case err := <-errChan:
+		return err
+	case <-signals:
+		grpcServer.GracefulStop()
+		return nil
+	}
+}
+
+func (s *server) logErrors(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	response, err := handler(ctx, request)
+	if err != nil {
+		s.logger.Info("request-failed", lager.Data{"method": info.FullMethod, "error": err.Error()})
+	}
+	return response, err
+}
+
+// SocketPath returns the path of the unix socket named by a CSI endpoint.
+func SocketPath(endpoint string) string {
+	return strings.TrimPrefix(endpoint, "unix://")
+}
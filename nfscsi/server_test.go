@@ -0,0 +1,69 @@
+package nfscsi_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nfsv3driver/nfscsi"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+	"google.golang.org/grpc"
+)
+
+var _ = Describe("Server", func() {
+	var (
+		dir     string
+		socket  string
+		process ifrit.Process
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "nfscsi")
+		Expect(err).NotTo(HaveOccurred())
+		socket = filepath.Join(dir, "plugin", "csi.sock")
+
+		// a socket left behind by an earlier run
+		Expect(os.MkdirAll(filepath.Dir(socket), 0750)).To(Succeed())
+		Expect(ioutil.WriteFile(socket, nil, 0600)).To(Succeed())
+	})
+
+	JustBeforeEach(func() {
+		logger := lagertest.NewTestLogger("csi")
+		node := nfscsi.NewNodeServer(logger, nil, nil, nil, nil, "node-1")
+		runner := nfscsi.NewServer(logger, "unix://"+socket, nfscsi.NewIdentityServer("1.2.3"), node)
+		process = ifrit.Invoke(runner)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("serves the identity service on the socket", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		conn, err := grpc.DialContext(ctx, socket, grpc.WithInsecure(), grpc.WithBlock(), grpc.WithContextDialer(func(ctx context.Context, address string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", address)
+		}))
+		Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+
+		response, err := csi.NewIdentityClient(conn).GetPluginInfo(ctx, &csi.GetPluginInfoRequest{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.GetName()).To(Equal(nfscsi.PluginName))
+
+		info, err := csi.NewNodeClient(conn).NodeGetInfo(ctx, &csi.NodeGetInfoRequest{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.GetNodeId()).To(Equal("node-1"))
+	})
+})
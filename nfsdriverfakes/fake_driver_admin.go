@@ -2,10 +2,10 @@
 package nfsdriverfakes
 
 import (
-	sync "sync"
+	"sync"
 
-	dockerdriver "code.cloudfoundry.org/dockerdriver"
-	driveradmin "code.cloudfoundry.org/nfsv3driver/driveradmin"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/nfsv3driver/driveradmin"
 )
 
 type FakeDriverAdmin struct {
@@ -20,6 +20,17 @@ type FakeDriverAdmin struct {
 	evacuateReturnsOnCall map[int]struct {
 		result1 driveradmin.ErrorResponse
 	}
+	MetricsStub        func(dockerdriver.Env) driveradmin.MetricsResponse
+	metricsMutex       sync.RWMutex
+	metricsArgsForCall []struct {
+		arg1 dockerdriver.Env
+	}
+	metricsReturns struct {
+		result1 driveradmin.MetricsResponse
+	}
+	metricsReturnsOnCall map[int]struct {
+		result1 driveradmin.MetricsResponse
+	}
 	PingStub        func(dockerdriver.Env) driveradmin.ErrorResponse
 	pingMutex       sync.RWMutex
 	pingArgsForCall []struct {
@@ -31,6 +42,73 @@ type FakeDriverAdmin struct {
 	pingReturnsOnCall map[int]struct {
 		result1 driveradmin.ErrorResponse
 	}
+	ReadyStub        func(dockerdriver.Env) driveradmin.ReadyResponse
+	readyMutex       sync.RWMutex
+	readyArgsForCall []struct {
+		arg1 dockerdriver.Env
+	}
+	readyReturns struct {
+		result1 driveradmin.ReadyResponse
+	}
+	readyReturnsOnCall map[int]struct {
+		result1 driveradmin.ReadyResponse
+	}
+	ReconciliationStub        func(dockerdriver.Env) driveradmin.ReconciliationResponse
+	reconciliationMutex       sync.RWMutex
+	reconciliationArgsForCall []struct {
+		arg1 dockerdriver.Env
+	}
+	reconciliationReturns struct {
+		result1 driveradmin.ReconciliationResponse
+	}
+	reconciliationReturnsOnCall map[int]struct {
+		result1 driveradmin.ReconciliationResponse
+	}
+	TranscriptStub        func(dockerdriver.Env) driveradmin.TranscriptResponse
+	transcriptMutex       sync.RWMutex
+	transcriptArgsForCall []struct {
+		arg1 dockerdriver.Env
+	}
+	transcriptReturns struct {
+		result1 driveradmin.TranscriptResponse
+	}
+	transcriptReturnsOnCall map[int]struct {
+		result1 driveradmin.TranscriptResponse
+	}
+	UnhealthyMountsStub        func(dockerdriver.Env) driveradmin.UnhealthyMountsResponse
+	unhealthyMountsMutex       sync.RWMutex
+	unhealthyMountsArgsForCall []struct {
+		arg1 dockerdriver.Env
+	}
+	unhealthyMountsReturns struct {
+		result1 driveradmin.UnhealthyMountsResponse
+	}
+	unhealthyMountsReturnsOnCall map[int]struct {
+		result1 driveradmin.UnhealthyMountsResponse
+	}
+	VolumeStub        func(dockerdriver.Env, string) driveradmin.VolumeResponse
+	volumeMutex       sync.RWMutex
+	volumeArgsForCall []struct {
+		arg1 dockerdriver.Env
+		arg2 string
+	}
+	volumeReturns struct {
+		result1 driveradmin.VolumeResponse
+	}
+	volumeReturnsOnCall map[int]struct {
+		result1 driveradmin.VolumeResponse
+	}
+	VolumesStub        func(dockerdriver.Env) driveradmin.VolumesResponse
+	volumesMutex       sync.RWMutex
+	volumesArgsForCall []struct {
+		arg1 dockerdriver.Env
+	}
+	volumesReturns struct {
+		result1 driveradmin.VolumesResponse
+	}
+	volumesReturnsOnCall map[int]struct {
+		result1 driveradmin.VolumesResponse
+	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
@@ -41,15 +119,16 @@ func (fake *FakeDriverAdmin) Evacuate(arg1 dockerdriver.Env) driveradmin.ErrorRe
 	fake.evacuateArgsForCall = append(fake.evacuateArgsForCall, struct {
 		arg1 dockerdriver.Env
 	}{arg1})
+	stub := fake.EvacuateStub
+	fakeReturns := fake.evacuateReturns
 	fake.recordInvocation("Evacuate", []interface{}{arg1})
 	fake.evacuateMutex.Unlock()
-	if fake.EvacuateStub != nil {
-		return fake.EvacuateStub(arg1)
+	if stub != nil {
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1
 	}
-	fakeReturns := fake.evacuateReturns
 	return fakeReturns.result1
 }
 
@@ -95,21 +174,83 @@ func (fake *FakeDriverAdmin) EvacuateReturnsOnCall(i int, result1 driveradmin.Er
 	}{result1}
 }
 
+func (fake *FakeDriverAdmin) Metrics(arg1 dockerdriver.Env) driveradmin.MetricsResponse {
+	fake.metricsMutex.Lock()
+	ret, specificReturn := fake.metricsReturnsOnCall[len(fake.metricsArgsForCall)]
+	fake.metricsArgsForCall = append(fake.metricsArgsForCall, struct {
+		arg1 dockerdriver.Env
+	}{arg1})
+	stub := fake.MetricsStub
+	fakeReturns := fake.metricsReturns
+	fake.recordInvocation("Metrics", []interface{}{arg1})
+	fake.metricsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeDriverAdmin) MetricsCallCount() int {
+	fake.metricsMutex.RLock()
+	defer fake.metricsMutex.RUnlock()
+	return len(fake.metricsArgsForCall)
+}
+
+func (fake *FakeDriverAdmin) MetricsCalls(stub func(dockerdriver.Env) driveradmin.MetricsResponse) {
+	fake.metricsMutex.Lock()
+	defer fake.metricsMutex.Unlock()
+	fake.MetricsStub = stub
+}
+
+func (fake *FakeDriverAdmin) MetricsArgsForCall(i int) dockerdriver.Env {
+	fake.metricsMutex.RLock()
+	defer fake.metricsMutex.RUnlock()
+	argsForCall := fake.metricsArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeDriverAdmin) MetricsReturns(result1 driveradmin.MetricsResponse) {
+	fake.metricsMutex.Lock()
+	defer fake.metricsMutex.Unlock()
+	fake.MetricsStub = nil
+	fake.metricsReturns = struct {
+		result1 driveradmin.MetricsResponse
+	}{result1}
+}
+
+func (fake *FakeDriverAdmin) MetricsReturnsOnCall(i int, result1 driveradmin.MetricsResponse) {
+	fake.metricsMutex.Lock()
+	defer fake.metricsMutex.Unlock()
+	fake.MetricsStub = nil
+	if fake.metricsReturnsOnCall == nil {
+		fake.metricsReturnsOnCall = make(map[int]struct {
+			result1 driveradmin.MetricsResponse
+		})
+	}
+	fake.metricsReturnsOnCall[i] = struct {
+		result1 driveradmin.MetricsResponse
+	}{result1}
+}
+
 func (fake *FakeDriverAdmin) Ping(arg1 dockerdriver.Env) driveradmin.ErrorResponse {
 	fake.pingMutex.Lock()
 	ret, specificReturn := fake.pingReturnsOnCall[len(fake.pingArgsForCall)]
 	fake.pingArgsForCall = append(fake.pingArgsForCall, struct {
 		arg1 dockerdriver.Env
 	}{arg1})
+	stub := fake.PingStub
+	fakeReturns := fake.pingReturns
 	fake.recordInvocation("Ping", []interface{}{arg1})
 	fake.pingMutex.Unlock()
-	if fake.PingStub != nil {
-		return fake.PingStub(arg1)
+	if stub != nil {
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1
 	}
-	fakeReturns := fake.pingReturns
 	return fakeReturns.result1
 }
 
@@ -155,13 +296,394 @@ func (fake *FakeDriverAdmin) PingReturnsOnCall(i int, result1 driveradmin.ErrorR
 	}{result1}
 }
 
+func (fake *FakeDriverAdmin) Ready(arg1 dockerdriver.Env) driveradmin.ReadyResponse {
+	fake.readyMutex.Lock()
+	ret, specificReturn := fake.readyReturnsOnCall[len(fake.readyArgsForCall)]
+	fake.readyArgsForCall = append(fake.readyArgsForCall, struct {
+		arg1 dockerdriver.Env
+	}{arg1})
+	stub := fake.ReadyStub
+	fakeReturns := fake.readyReturns
+	fake.recordInvocation("Ready", []interface{}{arg1})
+	fake.readyMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeDriverAdmin) ReadyCallCount() int {
+	fake.readyMutex.RLock()
+	defer fake.readyMutex.RUnlock()
+	return len(fake.readyArgsForCall)
+}
+
+func (fake *FakeDriverAdmin) ReadyCalls(stub func(dockerdriver.Env) driveradmin.ReadyResponse) {
+	fake.readyMutex.Lock()
+	defer fake.readyMutex.Unlock()
+	fake.ReadyStub = stub
+}
+
+func (fake *FakeDriverAdmin) ReadyArgsForCall(i int) dockerdriver.Env {
+	fake.readyMutex.RLock()
+	defer fake.readyMutex.RUnlock()
+	argsForCall := fake.readyArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeDriverAdmin) ReadyReturns(result1 driveradmin.ReadyResponse) {
+	fake.readyMutex.Lock()
+	defer fake.readyMutex.Unlock()
+	fake.ReadyStub = nil
+	fake.readyReturns = struct {
+		result1 driveradmin.ReadyResponse
+	}{result1}
+}
+
+func (fake *FakeDriverAdmin) ReadyReturnsOnCall(i int, result1 driveradmin.ReadyResponse) {
+	fake.readyMutex.Lock()
+	defer fake.readyMutex.Unlock()
+	fake.ReadyStub = nil
+	if fake.readyReturnsOnCall == nil {
+		fake.readyReturnsOnCall = make(map[int]struct {
+			result1 driveradmin.ReadyResponse
+		})
+	}
+	fake.readyReturnsOnCall[i] = struct {
+		result1 driveradmin.ReadyResponse
+	}{result1}
+}
+
+func (fake *FakeDriverAdmin) Reconciliation(arg1 dockerdriver.Env) driveradmin.ReconciliationResponse {
+	fake.reconciliationMutex.Lock()
+	ret, specificReturn := fake.reconciliationReturnsOnCall[len(fake.reconciliationArgsForCall)]
+	fake.reconciliationArgsForCall = append(fake.reconciliationArgsForCall, struct {
+		arg1 dockerdriver.Env
+	}{arg1})
+	stub := fake.ReconciliationStub
+	fakeReturns := fake.reconciliationReturns
+	fake.recordInvocation("Reconciliation", []interface{}{arg1})
+	fake.reconciliationMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeDriverAdmin) ReconciliationCallCount() int {
+	fake.reconciliationMutex.RLock()
+	defer fake.reconciliationMutex.RUnlock()
+	return len(fake.reconciliationArgsForCall)
+}
+
+func (fake *FakeDriverAdmin) ReconciliationCalls(stub func(dockerdriver.Env) driveradmin.ReconciliationResponse) {
+	fake.reconciliationMutex.Lock()
+	defer fake.reconciliationMutex.Unlock()
+	fake.ReconciliationStub = stub
+}
+
+func (fake *FakeDriverAdmin) ReconciliationArgsForCall(i int) dockerdriver.Env {
+	fake.reconciliationMutex.RLock()
+	defer fake.reconciliationMutex.RUnlock()
+	argsForCall := fake.reconciliationArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeDriverAdmin) ReconciliationReturns(result1 driveradmin.ReconciliationResponse) {
+	fake.reconciliationMutex.Lock()
+	defer fake.reconciliationMutex.Unlock()
+	fake.ReconciliationStub = nil
+	fake.reconciliationReturns = struct {
+		result1 driveradmin.ReconciliationResponse
+	}{result1}
+}
+
+func (fake *FakeDriverAdmin) ReconciliationReturnsOnCall(i int, result1 driveradmin.ReconciliationResponse) {
+	fake.reconciliationMutex.Lock()
+	defer fake.reconciliationMutex.Unlock()
+	fake.ReconciliationStub = nil
+	if fake.reconciliationReturnsOnCall == nil {
+		fake.reconciliationReturnsOnCall = make(map[int]struct {
+			result1 driveradmin.ReconciliationResponse
+		})
+	}
+	fake.reconciliationReturnsOnCall[i] = struct {
+		result1 driveradmin.ReconciliationResponse
+	}{result1}
+}
+
+func (fake *FakeDriverAdmin) Transcript(arg1 dockerdriver.Env) driveradmin.TranscriptResponse {
+	fake.transcriptMutex.Lock()
+	ret, specificReturn := fake.transcriptReturnsOnCall[len(fake.transcriptArgsForCall)]
+	fake.transcriptArgsForCall = append(fake.transcriptArgsForCall, struct {
+		arg1 dockerdriver.Env
+	}{arg1})
+	stub := fake.TranscriptStub
+	fakeReturns := fake.transcriptReturns
+	fake.recordInvocation("Transcript", []interface{}{arg1})
+	fake.transcriptMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeDriverAdmin) TranscriptCallCount() int {
+	fake.transcriptMutex.RLock()
+	defer fake.transcriptMutex.RUnlock()
+	return len(fake.transcriptArgsForCall)
+}
+
+func (fake *FakeDriverAdmin) TranscriptCalls(stub func(dockerdriver.Env) driveradmin.TranscriptResponse) {
+	fake.transcriptMutex.Lock()
+	defer fake.transcriptMutex.Unlock()
+	fake.TranscriptStub = stub
+}
+
+func (fake *FakeDriverAdmin) TranscriptArgsForCall(i int) dockerdriver.Env {
+	fake.transcriptMutex.RLock()
+	defer fake.transcriptMutex.RUnlock()
+	argsForCall := fake.transcriptArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeDriverAdmin) TranscriptReturns(result1 driveradmin.TranscriptResponse) {
+	fake.transcriptMutex.Lock()
+	defer fake.transcriptMutex.Unlock()
+	fake.TranscriptStub = nil
+	fake.transcriptReturns = struct {
+		result1 driveradmin.TranscriptResponse
+	}{result1}
+}
+
+func (fake *FakeDriverAdmin) TranscriptReturnsOnCall(i int, result1 driveradmin.TranscriptResponse) {
+	fake.transcriptMutex.Lock()
+	defer fake.transcriptMutex.Unlock()
+	fake.TranscriptStub = nil
+	if fake.transcriptReturnsOnCall == nil {
+		fake.transcriptReturnsOnCall = make(map[int]struct {
+			result1 driveradmin.TranscriptResponse
+		})
+	}
+	fake.transcriptReturnsOnCall[i] = struct {
+		result1 driveradmin.TranscriptResponse
+	}{result1}
+}
+
+func (fake *FakeDriverAdmin) UnhealthyMounts(arg1 dockerdriver.Env) driveradmin.UnhealthyMountsResponse {
+	fake.unhealthyMountsMutex.Lock()
+	ret, specificReturn := fake.unhealthyMountsReturnsOnCall[len(fake.unhealthyMountsArgsForCall)]
+	fake.unhealthyMountsArgsForCall = append(fake.unhealthyMountsArgsForCall, struct {
+		arg1 dockerdriver.Env
+	}{arg1})
+	stub := fake.UnhealthyMountsStub
+	fakeReturns := fake.unhealthyMountsReturns
+	fake.recordInvocation("UnhealthyMounts", []interface{}{arg1})
+	fake.unhealthyMountsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeDriverAdmin) UnhealthyMountsCallCount() int {
+	fake.unhealthyMountsMutex.RLock()
+	defer fake.unhealthyMountsMutex.RUnlock()
+	return len(fake.unhealthyMountsArgsForCall)
+}
+
+func (fake *FakeDriverAdmin) UnhealthyMountsCalls(stub func(dockerdriver.Env) driveradmin.UnhealthyMountsResponse) {
+	fake.unhealthyMountsMutex.Lock()
+	defer fake.unhealthyMountsMutex.Unlock()
+	fake.UnhealthyMountsStub = stub
+}
+
+func (fake *FakeDriverAdmin) UnhealthyMountsArgsForCall(i int) dockerdriver.Env {
+	fake.unhealthyMountsMutex.RLock()
+	defer fake.unhealthyMountsMutex.RUnlock()
+	argsForCall := fake.unhealthyMountsArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeDriverAdmin) UnhealthyMountsReturns(result1 driveradmin.UnhealthyMountsResponse) {
+	fake.unhealthyMountsMutex.Lock()
+	defer fake.unhealthyMountsMutex.Unlock()
+	fake.UnhealthyMountsStub = nil
+	fake.unhealthyMountsReturns = struct {
+		result1 driveradmin.UnhealthyMountsResponse
+	}{result1}
+}
+
+func (fake *FakeDriverAdmin) UnhealthyMountsReturnsOnCall(i int, result1 driveradmin.UnhealthyMountsResponse) {
+	fake.unhealthyMountsMutex.Lock()
+	defer fake.unhealthyMountsMutex.Unlock()
+	fake.UnhealthyMountsStub = nil
+	if fake.unhealthyMountsReturnsOnCall == nil {
+		fake.unhealthyMountsReturnsOnCall = make(map[int]struct {
+			result1 driveradmin.UnhealthyMountsResponse
+		})
+	}
+	fake.unhealthyMountsReturnsOnCall[i] = struct {
+		result1 driveradmin.UnhealthyMountsResponse
+	}{result1}
+}
+
+func (fake *FakeDriverAdmin) Volume(arg1 dockerdriver.Env, arg2 string) driveradmin.VolumeResponse {
+	fake.volumeMutex.Lock()
+	ret, specificReturn := fake.volumeReturnsOnCall[len(fake.volumeArgsForCall)]
+	fake.volumeArgsForCall = append(fake.volumeArgsForCall, struct {
+		arg1 dockerdriver.Env
+		arg2 string
+	}{arg1, arg2})
+	stub := fake.VolumeStub
+	fakeReturns := fake.volumeReturns
+	fake.recordInvocation("Volume", []interface{}{arg1, arg2})
+	fake.volumeMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeDriverAdmin) VolumeCallCount() int {
+	fake.volumeMutex.RLock()
+	defer fake.volumeMutex.RUnlock()
+	return len(fake.volumeArgsForCall)
+}
+
+func (fake *FakeDriverAdmin) VolumeCalls(stub func(dockerdriver.Env, string) driveradmin.VolumeResponse) {
+	fake.volumeMutex.Lock()
+	defer fake.volumeMutex.Unlock()
+	fake.VolumeStub = stub
+}
+
+func (fake *FakeDriverAdmin) VolumeArgsForCall(i int) (dockerdriver.Env, string) {
+	fake.volumeMutex.RLock()
+	defer fake.volumeMutex.RUnlock()
+	argsForCall := fake.volumeArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeDriverAdmin) VolumeReturns(result1 driveradmin.VolumeResponse) {
+	fake.volumeMutex.Lock()
+	defer fake.volumeMutex.Unlock()
+	fake.VolumeStub = nil
+	fake.volumeReturns = struct {
+		result1 driveradmin.VolumeResponse
+	}{result1}
+}
+
+func (fake *FakeDriverAdmin) VolumeReturnsOnCall(i int, result1 driveradmin.VolumeResponse) {
+	fake.volumeMutex.Lock()
+	defer fake.volumeMutex.Unlock()
+	fake.VolumeStub = nil
+	if fake.volumeReturnsOnCall == nil {
+		fake.volumeReturnsOnCall = make(map[int]struct {
+			result1 driveradmin.VolumeResponse
+		})
+	}
+	fake.volumeReturnsOnCall[i] = struct {
+		result1 driveradmin.VolumeResponse
+	}{result1}
+}
+
+func (fake *FakeDriverAdmin) Volumes(arg1 dockerdriver.Env) driveradmin.VolumesResponse {
+	fake.volumesMutex.Lock()
+	ret, specificReturn := fake.volumesReturnsOnCall[len(fake.volumesArgsForCall)]
+	fake.volumesArgsForCall = append(fake.volumesArgsForCall, struct {
+		arg1 dockerdriver.Env
+	}{arg1})
+	stub := fake.VolumesStub
+	fakeReturns := fake.volumesReturns
+	fake.recordInvocation("Volumes", []interface{}{arg1})
+	fake.volumesMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeDriverAdmin) VolumesCallCount() int {
+	fake.volumesMutex.RLock()
+	defer fake.volumesMutex.RUnlock()
+	return len(fake.volumesArgsForCall)
+}
+
+func (fake *FakeDriverAdmin) VolumesCalls(stub func(dockerdriver.Env) driveradmin.VolumesResponse) {
+	fake.volumesMutex.Lock()
+	defer fake.volumesMutex.Unlock()
+	fake.VolumesStub = stub
+}
+
+func (fake *FakeDriverAdmin) VolumesArgsForCall(i int) dockerdriver.Env {
+	fake.volumesMutex.RLock()
+	defer fake.volumesMutex.RUnlock()
+	argsForCall := fake.volumesArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeDriverAdmin) VolumesReturns(result1 driveradmin.VolumesResponse) {
+	fake.volumesMutex.Lock()
+	defer fake.volumesMutex.Unlock()
+	fake.VolumesStub = nil
+	fake.volumesReturns = struct {
+		result1 driveradmin.VolumesResponse
+	}{result1}
+}
+
+func (fake *FakeDriverAdmin) VolumesReturnsOnCall(i int, result1 driveradmin.VolumesResponse) {
+	fake.volumesMutex.Lock()
+	defer fake.volumesMutex.Unlock()
+	fake.VolumesStub = nil
+	if fake.volumesReturnsOnCall == nil {
+		fake.volumesReturnsOnCall = make(map[int]struct {
+			result1 driveradmin.VolumesResponse
+		})
+	}
+	fake.volumesReturnsOnCall[i] = struct {
+		result1 driveradmin.VolumesResponse
+	}{result1}
+}
+
 func (fake *FakeDriverAdmin) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
 	fake.evacuateMutex.RLock()
 	defer fake.evacuateMutex.RUnlock()
+	fake.metricsMutex.RLock()
+	defer fake.metricsMutex.RUnlock()
 	fake.pingMutex.RLock()
 	defer fake.pingMutex.RUnlock()
+	fake.readyMutex.RLock()
+	defer fake.readyMutex.RUnlock()
+	fake.reconciliationMutex.RLock()
+	defer fake.reconciliationMutex.RUnlock()
+	fake.transcriptMutex.RLock()
+	defer fake.transcriptMutex.RUnlock()
+	fake.unhealthyMountsMutex.RLock()
+	defer fake.unhealthyMountsMutex.RUnlock()
+	fake.volumeMutex.RLock()
+	defer fake.volumeMutex.RUnlock()
+	fake.volumesMutex.RLock()
+	defer fake.volumesMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
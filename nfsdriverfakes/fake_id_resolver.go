@@ -9,7 +9,7 @@ import (
 )
 
 type FakeIdResolver struct {
-	ResolveStub        func(dockerdriver.Env, string, string) (string, string, error)
+	ResolveStub        func(dockerdriver.Env, string, string) (string, string, []string, error)
 	resolveMutex       sync.RWMutex
 	resolveArgsForCall []struct {
 		arg1 dockerdriver.Env
@@ -19,18 +19,32 @@ type FakeIdResolver struct {
 	resolveReturns struct {
 		result1 string
 		result2 string
-		result3 error
+		result3 []string
+		result4 error
 	}
 	resolveReturnsOnCall map[int]struct {
 		result1 string
 		result2 string
-		result3 error
+		result3 []string
+		result4 error
+	}
+	ValidateStub        func(dockerdriver.Env, string) error
+	validateMutex       sync.RWMutex
+	validateArgsForCall []struct {
+		arg1 dockerdriver.Env
+		arg2 string
+	}
+	validateReturns struct {
+		result1 error
+	}
+	validateReturnsOnCall map[int]struct {
+		result1 error
 	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
 
-func (fake *FakeIdResolver) Resolve(arg1 dockerdriver.Env, arg2 string, arg3 string) (string, string, error) {
+func (fake *FakeIdResolver) Resolve(arg1 dockerdriver.Env, arg2 string, arg3 string) (string, string, []string, error) {
 	fake.resolveMutex.Lock()
 	ret, specificReturn := fake.resolveReturnsOnCall[len(fake.resolveArgsForCall)]
 	fake.resolveArgsForCall = append(fake.resolveArgsForCall, struct {
@@ -38,16 +52,17 @@ func (fake *FakeIdResolver) Resolve(arg1 dockerdriver.Env, arg2 string, arg3 str
 		arg2 string
 		arg3 string
 	}{arg1, arg2, arg3})
+	stub := fake.ResolveStub
+	fakeReturns := fake.resolveReturns
 	fake.recordInvocation("Resolve", []interface{}{arg1, arg2, arg3})
 	fake.resolveMutex.Unlock()
-	if fake.ResolveStub != nil {
-		return fake.ResolveStub(arg1, arg2, arg3)
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
 	}
 	if specificReturn {
-		return ret.result1, ret.result2, ret.result3
+		return ret.result1, ret.result2, ret.result3, ret.result4
 	}
-	fakeReturns := fake.resolveReturns
-	return fakeReturns.result1, fakeReturns.result2, fakeReturns.result3
+	return fakeReturns.result1, fakeReturns.result2, fakeReturns.result3, fakeReturns.result4
 }
 
 func (fake *FakeIdResolver) ResolveCallCount() int {
@@ -56,7 +71,7 @@ func (fake *FakeIdResolver) ResolveCallCount() int {
 	return len(fake.resolveArgsForCall)
 }
 
-func (fake *FakeIdResolver) ResolveCalls(stub func(dockerdriver.Env, string, string) (string, string, error)) {
+func (fake *FakeIdResolver) ResolveCalls(stub func(dockerdriver.Env, string, string) (string, string, []string, error)) {
 	fake.resolveMutex.Lock()
 	defer fake.resolveMutex.Unlock()
 	fake.ResolveStub = stub
@@ -69,18 +84,19 @@ func (fake *FakeIdResolver) ResolveArgsForCall(i int) (dockerdriver.Env, string,
 	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
 }
 
-func (fake *FakeIdResolver) ResolveReturns(result1 string, result2 string, result3 error) {
+func (fake *FakeIdResolver) ResolveReturns(result1 string, result2 string, result3 []string, result4 error) {
 	fake.resolveMutex.Lock()
 	defer fake.resolveMutex.Unlock()
 	fake.ResolveStub = nil
 	fake.resolveReturns = struct {
 		result1 string
 		result2 string
-		result3 error
-	}{result1, result2, result3}
+		result3 []string
+		result4 error
+	}{result1, result2, result3, result4}
 }
 
-func (fake *FakeIdResolver) ResolveReturnsOnCall(i int, result1 string, result2 string, result3 error) {
+func (fake *FakeIdResolver) ResolveReturnsOnCall(i int, result1 string, result2 string, result3 []string, result4 error) {
 	fake.resolveMutex.Lock()
 	defer fake.resolveMutex.Unlock()
 	fake.ResolveStub = nil
@@ -88,14 +104,78 @@ func (fake *FakeIdResolver) ResolveReturnsOnCall(i int, result1 string, result2
 		fake.resolveReturnsOnCall = make(map[int]struct {
 			result1 string
 			result2 string
-			result3 error
+			result3 []string
+			result4 error
 		})
 	}
 	fake.resolveReturnsOnCall[i] = struct {
 		result1 string
 		result2 string
-		result3 error
-	}{result1, result2, result3}
+		result3 []string
+		result4 error
+	}{result1, result2, result3, result4}
+}
+
+func (fake *FakeIdResolver) Validate(arg1 dockerdriver.Env, arg2 string) error {
+	fake.validateMutex.Lock()
+	ret, specificReturn := fake.validateReturnsOnCall[len(fake.validateArgsForCall)]
+	fake.validateArgsForCall = append(fake.validateArgsForCall, struct {
+		arg1 dockerdriver.Env
+		arg2 string
+	}{arg1, arg2})
+	stub := fake.ValidateStub
+	fakeReturns := fake.validateReturns
+	fake.recordInvocation("Validate", []interface{}{arg1, arg2})
+	fake.validateMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeIdResolver) ValidateCallCount() int {
+	fake.validateMutex.RLock()
+	defer fake.validateMutex.RUnlock()
+	return len(fake.validateArgsForCall)
+}
+
+func (fake *FakeIdResolver) ValidateCalls(stub func(dockerdriver.Env, string) error) {
+	fake.validateMutex.Lock()
+	defer fake.validateMutex.Unlock()
+	fake.ValidateStub = stub
+}
+
+func (fake *FakeIdResolver) ValidateArgsForCall(i int) (dockerdriver.Env, string) {
+	fake.validateMutex.RLock()
+	defer fake.validateMutex.RUnlock()
+	argsForCall := fake.validateArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeIdResolver) ValidateReturns(result1 error) {
+	fake.validateMutex.Lock()
+	defer fake.validateMutex.Unlock()
+	fake.ValidateStub = nil
+	fake.validateReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeIdResolver) ValidateReturnsOnCall(i int, result1 error) {
+	fake.validateMutex.Lock()
+	defer fake.validateMutex.Unlock()
+	fake.ValidateStub = nil
+	if fake.validateReturnsOnCall == nil {
+		fake.validateReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.validateReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
 }
 
 func (fake *FakeIdResolver) Invocations() map[string][][]interface{} {
@@ -103,6 +183,8 @@ func (fake *FakeIdResolver) Invocations() map[string][][]interface{} {
 	defer fake.invocationsMutex.RUnlock()
 	fake.resolveMutex.RLock()
 	defer fake.resolveMutex.RUnlock()
+	fake.validateMutex.RLock()
+	defer fake.validateMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
@@ -0,0 +1,270 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package nfsdriverfakes
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/nfsv3driver"
+)
+
+type FakeKerberosClient struct {
+	DestroyStub        func(dockerdriver.Env, string) error
+	destroyMutex       sync.RWMutex
+	destroyArgsForCall []struct {
+		arg1 dockerdriver.Env
+		arg2 string
+	}
+	destroyReturns struct {
+		result1 error
+	}
+	destroyReturnsOnCall map[int]struct {
+		result1 error
+	}
+	KinitStub        func(dockerdriver.Env, string, string, string) error
+	kinitMutex       sync.RWMutex
+	kinitArgsForCall []struct {
+		arg1 dockerdriver.Env
+		arg2 string
+		arg3 string
+		arg4 string
+	}
+	kinitReturns struct {
+		result1 error
+	}
+	kinitReturnsOnCall map[int]struct {
+		result1 error
+	}
+	RenewStub        func(dockerdriver.Env, string) error
+	renewMutex       sync.RWMutex
+	renewArgsForCall []struct {
+		arg1 dockerdriver.Env
+		arg2 string
+	}
+	renewReturns struct {
+		result1 error
+	}
+	renewReturnsOnCall map[int]struct {
+		result1 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeKerberosClient) Destroy(arg1 dockerdriver.Env, arg2 string) error {
+	fake.destroyMutex.Lock()
+	ret, specificReturn := fake.destroyReturnsOnCall[len(fake.destroyArgsForCall)]
+	fake.destroyArgsForCall = append(fake.destroyArgsForCall, struct {
+		arg1 dockerdriver.Env
+		arg2 string
+	}{arg1, arg2})
+	stub := fake.DestroyStub
+	fakeReturns := fake.destroyReturns
+	fake.recordInvocation("Destroy", []interface{}{arg1, arg2})
+	fake.destroyMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeKerberosClient) DestroyCallCount() int {
+	fake.destroyMutex.RLock()
+	defer fake.destroyMutex.RUnlock()
+	return len(fake.destroyArgsForCall)
+}
+
+func (fake *FakeKerberosClient) DestroyCalls(stub func(dockerdriver.Env, string) error) {
+	fake.destroyMutex.Lock()
+	defer fake.destroyMutex.Unlock()
+	fake.DestroyStub = stub
+}
+
+func (fake *FakeKerberosClient) DestroyArgsForCall(i int) (dockerdriver.Env, string) {
+	fake.destroyMutex.RLock()
+	defer fake.destroyMutex.RUnlock()
+	argsForCall := fake.destroyArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeKerberosClient) DestroyReturns(result1 error) {
+	fake.destroyMutex.Lock()
+	defer fake.destroyMutex.Unlock()
+	fake.DestroyStub = nil
+	fake.destroyReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeKerberosClient) DestroyReturnsOnCall(i int, result1 error) {
+	fake.destroyMutex.Lock()
+	defer fake.destroyMutex.Unlock()
+	fake.DestroyStub = nil
+	if fake.destroyReturnsOnCall == nil {
+		fake.destroyReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.destroyReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeKerberosClient) Kinit(arg1 dockerdriver.Env, arg2 string, arg3 string, arg4 string) error {
+	fake.kinitMutex.Lock()
+	ret, specificReturn := fake.kinitReturnsOnCall[len(fake.kinitArgsForCall)]
+	fake.kinitArgsForCall = append(fake.kinitArgsForCall, struct {
+		arg1 dockerdriver.Env
+		arg2 string
+		arg3 string
+		arg4 string
+	}{arg1, arg2, arg3, arg4})
+	stub := fake.KinitStub
+	fakeReturns := fake.kinitReturns
+	fake.recordInvocation("Kinit", []interface{}{arg1, arg2, arg3, arg4})
+	fake.kinitMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3, arg4)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeKerberosClient) KinitCallCount() int {
+	fake.kinitMutex.RLock()
+	defer fake.kinitMutex.RUnlock()
+	return len(fake.kinitArgsForCall)
+}
+
+func (fake *FakeKerberosClient) KinitCalls(stub func(dockerdriver.Env, string, string, string) error) {
+	fake.kinitMutex.Lock()
+	defer fake.kinitMutex.Unlock()
+	fake.KinitStub = stub
+}
+
+func (fake *FakeKerberosClient) KinitArgsForCall(i int) (dockerdriver.Env, string, string, string) {
+	fake.kinitMutex.RLock()
+	defer fake.kinitMutex.RUnlock()
+	argsForCall := fake.kinitArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4
+}
+
+func (fake *FakeKerberosClient) KinitReturns(result1 error) {
+	fake.kinitMutex.Lock()
+	defer fake.kinitMutex.Unlock()
+	fake.KinitStub = nil
+	fake.kinitReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeKerberosClient) KinitReturnsOnCall(i int, result1 error) {
+	fake.kinitMutex.Lock()
+	defer fake.kinitMutex.Unlock()
+	fake.KinitStub = nil
+	if fake.kinitReturnsOnCall == nil {
+		fake.kinitReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.kinitReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeKerberosClient) Renew(arg1 dockerdriver.Env, arg2 string) error {
+	fake.renewMutex.Lock()
+	ret, specificReturn := fake.renewReturnsOnCall[len(fake.renewArgsForCall)]
+	fake.renewArgsForCall = append(fake.renewArgsForCall, struct {
+		arg1 dockerdriver.Env
+		arg2 string
+	}{arg1, arg2})
+	stub := fake.RenewStub
+	fakeReturns := fake.renewReturns
+	fake.recordInvocation("Renew", []interface{}{arg1, arg2})
+	fake.renewMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeKerberosClient) RenewCallCount() int {
+	fake.renewMutex.RLock()
+	defer fake.renewMutex.RUnlock()
+	return len(fake.renewArgsForCall)
+}
+
+func (fake *FakeKerberosClient) RenewCalls(stub func(dockerdriver.Env, string) error) {
+	fake.renewMutex.Lock()
+	defer fake.renewMutex.Unlock()
+	fake.RenewStub = stub
+}
+
+func (fake *FakeKerberosClient) RenewArgsForCall(i int) (dockerdriver.Env, string) {
+	fake.renewMutex.RLock()
+	defer fake.renewMutex.RUnlock()
+	argsForCall := fake.renewArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeKerberosClient) RenewReturns(result1 error) {
+	fake.renewMutex.Lock()
+	defer fake.renewMutex.Unlock()
+	fake.RenewStub = nil
+	fake.renewReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeKerberosClient) RenewReturnsOnCall(i int, result1 error) {
+	fake.renewMutex.Lock()
+	defer fake.renewMutex.Unlock()
+	fake.RenewStub = nil
+	if fake.renewReturnsOnCall == nil {
+		fake.renewReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.renewReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeKerberosClient) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.destroyMutex.RLock()
+	defer fake.destroyMutex.RUnlock()
+	fake.kinitMutex.RLock()
+	defer fake.kinitMutex.RUnlock()
+	fake.renewMutex.RLock()
+	defer fake.renewMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeKerberosClient) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ nfsv3driver.KerberosClient = new(FakeKerberosClient)
@@ -0,0 +1,273 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package nfsdriverfakes
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/nfsv3driver"
+)
+
+type FakeLoginThrottle struct {
+	AllowStub        func(string, string) error
+	allowMutex       sync.RWMutex
+	allowArgsForCall []struct {
+		arg1 string
+		arg2 string
+	}
+	allowReturns struct {
+		result1 error
+	}
+	allowReturnsOnCall map[int]struct {
+		result1 error
+	}
+	RecordFailureStub        func(string, string)
+	recordFailureMutex       sync.RWMutex
+	recordFailureArgsForCall []struct {
+		arg1 string
+		arg2 string
+	}
+	RecordSourceFailureStub        func(string)
+	recordSourceFailureMutex       sync.RWMutex
+	recordSourceFailureArgsForCall []struct {
+		arg1 string
+	}
+	RecordSuccessStub        func(string, string)
+	recordSuccessMutex       sync.RWMutex
+	recordSuccessArgsForCall []struct {
+		arg1 string
+		arg2 string
+	}
+	ReloadStub        func(nfsv3driver.LoginThrottleConfig)
+	reloadMutex       sync.RWMutex
+	reloadArgsForCall []struct {
+		arg1 nfsv3driver.LoginThrottleConfig
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeLoginThrottle) Allow(arg1 string, arg2 string) error {
+	fake.allowMutex.Lock()
+	ret, specificReturn := fake.allowReturnsOnCall[len(fake.allowArgsForCall)]
+	fake.allowArgsForCall = append(fake.allowArgsForCall, struct {
+		arg1 string
+		arg2 string
+	}{arg1, arg2})
+	stub := fake.AllowStub
+	fakeReturns := fake.allowReturns
+	fake.recordInvocation("Allow", []interface{}{arg1, arg2})
+	fake.allowMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeLoginThrottle) AllowCallCount() int {
+	fake.allowMutex.RLock()
+	defer fake.allowMutex.RUnlock()
+	return len(fake.allowArgsForCall)
+}
+
+func (fake *FakeLoginThrottle) AllowCalls(stub func(string, string) error) {
+	fake.allowMutex.Lock()
+	defer fake.allowMutex.Unlock()
+	fake.AllowStub = stub
+}
+
+func (fake *FakeLoginThrottle) AllowArgsForCall(i int) (string, string) {
+	fake.allowMutex.RLock()
+	defer fake.allowMutex.RUnlock()
+	argsForCall := fake.allowArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeLoginThrottle) AllowReturns(result1 error) {
+	fake.allowMutex.Lock()
+	defer fake.allowMutex.Unlock()
+	fake.AllowStub = nil
+	fake.allowReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeLoginThrottle) AllowReturnsOnCall(i int, result1 error) {
+	fake.allowMutex.Lock()
+	defer fake.allowMutex.Unlock()
+	fake.AllowStub = nil
+	if fake.allowReturnsOnCall == nil {
+		fake.allowReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.allowReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeLoginThrottle) RecordFailure(arg1 string, arg2 string) {
+	fake.recordFailureMutex.Lock()
+	fake.recordFailureArgsForCall = append(fake.recordFailureArgsForCall, struct {
+		arg1 string
+		arg2 string
+	}{arg1, arg2})
+	stub := fake.RecordFailureStub
+	fake.recordInvocation("RecordFailure", []interface{}{arg1, arg2})
+	fake.recordFailureMutex.Unlock()
+	if stub != nil {
+		fake.RecordFailureStub(arg1, arg2)
+	}
+}
+
+func (fake *FakeLoginThrottle) RecordFailureCallCount() int {
+	fake.recordFailureMutex.RLock()
+	defer fake.recordFailureMutex.RUnlock()
+	return len(fake.recordFailureArgsForCall)
+}
+
+func (fake *FakeLoginThrottle) RecordFailureCalls(stub func(string, string)) {
+	fake.recordFailureMutex.Lock()
+	defer fake.recordFailureMutex.Unlock()
+	fake.RecordFailureStub = stub
+}
+
+func (fake *FakeLoginThrottle) RecordFailureArgsForCall(i int) (string, string) {
+	fake.recordFailureMutex.RLock()
+	defer fake.recordFailureMutex.RUnlock()
+	argsForCall := fake.recordFailureArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeLoginThrottle) RecordSourceFailure(arg1 string) {
+	fake.recordSourceFailureMutex.Lock()
+	fake.recordSourceFailureArgsForCall = append(fake.recordSourceFailureArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.RecordSourceFailureStub
+	fake.recordInvocation("RecordSourceFailure", []interface{}{arg1})
+	fake.recordSourceFailureMutex.Unlock()
+	if stub != nil {
+		fake.RecordSourceFailureStub(arg1)
+	}
+}
+
+func (fake *FakeLoginThrottle) RecordSourceFailureCallCount() int {
+	fake.recordSourceFailureMutex.RLock()
+	defer fake.recordSourceFailureMutex.RUnlock()
+	return len(fake.recordSourceFailureArgsForCall)
+}
+
+func (fake *FakeLoginThrottle) RecordSourceFailureCalls(stub func(string)) {
+	fake.recordSourceFailureMutex.Lock()
+	defer fake.recordSourceFailureMutex.Unlock()
+	fake.RecordSourceFailureStub = stub
+}
+
+func (fake *FakeLoginThrottle) RecordSourceFailureArgsForCall(i int) string {
+	fake.recordSourceFailureMutex.RLock()
+	defer fake.recordSourceFailureMutex.RUnlock()
+	argsForCall := fake.recordSourceFailureArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeLoginThrottle) RecordSuccess(arg1 string, arg2 string) {
+	fake.recordSuccessMutex.Lock()
+	fake.recordSuccessArgsForCall = append(fake.recordSuccessArgsForCall, struct {
+		arg1 string
+		arg2 string
+	}{arg1, arg2})
+	stub := fake.RecordSuccessStub
+	fake.recordInvocation("RecordSuccess", []interface{}{arg1, arg2})
+	fake.recordSuccessMutex.Unlock()
+	if stub != nil {
+		fake.RecordSuccessStub(arg1, arg2)
+	}
+}
+
+func (fake *FakeLoginThrottle) RecordSuccessCallCount() int {
+	fake.recordSuccessMutex.RLock()
+	defer fake.recordSuccessMutex.RUnlock()
+	return len(fake.recordSuccessArgsForCall)
+}
+
+func (fake *FakeLoginThrottle) RecordSuccessCalls(stub func(string, string)) {
+	fake.recordSuccessMutex.Lock()
+	defer fake.recordSuccessMutex.Unlock()
+	fake.RecordSuccessStub = stub
+}
+
+func (fake *FakeLoginThrottle) RecordSuccessArgsForCall(i int) (string, string) {
+	fake.recordSuccessMutex.RLock()
+	defer fake.recordSuccessMutex.RUnlock()
+	argsForCall := fake.recordSuccessArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeLoginThrottle) Reload(arg1 nfsv3driver.LoginThrottleConfig) {
+	fake.reloadMutex.Lock()
+	fake.reloadArgsForCall = append(fake.reloadArgsForCall, struct {
+		arg1 nfsv3driver.LoginThrottleConfig
+	}{arg1})
+	stub := fake.ReloadStub
+	fake.recordInvocation("Reload", []interface{}{arg1})
+	fake.reloadMutex.Unlock()
+	if stub != nil {
+		fake.ReloadStub(arg1)
+	}
+}
+
+func (fake *FakeLoginThrottle) ReloadCallCount() int {
+	fake.reloadMutex.RLock()
+	defer fake.reloadMutex.RUnlock()
+	return len(fake.reloadArgsForCall)
+}
+
+func (fake *FakeLoginThrottle) ReloadCalls(stub func(nfsv3driver.LoginThrottleConfig)) {
+	fake.reloadMutex.Lock()
+	defer fake.reloadMutex.Unlock()
+	fake.ReloadStub = stub
+}
+
+func (fake *FakeLoginThrottle) ReloadArgsForCall(i int) nfsv3driver.LoginThrottleConfig {
+	fake.reloadMutex.RLock()
+	defer fake.reloadMutex.RUnlock()
+	argsForCall := fake.reloadArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeLoginThrottle) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.allowMutex.RLock()
+	defer fake.allowMutex.RUnlock()
+	fake.recordFailureMutex.RLock()
+	defer fake.recordFailureMutex.RUnlock()
+	fake.recordSourceFailureMutex.RLock()
+	defer fake.recordSourceFailureMutex.RUnlock()
+	fake.recordSuccessMutex.RLock()
+	defer fake.recordSuccessMutex.RUnlock()
+	fake.reloadMutex.RLock()
+	defer fake.reloadMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeLoginThrottle) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ nfsv3driver.LoginThrottle = new(FakeLoginThrottle)
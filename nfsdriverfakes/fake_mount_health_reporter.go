@@ -0,0 +1,102 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package nfsdriverfakes
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/nfsv3driver/driveradmin"
+)
+
+type FakeMountHealthReporter struct {
+	UnhealthyMountsStub        func() []driveradmin.UnhealthyMount
+	unhealthyMountsMutex       sync.RWMutex
+	unhealthyMountsArgsForCall []struct {
+	}
+	unhealthyMountsReturns struct {
+		result1 []driveradmin.UnhealthyMount
+	}
+	unhealthyMountsReturnsOnCall map[int]struct {
+		result1 []driveradmin.UnhealthyMount
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeMountHealthReporter) UnhealthyMounts() []driveradmin.UnhealthyMount {
+	fake.unhealthyMountsMutex.Lock()
+	ret, specificReturn := fake.unhealthyMountsReturnsOnCall[len(fake.unhealthyMountsArgsForCall)]
+	fake.unhealthyMountsArgsForCall = append(fake.unhealthyMountsArgsForCall, struct {
+	}{})
+	stub := fake.UnhealthyMountsStub
+	fakeReturns := fake.unhealthyMountsReturns
+	fake.recordInvocation("UnhealthyMounts", []interface{}{})
+	fake.unhealthyMountsMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeMountHealthReporter) UnhealthyMountsCallCount() int {
+	fake.unhealthyMountsMutex.RLock()
+	defer fake.unhealthyMountsMutex.RUnlock()
+	return len(fake.unhealthyMountsArgsForCall)
+}
+
+func (fake *FakeMountHealthReporter) UnhealthyMountsCalls(stub func() []driveradmin.UnhealthyMount) {
+	fake.unhealthyMountsMutex.Lock()
+	defer fake.unhealthyMountsMutex.Unlock()
+	fake.UnhealthyMountsStub = stub
+}
+
+func (fake *FakeMountHealthReporter) UnhealthyMountsReturns(result1 []driveradmin.UnhealthyMount) {
+	fake.unhealthyMountsMutex.Lock()
+	defer fake.unhealthyMountsMutex.Unlock()
+	fake.UnhealthyMountsStub = nil
+	fake.unhealthyMountsReturns = struct {
+		result1 []driveradmin.UnhealthyMount
+	}{result1}
+}
+
+func (fake *FakeMountHealthReporter) UnhealthyMountsReturnsOnCall(i int, result1 []driveradmin.UnhealthyMount) {
+	fake.unhealthyMountsMutex.Lock()
+	defer fake.unhealthyMountsMutex.Unlock()
+	fake.UnhealthyMountsStub = nil
+	if fake.unhealthyMountsReturnsOnCall == nil {
+		fake.unhealthyMountsReturnsOnCall = make(map[int]struct {
+			result1 []driveradmin.UnhealthyMount
+		})
+	}
+	fake.unhealthyMountsReturnsOnCall[i] = struct {
+		result1 []driveradmin.UnhealthyMount
+	}{result1}
+}
+
+func (fake *FakeMountHealthReporter) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.unhealthyMountsMutex.RLock()
+	defer fake.unhealthyMountsMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeMountHealthReporter) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ driveradmin.MountHealthReporter = new(FakeMountHealthReporter)
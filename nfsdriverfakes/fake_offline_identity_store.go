@@ -0,0 +1,241 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package nfsdriverfakes
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/nfsv3driver"
+)
+
+type FakeOfflineIdentityStore struct {
+	LoadStub        func() (map[string]nfsv3driver.OfflineIdentity, error)
+	loadMutex       sync.RWMutex
+	loadArgsForCall []struct {
+	}
+	loadReturns struct {
+		result1 map[string]nfsv3driver.OfflineIdentity
+		result2 error
+	}
+	loadReturnsOnCall map[int]struct {
+		result1 map[string]nfsv3driver.OfflineIdentity
+		result2 error
+	}
+	LockStub        func()
+	lockMutex       sync.RWMutex
+	lockArgsForCall []struct {
+	}
+	SaveStub        func(map[string]nfsv3driver.OfflineIdentity) error
+	saveMutex       sync.RWMutex
+	saveArgsForCall []struct {
+		arg1 map[string]nfsv3driver.OfflineIdentity
+	}
+	saveReturns struct {
+		result1 error
+	}
+	saveReturnsOnCall map[int]struct {
+		result1 error
+	}
+	UnlockStub        func()
+	unlockMutex       sync.RWMutex
+	unlockArgsForCall []struct {
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeOfflineIdentityStore) Load() (map[string]nfsv3driver.OfflineIdentity, error) {
+	fake.loadMutex.Lock()
+	ret, specificReturn := fake.loadReturnsOnCall[len(fake.loadArgsForCall)]
+	fake.loadArgsForCall = append(fake.loadArgsForCall, struct {
+	}{})
+	stub := fake.LoadStub
+	fakeReturns := fake.loadReturns
+	fake.recordInvocation("Load", []interface{}{})
+	fake.loadMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeOfflineIdentityStore) LoadCallCount() int {
+	fake.loadMutex.RLock()
+	defer fake.loadMutex.RUnlock()
+	return len(fake.loadArgsForCall)
+}
+
+func (fake *FakeOfflineIdentityStore) LoadCalls(stub func() (map[string]nfsv3driver.OfflineIdentity, error)) {
+	fake.loadMutex.Lock()
+	defer fake.loadMutex.Unlock()
+	fake.LoadStub = stub
+}
+
+func (fake *FakeOfflineIdentityStore) LoadReturns(result1 map[string]nfsv3driver.OfflineIdentity, result2 error) {
+	fake.loadMutex.Lock()
+	defer fake.loadMutex.Unlock()
+	fake.LoadStub = nil
+	fake.loadReturns = struct {
+		result1 map[string]nfsv3driver.OfflineIdentity
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeOfflineIdentityStore) LoadReturnsOnCall(i int, result1 map[string]nfsv3driver.OfflineIdentity, result2 error) {
+	fake.loadMutex.Lock()
+	defer fake.loadMutex.Unlock()
+	fake.LoadStub = nil
+	if fake.loadReturnsOnCall == nil {
+		fake.loadReturnsOnCall = make(map[int]struct {
+			result1 map[string]nfsv3driver.OfflineIdentity
+			result2 error
+		})
+	}
+	fake.loadReturnsOnCall[i] = struct {
+		result1 map[string]nfsv3driver.OfflineIdentity
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeOfflineIdentityStore) Lock() {
+	fake.lockMutex.Lock()
+	fake.lockArgsForCall = append(fake.lockArgsForCall, struct {
+	}{})
+	stub := fake.LockStub
+	fake.recordInvocation("Lock", []interface{}{})
+	fake.lockMutex.Unlock()
+	if stub != nil {
+		fake.LockStub()
+	}
+}
+
+func (fake *FakeOfflineIdentityStore) LockCallCount() int {
+	fake.lockMutex.RLock()
+	defer fake.lockMutex.RUnlock()
+	return len(fake.lockArgsForCall)
+}
+
+func (fake *FakeOfflineIdentityStore) LockCalls(stub func()) {
+	fake.lockMutex.Lock()
+	defer fake.lockMutex.Unlock()
+	fake.LockStub = stub
+}
+
+func (fake *FakeOfflineIdentityStore) Save(arg1 map[string]nfsv3driver.OfflineIdentity) error {
+	fake.saveMutex.Lock()
+	ret, specificReturn := fake.saveReturnsOnCall[len(fake.saveArgsForCall)]
+	fake.saveArgsForCall = append(fake.saveArgsForCall, struct {
+		arg1 map[string]nfsv3driver.OfflineIdentity
+	}{arg1})
+	stub := fake.SaveStub
+	fakeReturns := fake.saveReturns
+	fake.recordInvocation("Save", []interface{}{arg1})
+	fake.saveMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeOfflineIdentityStore) SaveCallCount() int {
+	fake.saveMutex.RLock()
+	defer fake.saveMutex.RUnlock()
+	return len(fake.saveArgsForCall)
+}
+
+func (fake *FakeOfflineIdentityStore) SaveCalls(stub func(map[string]nfsv3driver.OfflineIdentity) error) {
+	fake.saveMutex.Lock()
+	defer fake.saveMutex.Unlock()
+	fake.SaveStub = stub
+}
+
+func (fake *FakeOfflineIdentityStore) SaveArgsForCall(i int) map[string]nfsv3driver.OfflineIdentity {
+	fake.saveMutex.RLock()
+	defer fake.saveMutex.RUnlock()
+	argsForCall := fake.saveArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeOfflineIdentityStore) SaveReturns(result1 error) {
+	fake.saveMutex.Lock()
+	defer fake.saveMutex.Unlock()
+	fake.SaveStub = nil
+	fake.saveReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeOfflineIdentityStore) SaveReturnsOnCall(i int, result1 error) {
+	fake.saveMutex.Lock()
+	defer fake.saveMutex.Unlock()
+	fake.SaveStub = nil
+	if fake.saveReturnsOnCall == nil {
+		fake.saveReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.saveReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeOfflineIdentityStore) Unlock() {
+	fake.unlockMutex.Lock()
+	fake.unlockArgsForCall = append(fake.unlockArgsForCall, struct {
+	}{})
+	stub := fake.UnlockStub
+	fake.recordInvocation("Unlock", []interface{}{})
+	fake.unlockMutex.Unlock()
+	if stub != nil {
+		fake.UnlockStub()
+	}
+}
+
+func (fake *FakeOfflineIdentityStore) UnlockCallCount() int {
+	fake.unlockMutex.RLock()
+	defer fake.unlockMutex.RUnlock()
+	return len(fake.unlockArgsForCall)
+}
+
+func (fake *FakeOfflineIdentityStore) UnlockCalls(stub func()) {
+	fake.unlockMutex.Lock()
+	defer fake.unlockMutex.Unlock()
+	fake.UnlockStub = stub
+}
+
+func (fake *FakeOfflineIdentityStore) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.loadMutex.RLock()
+	defer fake.loadMutex.RUnlock()
+	fake.lockMutex.RLock()
+	defer fake.lockMutex.RUnlock()
+	fake.saveMutex.RLock()
+	defer fake.saveMutex.RUnlock()
+	fake.unlockMutex.RLock()
+	defer fake.unlockMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeOfflineIdentityStore) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ nfsv3driver.OfflineIdentityStore = new(FakeOfflineIdentityStore)
@@ -0,0 +1,102 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package nfsdriverfakes
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/nfsv3driver/driveradmin"
+)
+
+type FakeReconciliationReporter struct {
+	ReconciliationActionsStub        func() []driveradmin.ReconciliationAction
+	reconciliationActionsMutex       sync.RWMutex
+	reconciliationActionsArgsForCall []struct {
+	}
+	reconciliationActionsReturns struct {
+		result1 []driveradmin.ReconciliationAction
+	}
+	reconciliationActionsReturnsOnCall map[int]struct {
+		result1 []driveradmin.ReconciliationAction
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeReconciliationReporter) ReconciliationActions() []driveradmin.ReconciliationAction {
+	fake.reconciliationActionsMutex.Lock()
+	ret, specificReturn := fake.reconciliationActionsReturnsOnCall[len(fake.reconciliationActionsArgsForCall)]
+	fake.reconciliationActionsArgsForCall = append(fake.reconciliationActionsArgsForCall, struct {
+	}{})
+	stub := fake.ReconciliationActionsStub
+	fakeReturns := fake.reconciliationActionsReturns
+	fake.recordInvocation("ReconciliationActions", []interface{}{})
+	fake.reconciliationActionsMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeReconciliationReporter) ReconciliationActionsCallCount() int {
+	fake.reconciliationActionsMutex.RLock()
+	defer fake.reconciliationActionsMutex.RUnlock()
+	return len(fake.reconciliationActionsArgsForCall)
+}
+
+func (fake *FakeReconciliationReporter) ReconciliationActionsCalls(stub func() []driveradmin.ReconciliationAction) {
+	fake.reconciliationActionsMutex.Lock()
+	defer fake.reconciliationActionsMutex.Unlock()
+	fake.ReconciliationActionsStub = stub
+}
+
+func (fake *FakeReconciliationReporter) ReconciliationActionsReturns(result1 []driveradmin.ReconciliationAction) {
+	fake.reconciliationActionsMutex.Lock()
+	defer fake.reconciliationActionsMutex.Unlock()
+	fake.ReconciliationActionsStub = nil
+	fake.reconciliationActionsReturns = struct {
+		result1 []driveradmin.ReconciliationAction
+	}{result1}
+}
+
+func (fake *FakeReconciliationReporter) ReconciliationActionsReturnsOnCall(i int, result1 []driveradmin.ReconciliationAction) {
+	fake.reconciliationActionsMutex.Lock()
+	defer fake.reconciliationActionsMutex.Unlock()
+	fake.ReconciliationActionsStub = nil
+	if fake.reconciliationActionsReturnsOnCall == nil {
+		fake.reconciliationActionsReturnsOnCall = make(map[int]struct {
+			result1 []driveradmin.ReconciliationAction
+		})
+	}
+	fake.reconciliationActionsReturnsOnCall[i] = struct {
+		result1 []driveradmin.ReconciliationAction
+	}{result1}
+}
+
+func (fake *FakeReconciliationReporter) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.reconciliationActionsMutex.RLock()
+	defer fake.reconciliationActionsMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeReconciliationReporter) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ driveradmin.ReconciliationReporter = new(FakeReconciliationReporter)
@@ -0,0 +1,102 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package nfsdriverfakes
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/nfsv3driver/driveradmin"
+)
+
+type FakeTranscriptReporter struct {
+	TranscriptEntriesStub        func() []driveradmin.TranscriptEntry
+	transcriptEntriesMutex       sync.RWMutex
+	transcriptEntriesArgsForCall []struct {
+	}
+	transcriptEntriesReturns struct {
+		result1 []driveradmin.TranscriptEntry
+	}
+	transcriptEntriesReturnsOnCall map[int]struct {
+		result1 []driveradmin.TranscriptEntry
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeTranscriptReporter) TranscriptEntries() []driveradmin.TranscriptEntry {
+	fake.transcriptEntriesMutex.Lock()
+	ret, specificReturn := fake.transcriptEntriesReturnsOnCall[len(fake.transcriptEntriesArgsForCall)]
+	fake.transcriptEntriesArgsForCall = append(fake.transcriptEntriesArgsForCall, struct {
+	}{})
+	stub := fake.TranscriptEntriesStub
+	fakeReturns := fake.transcriptEntriesReturns
+	fake.recordInvocation("TranscriptEntries", []interface{}{})
+	fake.transcriptEntriesMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeTranscriptReporter) TranscriptEntriesCallCount() int {
+	fake.transcriptEntriesMutex.RLock()
+	defer fake.transcriptEntriesMutex.RUnlock()
+	return len(fake.transcriptEntriesArgsForCall)
+}
+
+func (fake *FakeTranscriptReporter) TranscriptEntriesCalls(stub func() []driveradmin.TranscriptEntry) {
+	fake.transcriptEntriesMutex.Lock()
+	defer fake.transcriptEntriesMutex.Unlock()
+	fake.TranscriptEntriesStub = stub
+}
+
+func (fake *FakeTranscriptReporter) TranscriptEntriesReturns(result1 []driveradmin.TranscriptEntry) {
+	fake.transcriptEntriesMutex.Lock()
+	defer fake.transcriptEntriesMutex.Unlock()
+	fake.TranscriptEntriesStub = nil
+	fake.transcriptEntriesReturns = struct {
+		result1 []driveradmin.TranscriptEntry
+	}{result1}
+}
+
+func (fake *FakeTranscriptReporter) TranscriptEntriesReturnsOnCall(i int, result1 []driveradmin.TranscriptEntry) {
+	fake.transcriptEntriesMutex.Lock()
+	defer fake.transcriptEntriesMutex.Unlock()
+	fake.TranscriptEntriesStub = nil
+	if fake.transcriptEntriesReturnsOnCall == nil {
+		fake.transcriptEntriesReturnsOnCall = make(map[int]struct {
+			result1 []driveradmin.TranscriptEntry
+		})
+	}
+	fake.transcriptEntriesReturnsOnCall[i] = struct {
+		result1 []driveradmin.TranscriptEntry
+	}{result1}
+}
+
+func (fake *FakeTranscriptReporter) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.transcriptEntriesMutex.RLock()
+	defer fake.transcriptEntriesMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeTranscriptReporter) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ driveradmin.TranscriptReporter = new(FakeTranscriptReporter)
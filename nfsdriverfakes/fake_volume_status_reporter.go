@@ -0,0 +1,112 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package nfsdriverfakes
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/nfsv3driver/driveradmin"
+)
+
+type FakeVolumeStatusReporter struct {
+	VolumeStatusesStub        func(dockerdriver.Env) []driveradmin.VolumeStatus
+	volumeStatusesMutex       sync.RWMutex
+	volumeStatusesArgsForCall []struct {
+		arg1 dockerdriver.Env
+	}
+	volumeStatusesReturns struct {
+		result1 []driveradmin.VolumeStatus
+	}
+	volumeStatusesReturnsOnCall map[int]struct {
+		result1 []driveradmin.VolumeStatus
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeVolumeStatusReporter) VolumeStatuses(arg1 dockerdriver.Env) []driveradmin.VolumeStatus {
+	fake.volumeStatusesMutex.Lock()
+	ret, specificReturn := fake.volumeStatusesReturnsOnCall[len(fake.volumeStatusesArgsForCall)]
+	fake.volumeStatusesArgsForCall = append(fake.volumeStatusesArgsForCall, struct {
+		arg1 dockerdriver.Env
+	}{arg1})
+	stub := fake.VolumeStatusesStub
+	fakeReturns := fake.volumeStatusesReturns
+	fake.recordInvocation("VolumeStatuses", []interface{}{arg1})
+	fake.volumeStatusesMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeVolumeStatusReporter) VolumeStatusesCallCount() int {
+	fake.volumeStatusesMutex.RLock()
+	defer fake.volumeStatusesMutex.RUnlock()
+	return len(fake.volumeStatusesArgsForCall)
+}
+
+func (fake *FakeVolumeStatusReporter) VolumeStatusesCalls(stub func(dockerdriver.Env) []driveradmin.VolumeStatus) {
+	fake.volumeStatusesMutex.Lock()
+	defer fake.volumeStatusesMutex.Unlock()
+	fake.VolumeStatusesStub = stub
+}
+
+func (fake *FakeVolumeStatusReporter) VolumeStatusesArgsForCall(i int) dockerdriver.Env {
+	fake.volumeStatusesMutex.RLock()
+	defer fake.volumeStatusesMutex.RUnlock()
+	argsForCall := fake.volumeStatusesArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeVolumeStatusReporter) VolumeStatusesReturns(result1 []driveradmin.VolumeStatus) {
+	fake.volumeStatusesMutex.Lock()
+	defer fake.volumeStatusesMutex.Unlock()
+	fake.VolumeStatusesStub = nil
+	fake.volumeStatusesReturns = struct {
+		result1 []driveradmin.VolumeStatus
+	}{result1}
+}
+
+func (fake *FakeVolumeStatusReporter) VolumeStatusesReturnsOnCall(i int, result1 []driveradmin.VolumeStatus) {
+	fake.volumeStatusesMutex.Lock()
+	defer fake.volumeStatusesMutex.Unlock()
+	fake.VolumeStatusesStub = nil
+	if fake.volumeStatusesReturnsOnCall == nil {
+		fake.volumeStatusesReturnsOnCall = make(map[int]struct {
+			result1 []driveradmin.VolumeStatus
+		})
+	}
+	fake.volumeStatusesReturnsOnCall[i] = struct {
+		result1 []driveradmin.VolumeStatus
+	}{result1}
+}
+
+func (fake *FakeVolumeStatusReporter) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.volumeStatusesMutex.RLock()
+	defer fake.volumeStatusesMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeVolumeStatusReporter) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ driveradmin.VolumeStatusReporter = new(FakeVolumeStatusReporter)
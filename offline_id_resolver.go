@@ -0,0 +1,292 @@
+package nfsv3driver
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/goshims/ioutilshim"
+	"code.cloudfoundry.org/goshims/osshim"
+	"code.cloudfoundry.org/goshims/syscallshim"
+	"code.cloudfoundry.org/lager"
+)
+
+// OfflineVerifierIterations is the PBKDF2-HMAC-SHA256 work factor of the password verifiers in the offline cache.
+const OfflineVerifierIterations = 100000
+
+// OfflineIdentity is the last successful resolution of a user. The password is kept only as a salted verifier.
+type OfflineIdentity struct {
+	Salt       []byte    `json:"salt"`
+	Iterations int       `json:"iterations"`
+	Verifier   []byte    `json:"verifier"`
+	Uid        string    `json:"uid"`
+	Gid        string    `json:"gid"`
+	Groups     []string  `json:"groups"`
+	ResolvedAt time.Time `json:"resolved_at"`
+}
+
+// OfflineIdentityStore persists the offline cache, keyed by username. Callers hold its lock from a load to the
+// save that follows it, so that every resolver over the same store sees the others' changes.
+//
+//go:generate counterfeiter -o nfsdriverfakes/fake_offline_identity_store.go . OfflineIdentityStore
+type OfflineIdentityStore interface {
+	sync.Locker
+	Load() (map[string]OfflineIdentity, error)
+	Save(identities map[string]OfflineIdentity) error
+}
+
+type encryptedIdentityStore struct {
+	sync.Mutex
+	file *sealedFile
+}
+
+// NewEncryptedIdentityStore returns a store that keeps the offline cache in path, sealed with AES-256-GCM under
+// key. The file is replaced atomically, so a crash never leaves a partially written cache behind.
+func NewEncryptedIdentityStore(ioutil ioutilshim.Ioutil, os osshim.Os, syscall syscallshim.Syscall, path string, key []byte) (OfflineIdentityStore, error) {
+	file, err := newSealedFile(ioutil, os, syscall, path, key, "offline cache")
+	if err != nil {
+		return nil, err
+	}
+
+	return &encryptedIdentityStore{file: file}, nil
+}
+
+func (s *encryptedIdentityStore) Load() (map[string]OfflineIdentity, error) {
+	identities := map[string]OfflineIdentity{}
+	if err := s.file.load(&identities); err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+func (s *encryptedIdentityStore) Save(identities map[string]OfflineIdentity) error {
+	return s.file.save(identities)
+}
+
+type offlineIdResolver struct {
+	resolver    IdResolver
+	store       OfflineIdentityStore
+	clock       clock.Clock
+	gracePeriod time.Duration
+	throttle    LoginThrottle
+}
+
+// NewOfflineIdResolver remembers every user that resolver resolves, and answers from that memory for up to
+// gracePeriod after the last successful resolution while the directory cannot be reached. The cached password
+// verifier must match, and users the directory has revoked, or whose cached password it has refused as invalid or
+// for the state of the account, are forgotten. Any other failure, such as a timeout or a throttled login, says
+// nothing about the user and leaves the cache alone. Resolvers built over the same store, such as those of
+// successive configurations, share it safely. Passwords checked against the cache are audited and, unless
+// throttle is nil, throttled like those the directory checks, so that cutting the directory off does not allow
+// unlimited guesses, each of which costs a password verifier's worth of work.
+func NewOfflineIdResolver(resolver IdResolver, store OfflineIdentityStore, clock clock.Clock, gracePeriod time.Duration, throttle LoginThrottle) IdResolver {
+	return &offlineIdResolver{
+		resolver:    resolver,
+		store:       store,
+		clock:       clock,
+		gracePeriod: gracePeriod,
+		throttle:    throttle,
+	}
+}
+
+func (r *offlineIdResolver) Resolve(env dockerdriver.Env, username string, password string) (uid string, gid string, groups []string, err error) {
+	env = redactEnv(env, nil)
+	logger := env.Logger().Session("offline-resolve", lager.Data{"username": username})
+
+	uid, gid, groups, err = r.resolver.Resolve(env, username, password)
+	switch {
+	case err == nil:
+		r.remember(logger, username, password, uid, gid, groups)
+	case isLdapUnreachable(err):
+		if r.throttle != nil {
+			if throttleErr := r.throttle.Allow(LoginSource(env), username); throttleErr != nil {
+				r.audit(logger, "throttled", username)
+				return "", "", nil, throttleErr
+			}
+		}
+		if identity, ok := r.recall(logger, LoginSource(env), username, password); ok {
+			logger.Info("ldap-unreachable-using-offline-cache", lager.Data{
+				"uid":         identity.Uid,
+				"gid":         identity.Gid,
+				"resolved-at": identity.ResolvedAt,
+				"expires-at":  identity.ResolvedAt.Add(r.gracePeriod),
+			})
+			return identity.Uid, identity.Gid, identity.Groups, nil
+		}
+	case IsIdentityRevoked(err):
+		r.forget(logger, username, password, true)
+	case isInvalidCredentials(err) || isAccountStatus(err):
+		r.forget(logger, username, password, false)
+	}
+
+	return uid, gid, groups, err
+}
+
+func (r *offlineIdResolver) Validate(env dockerdriver.Env, username string) error {
+	err := r.resolver.Validate(env, username)
+	if IsIdentityRevoked(err) {
+		r.forget(env.Logger().Session("offline-validate", lager.Data{"username": username}), username, "", true)
+	}
+	return err
+}
+
+func (r *offlineIdResolver) remember(logger lager.Logger, username, password, uid, gid string, groups []string) {
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		logger.Error("generate-salt-failed", err)
+		return
+	}
+
+	r.update(logger, func(identities map[string]OfflineIdentity) bool {
+		identities[username] = OfflineIdentity{
+			Salt:       salt,
+			Iterations: OfflineVerifierIterations,
+			Verifier:   passwordVerifier(password, salt, OfflineVerifierIterations),
+			Uid:        uid,
+			Gid:        gid,
+			Groups:     groups,
+			ResolvedAt: r.clock.Now(),
+		}
+		return true
+	})
+}
+
+// forget drops username from the cache when they have been revoked, or when password is the one that was cached
+// and the directory has just refused it.
+func (r *offlineIdResolver) forget(logger lager.Logger, username, password string, revoked bool) {
+	r.update(logger, func(identities map[string]OfflineIdentity) bool {
+		identity, ok := identities[username]
+		if !ok || !(revoked || identity.matches(password)) {
+			return false
+		}
+
+		logger.Info("offline-cache-entry-removed", lager.Data{"revoked": revoked})
+		delete(identities, username)
+		return true
+	})
+}
+
+// recall checks password against the cached verifier of username, counting the outcome for source.
+func (r *offlineIdResolver) recall(logger lager.Logger, source, username, password string) (OfflineIdentity, bool) {
+	r.store.Lock()
+	defer r.store.Unlock()
+
+	identities, err := r.store.Load()
+	if err != nil {
+		logger.Error("load-offline-cache-failed", err)
+		return OfflineIdentity{}, false
+	}
+
+	identity, ok := identities[username]
+	if !ok {
+		logger.Info("offline-cache-miss")
+		r.audit(logger, "offline-not-cached", username)
+		if r.throttle != nil {
+			r.throttle.RecordSourceFailure(source)
+		}
+		return OfflineIdentity{}, false
+	}
+	if r.clock.Since(identity.ResolvedAt) > r.gracePeriod {
+		logger.Info("offline-cache-entry-expired", lager.Data{"resolved-at": identity.ResolvedAt})
+		r.audit(logger, "offline-not-cached", username)
+		if r.throttle != nil {
+			r.throttle.RecordSourceFailure(source)
+		}
+		return OfflineIdentity{}, false
+	}
+	if !identity.matches(password) {
+		logger.Info("offline-cache-password-mismatch")
+		r.audit(logger, "offline-failure", username)
+		if r.throttle != nil {
+			r.throttle.RecordFailure(source, username)
+		}
+		return OfflineIdentity{}, false
+	}
+
+	r.audit(logger, "offline-success", username)
+	if r.throttle != nil {
+		r.throttle.RecordSuccess(source, username)
+	}
+	return identity, true
+}
+
+func (r *offlineIdResolver) audit(logger lager.Logger, result string, username string) {
+	logger.Info("password-verification-audit", lager.Data{
+		"result":   result,
+		"username": username,
+	})
+}
+
+// update applies change to the stored cache, dropping entries past their grace period, and saves it if anything
+// changed.
+func (r *offlineIdResolver) update(logger lager.Logger, change func(map[string]OfflineIdentity) bool) {
+	r.store.Lock()
+	defer r.store.Unlock()
+
+	identities, err := r.store.Load()
+	if err != nil {
+		logger.Error("load-offline-cache-failed", err)
+		identities = map[string]OfflineIdentity{}
+	}
+
+	changed := change(identities)
+	for username, identity := range identities {
+		if r.clock.Since(identity.ResolvedAt) > r.gracePeriod {
+			delete(identities, username)
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+
+	if err := r.store.Save(identities); err != nil {
+		logger.Error("save-offline-cache-failed", err)
+	}
+}
+
+func (i OfflineIdentity) matches(password string) bool {
+	if i.Iterations <= 0 {
+		return false
+	}
+	return hmac.Equal(i.Verifier, passwordVerifier(password, i.Salt, i.Iterations))
+}
+
+// passwordVerifier derives a single 32 byte PBKDF2-HMAC-SHA256 block from password and salt.
+func passwordVerifier(password string, salt []byte, iterations int) []byte {
+	prf := hmac.New(sha256.New, []byte(password))
+
+	var index [4]byte
+	binary.BigEndian.PutUint32(index[:], 1)
+	prf.Write(salt)
+	prf.Write(index[:])
+	u := prf.Sum(nil)
+
+	verifier := make([]byte, len(u))
+	copy(verifier, u)
+	for n := 1; n < iterations; n++ {
+		prf.Reset()
+		prf.Write(u)
+		u = prf.Sum(u[:0])
+		for i := range verifier {
+			verifier[i] ^= u[i]
+		}
+	}
+	return verifier
+}
+
+func isInvalidCredentials(err error) bool {
+	safeErr, ok := err.(dockerdriver.SafeError)
+	return ok && safeErr.SafeDescription == InvalidCredentialsErrorMessage
+}
+
+func isLdapUnreachable(err error) bool {
+	safeErr, ok := err.(dockerdriver.SafeError)
+	return ok && safeErr.SafeDescription == LdapUnreachableErrorMessage
+}
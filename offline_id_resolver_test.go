@@ -0,0 +1,363 @@
+package nfsv3driver_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/goshims/ioutilshim/ioutil_fake"
+	"code.cloudfoundry.org/goshims/osshim"
+	"code.cloudfoundry.org/goshims/osshim/os_fake"
+	"code.cloudfoundry.org/goshims/syscallshim/syscall_fake"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nfsv3driver"
+	"code.cloudfoundry.org/nfsv3driver/nfsdriverfakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("OfflineIdResolver", func() {
+	var (
+		logger       *lagertest.TestLogger
+		env          dockerdriver.Env
+		fakeClock    *fakeclock.FakeClock
+		fakeResolver *nfsdriverfakes.FakeIdResolver
+		fakeThrottle *nfsdriverfakes.FakeLoginThrottle
+		fakeIoutil   *ioutil_fake.FakeIoutil
+		fakeOs       *os_fake.FakeOs
+		files        map[string][]byte
+		store        nfsv3driver.OfflineIdentityStore
+		resolver     nfsv3driver.IdResolver
+
+		uid, gid string
+		groups   []string
+		err      error
+	)
+
+	unreachable := dockerdriver.SafeError{SafeDescription: nfsv3driver.LdapUnreachableErrorMessage}
+	key := bytes.Repeat([]byte{7}, 32)
+
+	resolve := func(password string) {
+		uid, gid, groups, err = resolver.Resolve(env, "alice", password)
+	}
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("offline-id-resolver")
+		env = driverhttp.NewHttpDriverEnv(logger, context.TODO())
+		fakeClock = fakeclock.NewFakeClock(time.Unix(1600000000, 0))
+		fakeResolver = &nfsdriverfakes.FakeIdResolver{}
+		fakeResolver.ResolveReturns("1000", "1001", []string{"CN=Finance,DC=corp"}, nil)
+
+		files = map[string][]byte{}
+		fakeIoutil = &ioutil_fake.FakeIoutil{}
+		fakeIoutil.ReadFileStub = func(path string) ([]byte, error) {
+			contents, ok := files[path]
+			if !ok {
+				return nil, os.ErrNotExist
+			}
+			return contents, nil
+		}
+		fakeOs = &os_fake.FakeOs{}
+		fakeOs.IsNotExistStub = os.IsNotExist
+		writeFilesThrough(fakeOs, files)
+		fakeOs.RenameStub = func(from, to string) error {
+			files[to] = files[from]
+			delete(files, from)
+			return nil
+		}
+
+		store, err = nfsv3driver.NewEncryptedIdentityStore(fakeIoutil, fakeOs, &syscall_fake.FakeSyscall{}, "/var/vcap/data/nfsv3driver/offline-cache", key)
+		Expect(err).NotTo(HaveOccurred())
+		fakeThrottle = &nfsdriverfakes.FakeLoginThrottle{}
+		resolver = nfsv3driver.NewOfflineIdResolver(fakeResolver, store, fakeClock, 24*time.Hour, fakeThrottle)
+	})
+
+	Context("when the directory resolves the user", func() {
+		BeforeEach(func() {
+			resolve("secret")
+		})
+
+		It("returns the directory's answer", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(uid).To(Equal("1000"))
+			Expect(gid).To(Equal("1001"))
+		})
+
+		It("caches the identity encrypted, with the password only as a verifier", func() {
+			contents := files["/var/vcap/data/nfsv3driver/offline-cache"]
+			Expect(contents).NotTo(BeEmpty())
+			Expect(string(contents)).NotTo(ContainSubstring("alice"))
+			Expect(string(contents)).NotTo(ContainSubstring("1000"))
+
+			identities, err := store.Load()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(identities).To(HaveKey("alice"))
+			Expect(identities["alice"].Uid).To(Equal("1000"))
+			Expect(identities["alice"].Groups).To(ConsistOf("CN=Finance,DC=corp"))
+			Expect(identities["alice"].Salt).To(HaveLen(16))
+			Expect(string(identities["alice"].Verifier)).NotTo(ContainSubstring("secret"))
+		})
+
+		Context("when the directory then becomes unreachable", func() {
+			BeforeEach(func() {
+				fakeResolver.ResolveReturns("", "", nil, unreachable)
+			})
+
+			It("answers from the cache and says so", func() {
+				resolve("secret")
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(uid).To(Equal("1000"))
+				Expect(gid).To(Equal("1001"))
+				Expect(groups).To(ConsistOf("CN=Finance,DC=corp"))
+				Expect(logger.Buffer()).To(gbytes.Say(`ldap-unreachable-using-offline-cache.*"uid":"1000"`))
+			})
+
+			It("audits the login and clears its failures", func() {
+				resolve("secret")
+
+				Expect(logger.Buffer()).To(gbytes.Say(`password-verification-audit.*"result":"offline-success".*"username":"alice"`))
+				Expect(fakeThrottle.RecordSuccessCallCount()).To(Equal(1))
+				_, username := fakeThrottle.RecordSuccessArgsForCall(0)
+				Expect(username).To(Equal("alice"))
+			})
+
+			It("refuses a different password", func() {
+				resolve("guess")
+
+				Expect(err).To(MatchError(nfsv3driver.LdapUnreachableErrorMessage))
+				Expect(logger.Buffer()).To(gbytes.Say("offline-cache-password-mismatch"))
+			})
+
+			It("audits a different password and counts it against the user", func() {
+				resolve("guess")
+
+				Expect(logger.Buffer()).To(gbytes.Say(`password-verification-audit.*"result":"offline-failure".*"username":"alice"`))
+				Expect(fakeThrottle.RecordFailureCallCount()).To(Equal(1))
+				_, username := fakeThrottle.RecordFailureArgsForCall(0)
+				Expect(username).To(Equal("alice"))
+				Expect(fakeThrottle.RecordSuccessCallCount()).To(Equal(0))
+			})
+
+			Context("when the login is throttled", func() {
+				BeforeEach(func() {
+					fakeThrottle.AllowReturns(dockerdriver.SafeError{SafeDescription: nfsv3driver.TooManyFailedLoginsErrorMessage})
+				})
+
+				It("refuses without checking the password", func() {
+					resolve("secret")
+
+					Expect(err).To(MatchError(nfsv3driver.TooManyFailedLoginsErrorMessage))
+					Expect(uid).To(BeEmpty())
+					Expect(logger.Buffer()).To(gbytes.Say(`password-verification-audit.*"result":"throttled".*"username":"alice"`))
+					Expect(logger.Buffer()).NotTo(gbytes.Say("offline-cache-password-mismatch"))
+					Expect(fakeThrottle.RecordFailureCallCount()).To(Equal(0))
+					Expect(fakeThrottle.RecordSuccessCallCount()).To(Equal(0))
+				})
+			})
+
+			It("refuses once the grace period has passed", func() {
+				fakeClock.Increment(25 * time.Hour)
+				resolve("secret")
+
+				Expect(err).To(MatchError(nfsv3driver.LdapUnreachableErrorMessage))
+				Expect(logger.Buffer()).To(gbytes.Say("offline-cache-entry-expired"))
+				Expect(fakeThrottle.RecordSourceFailureCallCount()).To(Equal(1))
+			})
+
+			It("does not answer for other users", func() {
+				_, _, _, err = resolver.Resolve(env, "bob", "secret")
+
+				Expect(err).To(MatchError(nfsv3driver.LdapUnreachableErrorMessage))
+				Expect(logger.Buffer()).To(gbytes.Say(`password-verification-audit.*"result":"offline-not-cached".*"username":"bob"`))
+				Expect(fakeThrottle.RecordSourceFailureCallCount()).To(Equal(1))
+			})
+		})
+
+		Context("when the directory then refuses the cached password", func() {
+			BeforeEach(func() {
+				fakeResolver.ResolveReturns("", "", nil, dockerdriver.SafeError{SafeDescription: nfsv3driver.InvalidCredentialsErrorMessage})
+				resolve("secret")
+				fakeResolver.ResolveReturns("", "", nil, unreachable)
+			})
+
+			It("forgets the user", func() {
+				resolve("secret")
+				Expect(err).To(MatchError(nfsv3driver.LdapUnreachableErrorMessage))
+			})
+		})
+
+		Context("when the directory refuses some other password", func() {
+			BeforeEach(func() {
+				fakeResolver.ResolveReturns("", "", nil, dockerdriver.SafeError{SafeDescription: nfsv3driver.InvalidCredentialsErrorMessage})
+				resolve("guess")
+				fakeResolver.ResolveReturns("", "", nil, unreachable)
+			})
+
+			It("keeps the user", func() {
+				resolve("secret")
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+
+		Context("when the directory refuses the cached password for the state of the account", func() {
+			BeforeEach(func() {
+				fakeResolver.ResolveReturns("", "", nil, nfsv3driver.AccountStatusError{Code: nfsv3driver.AccountLockedErrorCode, Description: nfsv3driver.AccountLockedErrorMessage}.SafeError())
+				resolve("secret")
+				fakeResolver.ResolveReturns("", "", nil, unreachable)
+			})
+
+			It("forgets the user", func() {
+				resolve("secret")
+				Expect(err).To(MatchError(nfsv3driver.LdapUnreachableErrorMessage))
+			})
+		})
+
+		Context("when resolving the cached password times out", func() {
+			BeforeEach(func() {
+				fakeResolver.ResolveReturns("", "", nil, dockerdriver.SafeError{SafeDescription: `LDAP Result Code 200 "Network Error": ldap: connection timed out`})
+				resolve("secret")
+				fakeResolver.ResolveReturns("", "", nil, unreachable)
+			})
+
+			It("keeps the user", func() {
+				resolve("secret")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(uid).To(Equal("1000"))
+			})
+		})
+
+		Context("when the login with the cached password is throttled", func() {
+			BeforeEach(func() {
+				fakeResolver.ResolveReturns("", "", nil, dockerdriver.SafeError{SafeDescription: nfsv3driver.TooManyFailedLoginsErrorMessage})
+				resolve("secret")
+				fakeResolver.ResolveReturns("", "", nil, unreachable)
+			})
+
+			It("keeps the user", func() {
+				resolve("secret")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(uid).To(Equal("1000"))
+			})
+		})
+
+		Context("when the user is revoked", func() {
+			BeforeEach(func() {
+				fakeResolver.ValidateReturns(nfsv3driver.AccountStatusError{Code: nfsv3driver.AccountDisabledErrorCode, Description: nfsv3driver.AccountDisabledErrorMessage})
+				Expect(resolver.Validate(env, "alice")).To(HaveOccurred())
+				fakeResolver.ResolveReturns("", "", nil, unreachable)
+			})
+
+			It("forgets the user", func() {
+				resolve("secret")
+				Expect(err).To(MatchError(nfsv3driver.LdapUnreachableErrorMessage))
+			})
+		})
+	})
+
+	Context("when the directory is unreachable and the user was never cached", func() {
+		BeforeEach(func() {
+			fakeResolver.ResolveReturns("", "", nil, unreachable)
+			resolve("secret")
+		})
+
+		It("returns the directory's error", func() {
+			Expect(err).To(MatchError(nfsv3driver.LdapUnreachableErrorMessage))
+			Expect(logger.Buffer()).To(gbytes.Say("offline-cache-miss"))
+		})
+	})
+
+	Context("when several resolvers share the store", func() {
+		It("keeps every user that any of them resolves", func() {
+			other := nfsv3driver.NewOfflineIdResolver(fakeResolver, store, fakeClock, 24*time.Hour, fakeThrottle)
+
+			var wg sync.WaitGroup
+			for i, r := range []nfsv3driver.IdResolver{resolver, other, resolver, other} {
+				wg.Add(1)
+				go func(r nfsv3driver.IdResolver, username string) {
+					defer GinkgoRecover()
+					defer wg.Done()
+					_, _, _, err := r.Resolve(env, username, "secret")
+					Expect(err).NotTo(HaveOccurred())
+				}(r, fmt.Sprintf("user%d", i))
+			}
+			wg.Wait()
+
+			identities, err := store.Load()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(identities).To(HaveLen(4))
+		})
+	})
+
+	Context("when the cache cannot be saved", func() {
+		BeforeEach(func() {
+			fakeOs.OpenFileStub = nil
+			fakeOs.OpenFileReturns(nil, errors.New("disk full"))
+			resolve("secret")
+		})
+
+		It("still resolves the user", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(logger.Buffer()).To(gbytes.Say("save-offline-cache-failed.*disk full"))
+		})
+	})
+})
+
+var _ = Describe("EncryptedIdentityStore", func() {
+	It("refuses keys that are not 256 bits", func() {
+		_, err := nfsv3driver.NewEncryptedIdentityStore(&ioutil_fake.FakeIoutil{}, &os_fake.FakeOs{}, &syscall_fake.FakeSyscall{}, "/cache", []byte("short"))
+		Expect(err).To(MatchError("offline cache key must be 32 bytes"))
+	})
+
+	It("refuses a cache sealed with another key", func() {
+		files := map[string][]byte{}
+		fakeIoutil := &ioutil_fake.FakeIoutil{}
+		fakeIoutil.ReadFileStub = func(path string) ([]byte, error) {
+			return files[path], nil
+		}
+		fakeOs := &os_fake.FakeOs{}
+		writeFilesThrough(fakeOs, files)
+		fakeSyscall := &syscall_fake.FakeSyscall{}
+
+		store, err := nfsv3driver.NewEncryptedIdentityStore(fakeIoutil, fakeOs, fakeSyscall, "/cache", bytes.Repeat([]byte{1}, 32))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(store.Save(map[string]nfsv3driver.OfflineIdentity{"alice": {Uid: "1000"}})).To(Succeed())
+		path, _, mode := fakeOs.OpenFileArgsForCall(0)
+		Expect(path).To(Equal("/cache.tmp"))
+		Expect(mode).To(Equal(os.FileMode(0600)))
+		Expect(fakeSyscall.FsyncCallCount()).To(Equal(2))
+		Expect(fakeOs.OpenArgsForCall(0)).To(Equal("/"))
+
+		other, err := nfsv3driver.NewEncryptedIdentityStore(fakeIoutil, fakeOs, fakeSyscall, "/cache", bytes.Repeat([]byte{2}, 32))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = other.Load()
+		Expect(err).To(MatchError("offline cache cannot be decrypted with the configured key"))
+	})
+})
+
+// writeFilesThrough makes the files that fakeOs opens for writing, and renames, end up in files.
+func writeFilesThrough(fakeOs *os_fake.FakeOs, files map[string][]byte) {
+	fakeOs.OpenFileStub = func(path string, _ int, _ os.FileMode) (osshim.File, error) {
+		files[path] = nil
+		file := &os_fake.FakeFile{}
+		file.WriteStub = func(contents []byte) (int, error) {
+			files[path] = append(files[path], contents...)
+			return len(contents), nil
+		}
+		return file, nil
+	}
+	fakeOs.OpenReturns(&os_fake.FakeFile{}, nil)
+	fakeOs.RenameStub = func(from, to string) error {
+		files[to] = files[from]
+		delete(files, from)
+		return nil
+	}
+}
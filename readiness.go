@@ -0,0 +1,281 @@
+package nfsv3driver
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/goshims/ldapshim"
+	"code.cloudfoundry.org/goshims/osshim"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/nfsv3driver/driveradmin"
+	"code.cloudfoundry.org/volumedriver/invoker"
+)
+
+// FuseDevicePath is the device mapfs serves its file systems through.
+const FuseDevicePath = "/dev/fuse"
+
+// ReadinessFileName is the file the mount directory check creates, and removes again, to find out whether the
+// directory is writable.
+const ReadinessFileName = ".nfsv3driver-ready"
+
+// MountNfsPaths are the places mount(8) finds the NFS mount helper in.
+var MountNfsPaths = []string{"/sbin/mount.nfs", "/usr/sbin/mount.nfs"}
+
+type mapfsReadinessCheck struct {
+	invoker   invoker.Invoker
+	os        osshim.Os
+	mapfsPath string
+}
+
+// NewMapfsReadinessCheck returns a check that mapfsPath is an executable that runs on the host, which it finds out by
+// asking it for its version. Older builds do not know the -version flag; they are reported without a version, as
+// rejecting the flag shows that they run.
+func NewMapfsReadinessCheck(invoker invoker.Invoker, os osshim.Os, mapfsPath string) driveradmin.ReadinessCheck {
+	return &mapfsReadinessCheck{invoker: invoker, os: os, mapfsPath: mapfsPath}
+}
+
+func (c *mapfsReadinessCheck) Name() string {
+	return "mapfs"
+}
+
+func (c *mapfsReadinessCheck) Check(env dockerdriver.Env) (string, error) {
+	if err := executable(c.os, c.mapfsPath); err != nil {
+		return "", err
+	}
+
+	result := c.invoker.Invoke(env, c.mapfsPath, []string{"-version"})
+	if err := result.Wait(); err != nil {
+		if strings.Contains(result.StdError(), "flag provided but not defined") {
+			return fmt.Sprintf("%s, version unknown", c.mapfsPath), nil
+		}
+		return "", fmt.Errorf("%s -version failed: %s", c.mapfsPath, err.Error())
+	}
+
+	version := strings.SplitN(strings.TrimSpace(result.StdOutput()), "\n", 2)[0]
+	if version == "" {
+		return fmt.Sprintf("%s, version unknown", c.mapfsPath), nil
+	}
+	return fmt.Sprintf("%s, %s", c.mapfsPath, version), nil
+}
+
+type fuseReadinessCheck struct {
+	os osshim.Os
+}
+
+// NewFuseReadinessCheck returns a check that the FUSE device mapfs needs is present.
+func NewFuseReadinessCheck(os osshim.Os) driveradmin.ReadinessCheck {
+	return &fuseReadinessCheck{os: os}
+}
+
+func (c *fuseReadinessCheck) Name() string {
+	return "fuse"
+}
+
+func (c *fuseReadinessCheck) Check(env dockerdriver.Env) (string, error) {
+	info, err := c.os.Stat(FuseDevicePath)
+	if err != nil {
+		return "", err
+	}
+	if info.Mode()&os.ModeCharDevice == 0 {
+		return "", fmt.Errorf("%s is not a character device", FuseDevicePath)
+	}
+	return FuseDevicePath, nil
+}
+
+type mountNfsReadinessCheck struct {
+	os osshim.Os
+}
+
+// NewMountNfsReadinessCheck returns a check that the NFS mount helper is installed in one of MountNfsPaths.
+func NewMountNfsReadinessCheck(os osshim.Os) driveradmin.ReadinessCheck {
+	return &mountNfsReadinessCheck{os: os}
+}
+
+func (c *mountNfsReadinessCheck) Name() string {
+	return "mount.nfs"
+}
+
+func (c *mountNfsReadinessCheck) Check(env dockerdriver.Env) (string, error) {
+	for _, path := range MountNfsPaths {
+		if executable(c.os, path) == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("mount.nfs not found in %s", strings.Join(MountNfsPaths, ", "))
+}
+
+type mountDirReadinessCheck struct {
+	os       osshim.Os
+	mountDir string
+}
+
+// NewMountDirReadinessCheck returns a check that the directory volumes are mounted in exists and is writable.
+func NewMountDirReadinessCheck(os osshim.Os, mountDir string) driveradmin.ReadinessCheck {
+	return &mountDirReadinessCheck{os: os, mountDir: mountDir}
+}
+
+func (c *mountDirReadinessCheck) Name() string {
+	return "mount-dir"
+}
+
+func (c *mountDirReadinessCheck) Check(env dockerdriver.Env) (string, error) {
+	info, err := c.os.Stat(c.mountDir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", c.mountDir)
+	}
+
+	path := filepath.Join(c.mountDir, ReadinessFileName)
+	file, err := c.os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		return "", err
+	}
+	if err := c.os.Remove(path); err != nil {
+		return "", err
+	}
+	return c.mountDir, nil
+}
+
+type specFileReadinessCheck struct {
+	os   osshim.Os
+	path string
+}
+
+// NewSpecFileReadinessCheck returns a check that the spec file the volume manager finds the driver by is present.
+func NewSpecFileReadinessCheck(os osshim.Os, path string) driveradmin.ReadinessCheck {
+	return &specFileReadinessCheck{os: os, path: path}
+}
+
+func (c *specFileReadinessCheck) Name() string {
+	return "spec-file"
+}
+
+func (c *specFileReadinessCheck) Check(env dockerdriver.Env) (string, error) {
+	if _, err := c.os.Stat(c.path); err != nil {
+		return "", err
+	}
+	return c.path, nil
+}
+
+type ldapReadinessCheck struct {
+	name      string
+	directory *ldapIdResolver
+}
+
+// NewLdapReadinessCheck returns a check, called name, that the service account can bind to one of the LDAP hosts.
+func NewLdapReadinessCheck(
+	name string,
+	svcUser string,
+	svcPass Credential,
+	ldapHosts []string,
+	ldapPort int,
+	ldapProto string,
+	ldapCACert string,
+	ldap ldapshim.Ldap,
+	ldapTimeout time.Duration,
+) driveradmin.ReadinessCheck {
+	return &ldapReadinessCheck{
+		name: name,
+		directory: &ldapIdResolver{
+			svcUser:     svcUser,
+			svcPass:     svcPass,
+			ldapHosts:   ldapHosts,
+			ldapPort:    ldapPort,
+			ldapProto:   ldapProto,
+			ldapCACert:  ldapCACert,
+			ldap:        ldap,
+			ldapTimeout: ldapTimeout,
+		},
+	}
+}
+
+func (c *ldapReadinessCheck) Name() string {
+	return c.name
+}
+
+func (c *ldapReadinessCheck) Check(env dockerdriver.Env) (string, error) {
+	logger := env.Logger().Session("ldap-readiness", lager.Data{"check": c.name})
+
+	l, host, err := c.directory.dialAny(logger)
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+
+	svcPass, err := c.directory.svcPass.Value()
+	if err != nil {
+		return "", err
+	}
+
+	if err := l.Bind(c.directory.svcUser, svcPass); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("bound as %s on %s", c.directory.svcUser, host), nil
+}
+
+// ReloadableReadinessCheck runs a group of checks that can be replaced while the driver is running, e.g. the LDAP
+// checks when the LDAP settings are reloaded. It passes when every check in the group does, or when there are none.
+type ReloadableReadinessCheck struct {
+	name string
+
+	lock   sync.RWMutex
+	checks []driveradmin.ReadinessCheck
+}
+
+func NewReloadableReadinessCheck(name string, checks ...driveradmin.ReadinessCheck) *ReloadableReadinessCheck {
+	return &ReloadableReadinessCheck{name: name, checks: checks}
+}
+
+func (r *ReloadableReadinessCheck) Reload(checks ...driveradmin.ReadinessCheck) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.checks = checks
+}
+
+func (r *ReloadableReadinessCheck) Name() string {
+	return r.name
+}
+
+func (r *ReloadableReadinessCheck) Check(env dockerdriver.Env) (string, error) {
+	r.lock.RLock()
+	checks := r.checks
+	r.lock.RUnlock()
+
+	if len(checks) == 0 {
+		return "not configured", nil
+	}
+
+	var details []string
+	for _, check := range checks {
+		detail, err := check.Check(env)
+		if err != nil {
+			return strings.Join(details, "; "), fmt.Errorf("%s: %s", check.Name(), err.Error())
+		}
+		details = append(details, fmt.Sprintf("%s: %s", check.Name(), detail))
+	}
+	return strings.Join(details, "; "), nil
+}
+
+// executable returns an error unless path is a regular file that can be executed.
+func executable(os osshim.Os, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+		return errors.New(path + " is not an executable file")
+	}
+	return nil
+}
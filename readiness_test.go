@@ -0,0 +1,355 @@
+package nfsv3driver_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/goshims/ldapshim/ldap_fake"
+	"code.cloudfoundry.org/goshims/osshim/os_fake"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nfsv3driver"
+	"code.cloudfoundry.org/nfsv3driver/driveradmin"
+	"code.cloudfoundry.org/nfsv3driver/nfsdriverfakes"
+	"code.cloudfoundry.org/volumedriver/invokerfakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type modeInfo struct {
+	os.FileInfo
+	mode os.FileMode
+}
+
+func (i modeInfo) Mode() os.FileMode { return i.mode }
+func (i modeInfo) IsDir() bool       { return i.mode.IsDir() }
+
+var _ = Describe("Readiness checks", func() {
+	var (
+		env    dockerdriver.Env
+		fakeOs *os_fake.FakeOs
+		check  driveradmin.ReadinessCheck
+
+		detail string
+		err    error
+	)
+
+	BeforeEach(func() {
+		env = driverhttp.NewHttpDriverEnv(lagertest.NewTestLogger("readiness"), context.TODO())
+		fakeOs = &os_fake.FakeOs{}
+	})
+
+	JustBeforeEach(func() {
+		detail, err = check.Check(env)
+	})
+
+	Describe("mapfs", func() {
+		const mapfsPath = "/var/vcap/packages/mapfs/bin/mapfs"
+
+		var (
+			fakeInvoker      *invokerfakes.FakeInvoker
+			fakeInvokeResult *invokerfakes.FakeInvokeResult
+		)
+
+		BeforeEach(func() {
+			fakeInvoker = &invokerfakes.FakeInvoker{}
+			fakeInvokeResult = &invokerfakes.FakeInvokeResult{}
+			fakeInvoker.InvokeReturns(fakeInvokeResult)
+			fakeInvokeResult.StdOutputReturns("mapfs 1.2.3\n")
+			fakeOs.StatReturns(modeInfo{mode: 0755}, nil)
+
+			check = nfsv3driver.NewMapfsReadinessCheck(fakeInvoker, fakeOs, mapfsPath)
+		})
+
+		It("reports the version of the binary", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(check.Name()).To(Equal("mapfs"))
+			Expect(detail).To(Equal(mapfsPath + ", mapfs 1.2.3"))
+
+			_, executable, args, _ := fakeInvoker.InvokeArgsForCall(0)
+			Expect(executable).To(Equal(mapfsPath))
+			Expect(args).To(Equal([]string{"-version"}))
+		})
+
+		Context("when the binary is too old to report its version", func() {
+			BeforeEach(func() {
+				fakeInvokeResult.WaitReturns(errors.New("exit status 2"))
+				fakeInvokeResult.StdErrorReturns("flag provided but not defined: -version\n")
+			})
+
+			It("is still ready", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(detail).To(Equal(mapfsPath + ", version unknown"))
+			})
+		})
+
+		Context("when the binary cannot run", func() {
+			BeforeEach(func() {
+				fakeInvokeResult.WaitReturns(errors.New("exit status 127"))
+				fakeInvokeResult.StdErrorReturns("error while loading shared libraries: libfuse.so.2\n")
+			})
+
+			It("fails", func() {
+				Expect(err).To(MatchError(mapfsPath + " -version failed: exit status 127"))
+			})
+		})
+
+		Context("when the binary is missing", func() {
+			BeforeEach(func() {
+				fakeOs.StatReturns(nil, os.ErrNotExist)
+			})
+
+			It("fails", func() {
+				Expect(err).To(Equal(os.ErrNotExist))
+				Expect(fakeInvoker.InvokeCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the binary cannot be executed", func() {
+			BeforeEach(func() {
+				fakeOs.StatReturns(modeInfo{mode: 0644}, nil)
+			})
+
+			It("fails", func() {
+				Expect(err).To(MatchError(mapfsPath + " is not an executable file"))
+			})
+		})
+	})
+
+	Describe("fuse", func() {
+		BeforeEach(func() {
+			fakeOs.StatReturns(modeInfo{mode: os.ModeDevice | os.ModeCharDevice | 0666}, nil)
+
+			check = nfsv3driver.NewFuseReadinessCheck(fakeOs)
+		})
+
+		It("finds the device", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(detail).To(Equal("/dev/fuse"))
+			Expect(fakeOs.StatArgsForCall(0)).To(Equal(nfsv3driver.FuseDevicePath))
+		})
+
+		Context("when it is not a device", func() {
+			BeforeEach(func() {
+				fakeOs.StatReturns(modeInfo{mode: 0644}, nil)
+			})
+
+			It("fails", func() {
+				Expect(err).To(MatchError("/dev/fuse is not a character device"))
+			})
+		})
+	})
+
+	Describe("mount.nfs", func() {
+		BeforeEach(func() {
+			fakeOs.StatStub = func(path string) (os.FileInfo, error) {
+				if path == "/usr/sbin/mount.nfs" {
+					return modeInfo{mode: 0755}, nil
+				}
+				return nil, os.ErrNotExist
+			}
+
+			check = nfsv3driver.NewMountNfsReadinessCheck(fakeOs)
+		})
+
+		It("finds the mount helper", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(detail).To(Equal("/usr/sbin/mount.nfs"))
+		})
+
+		Context("when it is not installed", func() {
+			BeforeEach(func() {
+				fakeOs.StatStub = nil
+				fakeOs.StatReturns(nil, os.ErrNotExist)
+			})
+
+			It("fails", func() {
+				Expect(err).To(MatchError("mount.nfs not found in /sbin/mount.nfs, /usr/sbin/mount.nfs"))
+			})
+		})
+	})
+
+	Describe("mount-dir", func() {
+		const mountDir = "/var/vcap/data/volumes/nfs"
+
+		BeforeEach(func() {
+			fakeOs.StatReturns(modeInfo{mode: os.ModeDir | 0755}, nil)
+			fakeOs.OpenFileReturns(&os_fake.FakeFile{}, nil)
+
+			check = nfsv3driver.NewMountDirReadinessCheck(fakeOs, mountDir)
+		})
+
+		It("writes a file in the directory and removes it again", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(detail).To(Equal(mountDir))
+
+			Expect(fakeOs.StatArgsForCall(0)).To(Equal(mountDir))
+			Expect(fakeOs.MkdirAllCallCount()).To(Equal(0))
+			path, flag, _ := fakeOs.OpenFileArgsForCall(0)
+			Expect(path).To(Equal(mountDir + "/" + nfsv3driver.ReadinessFileName))
+			Expect(flag & os.O_CREATE).NotTo(BeZero())
+			Expect(fakeOs.RemoveArgsForCall(0)).To(Equal(path))
+		})
+
+		Context("when the directory is missing", func() {
+			BeforeEach(func() {
+				fakeOs.StatReturns(nil, os.ErrNotExist)
+			})
+
+			It("fails without creating it", func() {
+				Expect(err).To(Equal(os.ErrNotExist))
+				Expect(fakeOs.MkdirAllCallCount()).To(Equal(0))
+				Expect(fakeOs.OpenFileCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when it is not a directory", func() {
+			BeforeEach(func() {
+				fakeOs.StatReturns(modeInfo{mode: 0644}, nil)
+			})
+
+			It("fails", func() {
+				Expect(err).To(MatchError(mountDir + " is not a directory"))
+			})
+		})
+
+		Context("when the directory is read-only", func() {
+			BeforeEach(func() {
+				fakeOs.OpenFileReturns(nil, errors.New("read-only file system"))
+			})
+
+			It("fails", func() {
+				Expect(err).To(MatchError("read-only file system"))
+				Expect(fakeOs.RemoveCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("spec-file", func() {
+		BeforeEach(func() {
+			fakeOs.StatReturns(modeInfo{mode: 0644}, nil)
+
+			check = nfsv3driver.NewSpecFileReadinessCheck(fakeOs, "/var/vcap/data/voldrivers/nfsv3driver.json")
+		})
+
+		It("finds the spec file", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(detail).To(Equal("/var/vcap/data/voldrivers/nfsv3driver.json"))
+		})
+
+		Context("when it is missing", func() {
+			BeforeEach(func() {
+				fakeOs.StatReturns(nil, os.ErrNotExist)
+			})
+
+			It("fails", func() {
+				Expect(err).To(Equal(os.ErrNotExist))
+			})
+		})
+	})
+
+	Describe("ldap", func() {
+		var (
+			ldapFake           *ldap_fake.FakeLdap
+			ldapConnectionFake *ldap_fake.FakeLdapConnection
+		)
+
+		BeforeEach(func() {
+			ldapFake = &ldap_fake.FakeLdap{}
+			ldapConnectionFake = &ldap_fake.FakeLdapConnection{}
+			ldapFake.DialReturns(ldapConnectionFake, nil)
+
+			check = nfsv3driver.NewLdapReadinessCheck(
+				"corp",
+				"svc-user",
+				nfsv3driver.StaticCredential("svc-pass"),
+				[]string{"ldap1.corp", "ldap2.corp"},
+				389,
+				"tcp",
+				"",
+				ldapFake,
+				time.Minute,
+			)
+		})
+
+		It("binds with the service account", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(check.Name()).To(Equal("corp"))
+			Expect(detail).To(Equal("bound as svc-user on ldap1.corp"))
+
+			user, password := ldapConnectionFake.BindArgsForCall(0)
+			Expect(user).To(Equal("svc-user"))
+			Expect(password).To(Equal("svc-pass"))
+			Expect(ldapConnectionFake.CloseCallCount()).To(Equal(1))
+		})
+
+		Context("when the first host cannot be reached", func() {
+			BeforeEach(func() {
+				ldapFake.DialReturnsOnCall(0, nil, errors.New("connection refused"))
+			})
+
+			It("binds on the next one", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(detail).To(Equal("bound as svc-user on ldap2.corp"))
+			})
+		})
+
+		Context("when the bind fails", func() {
+			BeforeEach(func() {
+				ldapConnectionFake.BindReturns(errors.New("invalid credentials"))
+			})
+
+			It("fails", func() {
+				Expect(err).To(MatchError("invalid credentials"))
+			})
+		})
+	})
+
+	Describe("ReloadableReadinessCheck", func() {
+		var reloadable *nfsv3driver.ReloadableReadinessCheck
+
+		BeforeEach(func() {
+			reloadable = nfsv3driver.NewReloadableReadinessCheck("ldap")
+			check = reloadable
+		})
+
+		It("is ready when there are no checks", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(check.Name()).To(Equal("ldap"))
+			Expect(detail).To(Equal("not configured"))
+		})
+
+		Context("when it has been reloaded", func() {
+			var corp, branch *nfsdriverfakes.FakeReadinessCheck
+
+			BeforeEach(func() {
+				corp = &nfsdriverfakes.FakeReadinessCheck{}
+				corp.NameReturns("corp")
+				corp.CheckReturns("bound as svc-user on ldap1.corp", nil)
+				branch = &nfsdriverfakes.FakeReadinessCheck{}
+				branch.NameReturns("branch")
+				branch.CheckReturns("bound as svc-user on ldap.branch", nil)
+
+				reloadable.Reload(corp, branch)
+			})
+
+			It("runs every check", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(detail).To(Equal("corp: bound as svc-user on ldap1.corp; branch: bound as svc-user on ldap.branch"))
+			})
+
+			Context("when one of the checks fails", func() {
+				BeforeEach(func() {
+					branch.CheckReturns("", errors.New("connection refused"))
+				})
+
+				It("fails naming the check", func() {
+					Expect(err).To(MatchError("branch: connection refused"))
+				})
+			})
+		})
+	})
+})
@@ -0,0 +1,445 @@
+package nfsv3driver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/goshims/ioutilshim"
+	"code.cloudfoundry.org/goshims/osshim"
+	"code.cloudfoundry.org/goshims/syscallshim"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/nfsv3driver/driveradmin"
+	"code.cloudfoundry.org/volumedriver/invoker"
+)
+
+// The actions the reconciler reports.
+const (
+	ReconcileAdopted           = "adopted"
+	ReconcileReleased          = "released"
+	ReconcileUnhealthy         = "unhealthy"
+	ReconcileOrphanSuspected   = "orphan-suspected"
+	ReconcileMapfsKilled       = "mapfs-killed"
+	ReconcileOrphanUnmounted   = "orphan-unmounted"
+	ReconcileDirectoryRemoved  = "directory-removed"
+	ReconcileStateUnavailable  = "state-unavailable"
+	ReconcileHostUnobservable  = "host-unobservable"
+	ReconciliationHistoryLimit = 100
+)
+
+// VolumeLister lists the volumes the driver knows about.
+//
+//go:generate counterfeiter -o nfsdriverfakes/fake_volume_lister.go . VolumeLister
+type VolumeLister interface {
+	List(env dockerdriver.Env) dockerdriver.ListResponse
+}
+
+// hostMounts is what the kernel and process table say about the mount directory.
+type hostMounts struct {
+	mounts      map[string]bool
+	processes   map[string][]int
+	directories map[string]bool
+}
+
+// MountReconciler brings the driver's volumes in line with the mounts, mapfs processes and directories that are
+// actually present beneath the mount directory. At startup it rewrites the state file before the driver restores
+// it, keeping the mounts that are still healthy and releasing the rest. After that it watches the running driver,
+// reporting volumes whose mounts have broken and garbage-collecting anything beneath the mount directory that no
+// volume accounts for. An orphan must be seen on two passes in a row before it is collected, so that a mount in
+// progress is never mistaken for one. When the state file could not be read at startup, orphans are only reported,
+// since they are most likely the mounts of volumes the driver has lost track of.
+type MountReconciler struct {
+	logger    lager.Logger
+	clock     clock.Clock
+	invoker   invoker.Invoker
+	ioutil    ioutilshim.Ioutil
+	os        osshim.Os
+	syscall   syscallshim.Syscall
+	mountDir  string
+	mapfsPath string
+	interval  time.Duration
+
+	lock      sync.Mutex
+	volumes   VolumeLister
+	actions   []driveradmin.ReconciliationAction
+	suspects  map[string]bool
+	unhealthy map[string]string
+
+	// stateUnavailable is set when the state file could not be read at startup, so that the driver started without
+	// the volumes whose mounts it holds
+	stateUnavailable bool
+}
+
+func NewMountReconciler(
+	logger lager.Logger,
+	clock clock.Clock,
+	invoker invoker.Invoker,
+	ioutil ioutilshim.Ioutil,
+	os osshim.Os,
+	syscall syscallshim.Syscall,
+	mountDir string,
+	mapfsPath string,
+	interval time.Duration,
+) *MountReconciler {
+	if abs, err := filepath.Abs(mountDir); err == nil {
+		mountDir = abs
+	}
+
+	return &MountReconciler{
+		logger:    logger.Session("mount-reconciler"),
+		clock:     clock,
+		invoker:   invoker,
+		ioutil:    ioutil,
+		os:        os,
+		syscall:   syscall,
+		mountDir:  mountDir,
+		mapfsPath: mapfsPath,
+		interval:  interval,
+		suspects:  map[string]bool{},
+		unhealthy: map[string]string{},
+	}
+}
+
+// SetVolumeLister supplies the driver whose volumes are reconciled after startup.
+func (r *MountReconciler) SetVolumeLister(volumes VolumeLister) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.volumes = volumes
+}
+
+func (r *MountReconciler) ReconciliationActions() []driveradmin.ReconciliationAction {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	actions := make([]driveradmin.ReconciliationAction, len(r.actions))
+	copy(actions, r.actions)
+	return actions
+}
+
+// Restore reconciles the state file, read and written through state, with the host before the driver restores
+// it. Volumes whose mounts are healthy are adopted as they are; the others are released, so that the driver mounts
+// them afresh the next time they are used. Everything else beneath the mount directory is garbage-collected.
+func (r *MountReconciler) Restore(env dockerdriver.Env, state ioutilshim.Ioutil) {
+	logger := env.Logger().Session("restore")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	stateFile := filepath.Join(r.mountDir, DriverStateFileName)
+
+	volumes := map[string]*dockerdriver.VolumeInfo{}
+	contents, err := state.ReadFile(stateFile)
+	if err == nil {
+		err = json.Unmarshal(contents, &volumes)
+	}
+	if err != nil && !r.os.IsNotExist(err) {
+		// without the state there is no telling which mounts are orphans
+		r.record(logger, driveradmin.ReconciliationAction{Action: ReconcileStateUnavailable, Target: stateFile, Err: err.Error()})
+		r.lock.Lock()
+		r.stateUnavailable = true
+		r.lock.Unlock()
+		return
+	}
+
+	host, err := r.observe()
+	if err != nil {
+		r.record(logger, driveradmin.ReconciliationAction{Action: ReconcileHostUnobservable, Err: err.Error()})
+		return
+	}
+
+	known := map[string]bool{}
+	changed := false
+	for _, name := range sortedVolumeNames(volumes) {
+		volume := volumes[name]
+		if volume == nil || volume.Mountpoint == "" {
+			continue
+		}
+
+		known[volume.Mountpoint] = true
+
+		if reason := host.problem(volume.Mountpoint); reason != "" {
+			r.cleanup(env, logger, host, volume.Mountpoint, name)
+			r.record(logger, driveradmin.ReconciliationAction{Action: ReconcileReleased, Volume: name, Target: volume.Mountpoint, Detail: reason})
+			volume.Mountpoint = ""
+			volume.MountCount = 0
+			changed = true
+			continue
+		}
+
+		r.record(logger, driveradmin.ReconciliationAction{Action: ReconcileAdopted, Volume: name, Target: volume.Mountpoint, Detail: fmt.Sprintf("mounted %d time(s)", volume.MountCount)})
+	}
+
+	if changed {
+		contents, err := json.Marshal(volumes)
+		if err == nil {
+			err = state.WriteFile(stateFile, contents, os.ModePerm)
+		}
+		if err != nil {
+			logger.Error("write-reconciled-state-failed", err)
+		}
+	}
+
+	for _, target := range host.targets() {
+		if !known[target] {
+			r.cleanup(env, logger, host, target, "")
+		}
+	}
+}
+
+func (r *MountReconciler) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	ticker := r.clock.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	close(ready)
+
+	for {
+		select {
+		case <-ticker.C():
+			r.Reconcile(driverhttp.NewHttpDriverEnv(r.logger, context.Background()))
+		case <-signals:
+			return nil
+		}
+	}
+}
+
+// Reconcile compares the running driver's volumes with the host once. Broken mounts are reported and left for the
+// driver to remount; orphans are collected once they have been seen on two passes in a row.
+func (r *MountReconciler) Reconcile(env dockerdriver.Env) {
+	logger := env.Logger().Session("reconcile")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	r.lock.Lock()
+	lister := r.volumes
+	stateUnavailable := r.stateUnavailable
+	r.lock.Unlock()
+
+	if lister == nil {
+		return
+	}
+
+	// observe the host first, so that a volume mounted in the meantime is known rather than taken for an orphan
+	host, err := r.observe()
+	if err != nil {
+		logger.Error("observe-host-failed", err)
+		return
+	}
+
+	response := lister.List(env)
+	if response.Err != "" {
+		logger.Error("list-volumes-failed", errors.New(response.Err))
+		return
+	}
+
+	known := map[string]bool{}
+	unhealthy := map[string]string{}
+	for _, volume := range response.Volumes {
+		if volume.Mountpoint == "" {
+			continue
+		}
+		known[volume.Mountpoint] = true
+
+		reason := host.problem(volume.Mountpoint)
+		if reason == "" {
+			continue
+		}
+		unhealthy[volume.Mountpoint] = reason
+		if r.previouslyUnhealthy(volume.Mountpoint) != reason {
+			r.record(logger, driveradmin.ReconciliationAction{Action: ReconcileUnhealthy, Volume: volume.Name, Target: volume.Mountpoint, Detail: reason})
+		}
+	}
+
+	suspects := map[string]bool{}
+	for _, target := range host.targets() {
+		if known[target] {
+			continue
+		}
+		if r.suspected(target) {
+			if stateUnavailable {
+				suspects[target] = true
+			} else {
+				r.cleanup(env, logger, host, target, "")
+			}
+			continue
+		}
+		suspects[target] = true
+		detail := "not the mount point of any volume"
+		if stateUnavailable {
+			detail += ", kept because the state file could not be read"
+		}
+		r.record(logger, driveradmin.ReconciliationAction{Action: ReconcileOrphanSuspected, Target: target, Detail: detail})
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.suspects = suspects
+	r.unhealthy = unhealthy
+}
+
+func (r *MountReconciler) previouslyUnhealthy(target string) string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.unhealthy[target]
+}
+
+func (r *MountReconciler) suspected(target string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.suspects[target]
+}
+
+// cleanup stops the mapfs processes serving target, unmounts target and its intermediate mount, and removes their
+// directories.
+func (r *MountReconciler) cleanup(env dockerdriver.Env, logger lager.Logger, host hostMounts, target string, volume string) {
+	intermediate := target + MapfsDirectorySuffix
+
+	for _, pid := range host.processes[target] {
+		action := driveradmin.ReconciliationAction{Action: ReconcileMapfsKilled, Volume: volume, Target: target, Detail: fmt.Sprintf("pid %d", pid)}
+		if err := r.syscall.Kill(pid, syscall.SIGTERM); err != nil {
+			action.Err = err.Error()
+		}
+		r.record(logger, action)
+	}
+
+	for _, mountPoint := range []string{target, intermediate} {
+		if !host.mounts[mountPoint] {
+			continue
+		}
+		action := driveradmin.ReconciliationAction{Action: ReconcileOrphanUnmounted, Volume: volume, Target: mountPoint}
+		if err := r.invoker.Invoke(env, "umount", []string{"-l", "-f", mountPoint}).Wait(); err != nil {
+			action.Err = err.Error()
+		}
+		r.record(logger, action)
+	}
+
+	for _, directory := range []string{target, intermediate} {
+		if !host.directories[directory] {
+			continue
+		}
+		action := driveradmin.ReconciliationAction{Action: ReconcileDirectoryRemoved, Volume: volume, Target: directory}
+		if err := r.os.Remove(directory); err != nil {
+			if r.os.IsNotExist(err) {
+				continue
+			}
+			action.Err = err.Error()
+		}
+		r.record(logger, action)
+	}
+}
+
+func (r *MountReconciler) record(logger lager.Logger, action driveradmin.ReconciliationAction) {
+	action.Time = r.clock.Now()
+
+	data := lager.Data{"volume": action.Volume, "target": action.Target, "detail": action.Detail}
+	if action.Err != "" {
+		logger.Error(action.Action, errors.New(action.Err), data)
+	} else {
+		logger.Info(action.Action, data)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.actions = append(r.actions, action)
+	if len(r.actions) > ReconciliationHistoryLimit {
+		r.actions = r.actions[len(r.actions)-ReconciliationHistoryLimit:]
+	}
+}
+
+// observe collects the mounts, mapfs processes and directories directly beneath the mount directory.
+func (r *MountReconciler) observe() (hostMounts, error) {
+	host := hostMounts{mounts: map[string]bool{}, processes: map[string][]int{}, directories: map[string]bool{}}
+
+	mounts, err := readMountInfo(r.ioutil)
+	if err != nil {
+		return hostMounts{}, err
+	}
+	for _, mount := range mounts {
+		if filepath.Dir(mount.MountPoint) == r.mountDir {
+			host.mounts[mount.MountPoint] = true
+		}
+	}
+
+	processes, err := mapfsProcesses(r.ioutil, r.mapfsPath)
+	if err != nil {
+		return hostMounts{}, err
+	}
+	for target, pids := range processes {
+		if filepath.Dir(target) == r.mountDir {
+			host.processes[target] = pids
+		}
+	}
+
+	entries, err := r.ioutil.ReadDir(r.mountDir)
+	if err != nil && !r.os.IsNotExist(err) {
+		return hostMounts{}, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			host.directories[filepath.Join(r.mountDir, entry.Name())] = true
+		}
+	}
+
+	return host, nil
+}
+
+// problem returns why the mount at target cannot be used, or "" when it is healthy.
+func (h hostMounts) problem(target string) string {
+	intermediate := h.mounts[target+MapfsDirectorySuffix]
+	mapfs := len(h.processes[target]) > 0
+
+	switch {
+	case !h.mounts[target]:
+		return "not mounted"
+	case intermediate && !mapfs:
+		return "mapfs is not running"
+	case mapfs && !intermediate:
+		return "intermediate mount is missing"
+	default:
+		return ""
+	}
+}
+
+// targets lists every mount point that a mount, mapfs process or directory beneath the mount directory belongs to.
+func (h hostMounts) targets() []string {
+	seen := map[string]bool{}
+	for mountPoint := range h.mounts {
+		seen[strings.TrimSuffix(mountPoint, MapfsDirectorySuffix)] = true
+	}
+	for target := range h.processes {
+		seen[target] = true
+	}
+	for directory := range h.directories {
+		seen[strings.TrimSuffix(directory, MapfsDirectorySuffix)] = true
+	}
+
+	var targets []string
+	for target := range seen {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+func sortedVolumeNames(volumes map[string]*dockerdriver.VolumeInfo) []string {
+	var names []string
+	for name := range volumes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
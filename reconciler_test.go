@@ -0,0 +1,502 @@
+package nfsv3driver_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/goshims/ioutilshim/ioutil_fake"
+	"code.cloudfoundry.org/goshims/osshim/os_fake"
+	"code.cloudfoundry.org/goshims/syscallshim/syscall_fake"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nfsv3driver"
+	"code.cloudfoundry.org/nfsv3driver/driveradmin"
+	"code.cloudfoundry.org/nfsv3driver/nfsdriverfakes"
+	"code.cloudfoundry.org/volumedriver/invokerfakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/tedsuo/ifrit"
+)
+
+type dirEntry struct {
+	os.FileInfo
+	name string
+	dir  bool
+}
+
+func (e dirEntry) Name() string { return e.name }
+func (e dirEntry) IsDir() bool  { return e.dir }
+
+var _ = Describe("MountReconciler", func() {
+	const mountDir = "/var/vcap/data/volumes/nfs"
+	const mapfsPath = "/var/vcap/packages/mapfs/bin/mapfs"
+
+	var (
+		logger           *lagertest.TestLogger
+		env              dockerdriver.Env
+		fakeClock        *fakeclock.FakeClock
+		fakeInvoker      *invokerfakes.FakeInvoker
+		fakeInvokeResult *invokerfakes.FakeInvokeResult
+		fakeIoutil       *ioutil_fake.FakeIoutil
+		fakeOs           *os_fake.FakeOs
+		fakeSyscall      *syscall_fake.FakeSyscall
+		fakeState        *ioutil_fake.FakeIoutil
+		fakeLister       *nfsdriverfakes.FakeVolumeLister
+
+		mountInfo   []string
+		processes   map[string]string
+		directories []string
+
+		reconciler *nfsv3driver.MountReconciler
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("mount-reconciler")
+		env = driverhttp.NewHttpDriverEnv(logger, context.TODO())
+		fakeClock = fakeclock.NewFakeClock(time.Unix(1600000000, 0))
+		fakeInvoker = &invokerfakes.FakeInvoker{}
+		fakeInvokeResult = &invokerfakes.FakeInvokeResult{}
+		fakeInvoker.InvokeReturns(fakeInvokeResult)
+		fakeIoutil = &ioutil_fake.FakeIoutil{}
+		fakeOs = &os_fake.FakeOs{}
+		fakeOs.IsNotExistStub = os.IsNotExist
+		fakeSyscall = &syscall_fake.FakeSyscall{}
+		fakeState = &ioutil_fake.FakeIoutil{}
+		fakeState.ReadFileReturns(nil, os.ErrNotExist)
+		fakeLister = &nfsdriverfakes.FakeVolumeLister{}
+
+		mountInfo = []string{
+			"22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw",
+			"35 22 0:31 / /var/vcap/data rw,relatime shared:2 - ext4 /dev/sdb2 rw",
+		}
+		processes = map[string]string{
+			"1": "/sbin/init\x00",
+		}
+		directories = nil
+
+		fakeIoutil.ReadFileStub = func(path string) ([]byte, error) {
+			if path == "/proc/self/mountinfo" {
+				return []byte(strings.Join(mountInfo, "\n") + "\n"), nil
+			}
+			for pid, cmdline := range processes {
+				if path == "/proc/"+pid+"/cmdline" {
+					return []byte(cmdline), nil
+				}
+			}
+			return nil, os.ErrNotExist
+		}
+		fakeIoutil.ReadDirStub = func(path string) ([]os.FileInfo, error) {
+			var entries []os.FileInfo
+			switch path {
+			case "/proc":
+				entries = append(entries, dirEntry{name: "self", dir: true})
+				for pid := range processes {
+					entries = append(entries, dirEntry{name: pid, dir: true})
+				}
+			case mountDir:
+				entries = append(entries, dirEntry{name: "driver-state.json"})
+				for _, directory := range directories {
+					entries = append(entries, dirEntry{name: directory, dir: true})
+				}
+			}
+			return entries, nil
+		}
+	})
+
+	JustBeforeEach(func() {
+		reconciler = nfsv3driver.NewMountReconciler(logger, fakeClock, fakeInvoker, fakeIoutil, fakeOs, fakeSyscall, mountDir, mapfsPath, time.Minute)
+		reconciler.SetVolumeLister(fakeLister)
+	})
+
+	mapfsMount := func(name string, pid string) {
+		target := mountDir + "/" + name
+		mountInfo = append(mountInfo,
+			"40 35 0:40 / "+strings.Replace(target, " ", `\040`, -1)+"_mapfs rw,relatime shared:3 - nfs filer:/export rw",
+			"41 35 0:41 / "+strings.Replace(target, " ", `\040`, -1)+" rw,relatime shared:4 - fuse.mapfs mapfs rw",
+		)
+		if pid != "" {
+			processes[pid] = mapfsPath + "\x00-uid\x002000\x00-gid\x002000\x00" + target + "\x00" + target + "_mapfs\x00"
+		}
+		directories = append(directories, name, name+"_mapfs")
+	}
+
+	withState := func(volumes map[string]dockerdriver.VolumeInfo) {
+		contents, err := json.Marshal(volumes)
+		Expect(err).NotTo(HaveOccurred())
+		fakeState.ReadFileReturns(contents, nil)
+	}
+
+	unmounted := func() []string {
+		var mountPoints []string
+		for i := 0; i < fakeInvoker.InvokeCallCount(); i++ {
+			_, command, args, _ := fakeInvoker.InvokeArgsForCall(i)
+			Expect(command).To(Equal("umount"))
+			Expect(args[:2]).To(Equal([]string{"-l", "-f"}))
+			mountPoints = append(mountPoints, args[2])
+		}
+		return mountPoints
+	}
+
+	removed := func() []string {
+		var paths []string
+		for i := 0; i < fakeOs.RemoveCallCount(); i++ {
+			paths = append(paths, fakeOs.RemoveArgsForCall(i))
+		}
+		return paths
+	}
+
+	actions := func() []string {
+		var names []string
+		for _, action := range reconciler.ReconciliationActions() {
+			names = append(names, action.Action+" "+action.Target)
+		}
+		return names
+	}
+
+	Describe("Restore", func() {
+		JustBeforeEach(func() {
+			reconciler.Restore(env, fakeState)
+		})
+
+		Context("when a volume's mapfs mount is healthy", func() {
+			BeforeEach(func() {
+				mapfsMount("vol1", "123")
+				withState(map[string]dockerdriver.VolumeInfo{
+					"vol1": {Name: "vol1", Mountpoint: mountDir + "/vol1", MountCount: 2},
+				})
+			})
+
+			It("adopts it", func() {
+				Expect(fakeSyscall.KillCallCount()).To(Equal(0))
+				Expect(fakeInvoker.InvokeCallCount()).To(Equal(0))
+				Expect(fakeOs.RemoveCallCount()).To(Equal(0))
+				Expect(fakeState.WriteFileCallCount()).To(Equal(0))
+
+				Expect(reconciler.ReconciliationActions()).To(Equal([]driveradmin.ReconciliationAction{{
+					Time:   time.Unix(1600000000, 0),
+					Action: nfsv3driver.ReconcileAdopted,
+					Volume: "vol1",
+					Target: mountDir + "/vol1",
+					Detail: "mounted 2 time(s)",
+				}}))
+				Expect(logger.Buffer()).To(gbytes.Say(`adopted.*"volume":"vol1"`))
+			})
+		})
+
+		Context("when a volume is mounted without mapfs", func() {
+			BeforeEach(func() {
+				mountInfo = append(mountInfo, "40 35 0:40 / "+mountDir+"/vol1 rw,relatime shared:3 - nfs filer:/export rw")
+				directories = []string{"vol1"}
+				withState(map[string]dockerdriver.VolumeInfo{
+					"vol1": {Name: "vol1", Mountpoint: mountDir + "/vol1", MountCount: 1},
+				})
+			})
+
+			It("adopts it", func() {
+				Expect(fakeInvoker.InvokeCallCount()).To(Equal(0))
+				Expect(fakeOs.RemoveCallCount()).To(Equal(0))
+				Expect(actions()).To(ConsistOf("adopted " + mountDir + "/vol1"))
+			})
+		})
+
+		Context("when the mount point has a space in its name", func() {
+			BeforeEach(func() {
+				mapfsMount("my vol", "123")
+				withState(map[string]dockerdriver.VolumeInfo{
+					"my vol": {Name: "my vol", Mountpoint: mountDir + "/my vol", MountCount: 1},
+				})
+			})
+
+			It("recognises it", func() {
+				Expect(actions()).To(ConsistOf("adopted " + mountDir + "/my vol"))
+			})
+		})
+
+		Context("when a volume's mapfs process has gone", func() {
+			BeforeEach(func() {
+				mapfsMount("vol1", "")
+				withState(map[string]dockerdriver.VolumeInfo{
+					"vol1": {Name: "vol1", Mountpoint: mountDir + "/vol1", MountCount: 1},
+					"vol2": {Name: "vol2"},
+				})
+			})
+
+			It("cleans up its mounts and releases it", func() {
+				Expect(unmounted()).To(Equal([]string{mountDir + "/vol1", mountDir + "/vol1_mapfs"}))
+				Expect(removed()).To(Equal([]string{mountDir + "/vol1", mountDir + "/vol1_mapfs"}))
+
+				path, contents, _ := fakeState.WriteFileArgsForCall(0)
+				Expect(path).To(Equal(mountDir + "/driver-state.json"))
+				Expect(contents).To(MatchJSON(`{
+					"vol1": {"Name": "vol1", "Mountpoint": "", "MountCount": 0},
+					"vol2": {"Name": "vol2", "Mountpoint": "", "MountCount": 0}
+				}`))
+
+				Expect(reconciler.ReconciliationActions()).To(ContainElement(driveradmin.ReconciliationAction{
+					Time:   time.Unix(1600000000, 0),
+					Action: nfsv3driver.ReconcileReleased,
+					Volume: "vol1",
+					Target: mountDir + "/vol1",
+					Detail: "mapfs is not running",
+				}))
+			})
+		})
+
+		Context("when a volume is no longer mounted", func() {
+			BeforeEach(func() {
+				directories = []string{"vol1"}
+				withState(map[string]dockerdriver.VolumeInfo{
+					"vol1": {Name: "vol1", Mountpoint: mountDir + "/vol1", MountCount: 3},
+				})
+			})
+
+			It("releases it", func() {
+				Expect(fakeInvoker.InvokeCallCount()).To(Equal(0))
+				Expect(removed()).To(Equal([]string{mountDir + "/vol1"}))
+
+				_, contents, _ := fakeState.WriteFileArgsForCall(0)
+				Expect(contents).To(MatchJSON(`{"vol1": {"Name": "vol1", "Mountpoint": "", "MountCount": 0}}`))
+				Expect(actions()).To(ContainElement("released " + mountDir + "/vol1"))
+			})
+		})
+
+		Context("when the host has mounts and mapfs processes that no volume accounts for", func() {
+			BeforeEach(func() {
+				mapfsMount("vol1", "123")
+				mapfsMount("old", "456")
+				directories = append(directories, "empty")
+				mountInfo = append(mountInfo, "50 35 0:50 / /var/vcap/data/other rw - nfs filer:/other rw")
+				processes["789"] = mapfsPath + "\x00/somewhere/else\x00/somewhere/else_mapfs\x00"
+				withState(map[string]dockerdriver.VolumeInfo{
+					"vol1": {Name: "vol1", Mountpoint: mountDir + "/vol1", MountCount: 1},
+				})
+			})
+
+			It("garbage-collects them", func() {
+				Expect(fakeSyscall.KillCallCount()).To(Equal(1))
+				pid, signal := fakeSyscall.KillArgsForCall(0)
+				Expect(pid).To(Equal(456))
+				Expect(signal).To(Equal(syscall.SIGTERM))
+
+				Expect(unmounted()).To(Equal([]string{mountDir + "/old", mountDir + "/old_mapfs"}))
+				Expect(removed()).To(Equal([]string{mountDir + "/empty", mountDir + "/old", mountDir + "/old_mapfs"}))
+				Expect(fakeState.WriteFileCallCount()).To(Equal(0))
+
+				Expect(actions()).To(Equal([]string{
+					"adopted " + mountDir + "/vol1",
+					"directory-removed " + mountDir + "/empty",
+					"mapfs-killed " + mountDir + "/old",
+					"orphan-unmounted " + mountDir + "/old",
+					"orphan-unmounted " + mountDir + "/old_mapfs",
+					"directory-removed " + mountDir + "/old",
+					"directory-removed " + mountDir + "/old_mapfs",
+				}))
+			})
+
+			Context("when an orphan cannot be unmounted", func() {
+				BeforeEach(func() {
+					fakeInvokeResult.WaitReturns(errors.New("target is busy"))
+				})
+
+				It("reports the failure", func() {
+					Expect(reconciler.ReconciliationActions()).To(ContainElement(driveradmin.ReconciliationAction{
+						Time:   time.Unix(1600000000, 0),
+						Action: nfsv3driver.ReconcileOrphanUnmounted,
+						Target: mountDir + "/old",
+						Err:    "target is busy",
+					}))
+					Expect(logger.Buffer()).To(gbytes.Say(`orphan-unmounted.*target is busy`))
+				})
+			})
+		})
+
+		Context("when there is no state file", func() {
+			BeforeEach(func() {
+				mapfsMount("old", "456")
+			})
+
+			It("garbage-collects everything", func() {
+				Expect(fakeSyscall.KillCallCount()).To(Equal(1))
+				Expect(unmounted()).To(Equal([]string{mountDir + "/old", mountDir + "/old_mapfs"}))
+			})
+		})
+
+		Context("when the state file cannot be read", func() {
+			BeforeEach(func() {
+				mapfsMount("old", "456")
+				fakeState.ReadFileReturns(nil, errors.New("state file is not valid JSON"))
+			})
+
+			It("leaves the host alone", func() {
+				Expect(fakeSyscall.KillCallCount()).To(Equal(0))
+				Expect(fakeInvoker.InvokeCallCount()).To(Equal(0))
+				Expect(fakeOs.RemoveCallCount()).To(Equal(0))
+				Expect(actions()).To(Equal([]string{"state-unavailable " + mountDir + "/driver-state.json"}))
+			})
+		})
+
+		Context("when the mount table cannot be read", func() {
+			BeforeEach(func() {
+				directories = []string{"old"}
+				fakeIoutil.ReadFileReturns(nil, errors.New("permission denied"))
+				fakeIoutil.ReadFileStub = nil
+			})
+
+			It("leaves the host alone", func() {
+				Expect(fakeOs.RemoveCallCount()).To(Equal(0))
+				Expect(actions()).To(Equal([]string{"host-unobservable "}))
+			})
+		})
+	})
+
+	Describe("Reconcile", func() {
+		BeforeEach(func() {
+			mapfsMount("vol1", "123")
+			fakeLister.ListReturns(dockerdriver.ListResponse{Volumes: []dockerdriver.VolumeInfo{
+				{Name: "vol1", Mountpoint: mountDir + "/vol1", MountCount: 1},
+				{Name: "vol2"},
+			}})
+		})
+
+		It("leaves healthy volumes alone", func() {
+			reconciler.Reconcile(env)
+			reconciler.Reconcile(env)
+
+			Expect(fakeInvoker.InvokeCallCount()).To(Equal(0))
+			Expect(fakeOs.RemoveCallCount()).To(Equal(0))
+			Expect(reconciler.ReconciliationActions()).To(BeEmpty())
+		})
+
+		Context("when there is an orphan", func() {
+			BeforeEach(func() {
+				mapfsMount("old", "456")
+			})
+
+			It("collects it once it has been seen twice", func() {
+				reconciler.Reconcile(env)
+				Expect(fakeSyscall.KillCallCount()).To(Equal(0))
+				Expect(fakeInvoker.InvokeCallCount()).To(Equal(0))
+				Expect(actions()).To(Equal([]string{"orphan-suspected " + mountDir + "/old"}))
+
+				reconciler.Reconcile(env)
+				Expect(fakeSyscall.KillCallCount()).To(Equal(1))
+				Expect(unmounted()).To(Equal([]string{mountDir + "/old", mountDir + "/old_mapfs"}))
+				Expect(removed()).To(Equal([]string{mountDir + "/old", mountDir + "/old_mapfs"}))
+			})
+
+			It("spares it when a volume claims it in the meantime", func() {
+				reconciler.Reconcile(env)
+
+				fakeLister.ListReturns(dockerdriver.ListResponse{Volumes: []dockerdriver.VolumeInfo{
+					{Name: "vol1", Mountpoint: mountDir + "/vol1", MountCount: 1},
+					{Name: "old", Mountpoint: mountDir + "/old", MountCount: 1},
+				}})
+				reconciler.Reconcile(env)
+
+				Expect(fakeSyscall.KillCallCount()).To(Equal(0))
+				Expect(fakeInvoker.InvokeCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when a volume's mount has broken", func() {
+			BeforeEach(func() {
+				delete(processes, "123")
+			})
+
+			It("reports it once, without touching it", func() {
+				reconciler.Reconcile(env)
+				reconciler.Reconcile(env)
+
+				Expect(fakeInvoker.InvokeCallCount()).To(Equal(0))
+				Expect(reconciler.ReconciliationActions()).To(Equal([]driveradmin.ReconciliationAction{{
+					Time:   time.Unix(1600000000, 0),
+					Action: nfsv3driver.ReconcileUnhealthy,
+					Volume: "vol1",
+					Target: mountDir + "/vol1",
+					Detail: "mapfs is not running",
+				}}))
+			})
+		})
+
+		Context("when the state file could not be read at startup", func() {
+			BeforeEach(func() {
+				mapfsMount("old", "456")
+				fakeState.ReadFileReturns(nil, errors.New("state file is not valid JSON"))
+			})
+
+			JustBeforeEach(func() {
+				reconciler.Restore(env, fakeState)
+			})
+
+			It("reports orphans once, without collecting them", func() {
+				reconciler.Reconcile(env)
+				reconciler.Reconcile(env)
+				reconciler.Reconcile(env)
+
+				Expect(fakeSyscall.KillCallCount()).To(Equal(0))
+				Expect(fakeInvoker.InvokeCallCount()).To(Equal(0))
+				Expect(fakeOs.RemoveCallCount()).To(Equal(0))
+				Expect(actions()).To(Equal([]string{
+					"state-unavailable " + mountDir + "/driver-state.json",
+					"orphan-suspected " + mountDir + "/old",
+				}))
+				Expect(reconciler.ReconciliationActions()[1].Detail).To(ContainSubstring("the state file could not be read"))
+			})
+		})
+
+		Context("when the driver cannot list its volumes", func() {
+			BeforeEach(func() {
+				mapfsMount("old", "456")
+				fakeLister.ListReturns(dockerdriver.ListResponse{Err: "badness"})
+			})
+
+			It("does nothing", func() {
+				reconciler.Reconcile(env)
+				reconciler.Reconcile(env)
+
+				Expect(fakeSyscall.KillCallCount()).To(Equal(0))
+				Expect(reconciler.ReconciliationActions()).To(BeEmpty())
+			})
+		})
+	})
+
+	It("keeps a bounded history of its actions", func() {
+		for i := 0; i < nfsv3driver.ReconciliationHistoryLimit+5; i++ {
+			processes = map[string]string{}
+			mountInfo = nil
+			directories = []string{"old"}
+			reconciler.Restore(env, fakeState)
+		}
+
+		Expect(reconciler.ReconciliationActions()).To(HaveLen(nfsv3driver.ReconciliationHistoryLimit))
+	})
+
+	Describe("Run", func() {
+		var process ifrit.Process
+
+		JustBeforeEach(func() {
+			process = ifrit.Invoke(reconciler)
+		})
+
+		AfterEach(func() {
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+		})
+
+		It("reconciles every interval", func() {
+			fakeClock.WaitForWatcherAndIncrement(time.Minute)
+			Eventually(fakeLister.ListCallCount).Should(Equal(1))
+
+			fakeClock.Increment(time.Minute)
+			Eventually(fakeLister.ListCallCount).Should(Equal(2))
+		})
+	})
+})
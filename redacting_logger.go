@@ -0,0 +1,261 @@
+package nfsv3driver
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/lager"
+)
+
+const RedactedValue = "*REDACTED*"
+
+// SecretKeys are the option and data keys whose values are always scrubbed from log output.
+var SecretKeys = []string{"password", "passwd", "token", "secret", "keytab", "ldap_svc_pass", "svc_pass"}
+
+// redaction scrubs the values of SecretKeys and any extra keys from key=value pairs embedded in strings.
+type redaction struct {
+	keys    map[string]bool
+	pattern *regexp.Regexp
+}
+
+func newRedaction(extraKeys []string) redaction {
+	keys := map[string]bool{}
+	var quoted []string
+	for _, key := range append(append([]string{}, SecretKeys...), extraKeys...) {
+		key = strings.ToLower(key)
+		if key == "" || keys[key] {
+			continue
+		}
+		keys[key] = true
+		quoted = append(quoted, regexp.QuoteMeta(key))
+	}
+
+	return redaction{
+		keys:    keys,
+		pattern: regexp.MustCompile(`(?i)\b(` + strings.Join(quoted, "|") + `)=[^,\s]*`),
+	}
+}
+
+func (r redaction) redactString(s string) string {
+	return r.pattern.ReplaceAllStringFunc(s, func(match string) string {
+		return match[:strings.Index(match, "=")+1] + RedactedValue
+	})
+}
+
+type redactingLogger struct {
+	redaction
+	logger lager.Logger
+}
+
+// NewRedactingLogger wraps logger so that the values of SecretKeys and any extraKeys are scrubbed from every
+// lager.Data and error message it emits, including key=value pairs embedded in strings such as command arguments.
+func NewRedactingLogger(logger lager.Logger, extraKeys []string) lager.Logger {
+	if r, ok := logger.(*redactingLogger); ok {
+		logger = r.logger
+		for key := range r.keys {
+			extraKeys = append(extraKeys, key)
+		}
+	}
+
+	return &redactingLogger{
+		redaction: newRedaction(extraKeys),
+		logger:    logger,
+	}
+}
+
+// redactEnv returns env with a logger that scrubs the values of SecretKeys and extraKeys, keeping any keys its
+// logger already scrubs.
+func redactEnv(env dockerdriver.Env, extraKeys []string) dockerdriver.Env {
+	if r, ok := env.Logger().(*redactingLogger); ok && r.scrubs(extraKeys) {
+		return env
+	}
+	return driverhttp.EnvWithLogger(NewRedactingLogger(env.Logger(), extraKeys), env)
+}
+
+func (l *redactingLogger) scrubs(keys []string) bool {
+	for _, key := range keys {
+		if key != "" && !l.keys[strings.ToLower(key)] {
+			return false
+		}
+	}
+	return true
+}
+
+type redactingMounter struct {
+	ReloadableMounter
+	keys []string
+}
+
+// NewRedactingMounter returns a mounter that hands mounter envs whose loggers scrub the values of SecretKeys and
+// extraKeys, whatever logger the env it is called with has.
+func NewRedactingMounter(mounter ReloadableMounter, extraKeys []string) ReloadableMounter {
+	return &redactingMounter{ReloadableMounter: mounter, keys: extraKeys}
+}
+
+func (m *redactingMounter) Mount(env dockerdriver.Env, remote string, target string, opts map[string]interface{}) error {
+	return m.ReloadableMounter.Mount(redactEnv(env, m.keys), remote, target, opts)
+}
+
+func (m *redactingMounter) Unmount(env dockerdriver.Env, target string) error {
+	return m.ReloadableMounter.Unmount(redactEnv(env, m.keys), target)
+}
+
+func (m *redactingMounter) Check(env dockerdriver.Env, name, mountPoint string) bool {
+	return m.ReloadableMounter.Check(redactEnv(env, m.keys), name, mountPoint)
+}
+
+func (m *redactingMounter) Purge(env dockerdriver.Env, path string) {
+	m.ReloadableMounter.Purge(redactEnv(env, m.keys), path)
+}
+
+type redactingIdResolver struct {
+	IdResolver
+	keys []string
+}
+
+// NewRedactingIdResolver returns a resolver that hands resolver envs whose loggers scrub the values of SecretKeys and
+// extraKeys, whatever logger the env it is called with has.
+func NewRedactingIdResolver(resolver IdResolver, extraKeys []string) IdResolver {
+	return &redactingIdResolver{IdResolver: resolver, keys: extraKeys}
+}
+
+func (r *redactingIdResolver) Resolve(env dockerdriver.Env, username string, password string) (string, string, []string, error) {
+	return r.IdResolver.Resolve(redactEnv(env, r.keys), username, password)
+}
+
+func (r *redactingIdResolver) Validate(env dockerdriver.Env, username string) error {
+	return r.IdResolver.Validate(redactEnv(env, r.keys), username)
+}
+
+func (l *redactingLogger) RegisterSink(sink lager.Sink) {
+	l.logger.RegisterSink(sink)
+}
+
+func (l *redactingLogger) Session(task string, data ...lager.Data) lager.Logger {
+	return &redactingLogger{redaction: l.redaction, logger: l.logger.Session(task, l.redactAll(data)...)}
+}
+
+func (l *redactingLogger) SessionName() string {
+	return l.logger.SessionName()
+}
+
+func (l *redactingLogger) Debug(action string, data ...lager.Data) {
+	l.logger.Debug(action, l.redactAll(data)...)
+}
+
+func (l *redactingLogger) Info(action string, data ...lager.Data) {
+	l.logger.Info(action, l.redactAll(data)...)
+}
+
+func (l *redactingLogger) Error(action string, err error, data ...lager.Data) {
+	l.logger.Error(action, l.redactError(err), l.redactAll(data)...)
+}
+
+func (l *redactingLogger) Fatal(action string, err error, data ...lager.Data) {
+	l.logger.Fatal(action, l.redactError(err), l.redactAll(data)...)
+}
+
+func (l *redactingLogger) WithData(data lager.Data) lager.Logger {
+	return &redactingLogger{redaction: l.redaction, logger: l.logger.WithData(l.redactData(data))}
+}
+
+func (l *redactingLogger) redactAll(data []lager.Data) []lager.Data {
+	var ret []lager.Data
+	for _, d := range data {
+		ret = append(ret, l.redactData(d))
+	}
+	return ret
+}
+
+func (l *redactingLogger) redactData(data lager.Data) lager.Data {
+	if data == nil {
+		return nil
+	}
+	return lager.Data(l.redactMap(data))
+}
+
+func (l *redactingLogger) redactMap(data map[string]interface{}) map[string]interface{} {
+	ret := map[string]interface{}{}
+	for k, v := range data {
+		if l.keys[strings.ToLower(k)] {
+			ret[k] = RedactedValue
+		} else {
+			ret[k] = l.redactValue(v)
+		}
+	}
+	return ret
+}
+
+func (l *redactingLogger) redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return l.redactString(v)
+	case []string:
+		return l.redactArgs(v)
+	case error:
+		return l.redactError(v)
+	}
+
+	// any other map or list, such as lager.Data, map[string]string or a named options type, can hold secrets too. They
+	// are logged as JSON, so they are scrubbed into the generic types that marshal the same way.
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Map:
+		if v.IsNil() || v.Type().Key().Kind() != reflect.String {
+			return value
+		}
+		ret := map[string]interface{}{}
+		iter := v.MapRange()
+		for iter.Next() {
+			k := iter.Key().String()
+			if l.keys[strings.ToLower(k)] {
+				ret[k] = RedactedValue
+			} else {
+				ret[k] = l.redactValue(iter.Value().Interface())
+			}
+		}
+		return ret
+	case reflect.Slice, reflect.Array:
+		if (v.Kind() == reflect.Slice && v.IsNil()) || v.Type().Elem().Kind() == reflect.Uint8 {
+			return value
+		}
+		ret := make([]interface{}, v.Len())
+		for i := range ret {
+			ret[i] = l.redactValue(v.Index(i).Interface())
+		}
+		return ret
+	}
+	return value
+}
+
+// redactArgs scrubs command line arguments, covering both "key=value" and "--key value" forms.
+func (l *redactingLogger) redactArgs(args []string) []string {
+	ret := make([]string, len(args))
+	redactNext := false
+	for i, arg := range args {
+		if redactNext {
+			ret[i] = RedactedValue
+			redactNext = false
+			continue
+		}
+		ret[i] = l.redactString(arg)
+		redactNext = l.keys[strings.ToLower(strings.TrimLeft(arg, "-"))] && strings.HasPrefix(arg, "-")
+	}
+	return ret
+}
+
+func (l *redactingLogger) redactError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	redacted := l.redactString(err.Error())
+	if redacted == err.Error() {
+		return err
+	}
+	return errors.New(redacted)
+}
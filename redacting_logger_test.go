@@ -0,0 +1,148 @@
+package nfsv3driver_test
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nfsv3driver"
+	"code.cloudfoundry.org/nfsv3driver/nfsdriverfakes"
+	"code.cloudfoundry.org/volumedriver/invoker"
+)
+
+var _ = Describe("RedactingLogger", func() {
+	var (
+		testLogger *lagertest.TestLogger
+		subject    lager.Logger
+	)
+
+	output := func() string {
+		return string(testLogger.Buffer().Contents())
+	}
+
+	BeforeEach(func() {
+		testLogger = lagertest.NewTestLogger("redacting-logger")
+		subject = nfsv3driver.NewRedactingLogger(testLogger, []string{"custom_secret"})
+	})
+
+	It("scrubs known secret keys", func() {
+		subject.Info("data", lager.Data{"password": "hunter2", "token": "abc.def.ghi", "keytab": "BQIAAA", "user": "alice"})
+		Expect(output()).NotTo(ContainSubstring("hunter2"))
+		Expect(output()).NotTo(ContainSubstring("abc.def.ghi"))
+		Expect(output()).NotTo(ContainSubstring("BQIAAA"))
+		Expect(output()).To(ContainSubstring(`"password":"*REDACTED*"`))
+		Expect(output()).To(ContainSubstring(`"user":"alice"`))
+	})
+
+	It("scrubs configured extra keys regardless of case", func() {
+		subject.Info("data", lager.Data{"Custom_Secret": "hunter2"})
+		Expect(output()).NotTo(ContainSubstring("hunter2"))
+	})
+
+	It("scrubs secrets nested in maps", func() {
+		subject.Debug("data", lager.Data{"options": map[string]interface{}{"password": "hunter2", "uid": "100"}})
+		Expect(output()).NotTo(ContainSubstring("hunter2"))
+		Expect(output()).To(ContainSubstring(`"uid":"100"`))
+	})
+
+	It("scrubs secrets nested in map types and lists of them", func() {
+		type mountOptions map[string]interface{}
+		subject.Info("data", lager.Data{
+			"data":    lager.Data{"password": "hunter1"},
+			"env":     map[string]string{"custom_secret": "hunter2", "user": "alice"},
+			"options": mountOptions{"token": "hunter3"},
+			"volumes": []map[string]interface{}{{"secret": "hunter4"}},
+			"args":    map[string][]string{"mount": {"password=hunter5"}},
+		})
+		Expect(output()).NotTo(ContainSubstring("hunter"))
+		Expect(output()).To(ContainSubstring(`"user":"alice"`))
+		Expect(output()).To(ContainSubstring(`"custom_secret":"*REDACTED*"`))
+	})
+
+	It("scrubs key=value pairs and flags in command arguments", func() {
+		subject.Info("invoke", lager.Data{"args": []string{"-o", "vers=3,password=hunter2", "--token", "abc.def.ghi"}})
+		Expect(output()).NotTo(ContainSubstring("hunter2"))
+		Expect(output()).NotTo(ContainSubstring("abc.def.ghi"))
+		Expect(output()).To(ContainSubstring("vers=3,password=*REDACTED*"))
+	})
+
+	It("scrubs error messages", func() {
+		subject.Error("failed", errors.New("bad option password=hunter2"))
+		Expect(output()).NotTo(ContainSubstring("hunter2"))
+	})
+
+	It("scrubs session and WithData data", func() {
+		subject.Session("session", lager.Data{"password": "hunter2"}).WithData(lager.Data{"secret": "s3cret"}).Info("data")
+		Expect(output()).NotTo(ContainSubstring("hunter2"))
+		Expect(output()).NotTo(ContainSubstring("s3cret"))
+	})
+
+	It("keeps the extra keys when wrapped again", func() {
+		nfsv3driver.NewRedactingLogger(subject, nil).Info("data", lager.Data{"custom_secret": "hunter2"})
+		Expect(output()).NotTo(ContainSubstring("hunter2"))
+	})
+
+	Describe("NewRedactingMounter", func() {
+		It("hands the mounter an env that scrubs the extra keys", func() {
+			fakeMounter := &nfsdriverfakes.FakeReloadableMounter{}
+			fakeMounter.MountStub = func(env dockerdriver.Env, _ string, _ string, _ map[string]interface{}) error {
+				env.Logger().Info("mounting", lager.Data{"custom_secret": "hunter2", "password": "hunter3"})
+				return nil
+			}
+
+			env := driverhttp.NewHttpDriverEnv(testLogger, context.TODO())
+			mounter := nfsv3driver.NewRedactingMounter(fakeMounter, []string{"custom_secret"})
+			Expect(mounter.Mount(env, "filer:/export", "/mnt/vol", map[string]interface{}{})).To(Succeed())
+
+			Expect(output()).To(ContainSubstring("mounting"))
+			Expect(output()).NotTo(ContainSubstring("hunter"))
+		})
+
+		It("adds the extra keys to an env that already scrubs others", func() {
+			fakeMounter := &nfsdriverfakes.FakeReloadableMounter{}
+			fakeMounter.UnmountStub = func(env dockerdriver.Env, _ string) error {
+				env.Logger().Info("unmounting", lager.Data{"custom_secret": "hunter2", "other_secret": "hunter3"})
+				return nil
+			}
+
+			env := driverhttp.NewHttpDriverEnv(nfsv3driver.NewRedactingLogger(testLogger, []string{"other_secret"}), context.TODO())
+			mounter := nfsv3driver.NewRedactingMounter(fakeMounter, []string{"custom_secret"})
+			Expect(mounter.Unmount(env, "/mnt/vol")).To(Succeed())
+
+			Expect(output()).To(ContainSubstring("unmounting"))
+			Expect(output()).NotTo(ContainSubstring("hunter"))
+		})
+	})
+
+	Describe("NewRedactingIdResolver", func() {
+		It("hands the resolver an env that scrubs the extra keys", func() {
+			fakeResolver := &nfsdriverfakes.FakeIdResolver{}
+			fakeResolver.ResolveStub = func(env dockerdriver.Env, _ string, _ string) (string, string, []string, error) {
+				env.Logger().Info("resolving", lager.Data{"custom_secret": "hunter2"})
+				return "1000", "1000", nil, nil
+			}
+
+			env := driverhttp.NewHttpDriverEnv(testLogger, context.TODO())
+			_, _, _, err := nfsv3driver.NewRedactingIdResolver(fakeResolver, []string{"custom_secret"}).Resolve(env, "alice", "pw")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(output()).To(ContainSubstring("resolving"))
+			Expect(output()).NotTo(ContainSubstring("hunter2"))
+		})
+	})
+
+	Context("when used by a command invocation", func() {
+		It("does not log the secrets in the command arguments", func() {
+			env := driverhttp.NewHttpDriverEnv(subject, context.TODO())
+			Expect(invoker.NewProcessGroupInvoker().Invoke(env, "true", []string{"-o", "password=hunter2"}).Wait()).To(Succeed())
+			Expect(output()).To(ContainSubstring("invoking-command-pgroup"))
+			Expect(output()).NotTo(ContainSubstring("hunter2"))
+		})
+	})
+})
@@ -0,0 +1,49 @@
+package nfsv3driver
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/dockerdriver"
+)
+
+// ReloadableIdResolver delegates to a resolver that can be replaced while the driver is running, e.g. when the
+// LDAP settings are reloaded. A nil resolver means LDAP is not configured.
+type ReloadableIdResolver struct {
+	lock     sync.RWMutex
+	resolver IdResolver
+}
+
+func NewReloadableIdResolver(resolver IdResolver) *ReloadableIdResolver {
+	return &ReloadableIdResolver{resolver: resolver}
+}
+
+func (r *ReloadableIdResolver) Reload(resolver IdResolver) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.resolver = resolver
+}
+
+func (r *ReloadableIdResolver) Resolve(env dockerdriver.Env, username string, password string) (uid string, gid string, groups []string, err error) {
+	r.lock.RLock()
+	resolver := r.resolver
+	r.lock.RUnlock()
+
+	if resolver == nil {
+		return "", "", nil, dockerdriver.SafeError{SafeDescription: LdapNotConfiguredErrorMessage}
+	}
+
+	return resolver.Resolve(env, username, password)
+}
+
+func (r *ReloadableIdResolver) Validate(env dockerdriver.Env, username string) error {
+	r.lock.RLock()
+	resolver := r.resolver
+	r.lock.RUnlock()
+
+	if resolver == nil {
+		return dockerdriver.SafeError{SafeDescription: LdapNotConfiguredErrorMessage}
+	}
+
+	return resolver.Validate(env, username)
+}
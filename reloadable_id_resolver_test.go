@@ -0,0 +1,77 @@
+package nfsv3driver_test
+
+import (
+	"context"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nfsv3driver"
+	"code.cloudfoundry.org/nfsv3driver/nfsdriverfakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ReloadableIdResolver", func() {
+	var (
+		env          dockerdriver.Env
+		fakeResolver *nfsdriverfakes.FakeIdResolver
+		subject      *nfsv3driver.ReloadableIdResolver
+	)
+
+	BeforeEach(func() {
+		env = driverhttp.NewHttpDriverEnv(lagertest.NewTestLogger("reloadable-id-resolver"), context.TODO())
+		fakeResolver = &nfsdriverfakes.FakeIdResolver{}
+		fakeResolver.ResolveReturns("100", "200", nil, nil)
+	})
+
+	Context("when no resolver is configured", func() {
+		BeforeEach(func() {
+			subject = nfsv3driver.NewReloadableIdResolver(nil)
+		})
+
+		It("reports that LDAP is not configured", func() {
+			_, _, _, err := subject.Resolve(env, "user", "secret")
+			Expect(err).To(MatchError("LDAP username is specified but LDAP is not configured"))
+			Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+
+			Expect(subject.Validate(env, "user")).To(MatchError("LDAP username is specified but LDAP is not configured"))
+		})
+
+		It("uses a resolver once one is loaded", func() {
+			subject.Reload(fakeResolver)
+
+			Expect(subject.Validate(env, "user")).To(Succeed())
+			Expect(fakeResolver.ValidateCallCount()).To(Equal(1))
+
+			uid, gid, _, err := subject.Resolve(env, "user", "secret")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(uid).To(Equal("100"))
+			Expect(gid).To(Equal("200"))
+
+			_, username, password := fakeResolver.ResolveArgsForCall(0)
+			Expect(username).To(Equal("user"))
+			Expect(password).To(Equal("secret"))
+		})
+	})
+
+	Context("when the resolver is replaced", func() {
+		var newResolver *nfsdriverfakes.FakeIdResolver
+
+		BeforeEach(func() {
+			subject = nfsv3driver.NewReloadableIdResolver(fakeResolver)
+
+			newResolver = &nfsdriverfakes.FakeIdResolver{}
+			newResolver.ResolveReturns("300", "400", nil, nil)
+			subject.Reload(newResolver)
+		})
+
+		It("delegates to the new resolver only", func() {
+			uid, gid, _, err := subject.Resolve(env, "user", "secret")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(uid).To(Equal("300"))
+			Expect(gid).To(Equal("400"))
+			Expect(fakeResolver.ResolveCallCount()).To(Equal(0))
+		})
+	})
+})
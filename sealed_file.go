@@ -0,0 +1,109 @@
+package nfsv3driver
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/goshims/ioutilshim"
+	"code.cloudfoundry.org/goshims/osshim"
+	"code.cloudfoundry.org/goshims/syscallshim"
+)
+
+// sealedFile keeps a JSON document in a file sealed with AES-256-GCM, as the nonce followed by the ciphertext. The
+// file is replaced atomically and durably, so a crash never leaves a partially written or lost document behind.
+type sealedFile struct {
+	ioutil      ioutilshim.Ioutil
+	os          osshim.Os
+	syscall     syscallshim.Syscall
+	path        string
+	aead        cipher.AEAD
+	description string
+}
+
+func newSealedFile(ioutil ioutilshim.Ioutil, os osshim.Os, syscall syscallshim.Syscall, path string, key []byte, description string) (*sealedFile, error) {
+	if len(key) != 32 {
+		return nil, errors.New(description + " key must be 32 bytes")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sealedFile{ioutil: ioutil, os: os, syscall: syscall, path: path, aead: aead, description: description}, nil
+}
+
+// load decodes the document into v, leaving v alone if the file does not exist yet.
+func (f *sealedFile) load(v interface{}) error {
+	sealed, err := f.ioutil.ReadFile(f.path)
+	if f.os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	nonceSize := f.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return errors.New(f.description + " is truncated")
+	}
+	contents, err := f.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return errors.New(f.description + " cannot be decrypted with the configured key")
+	}
+
+	return json.Unmarshal(contents, v)
+}
+
+func (f *sealedFile) save(v interface{}) error {
+	contents, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, f.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+
+	tmp := f.path + ".tmp"
+	file, err := f.os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(f.aead.Seal(nonce, nonce, contents, nil))
+	if err == nil {
+		err = f.syscall.Fsync(int(file.Fd()))
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = f.os.Remove(tmp)
+		return err
+	}
+
+	if err := f.os.Rename(tmp, f.path); err != nil {
+		return err
+	}
+
+	// make the rename itself durable
+	dir, err := f.os.Open(filepath.Dir(f.path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return f.syscall.Fsync(int(dir.Fd()))
+}
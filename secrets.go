@@ -0,0 +1,65 @@
+package nfsv3driver
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"code.cloudfoundry.org/goshims/ioutilshim"
+)
+
+const SecretReferencePrefix = "secret://"
+
+// Credential yields the current value of a secret that may be rotated while the driver is running.
+type Credential interface {
+	Value() (string, error)
+}
+
+type StaticCredential string
+
+func (c StaticCredential) Value() (string, error) {
+	return string(c), nil
+}
+
+type fileCredential struct {
+	ioutil ioutilshim.Ioutil
+	path   string
+}
+
+// NewFileCredential returns a credential that re-reads path on every use, so that a rotated file takes effect
+// without restarting the driver.
+func NewFileCredential(ioutil ioutilshim.Ioutil, path string) Credential {
+	return &fileCredential{ioutil: ioutil, path: path}
+}
+
+func (c *fileCredential) Value() (string, error) {
+	contents, err := c.ioutil.ReadFile(c.path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(contents), "\r\n"), nil
+}
+
+//go:generate counterfeiter -o nfsdriverfakes/fake_secret_store.go . SecretStore
+type SecretStore interface {
+	Read(name string) (string, error)
+}
+
+type directorySecretStore struct {
+	ioutil ioutilshim.Ioutil
+	dir    string
+}
+
+// NewDirectorySecretStore returns a store that reads secrets from files in dir, which the platform populates.
+// Secret names must be plain file names; anything that could escape dir is rejected.
+func NewDirectorySecretStore(ioutil ioutilshim.Ioutil, dir string) SecretStore {
+	return &directorySecretStore{ioutil: ioutil, dir: dir}
+}
+
+func (s *directorySecretStore) Read(name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", errors.New("invalid secret name")
+	}
+
+	return NewFileCredential(s.ioutil, filepath.Join(s.dir, name)).Value()
+}
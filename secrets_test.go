@@ -0,0 +1,80 @@
+package nfsv3driver_test
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/goshims/ioutilshim/ioutil_fake"
+	"code.cloudfoundry.org/nfsv3driver"
+)
+
+var _ = Describe("Secrets", func() {
+	var fakeIoutil *ioutil_fake.FakeIoutil
+
+	BeforeEach(func() {
+		fakeIoutil = &ioutil_fake.FakeIoutil{}
+	})
+
+	Describe("FileCredential", func() {
+		var subject nfsv3driver.Credential
+
+		BeforeEach(func() {
+			subject = nfsv3driver.NewFileCredential(fakeIoutil, "/var/vcap/jobs/nfsv3driver/config/ldap_svc_pass")
+		})
+
+		It("reads the file without its trailing newline", func() {
+			fakeIoutil.ReadFileReturns([]byte("s3cret\n"), nil)
+
+			value, err := subject.Value()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(value).To(Equal("s3cret"))
+			Expect(fakeIoutil.ReadFileArgsForCall(0)).To(Equal("/var/vcap/jobs/nfsv3driver/config/ldap_svc_pass"))
+		})
+
+		It("re-reads the file on every use so that rotations take effect", func() {
+			fakeIoutil.ReadFileReturnsOnCall(0, []byte("old"), nil)
+			fakeIoutil.ReadFileReturnsOnCall(1, []byte("new"), nil)
+
+			Expect(subject.Value()).To(Equal("old"))
+			Expect(subject.Value()).To(Equal("new"))
+		})
+
+		It("returns read errors", func() {
+			fakeIoutil.ReadFileReturns(nil, errors.New("badness"))
+
+			_, err := subject.Value()
+			Expect(err).To(MatchError("badness"))
+		})
+	})
+
+	Describe("DirectorySecretStore", func() {
+		var subject nfsv3driver.SecretStore
+
+		BeforeEach(func() {
+			subject = nfsv3driver.NewDirectorySecretStore(fakeIoutil, "/var/vcap/data/secrets")
+			fakeIoutil.ReadFileReturns([]byte("s3cret"), nil)
+		})
+
+		It("reads the named secret from the directory", func() {
+			value, err := subject.Read("alice")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(value).To(Equal("s3cret"))
+			Expect(fakeIoutil.ReadFileArgsForCall(0)).To(Equal("/var/vcap/data/secrets/alice"))
+		})
+
+		table.DescribeTable("rejects names that could escape the directory", func(name string) {
+			_, err := subject.Read(name)
+			Expect(err).To(MatchError("invalid secret name"))
+			Expect(fakeIoutil.ReadFileCallCount()).To(Equal(0))
+		},
+			table.Entry("empty", ""),
+			table.Entry("parent", ".."),
+			table.Entry("relative path", "../etc/shadow"),
+			table.Entry("absolute path", "/etc/shadow"),
+			table.Entry("backslash", `..\shadow`),
+		)
+	})
+})
@@ -0,0 +1,147 @@
+package nfsv3driver
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/lager"
+	"gopkg.in/ldap.v2"
+)
+
+const ShareRequiresUsernameErrorMessage = "This share requires the 'username' option"
+const ShareNotAuthorizedErrorMessage = "User is not authorized to mount this share"
+const ShareNotPermittedErrorMessage = "Mounting this share is not permitted"
+
+// ShareAuthorizer decides whether a user, identified by the groups their directory entry belongs to, may mount a
+// share. username and groups are empty when the mount did not name a directory user.
+//
+//go:generate counterfeiter -o nfsdriverfakes/fake_share_authorizer.go . ShareAuthorizer
+type ShareAuthorizer interface {
+	Authorize(env dockerdriver.Env, remote string, username string, groups []string) error
+}
+
+// ShareRule grants the members of Groups access to every share matching Export. Export is a path.Match pattern
+// over "host:/path"; a rule that matches a directory also covers everything beneath it. Host names are compared
+// without regard to case or a trailing dot, paths exactly. Groups may be given as full distinguished names or as
+// bare common names, and are compared with the groups in the user's memberOf attribute only: groups nested in
+// those are not expanded, so members of a nested group must be granted through a group they belong to directly.
+type ShareRule struct {
+	Export string
+	Groups []string
+}
+
+type sharePolicy struct {
+	rules          []ShareRule
+	allowUnmatched bool
+}
+
+// NewSharePolicy returns an authorizer that applies the rule matching the share most closely, taking rules in order
+// when several match the same directory. Shares that no rule matches are allowed for everyone when allowUnmatched is set and refused otherwise.
+func NewSharePolicy(rules []ShareRule, allowUnmatched bool) (ShareAuthorizer, error) {
+	for i, rule := range rules {
+		if strings.TrimSpace(rule.Export) == "" {
+			return nil, fmt.Errorf("rule %d: export pattern is empty", i)
+		}
+		if _, err := path.Match(rule.Export, ""); err != nil {
+			return nil, fmt.Errorf("rule %d: invalid export pattern '%s': %s", i, rule.Export, err.Error())
+		}
+		if len(rule.Groups) == 0 {
+			return nil, fmt.Errorf("rule %d: no groups are allowed to mount '%s'", i, rule.Export)
+		}
+	}
+
+	normalized := make([]ShareRule, len(rules))
+	for i, rule := range rules {
+		normalized[i] = ShareRule{Export: normalizeShare(rule.Export), Groups: rule.Groups}
+	}
+
+	return &sharePolicy{rules: normalized, allowUnmatched: allowUnmatched}, nil
+}
+
+func (p *sharePolicy) Authorize(env dockerdriver.Env, remote string, username string, groups []string) error {
+	logger := env.Logger().Session("authorize-share", lager.Data{"remote": remote, "username": username})
+
+	rule, ok := p.match(remote)
+	if !ok {
+		if p.allowUnmatched {
+			return nil
+		}
+		logger.Info("no-matching-rule")
+		return dockerdriver.SafeError{SafeDescription: ShareNotPermittedErrorMessage}
+	}
+
+	if username == "" {
+		logger.Info("username-required", lager.Data{"export": rule.Export})
+		return dockerdriver.SafeError{SafeDescription: ShareRequiresUsernameErrorMessage}
+	}
+
+	for _, group := range groups {
+		for _, allowed := range rule.Groups {
+			if groupMatches(group, allowed) {
+				logger.Debug("authorized", lager.Data{"export": rule.Export, "group": group})
+				return nil
+			}
+		}
+	}
+
+	logger.Info("not-authorized", lager.Data{"export": rule.Export})
+	return dockerdriver.SafeError{SafeDescription: ShareNotAuthorizedErrorMessage}
+}
+
+func (p *sharePolicy) match(remote string) (ShareRule, bool) {
+	for _, share := range shareAndParents(remote) {
+		for _, rule := range p.rules {
+			if matched, _ := path.Match(rule.Export, share); matched {
+				return rule, true
+			}
+		}
+	}
+	return ShareRule{}, false
+}
+
+// shareAndParents lists remote followed by each of its parent directories, most specific first, so that the rule
+// closest to the share wins.
+func shareAndParents(remote string) []string {
+	remote = normalizeShare(remote)
+	host, dir := "", remote
+	if i := strings.Index(remote, ":"); i >= 0 {
+		host, dir = remote[:i+1], remote[i+1:]
+	}
+
+	dir = path.Clean("/" + dir)
+	shares := []string{host + dir}
+	for dir != "/" {
+		dir = path.Dir(dir)
+		shares = append(shares, host+dir)
+	}
+	return shares
+}
+
+// normalizeShare lower-cases the host of a share, or share pattern, and drops a trailing dot from it, so that
+// FILER:/secure and filer.:/secure are the share that filer:/secure names.
+func normalizeShare(share string) string {
+	i := strings.Index(share, ":")
+	if i < 0 {
+		return share
+	}
+	return strings.TrimSuffix(strings.ToLower(share[:i]), ".") + share[i:]
+}
+
+func groupMatches(group string, allowed string) bool {
+	if strings.EqualFold(group, allowed) {
+		return true
+	}
+
+	dn, err := ldap.ParseDN(group)
+	if err != nil || len(dn.RDNs) == 0 {
+		return false
+	}
+	for _, attribute := range dn.RDNs[0].Attributes {
+		if strings.EqualFold(attribute.Type, "cn") && strings.EqualFold(attribute.Value, allowed) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package nfsv3driver_test
+
+import (
+	"context"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nfsv3driver"
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SharePolicy", func() {
+	var (
+		env            dockerdriver.Env
+		rules          []nfsv3driver.ShareRule
+		allowUnmatched bool
+		subject        nfsv3driver.ShareAuthorizer
+	)
+
+	BeforeEach(func() {
+		env = driverhttp.NewHttpDriverEnv(lagertest.NewTestLogger("share-policy"), context.TODO())
+
+		rules = []nfsv3driver.ShareRule{
+			{Export: "Filer.:/finance/payroll", Groups: []string{"Payroll"}},
+			{Export: "filer:/finance", Groups: []string{"CN=Finance,OU=Groups,DC=corp,DC=com"}},
+			{Export: "*:/home/*", Groups: []string{"staff"}},
+		}
+		allowUnmatched = true
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		subject, err = nfsv3driver.NewSharePolicy(rules, allowUnmatched)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	table.DescribeTable("authorizes members of the groups allowed for the share",
+		func(remote string, groups []string) {
+			Expect(subject.Authorize(env, remote, "alice", groups)).To(Succeed())
+		},
+		table.Entry("the export itself", "filer:/finance", []string{"CN=Finance,OU=Groups,DC=corp,DC=com"}),
+		table.Entry("a directory beneath the export", "filer:/finance/reports/q3", []string{"CN=Finance,OU=Groups,DC=corp,DC=com"}),
+		table.Entry("a trailing slash", "filer:/finance/", []string{"CN=Finance,OU=Groups,DC=corp,DC=com"}),
+		table.Entry("a group named by its common name", "filer:/finance/payroll", []string{"CN=Payroll,OU=Groups,DC=corp,DC=com"}),
+		table.Entry("a differently cased group", "filer:/finance/payroll", []string{"cn=PAYROLL,ou=Groups,dc=corp,dc=com"}),
+		table.Entry("a wildcard export", "other-filer:/home/alice", []string{"CN=Staff,DC=corp"}),
+		table.Entry("a differently cased rule host", "filer:/finance/payroll", []string{"Payroll"}),
+	)
+
+	table.DescribeTable("governs the share however its host is written",
+		func(remote string) {
+			err := subject.Authorize(env, remote, "mallory", []string{"CN=Engineering,DC=corp"})
+			Expect(err).To(MatchError(nfsv3driver.ShareNotAuthorizedErrorMessage))
+		},
+		table.Entry("upper case", "FILER:/finance"),
+		table.Entry("mixed case beneath the export", "Filer:/finance/reports"),
+		table.Entry("a trailing dot", "filer.:/finance"),
+		table.Entry("upper case with a trailing dot", "FILER.:/finance/payroll"),
+	)
+
+	It("compares paths exactly", func() {
+		Expect(subject.Authorize(env, "filer:/FINANCE", "", nil)).To(Succeed())
+	})
+
+	It("applies the most specific matching export", func() {
+		err := subject.Authorize(env, "filer:/finance/payroll/2024", "alice", []string{"CN=Finance,OU=Groups,DC=corp,DC=com"})
+		Expect(err).To(MatchError(nfsv3driver.ShareNotAuthorizedErrorMessage))
+		Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+	})
+
+	It("refuses users outside the allowed groups", func() {
+		err := subject.Authorize(env, "filer:/finance", "mallory", []string{"CN=Finance,OU=Other,DC=corp,DC=com", "CN=Engineering,DC=corp"})
+		Expect(err).To(MatchError(nfsv3driver.ShareNotAuthorizedErrorMessage))
+	})
+
+	It("requires a directory user for a governed share", func() {
+		err := subject.Authorize(env, "filer:/finance", "", nil)
+		Expect(err).To(MatchError(nfsv3driver.ShareRequiresUsernameErrorMessage))
+		Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+	})
+
+	It("allows shares that no rule governs", func() {
+		Expect(subject.Authorize(env, "filer:/public", "", nil)).To(Succeed())
+	})
+
+	Context("when unmatched shares are denied", func() {
+		BeforeEach(func() {
+			allowUnmatched = false
+		})
+
+		It("refuses shares that no rule governs", func() {
+			err := subject.Authorize(env, "filer:/public", "alice", []string{"CN=Finance,OU=Groups,DC=corp,DC=com"})
+			Expect(err).To(MatchError(nfsv3driver.ShareNotPermittedErrorMessage))
+			Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+		})
+	})
+
+	table.DescribeTable("rejects invalid rules",
+		func(rule nfsv3driver.ShareRule, message string) {
+			_, err := nfsv3driver.NewSharePolicy([]nfsv3driver.ShareRule{rule}, true)
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		table.Entry("empty export", nfsv3driver.ShareRule{Groups: []string{"staff"}}, "export pattern is empty"),
+		table.Entry("malformed export", nfsv3driver.ShareRule{Export: "filer:/[", Groups: []string{"staff"}}, "invalid export pattern"),
+		table.Entry("no groups", nfsv3driver.ShareRule{Export: "filer:/finance"}, "no groups are allowed"),
+	)
+})
@@ -0,0 +1,199 @@
+package nfsv3driver
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/dockerdriver"
+)
+
+const (
+	InvalidObjectSidErrorMessage = "User has no valid objectSid to map to a uid"
+	RidOutOfRangeErrorMessage    = "User's id falls outside of the configured id mapping range"
+)
+
+// IdMapper derives POSIX ids for directory users that have no RFC2307 uidNumber and gidNumber.
+type IdMapper interface {
+	Map(objectSid []byte, primaryGroupID string) (uid string, gid string, err error)
+}
+
+// SidIdMapperConfig mirrors sssd's ldap_idmap_range_min, ldap_idmap_range_max, ldap_idmap_range_size and
+// ldap_idmap_default_domain_sid settings. DomainSlices pins domains to slices, for when sssd had to move a domain
+// off the slice its hash selects because of a collision.
+type SidIdMapperConfig struct {
+	RangeMin         uint32
+	RangeMax         uint32
+	RangeSize        uint32
+	DefaultDomainSid string
+	DomainSlices     map[string]uint32
+}
+
+type sidIdMapper struct {
+	config SidIdMapperConfig
+	slices uint32
+}
+
+// NewSidIdMapper returns a mapper that assigns ids the way sssd does with ldap_id_mapping enabled, so that a user
+// gets the same uid from the driver as on hosts joined to the domain with sssd. The id range is divided into
+// slices of RangeSize ids; each domain gets the slice selected by a hash of its SID, and a user's id is the start
+// of that slice plus the RID at the end of their objectSid.
+func NewSidIdMapper(config SidIdMapperConfig) (IdMapper, error) {
+	if config.RangeSize == 0 || config.RangeMax <= config.RangeMin {
+		return nil, errors.New("id mapping range is empty")
+	}
+
+	slices := (config.RangeMax - config.RangeMin) / config.RangeSize
+	if slices == 0 {
+		return nil, errors.New("id mapping range is smaller than one slice")
+	}
+
+	for sid, slice := range config.DomainSlices {
+		if !isSidString(sid) {
+			return nil, fmt.Errorf("invalid domain SID '%s'", sid)
+		}
+		if slice >= slices {
+			return nil, fmt.Errorf("slice %d of domain '%s' is outside of the %d slices in the id mapping range", slice, sid, slices)
+		}
+	}
+	if config.DefaultDomainSid != "" {
+		if !isSidString(config.DefaultDomainSid) {
+			return nil, fmt.Errorf("invalid default domain SID '%s'", config.DefaultDomainSid)
+		}
+	}
+
+	return &sidIdMapper{config: config, slices: slices}, nil
+}
+
+func (m *sidIdMapper) Map(objectSid []byte, primaryGroupID string) (string, string, error) {
+	domainSid, rid, err := parseBinarySid(objectSid)
+	if err != nil {
+		return "", "", dockerdriver.SafeError{SafeDescription: InvalidObjectSidErrorMessage}
+	}
+
+	uid, err := m.id(domainSid, rid)
+	if err != nil {
+		return "", "", err
+	}
+
+	// the primary group is in the same domain as the user, and is "Domain Users" unless changed
+	gid := uid
+	if primaryGroupID != "" {
+		groupRid, err := strconv.ParseUint(primaryGroupID, 10, 32)
+		if err != nil {
+			return "", "", dockerdriver.SafeError{SafeDescription: "User has an invalid primaryGroupID"}
+		}
+		gid, err = m.id(domainSid, uint32(groupRid))
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	return strconv.FormatUint(uint64(uid), 10), strconv.FormatUint(uint64(gid), 10), nil
+}
+
+func (m *sidIdMapper) id(domainSid string, rid uint32) (uint32, error) {
+	if rid >= m.config.RangeSize {
+		return 0, dockerdriver.SafeError{SafeDescription: RidOutOfRangeErrorMessage}
+	}
+
+	return m.config.RangeMin + m.slice(domainSid)*m.config.RangeSize + rid, nil
+}
+
+func (m *sidIdMapper) slice(domainSid string) uint32 {
+	if slice, ok := m.config.DomainSlices[domainSid]; ok {
+		return slice
+	}
+	if domainSid == m.config.DefaultDomainSid {
+		return 0
+	}
+
+	// sssd hashes the textual domain SID with MurmurHash3 and a fixed seed
+	return murmur3([]byte(domainSid), 0xdeadbeef) % m.slices
+}
+
+// parseBinarySid splits an objectSid in its binary wire format into the textual SID of the domain and the RID.
+func parseBinarySid(sid []byte) (string, uint32, error) {
+	if len(sid) < 8 || sid[0] != 1 {
+		return "", 0, errors.New("invalid SID")
+	}
+
+	count := int(sid[1])
+	if count < 2 || len(sid) != 8+4*count {
+		return "", 0, errors.New("invalid SID")
+	}
+
+	var authority uint64
+	for _, b := range sid[2:8] {
+		authority = authority<<8 | uint64(b)
+	}
+
+	parts := []string{"S", "1", strconv.FormatUint(authority, 10)}
+	for i := 0; i < count-1; i++ {
+		parts = append(parts, strconv.FormatUint(uint64(binary.LittleEndian.Uint32(sid[8+4*i:])), 10))
+	}
+	rid := binary.LittleEndian.Uint32(sid[8+4*(count-1):])
+
+	return strings.Join(parts, "-"), rid, nil
+}
+
+func isSidString(sid string) bool {
+	parts := strings.Split(sid, "-")
+	if len(parts) < 3 || parts[0] != "S" || parts[1] != "1" {
+		return false
+	}
+
+	for _, part := range parts[2:] {
+		if _, err := strconv.ParseUint(part, 10, 64); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// murmur3 is the 32 bit x86 variant of MurmurHash3.
+func murmur3(data []byte, seed uint32) uint32 {
+	const c1, c2 = 0xcc9e2d51, 0x1b873593
+
+	h := seed
+	blocks := len(data) / 4
+	for i := 0; i < blocks; i++ {
+		k := binary.LittleEndian.Uint32(data[4*i:])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+
+	var k uint32
+	tail := data[4*blocks:]
+	switch len(tail) {
+	case 3:
+		k ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(tail[0])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+
+	h ^= uint32(len(data))
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+
+	return h
+}
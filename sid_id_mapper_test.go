@@ -0,0 +1,121 @@
+package nfsv3driver_test
+
+import (
+	"encoding/binary"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/nfsv3driver"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// binarySid encodes S-1-5-<subAuthorities...> in the objectSid wire format.
+func binarySid(subAuthorities ...uint32) []byte {
+	sid := []byte{1, byte(len(subAuthorities)), 0, 0, 0, 0, 0, 5}
+	for _, subAuthority := range subAuthorities {
+		b := make([]byte, 4)
+		binary.LittleEndian.PutUint32(b, subAuthority)
+		sid = append(sid, b...)
+	}
+	return sid
+}
+
+var _ = Describe("SidIdMapper", func() {
+	var (
+		config  nfsv3driver.SidIdMapperConfig
+		subject nfsv3driver.IdMapper
+		err     error
+	)
+
+	BeforeEach(func() {
+		// sssd's defaults
+		config = nfsv3driver.SidIdMapperConfig{
+			RangeMin:  200000,
+			RangeMax:  2000200000,
+			RangeSize: 200000,
+		}
+	})
+
+	JustBeforeEach(func() {
+		subject, err = nfsv3driver.NewSidIdMapper(config)
+	})
+
+	It("maps the RID into the slice that sssd selects for the domain", func() {
+		Expect(err).NotTo(HaveOccurred())
+
+		uid, gid, err := subject.Map(binarySid(21, 3623811015, 3361044348, 30300820, 1013), "513")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(uid).To(Equal("674001013"))
+		Expect(gid).To(Equal("674000513"))
+	})
+
+	It("uses the user's own id as gid when there is no primaryGroupID", func() {
+		uid, gid, err := subject.Map(binarySid(21, 3623811015, 3361044348, 30300820, 1013), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gid).To(Equal(uid))
+	})
+
+	Context("when the domain is the default domain", func() {
+		BeforeEach(func() {
+			config.DefaultDomainSid = "S-1-5-21-3623811015-3361044348-30300820"
+		})
+
+		It("maps it to the first slice", func() {
+			uid, gid, err := subject.Map(binarySid(21, 3623811015, 3361044348, 30300820, 1013), "513")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(uid).To(Equal("201013"))
+			Expect(gid).To(Equal("200513"))
+		})
+	})
+
+	Context("when the domain is pinned to a slice", func() {
+		BeforeEach(func() {
+			config.DomainSlices = map[string]uint32{"S-1-5-21-3623811015-3361044348-30300820": 7}
+		})
+
+		It("maps it to that slice", func() {
+			uid, _, err := subject.Map(binarySid(21, 3623811015, 3361044348, 30300820, 1013), "513")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(uid).To(Equal("1601013"))
+		})
+	})
+
+	It("rejects RIDs that do not fit in a slice", func() {
+		_, _, err := subject.Map(binarySid(21, 3623811015, 3361044348, 30300820, 200000), "513")
+		Expect(err).To(MatchError(nfsv3driver.RidOutOfRangeErrorMessage))
+		Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+	})
+
+	It("rejects a missing or malformed objectSid", func() {
+		_, _, err := subject.Map(nil, "513")
+		Expect(err).To(MatchError(nfsv3driver.InvalidObjectSidErrorMessage))
+
+		_, _, err = subject.Map(binarySid(21, 3623811015, 3361044348, 30300820, 1013)[:20], "513")
+		Expect(err).To(MatchError(nfsv3driver.InvalidObjectSidErrorMessage))
+	})
+
+	It("rejects a malformed primaryGroupID", func() {
+		_, _, err := subject.Map(binarySid(21, 3623811015, 3361044348, 30300820, 1013), "users")
+		Expect(err).To(MatchError("User has an invalid primaryGroupID"))
+	})
+
+	Context("when the range is smaller than a slice", func() {
+		BeforeEach(func() {
+			config.RangeMax = config.RangeMin + 1000
+		})
+
+		It("fails", func() {
+			Expect(err).To(MatchError("id mapping range is smaller than one slice"))
+		})
+	})
+
+	Context("when a pinned slice is outside of the range", func() {
+		BeforeEach(func() {
+			config.DomainSlices = map[string]uint32{"S-1-5-21-1-2-3": 10000}
+		})
+
+		It("fails", func() {
+			Expect(err).To(MatchError(ContainSubstring("outside of the 10000 slices")))
+		})
+	})
+})
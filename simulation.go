@@ -0,0 +1,295 @@
+package nfsv3driver
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/goshims/osshim"
+	"code.cloudfoundry.org/nfsv3driver/driveradmin"
+	"code.cloudfoundry.org/volumedriver/invoker"
+	"code.cloudfoundry.org/volumedriver/mountchecker"
+)
+
+// TranscriptLimit is the number of commands a CommandTranscript keeps, the oldest being dropped first.
+const TranscriptLimit = 1000
+
+// CommandTranscript records the commands the mounter runs and the changes it makes to the file system. In a
+// simulation none of them are run: the commands that change the host succeed, `mountpoint` and the mount checkers
+// find the targets that were mounted earlier in the simulation and `pgrep` finds no mapfs processes, so that the
+// driver can be exercised end to end without root or an NFS server.
+type CommandTranscript struct {
+	clock     clock.Clock
+	simulate  bool
+	mapfsPath string
+
+	lock    sync.Mutex
+	entries []driveradmin.TranscriptEntry
+	dropped int
+	mounted map[string]bool
+}
+
+func NewCommandTranscript(clock clock.Clock, simulate bool, mapfsPath string) *CommandTranscript {
+	return &CommandTranscript{
+		clock:     clock,
+		simulate:  simulate,
+		mapfsPath: mapfsPath,
+		mounted:   map[string]bool{},
+	}
+}
+
+// TranscriptEntries returns the recorded commands, oldest first.
+func (t *CommandTranscript) TranscriptEntries() []driveradmin.TranscriptEntry {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return append([]driveradmin.TranscriptEntry{}, t.entries...)
+}
+
+// Invoker returns an invoker that records the commands it is given and runs them with invoker, unless this is a
+// simulation.
+func (t *CommandTranscript) Invoker(invoker invoker.Invoker) invoker.Invoker {
+	return &transcriptInvoker{invoker: invoker, transcript: t}
+}
+
+// Os returns an Os that records the directories os creates, removes and changes the owner of, and leaves them alone
+// in a simulation.
+func (t *CommandTranscript) Os(os osshim.Os) osshim.Os {
+	return &transcriptOs{Os: os, transcript: t}
+}
+
+// MountChecker returns a MountChecker that finds the mounts checker finds, or in a simulation the targets that were
+// mounted earlier in the simulation.
+func (t *CommandTranscript) MountChecker(checker mountchecker.MountChecker) mountchecker.MountChecker {
+	if !t.simulate {
+		return checker
+	}
+	return &simulatedMountChecker{transcript: t}
+}
+
+// KerberosClient returns a KerberosClient that records the kinit and kdestroy commands client runs, and runs none
+// of them in a simulation.
+func (t *CommandTranscript) KerberosClient(client KerberosClient, kinitPath, kdestroyPath string, renewableLifetime time.Duration) KerberosClient {
+	return &transcriptKerberosClient{
+		client:            client,
+		kinitPath:         kinitPath,
+		kdestroyPath:      kdestroyPath,
+		renewableLifetime: renewableLifetime,
+		transcript:        t,
+	}
+}
+
+func (t *CommandTranscript) start(command []string, stdin string) int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.entries = append(t.entries, driveradmin.TranscriptEntry{Time: t.clock.Now(), Command: command, Stdin: stdin})
+	if len(t.entries) > TranscriptLimit {
+		t.entries = t.entries[len(t.entries)-TranscriptLimit:]
+		t.dropped++
+	}
+	return t.dropped + len(t.entries) - 1
+}
+
+func (t *CommandTranscript) finish(index int, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if i := index - t.dropped; i >= 0 {
+		t.entries[i].Err = err.Error()
+	}
+	return err
+}
+
+// run records the command and runs it with do, unless this is a simulation.
+func (t *CommandTranscript) run(command []string, stdin string, do func() error) error {
+	index := t.start(command, stdin)
+	if t.simulate {
+		return nil
+	}
+	return t.finish(index, do())
+}
+
+// simulated returns what the command would have done to a host on which only the simulated commands had been run.
+func (t *CommandTranscript) simulated(executable string, args []string) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	switch {
+	case executable == "mount" && len(args) > 0:
+		t.mounted[filepath.Clean(args[len(args)-1])] = true
+	case executable == t.mapfsPath && len(args) > 1:
+		t.mounted[filepath.Clean(args[len(args)-2])] = true
+	case executable == "umount" && len(args) > 0:
+		delete(t.mounted, filepath.Clean(args[len(args)-1]))
+	case executable == "mountpoint" && len(args) > 0:
+		if !t.mounted[filepath.Clean(args[len(args)-1])] {
+			return fmt.Errorf("%s is not a mountpoint", args[len(args)-1])
+		}
+	case executable == "pgrep":
+		return errors.New("no processes found")
+	}
+	return nil
+}
+
+type transcriptInvoker struct {
+	invoker    invoker.Invoker
+	transcript *CommandTranscript
+}
+
+func (i *transcriptInvoker) Invoke(env dockerdriver.Env, executable string, args []string, envVars ...string) invoker.InvokeResult {
+	index := i.transcript.start(append([]string{executable}, args...), "")
+	if i.transcript.simulate {
+		return simulatedResult{err: i.transcript.finish(index, i.transcript.simulated(executable, args))}
+	}
+
+	return &transcriptResult{
+		InvokeResult: i.invoker.Invoke(env, executable, args, envVars...),
+		transcript:   i.transcript,
+		index:        index,
+	}
+}
+
+type transcriptResult struct {
+	invoker.InvokeResult
+	transcript *CommandTranscript
+	index      int
+}
+
+func (r *transcriptResult) Wait() error {
+	return r.transcript.finish(r.index, r.InvokeResult.Wait())
+}
+
+func (r *transcriptResult) WaitFor(output string, timeout time.Duration) error {
+	return r.transcript.finish(r.index, r.InvokeResult.WaitFor(output, timeout))
+}
+
+// simulatedResult is the result of a command that was not run.
+type simulatedResult struct {
+	err error
+}
+
+func (r simulatedResult) StdError() string  { return "" }
+func (r simulatedResult) StdOutput() string { return "" }
+
+func (r simulatedResult) Wait() error {
+	return r.err
+}
+
+func (r simulatedResult) WaitFor(string, time.Duration) error {
+	return r.err
+}
+
+// transcriptOs records the changes made to the file system as the commands that would make them.
+type transcriptOs struct {
+	osshim.Os
+	transcript *CommandTranscript
+}
+
+func (o *transcriptOs) MkdirAll(path string, perm os.FileMode) error {
+	return o.transcript.run([]string{"mkdir", "-p", "-m", fmt.Sprintf("%o", perm), path}, "", func() error {
+		return o.Os.MkdirAll(path, perm)
+	})
+}
+
+func (o *transcriptOs) Remove(name string) error {
+	return o.transcript.run([]string{"rm", "-d", name}, "", func() error {
+		return o.Os.Remove(name)
+	})
+}
+
+func (o *transcriptOs) Chown(name string, uid, gid int) error {
+	owner := strconv.Itoa(uid)
+	if gid >= 0 {
+		owner = owner + ":" + strconv.Itoa(gid)
+	}
+	return o.transcript.run([]string{"chown", owner, name}, "", func() error {
+		return o.Os.Chown(name, uid, gid)
+	})
+}
+
+func (o *transcriptOs) Lchown(name string, uid, gid int) error {
+	owner := strconv.Itoa(uid)
+	if gid >= 0 {
+		owner = owner + ":" + strconv.Itoa(gid)
+	}
+	return o.transcript.run([]string{"chown", "-h", owner, name}, "", func() error {
+		return o.Os.Lchown(name, uid, gid)
+	})
+}
+
+func (o *transcriptOs) Rename(oldpath, newpath string) error {
+	return o.transcript.run([]string{"mv", "-T", oldpath, newpath}, "", func() error {
+		return o.Os.Rename(oldpath, newpath)
+	})
+}
+
+// simulatedMountChecker answers from the mounts made in a simulation, in place of /proc/mounts.
+type simulatedMountChecker struct {
+	transcript *CommandTranscript
+}
+
+func (c *simulatedMountChecker) Exists(mountPath string) (bool, error) {
+	c.transcript.lock.Lock()
+	defer c.transcript.lock.Unlock()
+
+	return c.transcript.mounted[filepath.Clean(mountPath)], nil
+}
+
+func (c *simulatedMountChecker) List(pattern *regexp.Regexp) ([]string, error) {
+	c.transcript.lock.Lock()
+	defer c.transcript.lock.Unlock()
+
+	mounts := []string{}
+	for mount := range c.transcript.mounted {
+		if pattern.MatchString(mount) {
+			mounts = append(mounts, mount)
+		}
+	}
+	sort.Strings(mounts)
+	return mounts, nil
+}
+
+type transcriptKerberosClient struct {
+	client            KerberosClient
+	kinitPath         string
+	kdestroyPath      string
+	renewableLifetime time.Duration
+	transcript        *CommandTranscript
+}
+
+func (c *transcriptKerberosClient) Kinit(env dockerdriver.Env, principal, password, ccache string) error {
+	args := []string{c.kinitPath, "-c", ccache}
+	if c.renewableLifetime > 0 {
+		args = append(args, "-r", fmt.Sprintf("%ds", int64(c.renewableLifetime/time.Second)))
+	}
+	args = append(args, principal)
+
+	return c.transcript.run(args, "the user's password", func() error {
+		return c.client.Kinit(env, principal, password, ccache)
+	})
+}
+
+func (c *transcriptKerberosClient) Renew(env dockerdriver.Env, ccache string) error {
+	return c.transcript.run([]string{c.kinitPath, "-R", "-c", ccache}, "", func() error {
+		return c.client.Renew(env, ccache)
+	})
+}
+
+func (c *transcriptKerberosClient) Destroy(env dockerdriver.Env, ccache string) error {
+	return c.transcript.run([]string{c.kdestroyPath, "-c", ccache}, "", func() error {
+		return c.client.Destroy(env, ccache)
+	})
+}
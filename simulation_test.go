@@ -0,0 +1,191 @@
+package nfsv3driver_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/goshims/osshim"
+	"code.cloudfoundry.org/goshims/osshim/os_fake"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nfsv3driver"
+	"code.cloudfoundry.org/nfsv3driver/driveradmin"
+	"code.cloudfoundry.org/nfsv3driver/nfsdriverfakes"
+	"code.cloudfoundry.org/volumedriver/invoker"
+	"code.cloudfoundry.org/volumedriver/invokerfakes"
+	"code.cloudfoundry.org/volumedriver/volumedriverfakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CommandTranscript", func() {
+	const mapfsPath = "/var/vcap/packages/mapfs/bin/mapfs"
+	const target = "/var/vcap/data/volumes/nfs/vol1"
+
+	var (
+		env              dockerdriver.Env
+		fakeClock        *fakeclock.FakeClock
+		fakeInvoker      *invokerfakes.FakeInvoker
+		fakeInvokeResult *invokerfakes.FakeInvokeResult
+		fakeOs           *os_fake.FakeOs
+		fakeKinit        *nfsdriverfakes.FakeKerberosClient
+
+		simulate   bool
+		transcript *nfsv3driver.CommandTranscript
+
+		invoker invoker.Invoker
+		os      osshim.Os
+		kinit   nfsv3driver.KerberosClient
+	)
+
+	BeforeEach(func() {
+		env = driverhttp.NewHttpDriverEnv(lagertest.NewTestLogger("transcript"), context.TODO())
+		fakeClock = fakeclock.NewFakeClock(time.Unix(1600000000, 0))
+		fakeInvoker = &invokerfakes.FakeInvoker{}
+		fakeInvokeResult = &invokerfakes.FakeInvokeResult{}
+		fakeInvoker.InvokeReturns(fakeInvokeResult)
+		fakeOs = &os_fake.FakeOs{}
+		fakeKinit = &nfsdriverfakes.FakeKerberosClient{}
+
+		simulate = false
+	})
+
+	JustBeforeEach(func() {
+		transcript = nfsv3driver.NewCommandTranscript(fakeClock, simulate, mapfsPath)
+		invoker = transcript.Invoker(fakeInvoker)
+		os = transcript.Os(fakeOs)
+		kinit = transcript.KerberosClient(fakeKinit, "/usr/bin/kinit", "/usr/bin/kdestroy", 24*time.Hour)
+	})
+
+	commands := func() [][]string {
+		var commands [][]string
+		for _, entry := range transcript.TranscriptEntries() {
+			commands = append(commands, entry.Command)
+		}
+		return commands
+	}
+
+	It("runs the commands and records them", func() {
+		fakeInvokeResult.WaitReturns(errors.New("exit status 32"))
+
+		err := invoker.Invoke(env, "umount", []string{"-l", target}).Wait()
+		Expect(err).To(MatchError("exit status 32"))
+		Expect(fakeInvoker.InvokeCallCount()).To(Equal(1))
+
+		Expect(transcript.TranscriptEntries()).To(Equal([]driveradmin.TranscriptEntry{{
+			Time:    fakeClock.Now(),
+			Command: []string{"umount", "-l", target},
+			Err:     "exit status 32",
+		}}))
+	})
+
+	It("makes the changes to the file system and records them", func() {
+		Expect(os.MkdirAll(target, 0777)).To(Succeed())
+		Expect(os.Chown(target, 1000, 1001)).To(Succeed())
+		Expect(os.Lchown(target, 1000, -1)).To(Succeed())
+		Expect(os.Rename(target, target+"2")).To(Succeed())
+		Expect(os.Remove(target)).To(Succeed())
+
+		Expect(fakeOs.MkdirAllCallCount()).To(Equal(1))
+		Expect(fakeOs.ChownCallCount()).To(Equal(1))
+		Expect(fakeOs.LchownCallCount()).To(Equal(1))
+		Expect(fakeOs.RenameCallCount()).To(Equal(1))
+		Expect(fakeOs.RemoveCallCount()).To(Equal(1))
+		Expect(commands()).To(Equal([][]string{
+			{"mkdir", "-p", "-m", "777", target},
+			{"chown", "1000:1001", target},
+			{"chown", "-h", "1000", target},
+			{"mv", "-T", target, target + "2"},
+			{"rm", "-d", target},
+		}))
+	})
+
+	It("records the Kerberos commands without the password", func() {
+		Expect(kinit.Kinit(env, "alice@CORP.EXAMPLE.COM", "secret", "FILE:/tmp/krb5cc_1000")).To(Succeed())
+		Expect(fakeKinit.KinitCallCount()).To(Equal(1))
+
+		entries := transcript.TranscriptEntries()
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Command).To(Equal([]string{"/usr/bin/kinit", "-c", "FILE:/tmp/krb5cc_1000", "-r", "86400s", "alice@CORP.EXAMPLE.COM"}))
+		Expect(entries[0].Stdin).To(Equal("the user's password"))
+	})
+
+	It("keeps only the latest commands", func() {
+		for i := 0; i < nfsv3driver.TranscriptLimit+1; i++ {
+			invoker.Invoke(env, "pkill", []string{"mapfs"}).Wait()
+		}
+		fakeInvokeResult.WaitReturns(errors.New("exit status 1"))
+		invoker.Invoke(env, "mountpoint", []string{"-q", target}).Wait()
+
+		entries := transcript.TranscriptEntries()
+		Expect(entries).To(HaveLen(nfsv3driver.TranscriptLimit))
+		Expect(entries[len(entries)-1].Command).To(Equal([]string{"mountpoint", "-q", target}))
+		Expect(entries[len(entries)-1].Err).To(Equal("exit status 1"))
+	})
+
+	It("finds mounts with the mount checker it is given", func() {
+		fakeChecker := &volumedriverfakes.FakeMountChecker{}
+		fakeChecker.ExistsReturns(true, nil)
+
+		Expect(transcript.MountChecker(fakeChecker).Exists(target)).To(BeTrue())
+		Expect(fakeChecker.ExistsArgsForCall(0)).To(Equal(target))
+	})
+
+	Context("in a simulation", func() {
+		BeforeEach(func() {
+			simulate = true
+		})
+
+		It("runs nothing", func() {
+			Expect(invoker.Invoke(env, "pkill", []string{"mapfs"}).Wait()).To(Succeed())
+			Expect(os.MkdirAll(target, 0777)).To(Succeed())
+			Expect(kinit.Destroy(env, "FILE:/tmp/krb5cc_1000")).To(Succeed())
+
+			Expect(fakeInvoker.InvokeCallCount()).To(Equal(0))
+			Expect(fakeOs.MkdirAllCallCount()).To(Equal(0))
+			Expect(fakeKinit.DestroyCallCount()).To(Equal(0))
+			Expect(commands()).To(Equal([][]string{
+				{"pkill", "mapfs"},
+				{"mkdir", "-p", "-m", "777", target},
+				{"/usr/bin/kdestroy", "-c", "FILE:/tmp/krb5cc_1000"},
+			}))
+		})
+
+		It("finds the targets mounted earlier in the simulation", func() {
+			Expect(invoker.Invoke(env, "mountpoint", []string{"-q", target}).Wait()).To(MatchError(target + " is not a mountpoint"))
+
+			Expect(invoker.Invoke(env, "mount", []string{"-t", "nfs", "-o", "hard", "filer:/export", target + "_mapfs"}).Wait()).To(Succeed())
+			Expect(invoker.Invoke(env, mapfsPath, []string{"-uid", "1000", "-gid", "1001", target, target + "_mapfs"}).WaitFor("Mounted!", time.Minute)).To(Succeed())
+			Expect(invoker.Invoke(env, "mountpoint", []string{"-q", target}).Wait()).To(Succeed())
+
+			Expect(invoker.Invoke(env, "umount", []string{"-l", target}).Wait()).To(Succeed())
+			Expect(invoker.Invoke(env, "mountpoint", []string{"-q", target}).Wait()).To(HaveOccurred())
+
+			entries := transcript.TranscriptEntries()
+			Expect(entries[0].Err).To(Equal(target + " is not a mountpoint"))
+			Expect(entries[3].Err).To(BeEmpty())
+		})
+
+		It("lets the mount checkers find the targets mounted earlier in the simulation", func() {
+			checker := transcript.MountChecker(&volumedriverfakes.FakeMountChecker{})
+			Expect(checker.Exists(target)).To(BeFalse())
+
+			Expect(invoker.Invoke(env, "mount", []string{"-t", "nfs", "-o", "hard", "filer:/export", target + "_mapfs"}).Wait()).To(Succeed())
+			Expect(invoker.Invoke(env, mapfsPath, []string{"-uid", "1000", "-gid", "1001", target, target + "_mapfs"}).WaitFor("Mounted!", time.Minute)).To(Succeed())
+			Expect(checker.Exists(target + "/")).To(BeTrue())
+			Expect(checker.List(regexp.MustCompile("_mapfs$"))).To(Equal([]string{target + "_mapfs"}))
+
+			Expect(invoker.Invoke(env, "umount", []string{"-l", target}).Wait()).To(Succeed())
+			Expect(checker.Exists(target)).To(BeFalse())
+			Expect(checker.Exists(target + "_mapfs")).To(BeTrue())
+		})
+
+		It("finds no mapfs processes", func() {
+			Expect(invoker.Invoke(env, "pgrep", []string{"mapfs"}).Wait()).To(HaveOccurred())
+		})
+	})
+})
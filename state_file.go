@@ -0,0 +1,221 @@
+package nfsv3driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/goshims/ioutilshim"
+	"code.cloudfoundry.org/goshims/osshim"
+	"code.cloudfoundry.org/goshims/syscallshim"
+	"code.cloudfoundry.org/lager"
+)
+
+// DriverStateFileName is the name volumedriver gives its state file in the mount directory.
+const DriverStateFileName = "driver-state.json"
+
+// DriverStateVersion is the version of the state file format written by this driver. Version 0 is the bare map of
+// volumes that volumedriver writes itself.
+const DriverStateVersion = 1
+
+type driverState struct {
+	Version int             `json:"version"`
+	Volumes json.RawMessage `json:"volumes"`
+}
+
+// driverStateMigrations upgrade the volumes of a state file from the version they are keyed by to the next one.
+var driverStateMigrations = map[int]func(volumes json.RawMessage) (json.RawMessage, error){
+	0: func(volumes json.RawMessage) (json.RawMessage, error) { return volumes, nil },
+}
+
+type stateFileIoutil struct {
+	ioutilshim.Ioutil
+	logger  lager.Logger
+	os      osshim.Os
+	syscall syscallshim.Syscall
+	clock   clock.Clock
+	path    string
+}
+
+// NewStateFileIoutil returns an Ioutil for volumedriver that takes over the reading and writing of its state file
+// at path, and passes every other call through to ioutil. The state is written to a temporary file, synced and
+// renamed into place with owner-only permissions, inside a versioned envelope. Older formats are migrated when
+// read, and a file that cannot be read is moved aside and reported instead of being overwritten. The state is then
+// recovered from a temporary file left behind by a write that was interrupted, if there is one.
+func NewStateFileIoutil(logger lager.Logger, ioutil ioutilshim.Ioutil, os osshim.Os, syscall syscallshim.Syscall, clock clock.Clock, path string) ioutilshim.Ioutil {
+	return &stateFileIoutil{
+		Ioutil:  ioutil,
+		logger:  logger.Session("state-file", lager.Data{"path": path}),
+		os:      os,
+		syscall: syscall,
+		clock:   clock,
+		path:    path,
+	}
+}
+
+func (s *stateFileIoutil) ReadFile(filename string) ([]byte, error) {
+	if !s.isStateFile(filename) {
+		return s.Ioutil.ReadFile(filename)
+	}
+
+	logger := s.logger.Session("read")
+
+	contents, err := s.Ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	volumes, version, err := decodeDriverState(contents)
+	recovered := false
+	if err != nil {
+		quarantine := fmt.Sprintf("%s.corrupt-%s", s.path, s.clock.Now().UTC().Format("20060102T150405Z"))
+		logger.Error("state-file-quarantined", err, lager.Data{"quarantine": quarantine})
+		if renameErr := s.os.Rename(s.path, quarantine); renameErr != nil {
+			logger.Error("quarantine-failed", renameErr)
+		}
+
+		volumes, version, recovered = s.recoverTemporary(logger)
+		if !recovered {
+			return nil, err
+		}
+	}
+
+	if recovered {
+		if err := s.write(volumes); err != nil {
+			logger.Error("write-recovered-state-failed", err)
+		}
+	} else if version < DriverStateVersion {
+		logger.Info("state-file-migrated", lager.Data{"from-version": version, "to-version": DriverStateVersion})
+		if err := s.write(volumes); err != nil {
+			logger.Error("write-migrated-state-failed", err)
+		}
+	}
+
+	return volumes, nil
+}
+
+// recoverTemporary returns the volumes of the temporary state file, which is only left behind when the driver
+// stopped after writing and syncing it but before renaming it into place, and so holds the newest state there is.
+func (s *stateFileIoutil) recoverTemporary(logger lager.Logger) (json.RawMessage, int, bool) {
+	tmp := s.path + ".tmp"
+
+	contents, err := s.Ioutil.ReadFile(tmp)
+	if err != nil {
+		return nil, 0, false
+	}
+
+	volumes, version, err := decodeDriverState(contents)
+	if err != nil {
+		logger.Error("temporary-state-file-unusable", err, lager.Data{"temporary": tmp})
+		return nil, 0, false
+	}
+
+	logger.Info("state-file-recovered", lager.Data{"from": tmp})
+	return volumes, version, true
+}
+
+func (s *stateFileIoutil) WriteFile(filename string, data []byte, perm os.FileMode) error {
+	if !s.isStateFile(filename) {
+		return s.Ioutil.WriteFile(filename, data, perm)
+	}
+
+	return s.write(data)
+}
+
+func (s *stateFileIoutil) write(volumes []byte) error {
+	contents, err := json.Marshal(driverState{Version: DriverStateVersion, Volumes: volumes})
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	_ = s.os.Remove(tmp)
+
+	file, err := s.os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(contents)
+	if err == nil {
+		err = s.syscall.Fsync(int(file.Fd()))
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = s.os.Remove(tmp)
+		return err
+	}
+
+	err = s.os.Rename(tmp, s.path)
+	if err != nil {
+		return err
+	}
+
+	// make the rename itself durable
+	dir, err := s.os.Open(filepath.Dir(s.path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return s.syscall.Fsync(int(dir.Fd()))
+}
+
+func (s *stateFileIoutil) isStateFile(filename string) bool {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return false
+	}
+	path, err := filepath.Abs(s.path)
+	if err != nil {
+		return false
+	}
+	return abs == path
+}
+
+// decodeDriverState returns the volumes in a state file, migrated to the current version, and the version the file
+// was written in.
+func decodeDriverState(contents []byte) (json.RawMessage, int, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(contents, &fields); err != nil {
+		return nil, 0, fmt.Errorf("state file is not valid JSON: %s", err.Error())
+	}
+
+	// version 0 files are a map of volume names to objects, so a numeric version field marks an envelope
+	state := driverState{Version: 0, Volumes: contents}
+	if version, ok := fields["version"]; ok && json.Unmarshal(version, new(int)) == nil {
+		if err := json.Unmarshal(contents, &state); err != nil {
+			return nil, 0, fmt.Errorf("state file is not valid: %s", err.Error())
+		}
+	}
+
+	if state.Version > DriverStateVersion {
+		return nil, 0, fmt.Errorf("state file version %d is newer than the supported version %d", state.Version, DriverStateVersion)
+	}
+	if state.Version < 0 {
+		return nil, 0, fmt.Errorf("state file version %d is not valid", state.Version)
+	}
+
+	volumes := state.Volumes
+	for version := state.Version; version < DriverStateVersion; version++ {
+		var err error
+		volumes, err = driverStateMigrations[version](volumes)
+		if err != nil {
+			return nil, 0, fmt.Errorf("state file cannot be migrated from version %d: %s", version, err.Error())
+		}
+	}
+
+	var entries map[string]map[string]interface{}
+	if err := json.Unmarshal(volumes, &entries); err != nil {
+		return nil, 0, fmt.Errorf("state file volumes are not valid: %s", err.Error())
+	}
+	if entries == nil {
+		volumes = json.RawMessage("{}")
+	}
+
+	return volumes, state.Version, nil
+}
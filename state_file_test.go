@@ -0,0 +1,207 @@
+package nfsv3driver_test
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/goshims/ioutilshim"
+	"code.cloudfoundry.org/goshims/ioutilshim/ioutil_fake"
+	"code.cloudfoundry.org/goshims/osshim/os_fake"
+	"code.cloudfoundry.org/goshims/syscallshim/syscall_fake"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nfsv3driver"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("StateFileIoutil", func() {
+	const statePath = "/var/vcap/data/volumes/nfs/driver-state.json"
+
+	var (
+		logger      *lagertest.TestLogger
+		fakeIoutil  *ioutil_fake.FakeIoutil
+		fakeOs      *os_fake.FakeOs
+		fakeSyscall *syscall_fake.FakeSyscall
+		fakeFile    *os_fake.FakeFile
+		fakeDir     *os_fake.FakeFile
+		fakeClock   *fakeclock.FakeClock
+		subject     ioutilshim.Ioutil
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("state-file")
+		fakeIoutil = &ioutil_fake.FakeIoutil{}
+		fakeOs = &os_fake.FakeOs{}
+		fakeSyscall = &syscall_fake.FakeSyscall{}
+		fakeFile = &os_fake.FakeFile{}
+		fakeFile.FdReturns(7)
+		fakeDir = &os_fake.FakeFile{}
+		fakeDir.FdReturns(8)
+		fakeOs.OpenFileReturns(fakeFile, nil)
+		fakeOs.OpenReturns(fakeDir, nil)
+		fakeClock = fakeclock.NewFakeClock(time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC))
+
+		subject = nfsv3driver.NewStateFileIoutil(logger, fakeIoutil, fakeOs, fakeSyscall, fakeClock, statePath)
+	})
+
+	Describe("WriteFile", func() {
+		It("atomically replaces the state file with a durable, versioned, owner-only copy", func() {
+			Expect(subject.WriteFile(statePath, []byte(`{"vol1":{"Name":"vol1"}}`), os.ModePerm)).To(Succeed())
+
+			Expect(fakeIoutil.WriteFileCallCount()).To(Equal(0))
+
+			path, flag, perm := fakeOs.OpenFileArgsForCall(0)
+			Expect(path).To(Equal(statePath + ".tmp"))
+			Expect(flag & os.O_EXCL).NotTo(BeZero())
+			Expect(perm).To(Equal(os.FileMode(0600)))
+			Expect(fakeFile.WriteArgsForCall(0)).To(MatchJSON(`{"version":1,"volumes":{"vol1":{"Name":"vol1"}}}`))
+
+			Expect(fakeSyscall.FsyncCallCount()).To(Equal(2))
+			Expect(fakeSyscall.FsyncArgsForCall(0)).To(Equal(7))
+			Expect(fakeFile.CloseCallCount()).To(Equal(1))
+
+			from, to := fakeOs.RenameArgsForCall(0)
+			Expect(from).To(Equal(statePath + ".tmp"))
+			Expect(to).To(Equal(statePath))
+
+			Expect(fakeOs.OpenArgsForCall(0)).To(Equal("/var/vcap/data/volumes/nfs"))
+			Expect(fakeSyscall.FsyncArgsForCall(1)).To(Equal(8))
+		})
+
+		Context("when the temporary file cannot be synced", func() {
+			BeforeEach(func() {
+				fakeSyscall.FsyncReturns(errors.New("input/output error"))
+			})
+
+			It("leaves the state file alone", func() {
+				Expect(subject.WriteFile(statePath, []byte(`{}`), os.ModePerm)).To(MatchError("input/output error"))
+				Expect(fakeOs.RenameCallCount()).To(Equal(0))
+				Expect(fakeOs.RemoveArgsForCall(fakeOs.RemoveCallCount() - 1)).To(Equal(statePath + ".tmp"))
+			})
+		})
+
+		It("passes other files through", func() {
+			Expect(subject.WriteFile("/tmp/other", []byte("data"), 0644)).To(Succeed())
+
+			Expect(fakeIoutil.WriteFileCallCount()).To(Equal(1))
+			Expect(fakeOs.OpenFileCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("ReadFile", func() {
+		var (
+			contents []byte
+			err      error
+		)
+
+		read := func(stored string) {
+			fakeIoutil.ReadFileReturns([]byte(stored), nil)
+			contents, err = subject.ReadFile(statePath)
+		}
+
+		It("returns the volumes of a current state file", func() {
+			read(`{"version":1,"volumes":{"vol1":{"Name":"vol1"}}}`)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(contents).To(MatchJSON(`{"vol1":{"Name":"vol1"}}`))
+			Expect(fakeOs.OpenFileCallCount()).To(Equal(0))
+		})
+
+		Context("when the state file is in the format volumedriver writes", func() {
+			It("migrates it", func() {
+				read(`{"vol1":{"Name":"vol1"},"version":{"Name":"version"}}`)
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(contents).To(MatchJSON(`{"vol1":{"Name":"vol1"},"version":{"Name":"version"}}`))
+
+				Expect(fakeFile.WriteArgsForCall(0)).To(MatchJSON(`{"version":1,"volumes":{"vol1":{"Name":"vol1"},"version":{"Name":"version"}}}`))
+				Expect(logger.Buffer()).To(gbytes.Say(`state-file-migrated.*"from-version":0`))
+			})
+		})
+
+		Context("when there are no volumes", func() {
+			It("returns an empty map", func() {
+				read(`{"version":1,"volumes":null}`)
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(contents).To(MatchJSON(`{}`))
+			})
+		})
+
+		Context("when the state file does not exist", func() {
+			It("returns the error", func() {
+				fakeIoutil.ReadFileReturns(nil, os.ErrNotExist)
+				_, err := subject.ReadFile(statePath)
+
+				Expect(err).To(Equal(os.ErrNotExist))
+				Expect(fakeOs.RenameCallCount()).To(Equal(0))
+			})
+		})
+
+		quarantines := func(description, stored, reason string) {
+			Context(description, func() {
+				BeforeEach(func() {
+					read(stored)
+				})
+
+				It("moves it aside and reports it", func() {
+					Expect(err).To(MatchError(ContainSubstring(reason)))
+
+					from, to := fakeOs.RenameArgsForCall(0)
+					Expect(from).To(Equal(statePath))
+					Expect(to).To(Equal(statePath + ".corrupt-20200913T122640Z"))
+					Expect(logger.Buffer()).To(gbytes.Say("state-file-quarantined"))
+				})
+			})
+		}
+
+		Context("when a write was interrupted before the temporary file was renamed into place", func() {
+			BeforeEach(func() {
+				fakeIoutil.ReadFileStub = func(path string) ([]byte, error) {
+					if path == statePath+".tmp" {
+						return []byte(`{"version":1,"volumes":{"vol1":{"Name":"vol1"}}}`), nil
+					}
+					return []byte(`{"vol1":{"Na`), nil
+				}
+				contents, err = subject.ReadFile(statePath)
+			})
+
+			It("recovers the volumes from the temporary file", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(contents).To(MatchJSON(`{"vol1":{"Name":"vol1"}}`))
+				Expect(logger.Buffer()).To(gbytes.Say("state-file-quarantined"))
+				Expect(logger.Buffer()).To(gbytes.Say("state-file-recovered"))
+			})
+
+			It("writes them back to the state file", func() {
+				Expect(fakeFile.WriteArgsForCall(0)).To(MatchJSON(`{"version":1,"volumes":{"vol1":{"Name":"vol1"}}}`))
+				from, to := fakeOs.RenameArgsForCall(1)
+				Expect(from).To(Equal(statePath + ".tmp"))
+				Expect(to).To(Equal(statePath))
+			})
+		})
+
+		Context("when the temporary file is not usable either", func() {
+			It("reports the error of the state file", func() {
+				fakeIoutil.ReadFileStub = func(path string) ([]byte, error) {
+					if path == statePath+".tmp" {
+						return []byte(`{"version":1,"vol`), nil
+					}
+					return []byte(`{"version":2,"volumes":{}}`), nil
+				}
+				_, err := subject.ReadFile(statePath)
+
+				Expect(err).To(MatchError(ContainSubstring("state file version 2 is newer")))
+				Expect(fakeOs.OpenFileCallCount()).To(Equal(0))
+				Expect(logger.Buffer()).To(gbytes.Say("temporary-state-file-unusable"))
+			})
+		})
+
+		quarantines("when the state file is truncated", `{"vol1":{"Na`, "state file is not valid JSON")
+		quarantines("when the state file has a newer version", `{"version":2,"volumes":{}}`, "state file version 2 is newer than the supported version 1")
+		quarantines("when the volumes are not objects", `{"version":1,"volumes":{"vol1":"mounted"}}`, "state file volumes are not valid")
+	})
+})
@@ -0,0 +1,402 @@
+package nfsv3driver
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/goshims/ioutilshim"
+	"code.cloudfoundry.org/goshims/timeshim"
+	"code.cloudfoundry.org/lager"
+)
+
+const (
+	InvalidTokenErrorMessage       = "Invalid 'token' option"
+	TokenExpiredErrorMessage       = "Token has expired"
+	TokenNotYetValidErrorMessage   = "Token is not yet valid"
+	TokenAudienceErrorMessage      = "Token is not intended for this driver"
+	TokenIssuerErrorMessage        = "Token was not issued by a trusted issuer"
+	TokenMissingUidErrorMessage    = "Token has no uid claim"
+	TokenNotConfiguredErrorMessage = "Token is specified but token verification is not configured"
+)
+
+const tokenVerificationFailed = "token-verification-failed"
+
+// TokenClockSkew is how far the expiry and not-before claims may be off before a token is refused.
+const TokenClockSkew = time.Minute
+
+// TokenClaims are the identity a verified token vouches for.
+type TokenClaims struct {
+	Subject string
+	Uid     string
+	Gid     string
+	Groups  []string
+}
+
+// TokenVerifier checks a signed identity token and returns its claims.
+//
+//go:generate counterfeiter -o nfsdriverfakes/fake_token_verifier.go . TokenVerifier
+type TokenVerifier interface {
+	Verify(env dockerdriver.Env, token string) (TokenClaims, error)
+}
+
+// TokenKeySource yields the public keys that tokens may be signed with, by key id. Keys without an id are stored
+// under "".
+type TokenKeySource interface {
+	Keys() (map[string]crypto.PublicKey, error)
+}
+
+type fileTokenKeySource struct {
+	ioutil ioutilshim.Ioutil
+	path   string
+}
+
+// NewFileTokenKeySource returns a key source that re-reads path on every use, so that the platform can rotate its
+// signing keys without restarting the driver. The file holds either PEM encoded public keys or a JWKS document.
+func NewFileTokenKeySource(ioutil ioutilshim.Ioutil, path string) TokenKeySource {
+	return &fileTokenKeySource{ioutil: ioutil, path: path}
+}
+
+func (s *fileTokenKeySource) Keys() (map[string]crypto.PublicKey, error) {
+	contents, err := s.ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseTokenKeys(contents)
+}
+
+// ParseTokenKeys reads public keys from a JWKS document or from one or more PEM blocks.
+func ParseTokenKeys(contents []byte) (map[string]crypto.PublicKey, error) {
+	if trimmed := strings.TrimSpace(string(contents)); strings.HasPrefix(trimmed, "{") {
+		return parseJwks([]byte(trimmed))
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for i := 0; ; i++ {
+		var block *pem.Block
+		block, contents = pem.Decode(contents)
+		if block == nil {
+			break
+		}
+
+		var key crypto.PublicKey
+		var err error
+		switch block.Type {
+		case "PUBLIC KEY":
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		default:
+			err = fmt.Errorf("unsupported PEM block type '%s'", block.Type)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// the first PEM key has no id, later ones are numbered so that none is lost
+		id := ""
+		if i > 0 {
+			id = strconv.Itoa(i)
+		}
+		keys[id] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no public keys found")
+	}
+	return keys, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func parseJwks(contents []byte) (map[string]crypto.PublicKey, error) {
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(contents, &jwks); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key '%s': %s", k.Kid, err.Error())
+		}
+		keys[k.Kid] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys found")
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("RSA exponent is too large")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve '%s'", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type '%s'", k.Kty)
+	}
+}
+
+type jwtTokenVerifier struct {
+	keys     TokenKeySource
+	audience string
+	issuer   string
+	clock    timeshim.Time
+}
+
+// NewJwtTokenVerifier returns a verifier for JSON Web Tokens signed with one of keys using an RSA or ECDSA
+// algorithm. Tokens must name audience in their aud claim and carry an expiry; when issuer is set, the iss claim
+// must match it.
+func NewJwtTokenVerifier(keys TokenKeySource, audience string, issuer string, clock timeshim.Time) TokenVerifier {
+	return &jwtTokenVerifier{keys: keys, audience: audience, issuer: issuer, clock: clock}
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Subject   string          `json:"sub"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *int64          `json:"exp"`
+	NotBefore *int64          `json:"nbf"`
+	Uid       json.RawMessage `json:"uid"`
+	Gid       json.RawMessage `json:"gid"`
+	Groups    []string        `json:"groups"`
+}
+
+func (v *jwtTokenVerifier) Verify(env dockerdriver.Env, token string) (TokenClaims, error) {
+	logger := env.Logger().Session("verify-token")
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		logger.Info(tokenVerificationFailed, lager.Data{"reason": "malformed"})
+		return TokenClaims{}, dockerdriver.SafeError{SafeDescription: InvalidTokenErrorMessage}
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		logger.Info(tokenVerificationFailed, lager.Data{"reason": "malformed header"})
+		return TokenClaims{}, dockerdriver.SafeError{SafeDescription: InvalidTokenErrorMessage}
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		logger.Info(tokenVerificationFailed, lager.Data{"reason": "malformed signature"})
+		return TokenClaims{}, dockerdriver.SafeError{SafeDescription: InvalidTokenErrorMessage}
+	}
+
+	keys, err := v.keys.Keys()
+	if err != nil {
+		logger.Error("read-token-keys-failed", err)
+		return TokenClaims{}, dockerdriver.SafeError{SafeDescription: "Token signing keys could not be read, please contact your system administrator"}
+	}
+
+	if err := verifySignature(header, parts[0]+"."+parts[1], signature, keys); err != nil {
+		logger.Info(tokenVerificationFailed, lager.Data{"reason": err.Error(), "alg": header.Alg, "kid": header.Kid})
+		return TokenClaims{}, dockerdriver.SafeError{SafeDescription: InvalidTokenErrorMessage}
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		logger.Info(tokenVerificationFailed, lager.Data{"reason": "malformed claims"})
+		return TokenClaims{}, dockerdriver.SafeError{SafeDescription: InvalidTokenErrorMessage}
+	}
+	data := lager.Data{"sub": claims.Subject, "iss": claims.Issuer}
+
+	now := v.clock.Now()
+	if claims.ExpiresAt == nil || !now.Before(time.Unix(*claims.ExpiresAt, 0).Add(TokenClockSkew)) {
+		logger.Info(tokenVerificationFailed, lager.Data{"reason": "expired", "sub": claims.Subject})
+		return TokenClaims{}, dockerdriver.SafeError{SafeDescription: TokenExpiredErrorMessage}
+	}
+	if claims.NotBefore != nil && now.Add(TokenClockSkew).Before(time.Unix(*claims.NotBefore, 0)) {
+		logger.Info(tokenVerificationFailed, lager.Data{"reason": "not yet valid", "sub": claims.Subject})
+		return TokenClaims{}, dockerdriver.SafeError{SafeDescription: TokenNotYetValidErrorMessage}
+	}
+	if !hasAudience(claims.Audience, v.audience) {
+		logger.Info(tokenVerificationFailed, lager.Data{"reason": "audience", "sub": claims.Subject})
+		return TokenClaims{}, dockerdriver.SafeError{SafeDescription: TokenAudienceErrorMessage}
+	}
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		logger.Info(tokenVerificationFailed, lager.Data{"reason": "issuer", "sub": claims.Subject, "iss": claims.Issuer})
+		return TokenClaims{}, dockerdriver.SafeError{SafeDescription: TokenIssuerErrorMessage}
+	}
+
+	uid, gid := numericClaim(claims.Uid), numericClaim(claims.Gid)
+	if uid == "" {
+		return TokenClaims{}, dockerdriver.SafeError{SafeDescription: TokenMissingUidErrorMessage}
+	}
+	if gid == "" {
+		gid = uid
+	}
+	if !isPosixId(uid) {
+		return TokenClaims{}, dockerdriver.SafeError{SafeDescription: InvalidUidValueErrorMessage}
+	}
+	if !isPosixId(gid) {
+		return TokenClaims{}, dockerdriver.SafeError{SafeDescription: InvalidGidValueErrorMessage}
+	}
+
+	logger.Info("token-verified", data)
+	return TokenClaims{Subject: claims.Subject, Uid: uid, Gid: gid, Groups: claims.Groups}, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	contents, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(contents, v)
+}
+
+// verifySignature checks signature with the key the header names or, when it names none that is known, with each
+// of the keys in turn. The algorithm must suit the key, so that an RSA key cannot be used to check an HMAC.
+func verifySignature(header jwtHeader, signed string, signature []byte, keys map[string]crypto.PublicKey) error {
+	var hash crypto.Hash
+	switch header.Alg {
+	case "RS256", "PS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "PS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "PS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported algorithm '%s'", header.Alg)
+	}
+
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	candidates := keys
+	if key, ok := keys[header.Kid]; ok && header.Kid != "" {
+		candidates = map[string]crypto.PublicKey{header.Kid: key}
+	}
+
+	for _, key := range candidates {
+		switch key := key.(type) {
+		case *rsa.PublicKey:
+			if header.Alg[0] == 'R' && rsa.VerifyPKCS1v15(key, hash, digest, signature) == nil {
+				return nil
+			}
+			if header.Alg[0] == 'P' && rsa.VerifyPSS(key, hash, digest, signature, nil) == nil {
+				return nil
+			}
+		case *ecdsa.PublicKey:
+			size := (key.Curve.Params().BitSize + 7) / 8
+			if header.Alg[0] != 'E' || len(signature) != 2*size {
+				continue
+			}
+			r := new(big.Int).SetBytes(signature[:size])
+			s := new(big.Int).SetBytes(signature[size:])
+			if ecdsa.Verify(key, digest, r, s) {
+				return nil
+			}
+		}
+	}
+
+	return errors.New("signature does not match any key")
+}
+
+// hasAudience accepts the aud claim as a single string or a list of strings.
+func hasAudience(claim json.RawMessage, audience string) bool {
+	var single string
+	if json.Unmarshal(claim, &single) == nil {
+		return single == audience
+	}
+
+	var list []string
+	if json.Unmarshal(claim, &list) == nil {
+		for _, a := range list {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// numericClaim accepts an id claim given as a JSON number or string.
+func numericClaim(claim json.RawMessage) string {
+	if len(claim) == 0 {
+		return ""
+	}
+
+	var s string
+	if json.Unmarshal(claim, &s) == nil {
+		return s
+	}
+
+	var n json.Number
+	if json.Unmarshal(claim, &n) == nil {
+		return n.String()
+	}
+	return ""
+}
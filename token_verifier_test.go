@@ -0,0 +1,293 @@
+package nfsv3driver_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/goshims/ioutilshim/ioutil_fake"
+	"code.cloudfoundry.org/goshims/timeshim/time_fake"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/nfsv3driver"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("JwtTokenVerifier", func() {
+	var (
+		logger     *lagertest.TestLogger
+		env        dockerdriver.Env
+		rsaKey     *rsa.PrivateKey
+		fakeIoutil *ioutil_fake.FakeIoutil
+		fakeClock  *time_fake.FakeTime
+		now        time.Time
+		header     map[string]interface{}
+		claims     map[string]interface{}
+		sign       func(signed []byte) []byte
+		issuer     string
+		verified   nfsv3driver.TokenClaims
+		err        error
+	)
+
+	encode := func(v interface{}) string {
+		contents, err := json.Marshal(v)
+		Expect(err).NotTo(HaveOccurred())
+		return base64.RawURLEncoding.EncodeToString(contents)
+	}
+
+	signRS256 := func(key *rsa.PrivateKey) func([]byte) []byte {
+		return func(signed []byte) []byte {
+			digest := sha256.Sum256(signed)
+			signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+			Expect(err).NotTo(HaveOccurred())
+			return signature
+		}
+	}
+
+	publicKeyPem := func(key crypto.PublicKey) []byte {
+		der, err := x509.MarshalPKIXPublicKey(key)
+		Expect(err).NotTo(HaveOccurred())
+		return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	}
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("jwt-token-verifier")
+		env = driverhttp.NewHttpDriverEnv(logger, context.TODO())
+
+		rsaKey, err = rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).NotTo(HaveOccurred())
+
+		fakeIoutil = &ioutil_fake.FakeIoutil{}
+		fakeIoutil.ReadFileReturns(publicKeyPem(&rsaKey.PublicKey), nil)
+
+		now = time.Unix(1600000000, 0)
+		fakeClock = &time_fake.FakeTime{}
+		fakeClock.NowStub = func() time.Time { return now }
+
+		header = map[string]interface{}{"alg": "RS256", "typ": "JWT"}
+		claims = map[string]interface{}{
+			"sub":    "alice",
+			"aud":    "nfsv3driver",
+			"exp":    now.Add(time.Hour).Unix(),
+			"uid":    1000,
+			"gid":    "2000",
+			"groups": []string{"finance", "staff"},
+		}
+		sign = signRS256(rsaKey)
+		issuer = ""
+	})
+
+	JustBeforeEach(func() {
+		signed := encode(header) + "." + encode(claims)
+		token := signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+
+		verifier := nfsv3driver.NewJwtTokenVerifier(nfsv3driver.NewFileTokenKeySource(fakeIoutil, "/keys.pem"), "nfsv3driver", issuer, fakeClock)
+		verified, err = verifier.Verify(env, token)
+	})
+
+	It("returns the claims of a valid token", func() {
+		Expect(err).NotTo(HaveOccurred())
+		Expect(verified).To(Equal(nfsv3driver.TokenClaims{
+			Subject: "alice",
+			Uid:     "1000",
+			Gid:     "2000",
+			Groups:  []string{"finance", "staff"},
+		}))
+		Expect(fakeIoutil.ReadFileArgsForCall(0)).To(Equal("/keys.pem"))
+	})
+
+	It("never logs the token", func() {
+		Expect(logger.Buffer()).To(gbytes.Say(`token-verified.*"sub":"alice"`))
+		Expect(string(logger.Buffer().Contents())).NotTo(ContainSubstring(encode(header)))
+	})
+
+	Context("when the audience is given as a list", func() {
+		BeforeEach(func() {
+			claims["aud"] = []string{"other", "nfsv3driver"}
+		})
+
+		It("accepts the token", func() {
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("when there is no gid claim", func() {
+		BeforeEach(func() {
+			delete(claims, "gid")
+		})
+
+		It("uses the uid as the gid", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(verified.Gid).To(Equal("1000"))
+		})
+	})
+
+	rejects := func(description string, modify func(), expected string) {
+		Context(description, func() {
+			BeforeEach(modify)
+
+			It("refuses the token with a safe error", func() {
+				Expect(err).To(MatchError(expected))
+				Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+				Expect(verified).To(Equal(nfsv3driver.TokenClaims{}))
+			})
+		})
+	}
+
+	rejects("when the token is signed by another key", func() {
+		otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).NotTo(HaveOccurred())
+		sign = signRS256(otherKey)
+	}, nfsv3driver.InvalidTokenErrorMessage)
+	rejects("when the token is unsigned", func() {
+		header["alg"] = "none"
+		sign = func([]byte) []byte { return nil }
+	}, nfsv3driver.InvalidTokenErrorMessage)
+	rejects("when the token claims an HMAC signature", func() {
+		header["alg"] = "HS256"
+	}, nfsv3driver.InvalidTokenErrorMessage)
+	rejects("when the claims have been tampered with", func() {
+		original := sign
+		genuine := encode(header) + "." + encode(claims)
+		sign = func([]byte) []byte {
+			return original([]byte(genuine))
+		}
+		claims["uid"] = 2000
+	}, nfsv3driver.InvalidTokenErrorMessage)
+	rejects("when the token has expired", func() {
+		claims["exp"] = now.Add(-2 * time.Minute).Unix()
+	}, nfsv3driver.TokenExpiredErrorMessage)
+	rejects("when the token has no expiry", func() {
+		delete(claims, "exp")
+	}, nfsv3driver.TokenExpiredErrorMessage)
+	rejects("when the token is not yet valid", func() {
+		claims["nbf"] = now.Add(time.Hour).Unix()
+	}, nfsv3driver.TokenNotYetValidErrorMessage)
+	rejects("when the token is for another audience", func() {
+		claims["aud"] = "other"
+	}, nfsv3driver.TokenAudienceErrorMessage)
+	rejects("when the token has no uid", func() {
+		delete(claims, "uid")
+	}, nfsv3driver.TokenMissingUidErrorMessage)
+	rejects("when the uid is root", func() {
+		claims["uid"] = 0
+	}, nfsv3driver.InvalidUidValueErrorMessage)
+	rejects("when the gid is not a number", func() {
+		claims["gid"] = "staff"
+	}, nfsv3driver.InvalidGidValueErrorMessage)
+
+	Context("when the token has just expired", func() {
+		BeforeEach(func() {
+			claims["exp"] = now.Add(-30 * time.Second).Unix()
+		})
+
+		It("allows for clock skew", func() {
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("when an issuer is configured", func() {
+		BeforeEach(func() {
+			issuer = "https://uaa.example.com"
+		})
+
+		rejects("when the token has no issuer", func() {}, nfsv3driver.TokenIssuerErrorMessage)
+
+		Context("when the token names the issuer", func() {
+			BeforeEach(func() {
+				claims["iss"] = "https://uaa.example.com"
+			})
+
+			It("accepts the token", func() {
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+	})
+
+	Context("when the keys cannot be read", func() {
+		BeforeEach(func() {
+			fakeIoutil.ReadFileReturns(nil, errors.New("no such file"))
+		})
+
+		It("returns a safe error without the details", func() {
+			Expect(err).To(MatchError("Token signing keys could not be read, please contact your system administrator"))
+			Expect(logger.Buffer()).To(gbytes.Say("read-token-keys-failed.*no such file"))
+		})
+	})
+
+	Context("when the keys are a JWKS document", func() {
+		var ecKey *ecdsa.PrivateKey
+
+		BeforeEach(func() {
+			ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+
+			fixed := func(n *big.Int) string {
+				return base64.RawURLEncoding.EncodeToString(n.FillBytes(make([]byte, 32)))
+			}
+			fakeIoutil.ReadFileReturns([]byte(fmt.Sprintf(`{"keys": [
+				{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": "%s", "e": "AQAB"},
+				{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": "%s", "y": "%s"}
+			]}`,
+				base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+				fixed(ecKey.X),
+				fixed(ecKey.Y),
+			)), nil)
+
+			header = map[string]interface{}{"alg": "ES256", "kid": "ec-1"}
+			sign = func(signed []byte) []byte {
+				digest := sha256.Sum256(signed)
+				r, s, err := ecdsa.Sign(rand.Reader, ecKey, digest[:])
+				Expect(err).NotTo(HaveOccurred())
+				return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+			}
+		})
+
+		It("verifies with the key the token names", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(verified.Subject).To(Equal("alice"))
+		})
+
+		Context("when the token is signed with the RSA key", func() {
+			BeforeEach(func() {
+				header = map[string]interface{}{"alg": "RS256", "kid": "rsa-1"}
+				sign = signRS256(rsaKey)
+			})
+
+			It("verifies with that key", func() {
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+
+		rejects("when the token names the RSA key but carries an ECDSA signature", func() {
+			header["kid"] = "rsa-1"
+		}, nfsv3driver.InvalidTokenErrorMessage)
+	})
+})
+
+var _ = Describe("ParseTokenKeys", func() {
+	It("rejects files without keys", func() {
+		_, err := nfsv3driver.ParseTokenKeys([]byte("not a key"))
+		Expect(err).To(MatchError("no public keys found"))
+	})
+
+	It("rejects JWKS keys of unknown types", func() {
+		_, err := nfsv3driver.ParseTokenKeys([]byte(`{"keys": [{"kty": "oct", "kid": "k1", "k": "c2VjcmV0"}]}`))
+		Expect(err).To(MatchError("key 'k1': unsupported key type 'oct'"))
+	})
+})
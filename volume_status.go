@@ -0,0 +1,402 @@
+package nfsv3driver
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	cf_http_handlers "code.cloudfoundry.org/cfhttp/handlers"
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/goshims/ioutilshim"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/nfsv3driver/driveradmin"
+)
+
+const (
+	VolumeHealthy   = "healthy"
+	VolumeUnhealthy = "unhealthy"
+)
+
+var sourcePasswordPattern = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9+.-]*://[^/:@]*:)[^/@]*@`)
+
+// volumeStatus is what the tracker has seen happen to a volume's mount.
+type volumeStatus struct {
+	remote    string
+	username  string
+	uid       string
+	gid       string
+	mountedAt time.Time
+	health    string
+	checkedAt time.Time
+	lastError string
+
+	// generation is the tracker's generation when the status last changed
+	generation uint64
+}
+
+// VolumeStatusTracker follows the mounts, unmounts and health checks of each volume, and combines them with what
+// the host says about its mount when asked for the status of the driver's volumes. Volumes the driver no longer
+// lists are forgotten then.
+type VolumeStatusTracker struct {
+	clock     clock.Clock
+	ioutil    ioutilshim.Ioutil
+	mapfsPath string
+	redaction redaction
+
+	lock       sync.Mutex
+	lister     VolumeLister
+	volumes    map[string]*volumeStatus
+	generation uint64
+}
+
+// NewVolumeStatusTracker returns a tracker that scrubs the values of SecretKeys and redactKeys from the sources and
+// errors it reports, as the driver's logs do.
+func NewVolumeStatusTracker(clock clock.Clock, ioutil ioutilshim.Ioutil, mapfsPath string, redactKeys []string) *VolumeStatusTracker {
+	return &VolumeStatusTracker{
+		clock:     clock,
+		ioutil:    ioutil,
+		mapfsPath: mapfsPath,
+		redaction: newRedaction(redactKeys),
+		volumes:   map[string]*volumeStatus{},
+	}
+}
+
+// SetVolumeLister sets where the tracker gets the driver's volumes from. The driver is created after the mounter
+// the tracker watches, so it cannot be given to the constructor.
+func (t *VolumeStatusTracker) SetVolumeLister(lister VolumeLister) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.lister = lister
+}
+
+func (t *VolumeStatusTracker) VolumeStatuses(env dockerdriver.Env) []driveradmin.VolumeStatus {
+	logger := env.Logger().Session("volume-statuses")
+
+	t.lock.Lock()
+	lister := t.lister
+	listed := t.generation
+	t.lock.Unlock()
+
+	statuses := []driveradmin.VolumeStatus{}
+	if lister == nil {
+		return statuses
+	}
+
+	listResponse := lister.List(env)
+	if listResponse.Err != "" {
+		logger.Info("list-volumes-failed", lager.Data{"error": listResponse.Err})
+		return statuses
+	}
+
+	mounts, err := readMountInfo(t.ioutil)
+	if err != nil {
+		logger.Error("read-mountinfo-failed", err)
+	}
+	processes, err := mapfsProcesses(t.ioutil, t.mapfsPath)
+	if err != nil {
+		logger.Error("list-mapfs-processes-failed", err)
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.forgetUnlisted(listResponse.Volumes, listed)
+
+	for _, volume := range listResponse.Volumes {
+		status := driveradmin.VolumeStatus{
+			Name:       volume.Name,
+			Mountpoint: volume.Mountpoint,
+			MountCount: volume.MountCount,
+		}
+
+		if tracked, ok := t.volumes[volume.Name]; ok {
+			status.Source = t.redactSource(tracked.remote)
+			status.Username = tracked.username
+			status.Uid = tracked.uid
+			status.Gid = tracked.gid
+			status.Health = tracked.health
+			status.LastError = tracked.lastError
+			if !tracked.mountedAt.IsZero() {
+				mountedAt := tracked.mountedAt
+				status.MountedAt = &mountedAt
+			}
+			if !tracked.checkedAt.IsZero() {
+				checkedAt := tracked.checkedAt
+				status.CheckedAt = &checkedAt
+			}
+		}
+
+		if volume.Mountpoint != "" {
+			if mount, ok := nfsMount(mounts, volume.Mountpoint); ok {
+				status.KernelOptions = mountOptions(mount)
+				status.NfsVersion, _ = mount.option("vers")
+				if status.Source == "" {
+					status.Source = t.redactSource(mount.Source)
+				}
+			}
+			if pids := processes[volume.Mountpoint]; len(pids) > 0 {
+				status.MapfsPid = pids[0]
+			}
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
+
+// forgetUnlisted drops the statuses of the volumes that are not in volumes, as they have been removed, unless they
+// changed after the volumes were listed, in generation listed. The caller must hold the lock.
+func (t *VolumeStatusTracker) forgetUnlisted(volumes []dockerdriver.VolumeInfo, listed uint64) {
+	names := map[string]bool{}
+	for _, volume := range volumes {
+		names[volume.Name] = true
+	}
+
+	for name, status := range t.volumes {
+		if !names[name] && status.generation <= listed {
+			delete(t.volumes, name)
+		}
+	}
+}
+
+func (t *VolumeStatusTracker) update(target string, change func(status *volumeStatus)) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	volume := filepath.Base(target)
+	status, ok := t.volumes[volume]
+	if !ok {
+		status = &volumeStatus{}
+		t.volumes[volume] = status
+	}
+	change(status)
+
+	t.generation++
+	status.generation = t.generation
+}
+
+func (t *VolumeStatusTracker) mounted(target, remote string, opts map[string]interface{}) {
+	now := t.clock.Now()
+	t.update(target, func(status *volumeStatus) {
+		status.remote = remote
+		status.username, _ = opts["username"].(string)
+		status.uid = uniformData(opts["uid"])
+		status.gid = uniformData(opts["gid"])
+		status.mountedAt = now
+		status.health = VolumeHealthy
+		status.checkedAt = now
+		status.lastError = ""
+	})
+}
+
+func (t *VolumeStatusTracker) unmounted(target string) {
+	t.update(target, func(status *volumeStatus) {
+		*status = volumeStatus{remote: status.remote, lastError: status.lastError}
+	})
+}
+
+func (t *VolumeStatusTracker) failed(target string, err error) {
+	t.update(target, func(status *volumeStatus) {
+		status.lastError = t.redactSource(err.Error())
+	})
+}
+
+func (t *VolumeStatusTracker) checked(mountPoint string, healthy bool) {
+	now := t.clock.Now()
+	t.update(mountPoint, func(status *volumeStatus) {
+		status.checkedAt = now
+		if healthy {
+			status.health = VolumeHealthy
+		} else {
+			status.health = VolumeUnhealthy
+		}
+	})
+}
+
+// nfsMount returns the NFS mount behind target, which is mounted on the intermediate directory when mapfs maps the
+// volume's uid and gid.
+func nfsMount(mounts []mountInfoEntry, target string) (mountInfoEntry, bool) {
+	var found mountInfoEntry
+	ok := false
+	for _, mount := range mounts {
+		if !strings.HasPrefix(mount.FsType, "nfs") {
+			continue
+		}
+		if mount.MountPoint == target+MapfsDirectorySuffix {
+			return mount, true
+		}
+		if mount.MountPoint == target {
+			found, ok = mount, true
+		}
+	}
+	return found, ok
+}
+
+// mountOptions returns the per-mount and superblock options of mount, without repeating the ones in both.
+func mountOptions(mount mountInfoEntry) string {
+	seen := map[string]bool{}
+	var options []string
+	for _, option := range strings.Split(mount.Options+","+mount.SuperOptions, ",") {
+		if option == "" || seen[option] {
+			continue
+		}
+		seen[option] = true
+		options = append(options, option)
+	}
+	return strings.Join(options, ",")
+}
+
+// redactSource scrubs the password of a source URL and the values of any secret key=value pairs in it.
+func (t *VolumeStatusTracker) redactSource(source string) string {
+	return t.redaction.redactString(sourcePasswordPattern.ReplaceAllString(source, "${1}"+RedactedValue+"@"))
+}
+
+type statusTrackingMounter struct {
+	ReloadableMounter
+	tracker *VolumeStatusTracker
+}
+
+// NewStatusTrackingMounter reports every mount, unmount and health check made through mounter to tracker.
+func NewStatusTrackingMounter(mounter ReloadableMounter, tracker *VolumeStatusTracker) ReloadableMounter {
+	return &statusTrackingMounter{ReloadableMounter: mounter, tracker: tracker}
+}
+
+func (m *statusTrackingMounter) Mount(env dockerdriver.Env, remote string, target string, opts map[string]interface{}) error {
+	err := m.ReloadableMounter.Mount(env, remote, target, opts)
+	if err != nil {
+		m.tracker.failed(target, err)
+		return err
+	}
+
+	m.tracker.mounted(target, remote, opts)
+	return nil
+}
+
+func (m *statusTrackingMounter) Unmount(env dockerdriver.Env, target string) error {
+	err := m.ReloadableMounter.Unmount(env, target)
+	if err != nil {
+		m.tracker.failed(target, err)
+		return err
+	}
+
+	m.tracker.unmounted(target)
+	return nil
+}
+
+func (m *statusTrackingMounter) Check(env dockerdriver.Env, name, mountPoint string) bool {
+	healthy := m.ReloadableMounter.Check(env, name, mountPoint)
+	m.tracker.checked(mountPoint, healthy)
+	return healthy
+}
+
+type volumeInfoWithStatus struct {
+	dockerdriver.VolumeInfo
+	Status map[string]interface{} `json:",omitempty"`
+}
+
+type getResponseWithStatus struct {
+	Volume volumeInfoWithStatus
+	Err    string
+}
+
+type volumeStatusHandler struct {
+	http.Handler
+	logger   lager.Logger
+	driver   dockerdriver.Driver
+	reporter driveradmin.VolumeStatusReporter
+}
+
+// NewVolumeStatusHandler serves the Get requests of the volume plugin API itself, so that the volume in the
+// response carries a Status map with what reporter knows about it, and passes every other request on to handler.
+func NewVolumeStatusHandler(logger lager.Logger, handler http.Handler, driver dockerdriver.Driver, reporter driveradmin.VolumeStatusReporter) http.Handler {
+	return &volumeStatusHandler{
+		Handler:  handler,
+		logger:   logger,
+		driver:   driver,
+		reporter: reporter,
+	}
+}
+
+func (h *volumeStatusHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	route, _ := dockerdriver.Routes.FindRouteByName(dockerdriver.GetRoute)
+	if req.Method != route.Method || req.URL.Path != route.Path {
+		h.Handler.ServeHTTP(w, req)
+		return
+	}
+
+	logger := h.logger.Session("handle-get")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		logger.Error("failed-reading-get-request-body", err)
+		cf_http_handlers.WriteJSONResponse(w, http.StatusInternalServerError, dockerdriver.GetResponse{Err: err.Error()})
+		return
+	}
+
+	var getRequest dockerdriver.GetRequest
+	if err = json.Unmarshal(body, &getRequest); err != nil {
+		logger.Error("failed-unmarshalling-get-request-body", err)
+		cf_http_handlers.WriteJSONResponse(w, http.StatusInternalServerError, dockerdriver.GetResponse{Err: err.Error()})
+		return
+	}
+
+	env := driverhttp.EnvWithMonitor(logger, req.Context(), w)
+
+	getResponse := h.driver.Get(env, getRequest)
+	if getResponse.Err != "" {
+		logger.Info("failed-getting-volume", lager.Data{"volume": getRequest.Name, "error": getResponse.Err})
+		cf_http_handlers.WriteJSONResponse(w, http.StatusInternalServerError, getResponse)
+		return
+	}
+
+	response := getResponseWithStatus{Volume: volumeInfoWithStatus{VolumeInfo: getResponse.Volume}}
+	for _, status := range h.reporter.VolumeStatuses(env) {
+		if status.Name == getRequest.Name {
+			response.Volume.Status = dockerStatus(status)
+			break
+		}
+	}
+
+	cf_http_handlers.WriteJSONResponse(w, http.StatusOK, response)
+}
+
+// dockerStatus returns the fields of status that are set, in the form of the Status map of the volume plugin API.
+func dockerStatus(status driveradmin.VolumeStatus) map[string]interface{} {
+	fields := map[string]interface{}{}
+	set := func(key, value string) {
+		if value != "" {
+			fields[key] = value
+		}
+	}
+
+	set("source", status.Source)
+	set("kernel_options", status.KernelOptions)
+	set("nfs_version", status.NfsVersion)
+	set("username", status.Username)
+	set("uid", status.Uid)
+	set("gid", status.Gid)
+	if status.MapfsPid != 0 {
+		fields["mapfs_pid"] = status.MapfsPid
+	}
+	if status.MountedAt != nil {
+		set("mounted_at", status.MountedAt.UTC().Format(time.RFC3339))
+	}
+	set("health", status.Health)
+	if status.CheckedAt != nil {
+		set("checked_at", status.CheckedAt.UTC().Format(time.RFC3339))
+	}
+	set("last_error", status.LastError)
+
+	return fields
+}